@@ -0,0 +1,165 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+var AliasCommand = Command{
+	Name:     "alias",
+	Synopsis: "Creates a tag alias",
+	Usages: []string{"tmsu alias [OPTION]... TAG ALIAS...",
+		"tmsu alias --delete ALIAS...",
+		"tmsu alias --list [TAG]..."},
+	Description: `Creates ALIASes for TAG, alternative names by which the tag may also be referred to.
+
+An alias may be used wherever a tag name is accepted, including when tagging files, in queries and in the virtual filesystem, and always refers to its tag. The tag itself continues to be shown by its own name.
+
+An alias cannot share its name with a tag.`,
+	Examples: []string{`$ tmsu alias photo photos pics`,
+		`$ tmsu alias new-york nyc`,
+		"$ tmsu alias --list\n     nyc => new-york\n    pics => photo\n  photos => photo",
+		`$ tmsu alias --delete pics`},
+	Options: Options{Option{"--delete", "-d", "deletes the aliases", false, ""},
+		Option{"--list", "-l", "lists the aliases (of the specified tags)", false, ""}},
+	Exec: aliasExec,
+}
+
+func aliasExec(store *storage.Storage, options Options, args []string) error {
+	switch {
+	case options.HasOption("--list"):
+		return listAliases(store, args)
+	case options.HasOption("--delete"):
+		if len(args) < 1 {
+			return fmt.Errorf("aliases to delete must be specified")
+		}
+
+		return deleteAliases(store, args)
+	}
+
+	if len(args) < 2 {
+		return fmt.Errorf("tag and aliases must be specified")
+	}
+
+	return addAliases(store, args[0], args[1:])
+}
+
+// unexported
+
+func listAliases(store *storage.Storage, tagNames []string) error {
+	var aliases entities.Aliases
+
+	if len(tagNames) == 0 {
+		log.Infof(2, "retrieving tag aliases.")
+
+		var err error
+		aliases, err = store.Aliases()
+		if err != nil {
+			return fmt.Errorf("could not retrieve aliases: %v", err)
+		}
+	} else {
+		for _, tagName := range tagNames {
+			tag, err := store.TagByName(tagName)
+			if err != nil {
+				return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+			}
+			if tag == nil {
+				return fmt.Errorf("no such tag '%v'", tagName)
+			}
+
+			log.Infof(2, "retrieving aliases of tag '%v'.", tag.Name)
+
+			tagAliases, err := store.AliasesByTagId(tag.Id)
+			if err != nil {
+				return fmt.Errorf("could not retrieve aliases of tag '%v': %v", tag.Name, err)
+			}
+
+			aliases = append(aliases, tagAliases...)
+		}
+	}
+
+	width := 0
+	for _, alias := range aliases {
+		if len(alias.Name) > width {
+			width = len(alias.Name)
+		}
+	}
+
+	for _, alias := range aliases {
+		fmt.Printf("%*v => %v\n", width, alias.Name, alias.Tag.Name)
+	}
+
+	return nil
+}
+
+func addAliases(store *storage.Storage, tagName string, aliasNames []string) error {
+	tag, err := store.TagByName(tagName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+	}
+	if tag == nil {
+		return fmt.Errorf("no such tag '%v'", tagName)
+	}
+
+	wereErrors := false
+	for _, aliasName := range aliasNames {
+		log.Infof(2, "adding alias '%v' for tag '%v'.", aliasName, tag.Name)
+
+		if _, err := store.AddAlias(aliasName, tag.Id); err != nil {
+			log.Warnf("could not add alias '%v': %v", aliasName, err)
+			wereErrors = true
+		}
+	}
+
+	if wereErrors {
+		return errBlank
+	}
+
+	return nil
+}
+
+func deleteAliases(store *storage.Storage, aliasNames []string) error {
+	wereErrors := false
+	for _, aliasName := range aliasNames {
+		log.Infof(2, "removing alias '%v'.", aliasName)
+
+		alias, err := store.AliasByName(aliasName)
+		if err != nil {
+			return fmt.Errorf("could not retrieve alias '%v': %v", aliasName, err)
+		}
+		if alias == nil {
+			log.Warnf("no such alias '%v'.", aliasName)
+			wereErrors = true
+			continue
+		}
+
+		if err := store.RemoveAlias(aliasName); err != nil {
+			return fmt.Errorf("could not remove alias '%v': %v", aliasName, err)
+		}
+	}
+
+	if wereErrors {
+		return errBlank
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+	"tmsu/common/fingerprint"
+)
+
+func TestAliasAddListAndDelete(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, err := store.AddTag("photo"); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddTag("new-york"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := AliasCommand.Exec(store, Options{}, []string{"photo", "photos", "pics"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := AliasCommand.Exec(store, Options{}, []string{"new-york", "nyc"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := AliasCommand.Exec(store, Options{Option{"--delete", "-d", "", false, ""}}, []string{"pics"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := AliasCommand.Exec(store, Options{Option{"--list", "-l", "", false, ""}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+	if err := AliasCommand.Exec(store, Options{Option{"--list", "-l", "", false, ""}}, []string{"photos"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "   nyc => new-york\nphotos => photo\nphotos => photo\n", string(bytes))
+}
+
+func TestAliasCannotShareNameWithTag(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	photoTag, err := store.AddTag("photo")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddTag("photos"); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddAlias("pics", photoTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	// test & validate
+
+	if err := AliasCommand.Exec(store, Options{}, []string{"photo", "photos"}); err == nil {
+		test.Fatal("Alias with the name of a tag was added.")
+	}
+	if _, err := store.AddTag("pics"); err == nil {
+		test.Fatal("Tag with the name of an alias was added.")
+	}
+}
+
+func TestAliasResolvesToTag(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	yearTag, err := store.AddTag("year")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddAlias("yr", yearTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	value, err := store.AddValue("2014")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(fileA.Id, yearTag.Id, value.Id); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(fileB.Id, yearTag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{}, []string{"yr"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"yr = 2014"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagsCommand.Exec(store, Options{}, []string{"/tmp/a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/a\n/tmp/b\n/tmp/a\n/tmp/a: year=2014\n", string(bytes))
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"tmsu/common/log"
+	"tmsu/storage"
+)
+
+var BackupCommand = Command{
+	Name:     "backup",
+	Synopsis: "Back up the database",
+	Usages:   []string{"tmsu backup [OPTION]... DEST"},
+	Description: `Writes a consistent snapshot of the database to DEST.
+
+The snapshot is taken using SQLite's online backup API so is safe to take whilst the database is in use, for example whilst it is mounted as a virtual file-system.
+
+With --rotate, the snapshot is written to DEST suffixed with a timestamp and only the newest N such snapshots are kept.
+
+Snapshots can also be taken automatically before destructive operations: see the 'autoBackups' setting of the 'config' subcommand. Use the 'restore' subcommand to restore a snapshot.`,
+	Examples: []string{"$ tmsu backup ~/tmsu-backup.db",
+		"$ tmsu backup --rotate 7 ~/backups/tmsu.db"},
+	Options:  Options{{"--rotate", "-r", "keep the newest N timestamped snapshots", true, ""}},
+	Exec:     backupExec,
+	ReadOnly: true,
+}
+
+func backupExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("destination must be specified")
+	}
+
+	destPath := args[0]
+
+	if options.HasOption("--rotate") {
+		keep, err := strconv.ParseUint(options.Get("--rotate").Argument, 10, 0)
+		if err != nil || keep == 0 {
+			return fmt.Errorf("invalid snapshot count '%v'", options.Get("--rotate").Argument)
+		}
+
+		path, err := store.BackupRotated(destPath, uint(keep))
+		if err != nil {
+			return err
+		}
+
+		log.Infof(2, "backed up database to '%v'.", path)
+
+		return nil
+	}
+
+	if err := store.Backup(destPath); err != nil {
+		return err
+	}
+
+	log.Infof(2, "backed up database to '%v'.", destPath)
+
+	return nil
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+var CheckCommand = Command{
+	Name:     "check",
+	Synopsis: "Check the integrity of the database",
+	Usages:   []string{"tmsu check [OPTION]..."},
+	Description: `Checks the database for internal inconsistencies and reports any problems found.
+
+The following problems are identified:
+
+  Taggings that refer to a file, tag or value that does not exist
+  Tag implications that refer to a tag that does not exist
+  Tags that share the same name
+  Values that are not used by any tagging
+
+When run with the --fix option the problems are also repaired: broken taggings and implications are removed, tags with the same name are merged and unused values are deleted.
+
+Note: This subcommand examines the database only. To identify files that have been modified or moved use the 'status' and 'repair' subcommands.`,
+	Examples: []string{"$ tmsu check",
+		"$ tmsu check --fix"},
+	Options: Options{{"--fix", "-f", "repair the problems found", false, ""}},
+	Exec:    checkExec,
+}
+
+func checkExec(store *storage.Storage, options Options, args []string) error {
+	fix := options.HasOption("--fix")
+
+	problemCount := 0
+
+	count, err := checkDuplicateTags(store, fix)
+	if err != nil {
+		return err
+	}
+	problemCount += count
+
+	count, err = checkFileTags(store, fix)
+	if err != nil {
+		return err
+	}
+	problemCount += count
+
+	count, err = checkImplications(store, fix)
+	if err != nil {
+		return err
+	}
+	problemCount += count
+
+	count, err = checkValues(store, fix)
+	if err != nil {
+		return err
+	}
+	problemCount += count
+
+	log.Infof(2, "found %v problems.", problemCount)
+
+	if problemCount > 0 && !fix {
+		return errBlank
+	}
+
+	return nil
+}
+
+// unexported
+
+func checkDuplicateTags(store *storage.Storage, fix bool) (int, error) {
+	log.Info(2, "checking for duplicate tag names.")
+
+	tags, err := store.DuplicateTags()
+	if err != nil {
+		return 0, fmt.Errorf("could not retrieve duplicate tags: %v", err)
+	}
+
+	count := 0
+	for index := 0; index < len(tags); {
+		group := entities.Tags{tags[index]}
+		for index++; index < len(tags) && tags[index].Name == group[0].Name; index++ {
+			group = append(group, tags[index])
+		}
+
+		tagIds := make([]string, len(group))
+		for groupIndex, tag := range group {
+			tagIds[groupIndex] = fmt.Sprintf("#%v", tag.Id)
+		}
+
+		description := fmt.Sprintf("tag '%v': name is shared by tags %v", group[0].Name, strings.Join(tagIds, ", "))
+
+		if fix {
+			destTag := group[0]
+			for _, sourceTag := range group[1:] {
+				if err := mergeDuplicateTag(store, sourceTag, destTag); err != nil {
+					return 0, err
+				}
+			}
+
+			fmt.Printf("%v: merged into tag #%v\n", description, destTag.Id)
+		} else {
+			fmt.Println(description)
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+func mergeDuplicateTag(store *storage.Storage, sourceTag, destTag *entities.Tag) error {
+	log.Infof(2, "merging tag #%v into tag #%v.", sourceTag.Id, destTag.Id)
+
+	fileTags, err := store.FileTagsByTagId(sourceTag.Id, true)
+	if err != nil {
+		return fmt.Errorf("could not retrieve files for tag #%v: %v", sourceTag.Id, err)
+	}
+
+	for _, fileTag := range fileTags {
+		if _, err := store.AddFileTag(fileTag.FileId, destTag.Id, fileTag.ValueId); err != nil {
+			return fmt.Errorf("could not apply tag #%v to file #%v: %v", destTag.Id, fileTag.FileId, err)
+		}
+	}
+
+	if err := store.UpdateImplicationsForTagId(sourceTag.Id, destTag.Id); err != nil {
+		return fmt.Errorf("could not update implications for tag #%v: %v", sourceTag.Id, err)
+	}
+
+	if err := store.DeleteTag(sourceTag.Id); err != nil {
+		return fmt.Errorf("could not delete tag #%v: %v", sourceTag.Id, err)
+	}
+
+	return nil
+}
+
+func checkFileTags(store *storage.Storage, fix bool) (int, error) {
+	log.Info(2, "checking for taggings that refer to missing entities.")
+
+	fileTags, err := store.DanglingFileTags()
+	if err != nil {
+		return 0, fmt.Errorf("could not retrieve taggings: %v", err)
+	}
+
+	for _, fileTag := range fileTags {
+		missing := make([]string, 0, 3)
+
+		file, err := store.File(fileTag.FileId)
+		if err != nil {
+			return 0, fmt.Errorf("could not retrieve file #%v: %v", fileTag.FileId, err)
+		}
+		if file == nil {
+			missing = append(missing, fmt.Sprintf("file #%v", fileTag.FileId))
+		}
+
+		tag, err := store.Tag(fileTag.TagId)
+		if err != nil {
+			return 0, fmt.Errorf("could not retrieve tag #%v: %v", fileTag.TagId, err)
+		}
+		if tag == nil {
+			missing = append(missing, fmt.Sprintf("tag #%v", fileTag.TagId))
+		}
+
+		if fileTag.ValueId != 0 {
+			value, err := store.Value(fileTag.ValueId)
+			if err != nil {
+				return 0, fmt.Errorf("could not retrieve value #%v: %v", fileTag.ValueId, err)
+			}
+			if value == nil {
+				missing = append(missing, fmt.Sprintf("value #%v", fileTag.ValueId))
+			}
+		}
+
+		description := fmt.Sprintf("tagging of file #%v with tag #%v and value #%v: missing %v", fileTag.FileId, fileTag.TagId, fileTag.ValueId, strings.Join(missing, ", "))
+
+		if fix {
+			fmt.Printf("%v: removed\n", description)
+		} else {
+			fmt.Println(description)
+		}
+	}
+
+	if fix && len(fileTags) > 0 {
+		if err := store.DeleteDanglingFileTags(); err != nil {
+			return 0, fmt.Errorf("could not remove taggings: %v", err)
+		}
+	}
+
+	return len(fileTags), nil
+}
+
+func checkImplications(store *storage.Storage, fix bool) (int, error) {
+	log.Info(2, "checking for implications that refer to missing tags.")
+
+	implications, err := store.DanglingImplications()
+	if err != nil {
+		return 0, fmt.Errorf("could not retrieve implications: %v", err)
+	}
+
+	for _, implication := range implications {
+		missing := make([]string, 0, 2)
+		if implication.ImplyingTag.Name == "" {
+			missing = append(missing, fmt.Sprintf("tag #%v", implication.ImplyingTag.Id))
+		}
+		if implication.ImpliedTag.Name == "" {
+			missing = append(missing, fmt.Sprintf("tag #%v", implication.ImpliedTag.Id))
+		}
+
+		description := fmt.Sprintf("implication of tag #%v by tag #%v: missing %v", implication.ImpliedTag.Id, implication.ImplyingTag.Id, strings.Join(missing, ", "))
+
+		if fix {
+			fmt.Printf("%v: removed\n", description)
+		} else {
+			fmt.Println(description)
+		}
+	}
+
+	if fix && len(implications) > 0 {
+		if err := store.RemoveDanglingImplications(); err != nil {
+			return 0, fmt.Errorf("could not remove implications: %v", err)
+		}
+	}
+
+	return len(implications), nil
+}
+
+func checkValues(store *storage.Storage, fix bool) (int, error) {
+	log.Info(2, "checking for unused values.")
+
+	values, err := store.UnusedValues()
+	if err != nil {
+		return 0, fmt.Errorf("could not retrieve unused values: %v", err)
+	}
+
+	for _, value := range values {
+		description := fmt.Sprintf("value '%v' (#%v): unused", value.Name, value.Id)
+
+		if fix {
+			if err := store.DeleteValueIfUnused(value.Id); err != nil {
+				return 0, fmt.Errorf("could not delete value '%v': %v", value.Name, err)
+			}
+
+			fmt.Printf("%v: removed\n", description)
+		} else {
+			fmt.Println(description)
+		}
+	}
+
+	return len(values), nil
+}
@@ -0,0 +1,233 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/storage"
+)
+
+func TestCheckCleanDatabase(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	file, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tag, err := store.AddTag("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(file.Id, tag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := CheckCommand.Exec(store, Options{}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "", string(bytes))
+}
+
+func TestCheckReportsProblems(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	file, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if err := execUnenforced(databasePath, "INSERT INTO file_tag (file_id, tag_id, value_id) VALUES (?, 99, 0)", file.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddTag("apple"); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.Db.InsertTag("apple"); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddValue("orphan"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	err = CheckCommand.Exec(store, Options{}, []string{})
+
+	// validate
+
+	if err == nil {
+		test.Fatal("Problems were not identified.")
+	}
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, `tag 'apple': name is shared by tags #1, #2
+tagging of file #1 with tag #99 and value #0: missing tag #99
+value 'orphan' (#1): unused
+`, string(bytes))
+}
+
+func TestCheckFixesProblems(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	fileA, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileB, err := store.AddFile("/tmp/tmsu/b", fingerprint.Fingerprint("def"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	appleTag, err := store.AddTag("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	duplicateAppleTag, err := store.Db.InsertTag("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(fileA.Id, appleTag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(fileB.Id, duplicateAppleTag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := execUnenforced(databasePath, "INSERT INTO implication (tag_id, value_id, implied_tag_id, implied_value_id, preserve_value) VALUES (?, 0, 99, 0, 0)", duplicateAppleTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := CheckCommand.Exec(store, Options{Option{"--fix", "-f", "", false, ""}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tags, err := store.Tags()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Id != appleTag.Id {
+		test.Fatalf("Expected only tag #%v to remain but found: %v", appleTag.Id, tags)
+	}
+
+	expectTags(test, store, fileA, appleTag)
+	expectTags(test, store, fileB, appleTag)
+
+	implications, err := store.Implications()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(implications) != 0 {
+		test.Fatalf("Expected no implications but found %v.", len(implications))
+	}
+
+	implications, err = store.DanglingImplications()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(implications) != 0 {
+		test.Fatalf("Expected no dangling implications but found %v.", len(implications))
+	}
+}
+
+// unexported
+
+// Executes a statement on a separate connection without foreign key enforcement so
+// that the database can be broken.
+func execUnenforced(databasePath, statement string, args ...interface{}) error {
+	connection, err := sql.Open("sqlite3", databasePath)
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+
+	_, err = connection.Exec(statement, args...)
+	return err
+}
@@ -19,8 +19,10 @@ package cli
 
 import (
     "bufio"
+	"fmt"
     "io"
 	"os"
+	"path/filepath"
 	"strings"
 	"tmsu/common/log"
 	"tmsu/storage"
@@ -47,6 +49,31 @@ func Run() {
 
 	if dbOption := options.Get("--database"); dbOption != nil && dbOption.Argument != "" {
 		database.Path = dbOption.Argument
+		database.PathReason = "specified by the --database option"
+	}
+
+	if command := findCommand(commands, commandName); command != nil && command.NoDatabase {
+		if err := command.Exec(nil, options, arguments); err != nil {
+			if err != errBlank {
+				log.Warn(err.Error())
+			}
+
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if databasePaths := filepath.SplitList(database.Path); len(databasePaths) > 1 {
+		if err := runMultiple(commandName, databasePaths, options, arguments); err != nil {
+			if err != errBlank {
+				log.Warn(err.Error())
+			}
+
+			os.Exit(1)
+		}
+
+		return
 	}
 
     store, err := storage.Open()
@@ -54,7 +81,13 @@ func Run() {
         log.Fatalf("could not open storage: %v", err)
     }
 
-    if err := store.Begin(); err != nil {
+    // commands that only read do not lock out other processes writing to the database
+    begin := store.BeginWrite
+    if command := findCommand(commands, commandName); command != nil && command.ReadOnly {
+        begin = store.Begin
+    }
+
+    if err := begin(); err != nil {
         log.Fatalf("could not begin transaction: %v", err)
     }
 
@@ -64,7 +97,9 @@ func Run() {
         err = processCommand(store, commandName, options, arguments)
     }
 
-    store.Commit()
+    if commitErr := store.Commit(); commitErr != nil && err == nil {
+        err = fmt.Errorf("could not commit transaction: %v", commitErr)
+    }
     store.Close()
 
     if err != nil {
@@ -81,7 +116,7 @@ func Run() {
 var globalOptions = Options{Option{"--verbose", "-v", "show verbose messages", false, ""},
 	Option{"--help", "-h", "show help and exit", false, ""},
 	Option{"--version", "-V", "show version information and exit", false, ""},
-	Option{"--database", "-D", "use the specified database", true, ""},
+	Option{"--database", "-D", "use the specified database (or databases, separated by ':')", true, ""},
 	Option{"--color", "", "colorize the output (auto/always/never)", true, ""},
 }
 
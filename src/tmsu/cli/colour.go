@@ -0,0 +1,83 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"tmsu/common/terminal/ansi"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// The ANSI colour codes of the tags that have been given a colour, keyed by tag name.
+type tagColours map[string]string
+
+// Retrieves the colours given to tags by way of their 'colour' property.
+func retrieveTagColours(store *storage.Storage) (tagColours, error) {
+	properties, err := store.TagProperties()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tag properties: %v", err)
+	}
+
+	colours := make(tagColours)
+	for _, property := range properties {
+		if property.Name != entities.TagColourProperty {
+			continue
+		}
+
+		code, ok := ansi.ColourCode(property.Value)
+		if !ok {
+			continue
+		}
+
+		tag, err := store.Tag(property.TagId)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve tag #%v: %v", property.TagId, err)
+		}
+		if tag != nil {
+			colours[tag.Name] = code
+		}
+	}
+
+	return colours, nil
+}
+
+// Retrieves the colour code of the named tag, which inherits the colour of the nearest
+// namespace above it if it does not have a colour of its own.
+func (colours tagColours) of(tagName string) string {
+	levels := entities.TagNameLevels(tagName)
+
+	for count := len(levels); count > 0; count-- {
+		if code, ok := colours[strings.Join(levels[:count], entities.TagNamespaceSeparator)]; ok {
+			return code
+		}
+	}
+
+	return ""
+}
+
+// Applies the colour of the named tag, if any, to the text.
+func (colours tagColours) apply(tagName, text string) string {
+	code := colours.of(tagName)
+	if code == "" {
+		return text
+	}
+
+	return ansi.Colour(code, text)
+}
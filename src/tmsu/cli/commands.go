@@ -30,27 +30,43 @@ type Command struct {
 	Examples    []string
 	Options     Options
 	Exec        func(*storage.Storage, Options, []string) error
+	MultiExec   func([]*storage.Storage, Options, []string) error
 	Hidden      bool
+	NoDatabase  bool
+	ReadOnly    bool // does not write to the database
 }
 
 var commands = map[string]*Command{
+	"alias":    &AliasCommand,
+	"backup":   &BackupCommand,
+	"check":    &CheckCommand,
+	"config":   &ConfigCommand,
 	"copy":     &CopyCommand,
 	"delete":   &DeleteCommand,
+	"describe": &DescribeCommand,
 	"dupes":    &DupesCommand,
+	"export":   &ExportCommand,
 	"files":    &FilesCommand,
 	"help":     &HelpCommand,
+	"history":  &HistoryCommand,
 	"imply":    &ImplyCommand,
+	"import":   &ImportCommand,
+	"info":     &InfoCommand,
+	"init":     &InitCommand,
 	"merge":    &MergeCommand,
     "mount":    &MountCommand,
 	"rename":   &RenameCommand,
 	"repair":   &RepairCommand,
+	"restore":  &RestoreCommand,
 	"stats":    &StatsCommand,
 	"status":   &StatusCommand,
 	"tag":      &TagCommand,
 	"tags":     &TagsCommand,
+	"undo":     &UndoCommand,
     "unmount":  &UnmountCommand,
 	"untag":    &UntagCommand,
 	"untagged": &UntaggedCommand,
 	"values":   &ValuesCommand,
 	"version":  &VersionCommand,
-    "vfs":      &VfsCommand}
+    "vfs":      &VfsCommand,
+	"xattr":    &XattrCommand}
@@ -9,6 +9,7 @@ import (
 	"tmsu/entities"
 	"tmsu/storage"
 	"tmsu/storage/database"
+	"tmsu/storage/memory"
 )
 
 var stdout = os.Stdout
@@ -47,10 +48,46 @@ func restoreStreams() {
 
 func testDatabase() string {
 	databasePath := filepath.Join(os.TempDir(), "tmsu_test.db")
+
+	// a write-ahead log left by an earlier test would otherwise be applied to the new database
+	for _, path := range []string{databasePath, databasePath + "-wal", databasePath + "-shm"} {
+		os.Remove(path)
+	}
+
 	database.Path = databasePath
 	return databasePath
 }
 
+// The storage backends against which the tests are run. Every test is run against each of
+// them in turn so that their implementations, in particular of queries, cannot diverge.
+var testBackends = []struct {
+	name string
+	open func() (*storage.Storage, error)
+}{
+	{"memory", func() (*storage.Storage, error) { return storage.New(memory.New()) }},
+	{"sqlite", func() (*storage.Storage, error) { return storage.OpenAt(testDatabase()) }},
+}
+
+var testBackend = testBackends[0]
+
+func TestMain(m *testing.M) {
+	for _, backend := range testBackends {
+		testBackend = backend
+
+		if code := m.Run(); code != 0 {
+			fmt.Fprintf(stderr, "tests failed against the %v backend.\n", backend.name)
+			os.Exit(code)
+		}
+	}
+
+	os.Exit(0)
+}
+
+// Creates storage upon an empty database of the backend under test.
+func testStorage() (*storage.Storage, error) {
+	return testBackend.open()
+}
+
 func compareOutput(test *testing.T, expected, actual string) {
 	if actual != expected {
 		test.Fatal("Output was not as expected.\nExpected: " + strings.Replace(expected, "\n", "\\n", -1) + "\nActual: " + strings.Replace(actual, "\n", "\\n", -1))
@@ -0,0 +1,126 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"tmsu/common/log"
+	"tmsu/storage"
+)
+
+var ConfigCommand = Command{
+	Name:     "config",
+	Synopsis: "View or amend database settings",
+	Usages: []string{"tmsu config",
+		"tmsu config NAME...",
+		"tmsu config NAME=VALUE..."},
+	Description: `Views or amends the database settings.
+
+Without arguments the complete set of stored settings is listed. Settings can be viewed by specifying their names or amended by specifying a new value.
+
+  autoBackups        number of automatic backups to keep, taken before destructive
+                     operations such as 'merge' and 'delete': 0 (default) disables
+  autoCreateTags     automatically create tags when tagging: 'yes' (default) or 'no'
+  autoCreateValues   automatically create values when tagging: 'yes' (default) or 'no'
+  fingerprintAlgorithm
+                     the file fingerprint algorithm (default 'dynamic:SHA256')
+  root               directory that file paths are stored relative to, itself relative
+                     to the directory containing the database if not absolute
+  pathMappings.HOST  path prefix mappings to use on host HOST, of the form
+                     STORED=LOCAL, separated by ':' (';' on Windows)
+
+With a root configured, files beneath the root are stored relative to it so that the database continues to work when the root is mounted elsewhere or on another machine. Changing the root updates the paths of the files already in the database.
+
+Path mappings apply to the absolute paths of files outside of the root: a stored path beginning STORED is presented as beginning LOCAL when running on the host HOST.`,
+	Examples: []string{"$ tmsu config",
+		"$ tmsu config root\n..",
+		"$ tmsu config root=.",
+		"$ tmsu config pathMappings.laptop=/media/archive=/Volumes/archive"},
+	Options: Options{},
+	Exec:    configExec,
+}
+
+func configExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) == 0 {
+		return listAllSettings(store)
+	}
+
+	wereErrors := false
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		name := parts[0]
+
+		var err error
+		if len(parts) == 1 {
+			err = printSetting(store, name)
+		} else {
+			err = updateSetting(store, name, parts[1])
+		}
+
+		if err != nil {
+			log.Warn(err.Error())
+			wereErrors = true
+		}
+	}
+
+	if wereErrors {
+		return errBlank
+	}
+
+	return nil
+}
+
+// unexported
+
+func listAllSettings(store *storage.Storage) error {
+	settings, err := store.Settings()
+	if err != nil {
+		return fmt.Errorf("could not retrieve settings: %v", err)
+	}
+
+	for _, setting := range settings {
+		fmt.Printf("%v=%v\n", setting.Name, setting.Value)
+	}
+
+	return nil
+}
+
+func printSetting(store *storage.Storage, name string) error {
+	setting, err := store.Setting(name)
+	if err != nil {
+		return fmt.Errorf("could not retrieve setting '%v': %v", name, err)
+	}
+	if setting == nil {
+		return fmt.Errorf("no such setting '%v'.", name)
+	}
+
+	fmt.Println(setting.Value)
+
+	return nil
+}
+
+func updateSetting(store *storage.Storage, name, value string) error {
+	log.Infof(2, "updating setting '%v' to '%v'.", name, value)
+
+	if _, err := store.UpdateSetting(name, value); err != nil {
+		return fmt.Errorf("could not update setting '%v': %v", name, err)
+	}
+
+	return nil
+}
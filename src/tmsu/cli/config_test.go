@@ -0,0 +1,209 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"os"
+	"testing"
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/query"
+	"tmsu/storage"
+)
+
+func TestConfigRootStoresRelativePaths(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := ConfigCommand.Exec(store, Options{}, []string{"root=/tmp/tmsu"}); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFile("/tmp/tmsu/b/c", fingerprint.Fingerprint("def"), time.Now(), 123, false); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	storedFiles, err := store.Db.Files()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(storedFiles) != 2 {
+		test.Fatalf("Expected two files but are %v", len(storedFiles))
+	}
+	if storedFiles[0].Path() != "a" {
+		test.Fatalf("Expected stored path 'a' but was '%v'.", storedFiles[0].Path())
+	}
+	if storedFiles[1].Path() != "b/c" {
+		test.Fatalf("Expected stored path 'b/c' but was '%v'.", storedFiles[1].Path())
+	}
+
+	files, err := store.QueryFiles(query.EmptyExpression{}, query.NewPathScope([]string{"/tmp/tmsu/b"}, nil), true)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path() != "/tmp/tmsu/b/c" {
+		test.Fatalf("Expected only '/tmp/tmsu/b/c' under '/tmp/tmsu/b' but found %v files.", len(files))
+	}
+
+	files, err = store.FilesByDirectory("/tmp")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(files) != 2 {
+		test.Fatalf("Expected two files under '/tmp' but found %v.", len(files))
+	}
+}
+
+func TestConfigRootIsPortable(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.UpdateSetting("root", "/tmp/tmsu"); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false); err != nil {
+		test.Fatal(err)
+	}
+
+	// simulate the database being moved alongside the files
+	if _, err := store.Db.UpdateSetting("root", "/tmp/moved"); err != nil {
+		test.Fatal(err)
+	}
+
+	store.Close()
+
+	// test
+
+	store, err = storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	// validate
+
+	file, err := store.FileByPath("/tmp/moved/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file == nil {
+		test.Fatal("File was not found at its new location.")
+	}
+	if file.Path() != "/tmp/moved/a" {
+		test.Fatalf("Expected path '/tmp/moved/a' but was '%v'.", file.Path())
+	}
+}
+
+func TestConfigPathMappings(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, err := store.AddFile("/media/drive/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false); err != nil {
+		test.Fatal(err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := ConfigCommand.Exec(store, Options{}, []string{"pathMappings." + hostname + "=/media/drive=/mnt/drive"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	files, err := store.Files()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path() != "/mnt/drive/a" {
+		test.Fatalf("Expected mapped path '/mnt/drive/a'.")
+	}
+
+	file, err := store.FileByPath("/mnt/drive/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file == nil {
+		test.Fatal("File was not found by its mapped path.")
+	}
+}
+
+func TestConfigRejectsInvalidValue(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	// test
+
+	err = ConfigCommand.Exec(store, Options{}, []string{"autoCreateTags=maybe"})
+
+	// validate
+
+	if err == nil {
+		test.Fatal("Invalid setting value was accepted.")
+	}
+}
@@ -39,7 +39,7 @@ func copyExec(store *storage.Storage, options Options, args []string) error {
 	sourceTagName := args[0]
 	destTagNames := args[1:]
 
-	sourceTag, err := store.Db.TagByName(sourceTagName)
+	sourceTag, err := store.TagByName(sourceTagName)
 	if err != nil {
 		return fmt.Errorf("could not retrieve tag '%v': %v", sourceTagName, err)
 	}
@@ -49,7 +49,7 @@ func copyExec(store *storage.Storage, options Options, args []string) error {
 
 	wereErrors := false
 	for _, destTagName := range destTagNames {
-		destTag, err := store.Db.TagByName(destTagName)
+		destTag, err := store.TagByName(destTagName)
 		if err != nil {
 			return fmt.Errorf("could not retrieve tag '%v': %v", destTagName, err)
 		}
@@ -18,20 +18,15 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package cli
 
 import (
-	"os"
 	"testing"
 	"time"
 	"tmsu/common/fingerprint"
-	"tmsu/storage"
 )
 
 func TestCopySuccessful(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -83,10 +78,7 @@ func TestCopySuccessful(test *testing.T) {
 func TestCopyNonExistentSourceTag(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -106,10 +98,7 @@ func TestCopyNonExistentSourceTag(test *testing.T) {
 func TestCopyInvalidDestTag(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -129,10 +118,7 @@ func TestCopyInvalidDestTag(test *testing.T) {
 func TestCopyDestTagAlreadyExists(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
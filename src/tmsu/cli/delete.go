@@ -40,6 +40,10 @@ func deleteExec(store *storage.Storage, options Options, args []string) error {
 		return fmt.Errorf("no tags to delete specified")
 	}
 
+	if err := store.AutoBackup(); err != nil {
+		return fmt.Errorf("could not take automatic backup: %v", err)
+	}
+
 	wereErrors := false
 	for _, tagName := range args {
 		tag, err := store.TagByName(tagName)
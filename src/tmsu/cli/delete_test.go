@@ -18,20 +18,15 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package cli
 
 import (
-	"os"
 	"testing"
 	"time"
 	"tmsu/common/fingerprint"
-	"tmsu/storage"
 )
 
 func TestDeleteUnappliedTag(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -62,10 +57,7 @@ func TestDeleteUnappliedTag(test *testing.T) {
 func TestDeleteAppliedTag(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -161,10 +153,7 @@ func TestDeleteAppliedTag(test *testing.T) {
 func TestDeleteNonExistentTag(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
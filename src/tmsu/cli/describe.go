@@ -0,0 +1,177 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+var DescribeCommand = Command{
+	Name:     "describe",
+	Synopsis: "View or amend tag descriptions",
+	Usages: []string{"tmsu describe [OPTION]... TAG [DESCRIPTION]...",
+		"tmsu describe --all TAG"},
+	Description: `Views or amends the description and other properties of TAG.
+
+Where DESCRIPTION is specified the tag's description is set to it, an empty DESCRIPTION removing the description. Otherwise, unless properties are being amended, the description is shown.
+
+Tags may also carry arbitrary named properties, which are set using --set and removed using --unset. The following properties have a special meaning:
+
+  description  the tag's description, which is also available in the virtual filesystem
+               as a README file within the tag's directory, unless a tag is itself
+               named README
+  colour       the colour the tag is shown in by 'tags' and files with the tag are
+               shown in by 'files': red, green, yellow, blue, magenta, cyan or white
+  type         the type of the tag's values, which is checked when tagging and governs
+               how the values are compared in queries and ordered by 'values':
+               string, integer, decimal, date or version
+
+Hierarchical tags without a colour of their own are shown in the colour of the nearest namespace above them that has one.
+
+Dates are given as YYYY-MM-DD, optionally followed by a time as THH:MM or THH:MM:SS, or in RFC 3339 format. Versions are dot separated numbers, optionally prefixed with 'v' and suffixed with a '-' pre-release, which sorts before the release.`,
+	Examples: []string{`$ tmsu describe music "Audio recordings of any kind"`,
+		"$ tmsu describe music\nAudio recordings of any kind",
+		"$ tmsu describe --set colour=blue --set source=discogs music",
+		"$ tmsu describe --all music\ncolour=blue\ndescription=Audio recordings of any kind\nsource=discogs",
+		"$ tmsu describe --unset source music",
+		"$ tmsu describe --set type=version release"},
+	Options: Options{Option{"--all", "-a", "list all of the tag's properties", false, ""},
+		Option{"--set", "-s", "set property NAME to VALUE, given as NAME=VALUE (may be repeated)", true, ""},
+		Option{"--unset", "-u", "remove property NAME (may be repeated)", true, ""}},
+	Exec: describeExec,
+}
+
+func describeExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("tag to describe must be specified")
+	}
+
+	tagName := args[0]
+	tag, err := store.TagByName(tagName)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+	}
+	if tag == nil {
+		return fmt.Errorf("no such tag '%v'", tagName)
+	}
+
+	if options.HasOption("--all") {
+		return listTagProperties(store, tag)
+	}
+
+	amending := false
+
+	for _, option := range options {
+		switch option.LongName {
+		case "--set":
+			parts := strings.SplitN(option.Argument, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("invalid property '%v': expected NAME=VALUE", option.Argument)
+			}
+
+			if err := setTagProperty(store, tag, parts[0], parts[1]); err != nil {
+				return err
+			}
+			amending = true
+		case "--unset":
+			if err := unsetTagProperty(store, tag, option.Argument); err != nil {
+				return err
+			}
+			amending = true
+		}
+	}
+
+	if len(args) > 1 {
+		description := strings.Join(args[1:], " ")
+		if description == "" {
+			return unsetTagProperty(store, tag, entities.TagDescriptionProperty)
+		}
+
+		return setTagProperty(store, tag, entities.TagDescriptionProperty, description)
+	}
+
+	if amending {
+		return nil
+	}
+
+	return printTagDescription(store, tag)
+}
+
+// unexported
+
+func printTagDescription(store *storage.Storage, tag *entities.Tag) error {
+	properties, err := store.TagPropertiesByTagId(tag.Id)
+	if err != nil {
+		return fmt.Errorf("could not retrieve properties of tag '%v': %v", tag.Name, err)
+	}
+
+	description := properties.Value(entities.TagDescriptionProperty)
+	if description == "" {
+		log.Infof(1, "tag '%v' has no description.", tag.Name)
+		return nil
+	}
+
+	fmt.Println(description)
+
+	return nil
+}
+
+func listTagProperties(store *storage.Storage, tag *entities.Tag) error {
+	properties, err := store.TagPropertiesByTagId(tag.Id)
+	if err != nil {
+		return fmt.Errorf("could not retrieve properties of tag '%v': %v", tag.Name, err)
+	}
+
+	for _, property := range properties {
+		fmt.Printf("%v=%v\n", property.Name, property.Value)
+	}
+
+	return nil
+}
+
+func setTagProperty(store *storage.Storage, tag *entities.Tag, name, value string) error {
+	log.Infof(2, "setting property '%v' of tag '%v' to '%v'.", name, tag.Name, value)
+
+	if _, err := store.SetTagProperty(tag.Id, name, value); err != nil {
+		return fmt.Errorf("could not set property '%v' of tag '%v': %v", name, tag.Name, err)
+	}
+
+	return nil
+}
+
+func unsetTagProperty(store *storage.Storage, tag *entities.Tag, name string) error {
+	log.Infof(2, "removing property '%v' of tag '%v'.", name, tag.Name)
+
+	properties, err := store.TagPropertiesByTagId(tag.Id)
+	if err != nil {
+		return fmt.Errorf("could not retrieve properties of tag '%v': %v", tag.Name, err)
+	}
+	if properties.Value(name) == "" {
+		return fmt.Errorf("tag '%v' has no property '%v'", tag.Name, name)
+	}
+
+	if err := store.RemoveTagProperty(tag.Id, name); err != nil {
+		return fmt.Errorf("could not remove property '%v' of tag '%v': %v", name, tag.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/common/terminal/ansi"
+)
+
+func TestDescribeSetShowAndUnset(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, err := store.AddTag("music"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := DescribeCommand.Exec(store, Options{}, []string{"music", "Audio", "recordings"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := DescribeCommand.Exec(store, Options{Option{"--set", "-s", "", true, "colour=blue"}, Option{"--set", "-s", "", true, "source=discogs"}}, []string{"music"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := DescribeCommand.Exec(store, Options{}, []string{"music"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := DescribeCommand.Exec(store, Options{Option{"--unset", "-u", "", true, "source"}}, []string{"music"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := DescribeCommand.Exec(store, Options{Option{"--all", "-a", "", false, ""}}, []string{"music"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "Audio recordings\ncolour=blue\ndescription=Audio recordings\n", string(bytes))
+}
+
+func TestDescribeRejectsUnknownColour(test *testing.T) {
+	// set-up
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, err := store.AddTag("music"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	err = DescribeCommand.Exec(store, Options{Option{"--set", "-s", "", true, "colour=mauve"}}, []string{"music"})
+
+	// validate
+
+	if err == nil {
+		test.Fatal("Expected an unknown colour to be rejected.")
+	}
+}
+
+func TestTagColoursAreInherited(test *testing.T) {
+	// set-up
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	file, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	musicTag, err := store.AddTag("music")
+	if err != nil {
+		test.Fatal(err)
+	}
+	jazzTag, err := store.AddTag("music:jazz")
+	if err != nil {
+		test.Fatal(err)
+	}
+	photoTag, err := store.AddTag("photo")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.SetTagProperty(musicTag.Id, "colour", "blue"); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(file.Id, jazzTag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(file.Id, photoTag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	tagNames, err := tagNamesForFile(store, file.Id, false, true)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if len(tagNames) != 2 {
+		test.Fatalf("Expected 2 tags but got %v.", len(tagNames))
+	}
+	if tagNames[0] != ansi.Blue("music:jazz") {
+		test.Fatalf("Expected 'music:jazz' to inherit the colour of 'music' but got %q.", tagNames[0])
+	}
+	if tagNames[1] != "photo" {
+		test.Fatalf("Expected 'photo' to be uncoloured but got %q.", tagNames[1])
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"tmsu/common/filesystem"
 	"tmsu/common/fingerprint"
 	"tmsu/common/log"
@@ -36,8 +37,10 @@ var DupesCommand = Command{
 	Description: `Identifies all files in the database that are exact duplicates of FILE. If no FILE is specified then identifies duplicates between files in the database.`,
 	Examples: []string{"$ tmsu dupes\nSet of 2 duplicates:\n  /tmp/song.mp3\n  /tmp/copy of song.mp3a",
 		"$ tmsu dupes /tmp/song.mp3\n/tmp/copy of song.mp3"},
-	Options: Options{Option{"--recursive", "-r", "recursively check directory contents", false, ""}},
-	Exec:    dupesExec,
+	Options:   Options{Option{"--recursive", "-r", "recursively check directory contents", false, ""}},
+	Exec:      dupesExec,
+	MultiExec: dupesMultiExec,
+	ReadOnly:  true,
 }
 
 func dupesExec(store *storage.Storage, options Options, args []string) error {
@@ -53,6 +56,17 @@ func dupesExec(store *storage.Storage, options Options, args []string) error {
 	return nil
 }
 
+func dupesMultiExec(stores []*storage.Storage, options Options, args []string) error {
+	recursive := options.HasOption("--recursive")
+
+	switch len(args) {
+	case 0:
+		return findDuplicatesInDbs(stores)
+	default:
+		return findDuplicatesOfMulti(stores, args, recursive)
+	}
+}
+
 func findDuplicatesInDb(store *storage.Storage) error {
 	log.Info(2, "identifying duplicate files.")
 
@@ -80,12 +94,6 @@ func findDuplicatesInDb(store *storage.Storage) error {
 }
 
 func findDuplicatesOf(store *storage.Storage, paths []string, recursive bool) error {
-	store, err := storage.Open()
-	if err != nil {
-		return fmt.Errorf("could not open storage: %v", err)
-	}
-	defer store.Close()
-
 	fingerprintAlgorithm, err := store.SettingAsString("fingerprintAlgorithm")
 	if err != nil {
 		return err
@@ -175,3 +183,156 @@ func findDuplicatesOf(store *storage.Storage, paths []string, recursive bool) er
 
 	return nil
 }
+
+// Identifies duplicate files both within and between the databases.
+func findDuplicatesInDbs(stores []*storage.Storage) error {
+	log.Info(2, "identifying duplicate files.")
+
+	entriesByFingerprint := make(map[fingerprint.Fingerprint]labelledEntries)
+	fingerprints := make([]string, 0, 100)
+
+	for _, store := range stores {
+		files, err := store.Files()
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve files: %v", store.Db.Location(), err)
+		}
+
+		for _, file := range files {
+			if file.Fingerprint == fingerprint.Fingerprint("") {
+				continue
+			}
+
+			entries, found := entriesByFingerprint[file.Fingerprint]
+			if !found {
+				fingerprints = append(fingerprints, string(file.Fingerprint))
+			}
+
+			entriesByFingerprint[file.Fingerprint] = append(entries, labelledEntry{store.Db.Location(), _path.Rel(file.Path())})
+		}
+	}
+
+	sort.Strings(fingerprints)
+
+	first := true
+	for _, fp := range fingerprints {
+		entries := entriesByFingerprint[fingerprint.Fingerprint(fp)]
+		if len(entries) < 2 {
+			continue
+		}
+
+		if first {
+			first = false
+		} else {
+			fmt.Println()
+		}
+
+		sort.Sort(entries)
+
+		fmt.Printf("Set of %v duplicates:\n", len(entries))
+
+		for _, entry := range entries {
+			fmt.Printf("  %v: %v\n", entry.label, entry.text)
+		}
+	}
+
+	return nil
+}
+
+func findDuplicatesOfMulti(stores []*storage.Storage, paths []string, recursive bool) error {
+	wereErrors := false
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			switch {
+			case os.IsNotExist(err):
+				log.Warnf("%v: no such file", path)
+				wereErrors = true
+				continue
+			case os.IsPermission(err):
+				log.Warnf("%v: permission denied", path)
+				wereErrors = true
+				continue
+			default:
+				return err
+			}
+		}
+	}
+
+	if wereErrors {
+		return errBlank
+	}
+
+	if recursive {
+		p, err := filesystem.Enumerate(paths...)
+		if err != nil {
+			return fmt.Errorf("could not enumerate paths: %v", err)
+		}
+
+		paths = make([]string, len(p))
+		for index, path := range p {
+			paths[index] = path.Path
+		}
+	}
+
+	first := true
+	for _, path := range paths {
+		log.Infof(2, "%v: identifying duplicate files.", path)
+
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("%v: could not determine absolute path: %v", path, err)
+		}
+
+		entries := make(labelledEntries, 0, 10)
+		for _, store := range stores {
+			fingerprintAlgorithm, err := store.SettingAsString("fingerprintAlgorithm")
+			if err != nil {
+				return err
+			}
+
+			fp, err := fingerprint.Create(path, fingerprintAlgorithm)
+			if err != nil {
+				return fmt.Errorf("%v: could not create fingerprint: %v", path, err)
+			}
+
+			if fp == fingerprint.Fingerprint("") {
+				continue
+			}
+
+			files, err := store.FilesByFingerprint(fp)
+			if err != nil {
+				return fmt.Errorf("%v: %v: could not retrieve files matching fingerprint '%v': %v", store.Db.Location(), path, fp, err)
+			}
+
+			for _, file := range files {
+				// filter out the file we're searching on
+				if file.Path() != absPath {
+					entries = append(entries, labelledEntry{store.Db.Location(), _path.Rel(file.Path())})
+				}
+			}
+		}
+
+		if len(entries) == 0 {
+			continue
+		}
+
+		sort.Sort(entries)
+
+		if len(paths) > 1 {
+			if first {
+				first = false
+			} else {
+				fmt.Println()
+			}
+
+			fmt.Printf("%v:\n", path)
+
+			for _, entry := range entries {
+				fmt.Printf("  %v: %v\n", entry.label, entry.text)
+			}
+		} else {
+			entries.print()
+		}
+	}
+
+	return nil
+}
@@ -24,22 +24,18 @@ import (
 	"testing"
 	"time"
 	"tmsu/common/fingerprint"
-	"tmsu/storage"
 )
 
 func TestDupesSingle(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -71,16 +67,13 @@ func TestDupesSingle(test *testing.T) {
 
 func TestDupesMultiple(test *testing.T) {
 	// set-up
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -124,16 +117,13 @@ func TestDupesMultiple(test *testing.T) {
 
 func TestDupesNone(test *testing.T) {
 	// set-up
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -176,9 +166,6 @@ func TestDupesNone(test *testing.T) {
 
 func TestDupesSingleUntaggedFile(test *testing.T) {
 	// set-up
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
@@ -192,7 +179,7 @@ func TestDupesSingleUntaggedFile(test *testing.T) {
 	}
 	defer os.Remove(path)
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -235,9 +222,6 @@ func TestDupesSingleUntaggedFile(test *testing.T) {
 
 func TestDupesMultipleUntaggedFile(test *testing.T) {
 	// set-up
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
@@ -251,7 +235,7 @@ func TestDupesMultipleUntaggedFile(test *testing.T) {
 	}
 	defer os.Remove(path)
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -294,9 +278,6 @@ func TestDupesMultipleUntaggedFile(test *testing.T) {
 
 func TestDupesNoneUntaggedFile(test *testing.T) {
 	// set-up
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
@@ -310,7 +291,7 @@ func TestDupesNoneUntaggedFile(test *testing.T) {
 	}
 	defer os.Remove(path)
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -0,0 +1,128 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"tmsu/common/log"
+	"tmsu/storage"
+)
+
+var ExportCommand = Command{
+	Name:     "export",
+	Synopsis: "Export the database",
+	Usages:   []string{"tmsu export [OPTION]... [FILE]"},
+	Description: `Exports the complete database to FILE, or to standard output if FILE is not specified, in a text-based interchange format suitable for version control or processing by other tools. The exported data can be loaded into another database using the 'import' subcommand.
+
+Settings, tags, tag aliases, tag properties, values, files (with their fingerprints), taggings, tag implications and saved queries are exported. Tags and values are identified by name and files by path: database identifiers are not exported. The paths of files beneath the root directory of the database are exported relative to it, so that they are resolved against the root directory of the database imported into. Only explicit taggings are exported as implied taggings are derived from the implications.
+
+Two formats are supported:
+
+  json  A single object with the members 'version' (currently 1), 'settings', 'tags', 'aliases', 'tagProperties', 'values', 'files', 'implications' and 'queries'. Each alias has a 'name' and the 'tag' it refers to. Each tag property has a 'tag', 'name' and 'value'. Each file has a 'path', 'fingerprint', 'modTime', 'size', 'isDir' and its 'tags', each of which has a 'tag' and optional 'value'. Each implication has a 'tag' and 'implied' tag, optional 'value' and 'impliedValue', and 'preservesValue' if the implied tag takes the implying tag's value.
+
+  csv   One record per line, the first field identifying the type of record:
+
+          tmsu,VERSION
+          setting,NAME,VALUE
+          tag,NAME
+          alias,NAME,TAG
+          property,TAG,NAME,VALUE
+          value,NAME
+          file,PATH,FINGERPRINT,MODTIME,SIZE,ISDIR
+          filetag,PATH,TAG,VALUE
+          implication,TAG,IMPLIED-TAG[,VALUE,IMPLIED-VALUE,PRESERVES-VALUE]
+          query,TEXT
+
+If the format is not specified it is determined from the extension of FILE, defaulting to json.`,
+	Examples: []string{"$ tmsu export >tags.json",
+		"$ tmsu export --format=csv tags.csv"},
+	Options:  Options{{"--format", "-f", "the format to use: json or csv", true, ""}},
+	Exec:     exportExec,
+	ReadOnly: true,
+}
+
+func exportExec(store *storage.Storage, options Options, args []string) error {
+	path := ""
+	switch len(args) {
+	case 0:
+	case 1:
+		path = args[0]
+	default:
+		return fmt.Errorf("too many arguments.")
+	}
+
+	format, err := interchangeFormat(options, path)
+	if err != nil {
+		return err
+	}
+
+	log.Info(2, "retrieving database contents.")
+
+	document, err := buildInterchangeDocument(store)
+	if err != nil {
+		return err
+	}
+
+	var writer io.Writer = os.Stdout
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("%v: could not create file: %v", path, err)
+		}
+		defer file.Close()
+
+		writer = file
+	}
+
+	log.Infof(2, "writing %v.", format)
+
+	switch format {
+	case "json":
+		err = writeJsonDocument(writer, document)
+	case "csv":
+		err = writeCsvDocument(writer, document)
+	}
+	if err != nil {
+		return fmt.Errorf("could not write export: %v", err)
+	}
+
+	return nil
+}
+
+// unexported
+
+func interchangeFormat(options Options, path string) (string, error) {
+	if options.HasOption("--format") {
+		format := options.Get("--format").Argument
+		switch format {
+		case "json", "csv":
+			return format, nil
+		default:
+			return "", fmt.Errorf("invalid format '%v': expected 'json' or 'csv'.", format)
+		}
+	}
+
+	if filepath.Ext(path) == ".csv" {
+		return "csv", nil
+	}
+
+	return "json", nil
+}
@@ -24,6 +24,7 @@ import (
 	"strings"
 	"tmsu/common/log"
 	"tmsu/common/path"
+	"tmsu/common/terminal/ansi"
 	"tmsu/entities"
 	"tmsu/query"
 	"tmsu/storage"
@@ -36,9 +37,39 @@ var FilesCommand = Command{
 	Usages:   []string{"tmsu files [OPTION]... [QUERY]"},
 	Description: `Lists the files in the database that match the QUERY specified. If no query is specified, all files in the database are listed.
 
-QUERY may contain tag names to match, operators and parentheses. Operators are: and or not == != < > <= >=.
+QUERY may contain tag names to match, operators and parentheses. Operators are: and or not == != < > <= >= ~ =~ in ?.
 
-Queries are run against the database so the results may not reflect the current state of the filesystem. Only tagged files are matched: to identify untagged files use the 'untagged' subcommand.
+The ~ operator matches values against a glob, in which '*' matches any text, '?' any single character and '[...]' any of the enclosed characters. The =~ operator matches values against a regular expression. Tag names are matched in the same way using the 'tag' attribute described below, as in 'tag =~ "^proj-"', rather than with a 'tag:' prefix, which would denote a tag in the 'tag' namespace. A value containing spaces or punctuation used by the query language may be enclosed in double quotes.
+
+The ~ and ? operators are recognised only where they follow a tag and are separated from it by a space: elsewhere they are part of a name, so that a tag such as 'a~b' can be queried as is.
+
+The 'in' operator matches any of a parenthesised list of values, so 'country in (fr, de, it)' is equivalent to 'country = fr or country = de or country = it'. It is an operator only between a tag and a parenthesis: elsewhere 'in' is a tag name, as it is in 'country and in (fr)'. A range of values, inclusive of both ends, is written without spaces after the tag, as in 'year 1990..1999', or compared with '=', as in 'year = 1990..1999'. A value containing '..' is compared as is when enclosed in double quotes. A tag followed by '?', or 'has-value(year)', matches files tagged with any value of the tag whereas 'not-valued(year)' matches files to which the tag is applied without a value.
+
+The files' own attributes can be compared in place of a tag, unless there is a tag of the same name:
+
+  size         the size, optionally with a unit: 10kB, 10MB, 1GB or 10K, 10M, 1G (1024)
+  mtime        the modification time (see below)
+  name         the file name, without the directory
+  ext          the file name extension, without the dot and in any case: ext = jpg
+  dir          the directory containing the file
+  type         file or dir: 'type = dir' is equivalent to --directory
+  fingerprint  the file's fingerprint
+  tag          the names of the file's tags: 'tag =~ "^proj-"' matches any tag starting 'proj-'
+  tagcount     the number of distinct tags applied to the file: 'tagcount < 3'
+
+Similarly, 'only(photo, raw)' matches the files tagged with each of the tags listed and no others. This, and 'tagcount', consider only the tags applied explicitly.
+
+The 'untagged' predicate matches the files and directories that are not in the database, which are found as for the 'untagged' subcommand beneath each --path or, where none is given, the current working directory. They have no tags so can only otherwise be matched by their attributes, as in 'untagged and ext = jpg', and are listed along with the files in the database that match the query.
+
+The modification time is compared with either a date, such as 2014-03-09 or 2014-03-09T13:45, or a duration before now, such as 30min, 12h, 7d, 2w, 3months or 1y. A date stands for the whole period it denotes, so 'mtime = 2014-03' matches files modified at any time in March 2014. Dates without a time zone are in local time.
+
+Unless --explicit is specified, files to which a tag is applied by way of a tag implication also match, including comparisons where the implication gives the tag a value.
+
+Values are compared according to the type declared for the tag, using the 'describe' subcommand, so that, for example, version 1.10 follows 1.9. Where a tag has no declared type its values are compared numerically when compared with a number and as text otherwise.
+
+When color is turned on, each file is shown in the color given, using the 'describe' subcommand, to the first of its tags that the query refers to.
+
+Queries are run against the database so the results may not reflect the current state of the filesystem. Only files in the database are matched: to identify files that have not been added to the database use the 'untagged' subcommand.
 
 Note: Your shell may use some punctuation (e.g. < and >) for its own purposes. Either enclose the query in quotation marks, escape the problematic characters or use the equivalent text operators: == eq, != ne, < lt, > gt, <= le, >= ge.`,
 	Examples: []string{"$ tmsu files music mp3  # files with both 'music' and 'mp3'",
@@ -48,18 +79,35 @@ Note: Your shell may use some punctuation (e.g. < and >) for its own purposes. E
 		`$ tmsu files "year == 2014"  # tagged 'year' with a value '2014'`,
 		`$ tmsu files "year < 2014" # tagged 'year' with values under '2014'`,
 		`$ tmsu files year lt 2014  # same query but using textual operator`,
+		`$ tmsu files "release >= 1.10"  # tagged 'release' with a later version, if typed 'version'`,
 		`$ tmsu files year  # tagged 'year' (any or no value)`,
+		`$ tmsu files "year ?"  # tagged 'year' with any value`,
+		`$ tmsu files "not-valued(year)"  # tagged 'year' without a value`,
+		`$ tmsu files "country in (fr, de, it)"`,
+		`$ tmsu files year 1990..1999  # tagged 'year' with a value from 1990 to 1999`,
+		`$ tmsu files "photo and mtime > 7d"  # tagged 'photo' and modified in the last week`,
+		`$ tmsu files "mtime < 2014-01-01"  # modified before 2014`,
+		`$ tmsu files "photo and size > 10MB and ext == jpg"`,
+		`$ tmsu files 'year ~ 19*'  # tagged 'year' with a value starting '19'`,
+		`$ tmsu files 'tag =~ "^proj-[0-9]+$"'  # tagged with any tag matching the regular expression`,
+		`$ tmsu files "photo and tagcount < 3"  # tagged 'photo' and fewer than two other tags`,
+		`$ tmsu files "only(photo, raw)"  # tagged 'photo' and 'raw' and nothing else`,
+		`$ tmsu files --path=photos "untagged or only(photo)"  # under 'photos' and not tagged beyond 'photo'`,
 		`$ tmsu files --top music  # don't list individual files if directory is tagged`,
-		`$ tmsu files --path=/home/bob music  # tagged 'music' under /home/bob`},
+		`$ tmsu files --path=/home/bob music  # tagged 'music' under /home/bob`,
+		`$ tmsu files --path=/home/bob --exclude=/home/bob/tmp music  # as above but not under /home/bob/tmp`},
 	Options: Options{{"--directory", "-d", "list only items that are directories", false, ""},
 		{"--file", "-f", "list only items that are files", false, ""},
 		{"--top", "-t", "list only the top-most matching items (exclude files under matching directories)", false, ""},
 		{"--leaf", "-l", "list only the leaf items (files and directories without tagged contents)", false, ""},
 		{"--print0", "-0", "delimit files with a NUL character rather than newline.", false, ""},
 		{"--count", "-c", "lists the number of files rather than their names", false, ""},
-		{"--path", "-p", "list only items under PATH", true, ""},
+		{"--path", "-p", "list only items under PATH (may be repeated)", true, ""},
+		{"--exclude", "-x", "exclude items under PATH (may be repeated)", true, ""},
 		{"--explicit", "-e", "list only explicitly tagged files", false, ""}},
-	Exec: filesExec,
+	Exec:      filesExec,
+	MultiExec: filesMultiExec,
+	ReadOnly:  true,
 }
 
 func filesExec(store *storage.Storage, options Options, args []string) error {
@@ -69,45 +117,83 @@ func filesExec(store *storage.Storage, options Options, args []string) error {
 	leafOnly := options.HasOption("--leaf")
 	print0 := options.HasOption("--print0")
 	showCount := options.HasOption("--count")
-	hasPath := options.HasOption("--path")
 	explicitOnly := options.HasOption("--explicit")
 
-	absPath := ""
-	if hasPath {
-		relPath := options.Get("--path").Argument
+	scope, err := filesScopeOption(options)
+	if err != nil {
+		return err
+	}
 
-		var err error
-		absPath, err = filepath.Abs(relPath)
-		if err != nil {
-			fmt.Println("could not get absolute path of '%v': %v'", relPath, err)
-		}
+	colour, err := colourOption(options)
+	if err != nil {
+		return err
 	}
 
 	queryText := strings.Join(args, " ")
-	return listFilesForQuery(store, queryText, absPath, dirOnly, fileOnly, topOnly, leafOnly, print0, showCount, explicitOnly)
+	return listFilesForQuery(store, queryText, scope, dirOnly, fileOnly, topOnly, leafOnly, print0, showCount, explicitOnly, colour)
 }
 
-// unexported
+func filesMultiExec(stores []*storage.Storage, options Options, args []string) error {
+	dirOnly := options.HasOption("--directory")
+	fileOnly := options.HasOption("--file")
+	topOnly := options.HasOption("--top")
+	leafOnly := options.HasOption("--leaf")
+	print0 := options.HasOption("--print0")
+	showCount := options.HasOption("--count")
+	explicitOnly := options.HasOption("--explicit")
 
-func listFilesForQuery(store *storage.Storage, queryText, path string, dirOnly, fileOnly, topOnly, leafOnly, print0, showCount, explicitOnly bool) error {
-	log.Info(2, "parsing query")
+	scope, err := filesScopeOption(options)
+	if err != nil {
+		return err
+	}
 
-	expression, err := query.Parse(queryText)
+	expression, err := query.Parse(strings.Join(args, " "))
 	if err != nil {
 		return fmt.Errorf("could not parse query: %v", err)
 	}
 
-	log.Info(2, "checking tag names")
+	tagNames := query.TagNames(expression)
+	missingCounts := make(map[string]int, len(tagNames))
 
-	wereErrors := false
+	entries := make(labelledEntries, 0, 100)
+	for _, store := range stores {
+		missingTagNames, err := missingTagNames(store, tagNames)
+		if err != nil {
+			return err
+		}
+		if len(missingTagNames) > 0 {
+			log.Infof(2, "%v: skipping database as it lacks tags %v.", store.Db.Location(), missingTagNames)
 
-	tagNames := query.TagNames(expression)
-	tags, err := store.TagsByNames(tagNames)
+			for _, tagName := range missingTagNames {
+				missingCounts[tagName]++
+			}
+			continue
+		}
+
+		log.Infof(2, "%v: querying database", store.Db.Location())
+
+		files, err := queryFiles(store, expression, scope, explicitOnly)
+		if err != nil {
+			return fmt.Errorf("%v: %v", store.Db.Location(), err)
+		}
+
+		absPaths := filterFilePaths(files, dirOnly, fileOnly, topOnly, leafOnly)
+
+		if showCount {
+			entries = append(entries, labelledEntry{store.Db.Location(), fmt.Sprint(len(absPaths))})
+			continue
+		}
+
+		for _, absPath := range absPaths {
+			entries = append(entries, labelledEntry{store.Db.Location(), path.Rel(absPath)})
+		}
+	}
+
+	wereErrors := false
 	for _, tagName := range tagNames {
-		if !tags.ContainsName(tagName) {
+		if missingCounts[tagName] == len(stores) {
 			log.Warnf("no such tag '%v'.", tagName)
 			wereErrors = true
-			continue
 		}
 	}
 
@@ -115,54 +201,221 @@ func listFilesForQuery(store *storage.Storage, queryText, path string, dirOnly,
 		return errBlank
 	}
 
+	if !showCount {
+		sort.Sort(entries)
+	}
+
+	for _, entry := range entries {
+		if print0 {
+			fmt.Printf("%v: %v\000", entry.label, entry.text)
+		} else {
+			fmt.Printf("%v: %v\n", entry.label, entry.text)
+		}
+	}
+
+	return nil
+}
+
+// unexported
+
+func filesScopeOption(options Options) (query.PathScope, error) {
+	include, err := absOptionPaths(options, "--path")
+	if err != nil {
+		return query.PathScope{}, err
+	}
+
+	exclude, err := absOptionPaths(options, "--exclude")
+	if err != nil {
+		return query.PathScope{}, err
+	}
+
+	return query.NewPathScope(include, exclude), nil
+}
+
+func absOptionPaths(options Options, name string) ([]string, error) {
+	absPaths := make([]string, 0, options.Count(name))
+
+	for _, option := range options {
+		if option.LongName != name {
+			continue
+		}
+
+		absPath, err := filepath.Abs(option.Argument)
+		if err != nil {
+			return nil, fmt.Errorf("could not get absolute path of '%v': %v", option.Argument, err)
+		}
+
+		absPaths = append(absPaths, absPath)
+	}
+
+	return absPaths, nil
+}
+
+func listFilesForQuery(store *storage.Storage, queryText string, scope query.PathScope, dirOnly, fileOnly, topOnly, leafOnly, print0, showCount, explicitOnly, colour bool) error {
+	log.Info(2, "parsing query")
+
+	expression, err := query.Parse(queryText)
+	if err != nil {
+		return fmt.Errorf("could not parse query: %v", err)
+	}
+
+	log.Info(2, "checking tag names")
+
+	missingTagNames, err := missingTagNames(store, query.TagNames(expression))
+	if err != nil {
+		return err
+	}
+	if len(missingTagNames) > 0 {
+		for _, tagName := range missingTagNames {
+			log.Warnf("no such tag '%v'.", tagName)
+		}
+
+		return errBlank
+	}
+
 	log.Info(2, "querying database")
 
-	files, err := store.QueryFiles(expression, path, explicitOnly)
+	files, err := queryFiles(store, expression, scope, explicitOnly)
 	if err != nil {
-		return fmt.Errorf("could not query files: %v", err)
+		return err
 	}
 
-	if err = listFiles(files, dirOnly, fileOnly, topOnly, leafOnly, print0, showCount); err != nil {
+	var pathColours map[string]string
+	if colour && !print0 && !showCount {
+		pathColours, err = fileColours(store, files, query.TagNames(expression), explicitOnly)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = listFiles(files, dirOnly, fileOnly, topOnly, leafOnly, print0, showCount, pathColours); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func listFiles(files entities.Files, dirOnly, fileOnly, topOnly, leafOnly, print0, showCount bool) error {
-	tree := path.NewTree()
-	for _, file := range files {
-		tree.Add(file.Path(), file.IsDir)
+// Retrieves the files in the database that match the query and, where the query refers to
+// untagged files, the matching paths that are not in the database.
+func queryFiles(store *storage.Storage, expression query.Expression, scope query.PathScope, explicitOnly bool) (entities.Files, error) {
+	files, err := store.QueryFiles(expression, scope, explicitOnly)
+	if err != nil {
+		return nil, fmt.Errorf("could not query files: %v", err)
 	}
 
-	if topOnly {
-		tree = tree.TopLevel()
+	for _, name := range query.AttributeNames(expression) {
+		if name != query.UntaggedAttribute {
+			continue
+		}
+
+		log.Info(2, "examining the filesystem for untagged files")
+
+		untaggedFiles, err := store.QueryUntaggedFiles(expression, scope, explicitOnly)
+		if err != nil {
+			return nil, fmt.Errorf("could not query untagged files: %v", err)
+		}
+
+		return append(files, untaggedFiles...), nil
 	}
 
-	if leafOnly {
-		tree = tree.Leaves()
+	return files, nil
+}
+
+// Determines the colour code of each file from the colours of its tags, keyed by path.
+//
+// A file takes the colour of the first of the query's tags it has (or has beneath it in the
+// hierarchy) that has a colour. With no tags in the query, any of the file's tags may be used.
+func fileColours(store *storage.Storage, files entities.Files, queryTagNames []string, explicitOnly bool) (map[string]string, error) {
+	colours, err := retrieveTagColours(store)
+	if err != nil {
+		return nil, err
+	}
+	if len(colours) == 0 {
+		return nil, nil
 	}
 
-	if fileOnly {
-		tree = tree.Files()
+	queryTagNames, err = store.CanonicalTagNames(queryTagNames)
+	if err != nil {
+		return nil, err
 	}
 
-	if dirOnly {
-		tree = tree.Directories()
+	pathColours := make(map[string]string, len(files))
+	for _, file := range files {
+		fileTags, err := store.FileTagsByFileId(file.Id, explicitOnly)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not retrieve file-tags: %v", file.Path(), err)
+		}
+
+		tags, err := store.TagsByIds(fileTags.TagIds().Uniq())
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not retrieve tags: %v", file.Path(), err)
+		}
+
+		if code := fileColour(colours, tags, queryTagNames); code != "" {
+			pathColours[file.Path()] = code
+		}
 	}
 
-	absPaths := tree.Paths()
+	return pathColours, nil
+}
+
+func fileColour(colours tagColours, tags entities.Tags, queryTagNames []string) string {
+	if len(queryTagNames) == 0 {
+		sort.Sort(tags)
+		for _, tag := range tags {
+			if code := colours.of(tag.Name); code != "" {
+				return code
+			}
+		}
+
+		return ""
+	}
+
+	for _, queryTagName := range queryTagNames {
+		for _, tag := range tags {
+			if tag.Name != queryTagName && !entities.IsDescendantTagName(tag.Name, queryTagName) {
+				continue
+			}
+
+			if code := colours.of(tag.Name); code != "" {
+				return code
+			}
+		}
+	}
+
+	return ""
+}
+
+func missingTagNames(store *storage.Storage, tagNames []string) ([]string, error) {
+	missing, err := store.UnknownTagNames(tagNames)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	return missing, nil
+}
+
+func listFiles(files entities.Files, dirOnly, fileOnly, topOnly, leafOnly, print0, showCount bool, pathColours map[string]string) error {
+	absPaths := filterFilePaths(files, dirOnly, fileOnly, topOnly, leafOnly)
 
 	if showCount {
 		fmt.Println(len(absPaths))
 	} else {
 		relPaths := make([]string, len(absPaths))
+		colourByRelPath := make(map[string]string, len(pathColours))
 		for index, absPath := range absPaths {
 			relPaths[index] = path.Rel(absPath)
+			if code, ok := pathColours[absPath]; ok {
+				colourByRelPath[relPaths[index]] = code
+			}
 		}
 		sort.Strings(relPaths)
 
 		for _, relPath := range relPaths {
+			if code, ok := colourByRelPath[relPath]; ok {
+				relPath = ansi.Colour(code, relPath)
+			}
+
 			if print0 {
 				fmt.Printf("%v\000", relPath)
 			} else {
@@ -174,6 +427,31 @@ func listFiles(files entities.Files, dirOnly, fileOnly, topOnly, leafOnly, print
 	return nil
 }
 
+func filterFilePaths(files entities.Files, dirOnly, fileOnly, topOnly, leafOnly bool) []string {
+	tree := path.NewTree()
+	for _, file := range files {
+		tree.Add(file.Path(), file.IsDir)
+	}
+
+	if topOnly {
+		tree = tree.TopLevel()
+	}
+
+	if leafOnly {
+		tree = tree.Leaves()
+	}
+
+	if fileOnly {
+		tree = tree.Files()
+	}
+
+	if dirOnly {
+		tree = tree.Directories()
+	}
+
+	return tree.Paths()
+}
+
 func containsTag(tags []string, tag string) bool {
 	for _, iteratedTag := range tags {
 		if iteratedTag == tag {
@@ -18,27 +18,27 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package cli
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 	"tmsu/common/fingerprint"
-	"tmsu/storage"
+	"tmsu/entities"
 )
 
 func TestFilesAll(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -74,16 +74,13 @@ func TestFilesAll(test *testing.T) {
 func TestFilesSingleTag(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -138,16 +135,13 @@ func TestFilesSingleTag(test *testing.T) {
 func TestFilesNotSingleTag(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -201,16 +195,13 @@ func TestFilesNotSingleTag(test *testing.T) {
 func TestFilesImplicitAnd(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -272,16 +263,13 @@ func TestFilesImplicitAnd(test *testing.T) {
 func TestFilesAnd(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -343,16 +331,13 @@ func TestFilesAnd(test *testing.T) {
 func TestFilesImplicitAndNot(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -414,16 +399,13 @@ func TestFilesImplicitAndNot(test *testing.T) {
 func TestFilesAndNot(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -485,16 +467,13 @@ func TestFilesAndNot(test *testing.T) {
 func TestFilesOr(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -556,16 +535,13 @@ func TestFilesOr(test *testing.T) {
 func TestFilesTagEqualsValue(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -621,16 +597,13 @@ func TestFilesTagEqualsValue(test *testing.T) {
 func TestFilesTagNotEqualsValue(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -689,16 +662,13 @@ func TestFilesTagNotEqualsValue(test *testing.T) {
 func TestFilesTagLessThanValue(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -757,16 +727,13 @@ func TestFilesTagLessThanValue(test *testing.T) {
 func TestFilesTagGreaterThanValue(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -822,11 +789,145 @@ func TestFilesTagGreaterThanValue(test *testing.T) {
 	compareOutput(test, "/tmp/b\n/tmp/b\n/tmp/b\n", string(bytes))
 }
 
-func TestFilesTagLessThanOrEqualToValue(test *testing.T) {
+func TestFilesTypedTagComparison(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileC, err := store.AddFile("/tmp/c", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tagRelease, err := store.AddTag("release")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	value19, err := store.AddValue("1.9")
+	if err != nil {
+		test.Fatal(err)
+	}
+	value110, err := store.AddValue("1.10")
+	if err != nil {
+		test.Fatal(err)
+	}
+	value20rc1, err := store.AddValue("2.0-rc1")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(fileA.Id, tagRelease.Id, value19.Id); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(fileB.Id, tagRelease.Id, value110.Id); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(fileC.Id, tagRelease.Id, value20rc1.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.SetTagProperty(tagRelease.Id, "type", "version"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{}, []string{"release > 1.9"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"release < 2.0"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/b\n/tmp/c\n/tmp/a\n/tmp/b\n/tmp/c\n", string(bytes))
+}
+
+func TestFilesTypedTagComparisonMatchingManyValues(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := store.Begin(); err != nil {
+		test.Fatal(err)
+	}
+
+	sizeTag, err := store.AddTag("size")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.SetTagProperty(sizeTag.Id, "type", "integer"); err != nil {
+		test.Fatal(err)
+	}
+
+	// more values than SQLite allows statement parameters
+	for size := 1; size <= 1500; size++ {
+		file, err := store.AddFile(fmt.Sprintf("/tmp/%v", size), fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+		if err != nil {
+			test.Fatal(err)
+		}
+		value, err := store.AddValue(strconv.Itoa(size))
+		if err != nil {
+			test.Fatal(err)
+		}
+		if _, err := store.AddFileTag(file.Id, sizeTag.Id, value.Id); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := store.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{Option{"--count", "-c", "", false, ""}}, []string{"size > 100"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "1400\n", string(bytes))
+}
+
+func TestFilesTagLessThanOrEqualToValue(test *testing.T) {
+	// set-up
 
 	err := redirectStreams()
 	if err != nil {
@@ -834,7 +935,7 @@ func TestFilesTagLessThanOrEqualToValue(test *testing.T) {
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -893,16 +994,13 @@ func TestFilesTagLessThanOrEqualToValue(test *testing.T) {
 func TestFilesTagGreaterThanOrEqualToValue(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -959,3 +1057,687 @@ func TestFilesTagGreaterThanOrEqualToValue(test *testing.T) {
 }
 
 //TODO tests for 'file' and 'directory' options.
+
+func TestFilesModificationTime(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now().Add(-time.Hour), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Date(2013, 12, 31, 23, 0, 0, 0, time.Local), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileC, err := store.AddFile("/tmp/c", fingerprint.Fingerprint("abc"), time.Date(2014, 1, 1, 0, 30, 0, 0, time.Local), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tagPhoto, err := store.AddTag("photo")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for _, file := range []*entities.File{fileA, fileB, fileC} {
+		if _, err := store.AddFileTag(file.Id, tagPhoto.Id, 0); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{}, []string{"photo and mtime > 7d"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"mtime < 2014-01-01"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"mtime = 2014"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"not mtime = 2014"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/a\n/tmp/b\n/tmp/c\n/tmp/a\n/tmp/b\n", string(bytes))
+}
+
+func TestFilesFileAttributes(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	fileA, err := store.AddFile("/tmp/a.jpg", fingerprint.Fingerprint("abc"), time.Now(), 20000000, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileB, err := store.AddFile("/tmp/b.JPG", fingerprint.Fingerprint("def"), time.Now(), 5000000, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileC, err := store.AddFile("/tmp/c.png", fingerprint.Fingerprint("ghi"), time.Now(), 30000000, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileD, err := store.AddFile("/tmp/d", fingerprint.Fingerprint(""), time.Now(), 0, true)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tagPhoto, err := store.AddTag("photo")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for _, file := range []*entities.File{fileA, fileB, fileC, fileD} {
+		if _, err := store.AddFileTag(file.Id, tagPhoto.Id, 0); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{}, []string{"photo and size > 10MB and ext == jpg"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"ext = jpg and name > b"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"photo and type = dir"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"fingerprint = ghi or dir != /tmp"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/a.jpg\n/tmp/b.JPG\n/tmp/d\n/tmp/c.png\n", string(bytes))
+}
+
+func TestFilesPatterns(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	fileA, err := store.AddFile("/tmp/a.jpg", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileB, err := store.AddFile("/tmp/b.png", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileC, err := store.AddFile("/tmp/c.jpg", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tagYear, err := store.AddTag("year")
+	if err != nil {
+		test.Fatal(err)
+	}
+	tagProjA, err := store.AddTag("proj-a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	tagProjB, err := store.AddTag("proj-b")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	value1985, err := store.AddValue("1985")
+	if err != nil {
+		test.Fatal(err)
+	}
+	value2001, err := store.AddValue("2001")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(fileA.Id, tagYear.Id, value1985.Id); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(fileB.Id, tagYear.Id, value2001.Id); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(fileB.Id, tagProjA.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(fileC.Id, tagProjB.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{}, []string{"year ~ 19*"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{`year =~ "^(19|20)[0-9]{2}$"`}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"tag ~ proj-*"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"tag ~ other-* or name ~ *.png"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/a.jpg\n/tmp/a.jpg\n/tmp/b.png\n/tmp/b.png\n/tmp/c.jpg\n/tmp/b.png\n", string(bytes))
+}
+
+func TestFilesValueSetsAndRanges(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileC, err := store.AddFile("/tmp/c", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileD, err := store.AddFile("/tmp/d", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tagCountry, err := store.AddTag("country")
+	if err != nil {
+		test.Fatal(err)
+	}
+	tagYear, err := store.AddTag("year")
+	if err != nil {
+		test.Fatal(err)
+	}
+	tagLive, err := store.AddTag("live")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	valueFr, err := store.AddValue("fr")
+	if err != nil {
+		test.Fatal(err)
+	}
+	valueDe, err := store.AddValue("de")
+	if err != nil {
+		test.Fatal(err)
+	}
+	valueUk, err := store.AddValue("uk")
+	if err != nil {
+		test.Fatal(err)
+	}
+	value1985, err := store.AddValue("1985")
+	if err != nil {
+		test.Fatal(err)
+	}
+	value1999, err := store.AddValue("1999")
+	if err != nil {
+		test.Fatal(err)
+	}
+	value2001, err := store.AddValue("2001")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for _, fileTag := range []struct {
+		fileId  entities.FileId
+		tagId   entities.TagId
+		valueId entities.ValueId
+	}{{fileA.Id, tagCountry.Id, valueFr.Id}, {fileA.Id, tagYear.Id, value1985.Id},
+		{fileB.Id, tagCountry.Id, valueDe.Id}, {fileB.Id, tagYear.Id, value2001.Id},
+		{fileC.Id, tagCountry.Id, valueUk.Id}, {fileC.Id, tagYear.Id, 0},
+		{fileD.Id, tagLive.Id, 0}} {
+		if _, err := store.AddFileTag(fileTag.fileId, fileTag.tagId, fileTag.valueId); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// live recordings are implied to be from 1999
+	if err := store.AddImplication(tagLive.Id, 0, tagYear.Id, value1999.Id, false); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	for _, queryText := range []string{"country in (fr, de, it)", "year 1990..2010", "year ?", "has-value(year)",
+		"not-valued(year)", "country IN (uk) or year = 1980..1989"} {
+		if err := FilesCommand.Exec(store, Options{}, []string{queryText}); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := FilesCommand.Exec(store, Options{}, []string{"year = 2010..1990"}); err == nil {
+		test.Fatal("Expected an error for a range with its bounds reversed.")
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/a\n/tmp/b\n/tmp/b\n/tmp/d\n/tmp/a\n/tmp/b\n/tmp/d\n/tmp/a\n/tmp/b\n/tmp/d\n/tmp/c\n/tmp/a\n/tmp/c\n", string(bytes))
+}
+
+func TestFilesTagCountAndOnly(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileC, err := store.AddFile("/tmp/c", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	tagPhoto, err := store.AddTag("photo")
+	if err != nil {
+		test.Fatal(err)
+	}
+	tagRaw, err := store.AddTag("raw")
+	if err != nil {
+		test.Fatal(err)
+	}
+	tagYear, err := store.AddTag("year")
+	if err != nil {
+		test.Fatal(err)
+	}
+	tagImage, err := store.AddTag("image")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	value2014, err := store.AddValue("2014")
+	if err != nil {
+		test.Fatal(err)
+	}
+	value2015, err := store.AddValue("2015")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for _, fileTag := range []struct {
+		fileId  entities.FileId
+		tagId   entities.TagId
+		valueId entities.ValueId
+	}{{fileA.Id, tagPhoto.Id, 0}, {fileA.Id, tagRaw.Id, 0},
+		{fileB.Id, tagPhoto.Id, 0}, {fileB.Id, tagRaw.Id, 0}, {fileB.Id, tagYear.Id, value2014.Id},
+		{fileC.Id, tagPhoto.Id, 0}, {fileC.Id, tagYear.Id, value2014.Id}, {fileC.Id, tagYear.Id, value2015.Id}} {
+		if _, err := store.AddFileTag(fileTag.fileId, fileTag.tagId, fileTag.valueId); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// implied tags are not counted
+	if err := store.AddImplication(tagPhoto.Id, 0, tagImage.Id, 0, false); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	for _, queryText := range []string{"photo and tagcount < 3", "only(photo, raw)", "only(year, photo)",
+		"tagcount >= 2 and not only(raw, photo)"} {
+		if err := FilesCommand.Exec(store, Options{}, []string{queryText}); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/a\n/tmp/c\n/tmp/a\n/tmp/c\n/tmp/b\n/tmp/c\n", string(bytes))
+}
+
+func TestFilesUntagged(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	dir := filepath.Join(os.TempDir(), "tmsu_untagged_test")
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a.jpg", "b.jpg", "c.txt", "skip/d.jpg"} {
+		if err := createFile(filepath.Join(dir, name), "abc"); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	file, err := store.AddFile(filepath.Join(dir, "a.jpg"), fingerprint.Fingerprint("abc"), time.Now(), 3, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tag, err := store.AddTag("photo")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(file.Id, tag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	options := Options{Option{"--path", "-p", "", true, dir},
+		Option{"--exclude", "-x", "", true, filepath.Join(dir, "skip")}}
+
+	// test
+
+	for _, queryText := range []string{"untagged", "untagged and ext = jpg", "photo or untagged and type = file"} {
+		if err := FilesCommand.Exec(store, options, []string{queryText}); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, dir+"\n"+dir+"/b.jpg\n"+dir+"/c.txt\n"+
+		dir+"/b.jpg\n"+
+		dir+"/a.jpg\n"+dir+"/b.jpg\n"+dir+"/c.txt\n", string(bytes))
+}
+
+func TestFilesPathsAndExclusions(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	for _, path := range []string{"/tmp/a/1", "/tmp/a/skip/2", "/tmp/b/3", "/tmp/c/4"} {
+		if _, err := store.AddFile(path, fingerprint.Fingerprint("abc"), time.Now(), 123, false); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	options := Options{Option{"--path", "-p", "", true, "/tmp/a"},
+		Option{"--path", "-p", "", true, "/tmp/b"},
+		Option{"--exclude", "-x", "", true, "/tmp/a/skip"}}
+
+	// test
+
+	if err := FilesCommand.Exec(store, options, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/a/1\n/tmp/b/3\n", string(bytes))
+}
+
+func TestFilesTagComparisonThroughImplications(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileC, err := store.AddFile("/tmp/c", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tagYear, err := store.AddTag("year")
+	if err != nil {
+		test.Fatal(err)
+	}
+	tagAlbum, err := store.AddTag("album")
+	if err != nil {
+		test.Fatal(err)
+	}
+	tagRemaster, err := store.AddTag("remaster")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	value1999, err := store.AddValue("1999")
+	if err != nil {
+		test.Fatal(err)
+	}
+	value2005, err := store.AddValue("2005")
+	if err != nil {
+		test.Fatal(err)
+	}
+	value2010, err := store.AddValue("2010")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if err := store.AddImplication(tagAlbum.Id, 0, tagYear.Id, value2005.Id, false); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.AddImplication(tagRemaster.Id, 0, tagYear.Id, 0, true); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(fileA.Id, tagYear.Id, value1999.Id); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(fileB.Id, tagAlbum.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(fileC.Id, tagRemaster.Id, value2010.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{}, []string{"year > 2000"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"year = 2010"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"year < 2000"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{Option{"--explicit", "-e", "", false, ""}}, []string{"year > 2000"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/b\n/tmp/c\n/tmp/c\n/tmp/a\n", string(bytes))
+}
+
+func TestFilesNamespace(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	fileA, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileB, err := store.AddFile("/tmp/b", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileC, err := store.AddFile("/tmp/c", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	fileD, err := store.AddFile("/tmp/d", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tagJazz, err := store.AddTag("music:genre:jazz")
+	if err != nil {
+		test.Fatal(err)
+	}
+	tagRock, err := store.AddTag("music:genre:rock")
+	if err != nil {
+		test.Fatal(err)
+	}
+	tagMusic, err := store.AddTag("music")
+	if err != nil {
+		test.Fatal(err)
+	}
+	tagMusical, err := store.AddTag("musical")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(fileA.Id, tagJazz.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(fileB.Id, tagRock.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(fileC.Id, tagMusic.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(fileD.Id, tagMusical.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := FilesCommand.Exec(store, Options{}, []string{"music:genre"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"music"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"music", "not", "music:genre:rock"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "/tmp/a\n/tmp/b\n/tmp/a\n/tmp/b\n/tmp/c\n/tmp/a\n/tmp/c\n", string(bytes))
+}
@@ -35,6 +35,7 @@ var HelpCommand = Command{
 	Description: `Shows help summary or, where SUBCOMMAND is specified, help for SUBCOMMAND.`,
 	Options:     Options{{"--list", "-l", "list commands", false, ""}},
 	Exec:        helpExec,
+	NoDatabase:  true,
 }
 
 var helpCommands map[string]*Command
@@ -0,0 +1,178 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+var HistoryCommand = Command{
+	Name:     "history",
+	Synopsis: "List the changes made to the database",
+	Usages: []string{"tmsu history [OPTION]...",
+		"tmsu history ID..."},
+	Description: `Lists the operations that have changed the database, oldest first, showing for each when it was run, by which user and with which command line.
+
+If operation IDs are specified then the individual changes made by those operations are listed.
+
+Operations that have been undone are marked as such. See the 'undo' subcommand.`,
+	Examples: []string{"$ tmsu history --count 2\n12 2014-03-01 18:40:12 paul: tmsu tag mountain.jpg holiday (1 change)\n13 2014-03-01 18:41:05 paul: tmsu delete holiday (2 changes)",
+		"$ tmsu history 13\n13 2014-03-01 18:41:05 paul: tmsu delete holiday (2 changes)\n  removed tagging of file #4 with tag #7\n  removed tag #7 'holiday'"},
+	Options:  Options{{"--count", "-n", "list only the last N operations", true, ""}},
+	Exec:     historyExec,
+	ReadOnly: true,
+}
+
+func historyExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) > 0 {
+		return listOperationChanges(store, args)
+	}
+
+	operations, err := store.Operations()
+	if err != nil {
+		return fmt.Errorf("could not retrieve operations: %v", err)
+	}
+
+	if options.HasOption("--count") {
+		count, err := strconv.ParseUint(options.Get("--count").Argument, 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid count '%v'", options.Get("--count").Argument)
+		}
+
+		if uint64(len(operations)) > count {
+			operations = operations[len(operations)-int(count):]
+		}
+	}
+
+	for _, operation := range operations {
+		printOperation(operation)
+	}
+
+	return nil
+}
+
+// unexported
+
+func listOperationChanges(store *storage.Storage, args []string) error {
+	for _, arg := range args {
+		operationId, err := parseOperationId(arg)
+		if err != nil {
+			return err
+		}
+
+		operation, err := store.Operation(operationId)
+		if err != nil {
+			return fmt.Errorf("could not retrieve operation #%v: %v", operationId, err)
+		}
+		if operation == nil {
+			return fmt.Errorf("no such operation #%v", operationId)
+		}
+
+		log.Infof(2, "retrieving changes for operation #%v.", operationId)
+
+		entries, err := store.JournalEntries(operationId)
+		if err != nil {
+			return fmt.Errorf("could not retrieve changes for operation #%v: %v", operationId, err)
+		}
+
+		printOperation(operation)
+
+		for _, entry := range entries {
+			fmt.Printf("  %v\n", describeJournalEntry(entry))
+		}
+	}
+
+	return nil
+}
+
+func printOperation(operation *entities.Operation) {
+	changes := "changes"
+	if operation.ChangeCount == 1 {
+		changes = "change"
+	}
+
+	status := ""
+	if operation.UndoneBy != 0 {
+		status = fmt.Sprintf(", undone by #%v", operation.UndoneBy)
+	}
+
+	fmt.Printf("%v %v %v: %v (%v %v%v)\n", operation.Id, operation.Time.Local().Format("2006-01-02 15:04:05"), operation.User, operation.Command, operation.ChangeCount, changes, status)
+}
+
+func describeJournalEntry(entry *entities.JournalEntry) string {
+	verb := "added"
+	if entry.Action == entities.JournalDelete {
+		verb = "removed"
+	}
+
+	columns := entry.Columns
+
+	var description string
+	switch entry.Table {
+	case "file":
+		description = fmt.Sprintf("file #%v '%v'", columns[0], entities.File{Directory: fmt.Sprint(columns[1]), Name: fmt.Sprint(columns[2])}.Path())
+	case "tag":
+		description = fmt.Sprintf("tag #%v '%v'", columns[0], columns[1])
+	case "value":
+		description = fmt.Sprintf("value #%v '%v'", columns[0], columns[1])
+	case "file_tag":
+		description = fmt.Sprintf("tagging of file #%v with tag #%v", columns[0], columns[1])
+		if fmt.Sprint(columns[2]) != "0" {
+			description += fmt.Sprintf(" and value #%v", columns[2])
+		}
+	case "implication":
+		description = fmt.Sprintf("implication of tag #%v by tag #%v", columns[1], columns[0])
+		if len(columns) == 5 {
+			if fmt.Sprint(columns[2]) != "0" {
+				description += fmt.Sprintf(" with value #%v", columns[2])
+			}
+			if fmt.Sprint(columns[3]) != "0" {
+				description += fmt.Sprintf(" implying value #%v", columns[3])
+			}
+			if fmt.Sprint(columns[4]) == "1" || fmt.Sprint(columns[4]) == "true" {
+				description += " preserving its value"
+			}
+		}
+	case "alias":
+		description = fmt.Sprintf("alias '%v' of tag #%v", columns[0], columns[1])
+	case "tag_property":
+		description = fmt.Sprintf("property '%v' = '%v' of tag #%v", columns[1], columns[2], columns[0])
+	case "query":
+		description = fmt.Sprintf("query '%v'", columns[0])
+	case "setting":
+		description = fmt.Sprintf("setting '%v' = '%v'", columns[0], columns[1])
+	default:
+		description = fmt.Sprintf("%v row", entry.Table)
+	}
+
+	return verb + " " + description
+}
+
+func parseOperationId(text string) (entities.OperationId, error) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(text, "#"), 10, 0)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("invalid operation ID '%v'", text)
+	}
+
+	return entities.OperationId(id), nil
+}
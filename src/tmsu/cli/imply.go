@@ -19,29 +19,39 @@ package cli
 
 import (
 	"fmt"
+	"strings"
 	"tmsu/common/log"
+	"tmsu/entities"
 	"tmsu/storage"
 )
 
 var ImplyCommand = Command{
 	Name:     "imply",
 	Synopsis: "Creates a tag implication",
-	Usages: []string{"tmsu imply [OPTION] TAG IMPL...",
+	Usages: []string{"tmsu imply [OPTION]... TAG[=VALUE] IMPL[=VALUE]...",
 		"tmsu imply --list"},
 	Description: `Creates a tag implication such that whenever TAG is applied, IMPL are automatically applied.
 
+Where a VALUE is specified for TAG the implication applies only to files tagged with that value. Where a VALUE is specified for IMPL the implied tag is applied with that value. With the --preserve option the implied tags instead take the value of TAG, such that, for example, 'composer=bach' implies 'person=bach': these implications are listed with the value '*'.
+
 It is possible that a file may end up with the same tag applied explicitly and by way of a tag implication, making the explicit tag redundant. The decision on whether to keep or remove the redundant explicit tag is with you, but understand that the implied tags are more flexible in that the rules of which tags implies which others can be changed at any time.
 
 The 'tags' subcommand can be used to identify which tags applied to a file are implied.`,
 	Examples: []string{`$ tmsu imply mp3 music`,
-		`$ tmsu imply --list\nmp3 => music`,
+		`$ tmsu imply country=france continent=europe`,
+		`$ tmsu imply camera type=photo`,
+		`$ tmsu imply --preserve composer person`,
+		"$ tmsu imply --list\n  camera => type=photo\ncomposer => person=*\n     mp3 => music",
 		`$ tmsu imply --delete mp3 music`},
 	Options: Options{Option{"--delete", "-d", "deletes the tag implication", false, ""},
-		Option{"--list", "-l", "lists the tag implications", false, ""}},
+		Option{"--list", "-l", "lists the tag implications", false, ""},
+		Option{"--preserve", "-p", "the implied tags take the value of the implying tag", false, ""}},
 	Exec: implyExec,
 }
 
 func implyExec(store *storage.Storage, options Options, args []string) error {
+	preserveValue := options.HasOption("--preserve")
+
 	switch {
 	case options.HasOption("--list"):
 		return listImplications(store)
@@ -50,14 +60,14 @@ func implyExec(store *storage.Storage, options Options, args []string) error {
 			return fmt.Errorf("implying and implied tag must be specified")
 		}
 
-		return deleteImplications(store, args[0], args[1:])
+		return deleteImplications(store, args[0], args[1:], preserveValue)
 	}
 
 	if len(args) < 2 {
 		return fmt.Errorf("implying and implied tags must be specified")
 	}
 
-	return addImplications(store, args[0], args[1:])
+	return addImplications(store, args[0], args[1:], preserveValue)
 }
 
 // unexported
@@ -72,25 +82,26 @@ func listImplications(store *storage.Storage) error {
 
 	width := 0
 	for _, implication := range implications {
-		length := len(implication.ImplyingTag.Name)
+		length := len(implyingName(implication))
 		if length > width {
 			width = length
 		}
 	}
 
 	if len(implications) > 0 {
-		previousImplyingTagName := ""
+		previousImplyingName := ""
 		for _, implication := range implications {
-			if implication.ImplyingTag.Name != previousImplyingTagName {
-				if previousImplyingTagName != "" {
+			name := implyingName(implication)
+			if name != previousImplyingName {
+				if previousImplyingName != "" {
 					fmt.Println()
 				}
 
-				previousImplyingTagName = implication.ImplyingTag.Name
+				previousImplyingName = name
 
-				fmt.Printf("%*v => %v", width, implication.ImplyingTag.Name, implication.ImpliedTag.Name)
+				fmt.Printf("%*v => %v", width, name, impliedName(implication))
 			} else {
-				fmt.Printf(" %v", implication.ImpliedTag.Name)
+				fmt.Printf(" %v", impliedName(implication))
 			}
 		}
 
@@ -100,66 +111,107 @@ func listImplications(store *storage.Storage) error {
 	return nil
 }
 
-func addImplications(store *storage.Storage, tagName string, impliedTagNames []string) error {
-	log.Infof(2, "looking up tag '%v'.", tagName)
+func implyingName(implication *entities.Implication) string {
+	if implication.ImplyingValue.Id == 0 {
+		return implication.ImplyingTag.Name
+	}
 
-	tag, err := store.TagByName(tagName)
+	return implication.ImplyingTag.Name + "=" + implication.ImplyingValue.Name
+}
+
+func impliedName(implication *entities.Implication) string {
+	switch {
+	case implication.PreservesValue:
+		return implication.ImpliedTag.Name + "=*"
+	case implication.ImpliedValue.Id != 0:
+		return implication.ImpliedTag.Name + "=" + implication.ImpliedValue.Name
+	default:
+		return implication.ImpliedTag.Name
+	}
+}
+
+func addImplications(store *storage.Storage, tagArg string, impliedTagArgs []string, preserveValue bool) error {
+	tag, value, err := lookupImplicationTag(store, tagArg, true)
 	if err != nil {
-		return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+		return err
 	}
-	if tag == nil {
-		return fmt.Errorf("no such tag '%v'", tagName)
+
+	for _, impliedTagArg := range impliedTagArgs {
+		impliedTag, impliedValue, err := lookupImplicationTag(store, impliedTagArg, true)
+		if err != nil {
+			return err
+		}
+		if preserveValue && impliedValue.Id != 0 {
+			return fmt.Errorf("'%v': implied tag cannot have a value when preserving the implying tag's value", impliedTagArg)
+		}
+		if impliedTag.Id == tag.Id && (preserveValue || impliedValue.Id == value.Id) {
+			// either name may be an alias of the other
+			return fmt.Errorf("'%v' cannot imply itself", tagArg)
+		}
+
+		log.Infof(2, "adding tag implication of '%v' to '%v'", tagArg, impliedTagArg)
+
+		if err = store.AddImplication(tag.Id, value.Id, impliedTag.Id, impliedValue.Id, preserveValue); err != nil {
+			return fmt.Errorf("could not add tag implication of '%v' to '%v': %v", tagArg, impliedTagArg, err)
+		}
 	}
 
-	for _, impliedTagName := range impliedTagNames {
-		log.Infof(2, "looking up tag '%v'", impliedTagName)
+	return nil
+}
 
-		impliedTag, err := store.TagByName(impliedTagName)
+func deleteImplications(store *storage.Storage, tagArg string, impliedTagArgs []string, preserveValue bool) error {
+	tag, value, err := lookupImplicationTag(store, tagArg, false)
+	if err != nil {
+		return err
+	}
+
+	for _, impliedTagArg := range impliedTagArgs {
+		impliedTag, impliedValue, err := lookupImplicationTag(store, impliedTagArg, false)
 		if err != nil {
-			return fmt.Errorf("could not retrieve tag '%v': %v", impliedTagName, err)
-		}
-		if impliedTag == nil {
-			return fmt.Errorf("no such tag '%v'", impliedTagName)
+			return err
 		}
 
-		log.Infof(2, "adding tag implication of '%v' to '%v'", tagName, impliedTagName)
+		log.Infof(2, "removing tag implication of '%v' to '%v'.", tagArg, impliedTagArg)
 
-		if err = store.AddImplication(tag.Id, impliedTag.Id); err != nil {
-			return fmt.Errorf("could not add tag implication of '%v' to '%v': %v", tagName, impliedTagName, err)
+		if err = store.RemoveImplication(tag.Id, value.Id, impliedTag.Id, impliedValue.Id, preserveValue); err != nil {
+			return fmt.Errorf("could not delete tag implication of '%v' to '%v': %v", tagArg, impliedTagArg, err)
 		}
 	}
 
 	return nil
 }
 
-func deleteImplications(store *storage.Storage, tagName string, impliedTagNames []string) error {
+// Looks up the tag and value of a TAG[=VALUE] argument, creating the value if permitted.
+func lookupImplicationTag(store *storage.Storage, tagArg string, createValue bool) (*entities.Tag, *entities.Value, error) {
+	tagName, valueName := tagArg, ""
+	if index := strings.Index(tagArg, "="); index > 0 {
+		tagName, valueName = tagArg[:index], tagArg[index+1:]
+	}
+
 	log.Infof(2, "looking up tag '%v'.", tagName)
 
 	tag, err := store.TagByName(tagName)
 	if err != nil {
-		return fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+		return nil, nil, fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
 	}
 	if tag == nil {
-		return fmt.Errorf("no such tag '%v'", tagName)
+		return nil, nil, fmt.Errorf("no such tag '%v'", tagName)
 	}
 
-	for _, impliedTagName := range impliedTagNames {
-		log.Infof(2, "looking up tag '%v'.", impliedTagName)
-
-		impliedTag, err := store.TagByName(impliedTagName)
-		if err != nil {
-			return fmt.Errorf("could not retrieve tag '%v': %v", impliedTagName, err)
-		}
-		if impliedTag == nil {
-			return fmt.Errorf("no such tag '%v'", impliedTagName)
+	value, err := store.ValueByName(valueName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not retrieve value '%v': %v", valueName, err)
+	}
+	if value == nil {
+		if !createValue {
+			return nil, nil, fmt.Errorf("no such value '%v'", valueName)
 		}
 
-		log.Infof(2, "removing tag implication of '%v' to '%v'.", tagName, impliedTagName)
-
-		if err = store.RemoveImplication(tag.Id, impliedTag.Id); err != nil {
-			return fmt.Errorf("could not delete tag implication of '%v' to '%v': %v", tagName, impliedTagName, err)
+		value, err = store.AddValue(valueName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not create value '%v': %v", valueName, err)
 		}
 	}
 
-	return nil
+	return tag, value, nil
 }
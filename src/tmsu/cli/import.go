@@ -0,0 +1,448 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"tmsu/common/fingerprint"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+var ImportCommand = Command{
+	Name:     "import",
+	Synopsis: "Import into the database",
+	Usages:   []string{"tmsu import [OPTION]... [FILE]"},
+	Description: `Imports data previously exported by the 'export' subcommand from FILE, or from standard input if FILE is not specified, merging it into the database.
+
+Tags and values are merged with any existing tags and values of the same name. Relative file paths are resolved against the root directory of the database. Files are matched with existing files by path or, failing that, by fingerprint where this identifies exactly one file. Existing settings are retained.
+
+Conflicts, such as a file whose fingerprint differs from that of the existing file at the same path or a setting with a different value, are reported. In each case the existing data is retained.
+
+With the --dry-run option the database is left unchanged and a summary of the changes that would be made is shown.
+
+See the 'export' subcommand for a description of the formats.`,
+	Examples: []string{"$ tmsu import tags.json",
+		"$ tmsu import --dry-run --format=csv <tags.csv"},
+	Options: Options{{"--format", "-f", "the format to use: json or csv", true, ""},
+		{"--dry-run", "-n", "report the changes and conflicts without importing", false, ""}},
+	Exec: importExec,
+}
+
+func importExec(store *storage.Storage, options Options, args []string) error {
+	dryRun := options.HasOption("--dry-run")
+
+	path := ""
+	switch len(args) {
+	case 0:
+	case 1:
+		path = args[0]
+	default:
+		return fmt.Errorf("too many arguments.")
+	}
+
+	format, err := interchangeFormat(options, path)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader = os.Stdin
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("%v: could not open file: %v", path, err)
+		}
+		defer file.Close()
+
+		reader = file
+	}
+
+	log.Infof(2, "reading %v.", format)
+
+	var document *interchangeDocument
+	switch format {
+	case "json":
+		document, err = readJsonDocument(reader)
+	case "csv":
+		document, err = readCsvDocument(reader)
+	}
+	if err != nil {
+		return fmt.Errorf("could not read import: %v", err)
+	}
+
+	summary, err := importDocument(store, document)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		// discard the changes made: an empty transaction is left for the caller to commit
+		if err := store.Rollback(); err != nil {
+			return err
+		}
+		if err := store.Begin(); err != nil {
+			return err
+		}
+
+		summary.print()
+
+		if summary.conflicts > 0 {
+			return errBlank
+		}
+	}
+
+	return nil
+}
+
+// unexported
+
+type importSummary struct {
+	settingsAdded, tagsAdded, aliasesAdded, propertiesAdded, valuesAdded int
+	filesAdded, filesMatchedByPath, filesMatchedByFingerprint            int
+	taggingsAdded, implicationsAdded, queriesAdded, conflicts            int
+}
+
+func (summary importSummary) print() {
+	fmt.Printf("Settings: %v added\n", summary.settingsAdded)
+	fmt.Printf("Tags: %v added\n", summary.tagsAdded)
+	fmt.Printf("Aliases: %v added\n", summary.aliasesAdded)
+	fmt.Printf("Tag properties: %v added\n", summary.propertiesAdded)
+	fmt.Printf("Values: %v added\n", summary.valuesAdded)
+	fmt.Printf("Files: %v added, %v matched by path, %v matched by fingerprint\n", summary.filesAdded, summary.filesMatchedByPath, summary.filesMatchedByFingerprint)
+	fmt.Printf("Taggings: %v added\n", summary.taggingsAdded)
+	fmt.Printf("Implications: %v added\n", summary.implicationsAdded)
+	fmt.Printf("Queries: %v added\n", summary.queriesAdded)
+	fmt.Printf("Conflicts: %v\n", summary.conflicts)
+}
+
+func importDocument(store *storage.Storage, document *interchangeDocument) (*importSummary, error) {
+	summary := &importSummary{}
+	importer := &importer{store, nil, make(map[string]*entities.Tag), make(map[string]*entities.Value), summary}
+
+	log.Info(2, "importing settings.")
+
+	for _, setting := range document.Settings {
+		existing, err := store.Db.Setting(setting.Name)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve setting '%v': %v", setting.Name, err)
+		}
+
+		switch {
+		case existing == nil:
+			if _, err := store.UpdateSetting(setting.Name, setting.Value); err != nil {
+				return nil, fmt.Errorf("could not add setting '%v': %v", setting.Name, err)
+			}
+			summary.settingsAdded++
+		case existing.Value != setting.Value:
+			log.Warnf("conflict: setting '%v' has value '%v' but the import has '%v'.", setting.Name, existing.Value, setting.Value)
+			summary.conflicts++
+		}
+	}
+
+	log.Info(2, "importing tags and values.")
+
+	for _, tagName := range document.Tags {
+		if _, err := importer.tag(tagName); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, valueName := range document.Values {
+		if _, err := importer.value(valueName); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info(2, "importing aliases.")
+
+	for _, alias := range document.Aliases {
+		if err := importer.alias(alias); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info(2, "importing tag properties.")
+
+	for _, property := range document.Properties {
+		if err := importer.property(property); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info(2, "importing files.")
+
+	batch, err := store.NewBatch()
+	if err != nil {
+		return nil, err
+	}
+	importer.batch = batch
+
+	for _, file := range document.Files {
+		if err := importer.file(file); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := batch.Flush(); err != nil {
+		return nil, fmt.Errorf("could not apply tags: %v", err)
+	}
+
+	log.Info(2, "importing implications.")
+
+	for _, imported := range document.Implications {
+		tag, err := importer.tag(imported.Tag)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := importer.value(imported.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		impliedTag, err := importer.tag(imported.Implied)
+		if err != nil {
+			return nil, err
+		}
+
+		impliedValue, err := importer.value(imported.ImpliedValue)
+		if err != nil {
+			return nil, err
+		}
+
+		implications, err := store.Db.ImplicationsForTags(entities.TagIds{tag.Id})
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve implications for tag '%v': %v", tag.Name, err)
+		}
+		if implications.Contains(&entities.Implication{*tag, *value, *impliedTag, *impliedValue, imported.PreservesValue}) {
+			continue
+		}
+
+		if err := store.AddImplication(tag.Id, value.Id, impliedTag.Id, impliedValue.Id, imported.PreservesValue); err != nil {
+			return nil, fmt.Errorf("could not add implication of '%v' by '%v': %v", impliedTag.Name, tag.Name, err)
+		}
+		summary.implicationsAdded++
+	}
+
+	log.Info(2, "importing queries.")
+
+	for _, text := range document.Queries {
+		query, err := store.Query(text)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve query '%v': %v", text, err)
+		}
+		if query != nil {
+			continue
+		}
+
+		if _, err := store.AddQuery(text); err != nil {
+			return nil, fmt.Errorf("could not add query '%v': %v", text, err)
+		}
+		summary.queriesAdded++
+	}
+
+	return summary, nil
+}
+
+// Imports the entities of a document, retrieving each tag and value from the database
+// only once.
+type importer struct {
+	store   *storage.Storage
+	batch   *storage.Batch
+	tags    map[string]*entities.Tag
+	values  map[string]*entities.Value
+	summary *importSummary
+}
+
+func (importer *importer) tag(tagName string) (*entities.Tag, error) {
+	if tag, ok := importer.tags[tagName]; ok {
+		return tag, nil
+	}
+
+	tag, err := importer.store.TagByName(tagName)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
+	}
+	if tag == nil {
+		tag, err = importer.store.AddTag(tagName)
+		if err != nil {
+			return nil, fmt.Errorf("could not add tag '%v': %v", tagName, err)
+		}
+		importer.summary.tagsAdded++
+	}
+
+	importer.tags[tagName] = tag
+
+	return tag, nil
+}
+
+func (importer *importer) alias(imported interchangeAlias) error {
+	tag, err := importer.tag(imported.Tag)
+	if err != nil {
+		return err
+	}
+
+	existingTag, err := importer.store.TagByName(imported.Name)
+	if err != nil {
+		return fmt.Errorf("could not retrieve tag '%v': %v", imported.Name, err)
+	}
+
+	switch {
+	case existingTag == nil:
+		if _, err := importer.store.AddAlias(imported.Name, tag.Id); err != nil {
+			return fmt.Errorf("could not add alias '%v': %v", imported.Name, err)
+		}
+		importer.summary.aliasesAdded++
+	case existingTag.Id != tag.Id:
+		log.Warnf("conflict: '%v' refers to tag '%v' but the import has it as an alias of '%v'.", imported.Name, existingTag.Name, tag.Name)
+		importer.summary.conflicts++
+	}
+
+	return nil
+}
+
+func (importer *importer) property(imported interchangeProperty) error {
+	tag, err := importer.tag(imported.Tag)
+	if err != nil {
+		return err
+	}
+
+	properties, err := importer.store.TagPropertiesByTagId(tag.Id)
+	if err != nil {
+		return fmt.Errorf("could not retrieve properties of tag '%v': %v", tag.Name, err)
+	}
+
+	for _, existing := range properties {
+		if existing.Name != imported.Name {
+			continue
+		}
+
+		if existing.Value != imported.Value {
+			log.Warnf("conflict: tag '%v' has property '%v' of '%v' but the import has '%v'.", tag.Name, imported.Name, existing.Value, imported.Value)
+			importer.summary.conflicts++
+		}
+
+		return nil
+	}
+
+	if _, err := importer.store.SetTagProperty(tag.Id, imported.Name, imported.Value); err != nil {
+		return fmt.Errorf("could not set property '%v' of tag '%v': %v", imported.Name, tag.Name, err)
+	}
+	importer.summary.propertiesAdded++
+
+	return nil
+}
+
+func (importer *importer) value(valueName string) (*entities.Value, error) {
+	if valueName == "" {
+		return &entities.Value{0, ""}, nil
+	}
+
+	if value, ok := importer.values[valueName]; ok {
+		return value, nil
+	}
+
+	value, err := importer.store.ValueByName(valueName)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve value '%v': %v", valueName, err)
+	}
+	if value == nil {
+		value, err = importer.store.AddValue(valueName)
+		if err != nil {
+			return nil, fmt.Errorf("could not add value '%v': %v", valueName, err)
+		}
+		importer.summary.valuesAdded++
+	}
+
+	importer.values[valueName] = value
+
+	return value, nil
+}
+
+func (importer *importer) file(importedFile interchangeFile) error {
+	summary := importer.summary
+	fp := fingerprint.Fingerprint(importedFile.Fingerprint)
+
+	path, err := importer.store.ResolveRootRelativePath(importedFile.Path)
+	if err != nil {
+		return fmt.Errorf("%v: %v", importedFile.Path, err)
+	}
+
+	file, err := importer.batch.FileByPath(path)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+
+	switch {
+	case file != nil:
+		if file.Fingerprint != fp {
+			log.Warnf("conflict: %v: file has fingerprint '%v' but the import has '%v'.", path, file.Fingerprint, fp)
+			summary.conflicts++
+		}
+		summary.filesMatchedByPath++
+	case fp != fingerprint.Fingerprint(""):
+		files, err := importer.store.FilesByFingerprint(fp)
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve files by fingerprint: %v", path, err)
+		}
+		if len(files) == 1 {
+			log.Infof(2, "%v: matched file '%v' by fingerprint.", path, files[0].Path())
+			file = files[0]
+			summary.filesMatchedByFingerprint++
+		} else if len(files) > 1 {
+			log.Warnf("conflict: %v: fingerprint matches %v files so the file will be added.", path, len(files))
+			summary.conflicts++
+		}
+	}
+
+	if file == nil {
+		file, err = importer.batch.AddFile(path, fp, importedFile.ModTime, importedFile.Size, importedFile.IsDir)
+		if err != nil {
+			return fmt.Errorf("%v: could not add file: %v", path, err)
+		}
+		summary.filesAdded++
+	}
+
+	tagIds := make(entities.TagIds, len(importedFile.Tags))
+	valueIds := make(entities.ValueIds, len(importedFile.Tags))
+	for index, tagging := range importedFile.Tags {
+		tag, err := importer.tag(tagging.Tag)
+		if err != nil {
+			return err
+		}
+
+		value, err := importer.value(tagging.Value)
+		if err != nil {
+			return err
+		}
+
+		tagIds[index] = tag.Id
+		valueIds[index] = value.Id
+	}
+
+	count, err := importer.batch.AddFileTags(file, tagIds, valueIds, true)
+	if err != nil {
+		return fmt.Errorf("%v: could not apply tags: %v", path, err)
+	}
+	summary.taggingsAdded += int(count)
+
+	return nil
+}
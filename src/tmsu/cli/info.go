@@ -0,0 +1,59 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"tmsu/storage"
+	"tmsu/storage/database"
+)
+
+var InfoCommand = Command{
+	Name:        "info",
+	Synopsis:    "Show database information",
+	Usages:      []string{"tmsu info"},
+	Description: "Shows the location of the database in use and why it was selected.",
+	Examples:    []string{"$ tmsu info\nDatabase: /home/fred/music/.tmsu/db\nSelected: found by searching upward from the working directory\nRoot: /home/fred/music\nSize: 24576 bytes"},
+	Options:     Options{},
+	Exec:        infoExec,
+	ReadOnly:    true,
+}
+
+func infoExec(store *storage.Storage, options Options, args []string) error {
+	root := store.Root()
+	if root == "" {
+		root = "none (absolute paths)"
+	}
+
+	path, err := filepath.Abs(store.Db.Location())
+	if err != nil {
+		return fmt.Errorf("could not resolve database path: %v", err)
+	}
+
+	fmt.Printf("Database: %v\n", path)
+	fmt.Printf("Selected: %v\n", database.PathReason)
+	fmt.Printf("Root: %v\n", root)
+
+	if info, err := os.Stat(path); err == nil {
+		fmt.Printf("Size: %v bytes\n", info.Size())
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"tmsu/common/log"
+	"tmsu/storage"
+	"tmsu/storage/database"
+)
+
+var InitCommand = Command{
+	Name:     "init",
+	Synopsis: "Initialize a new local database",
+	Usages:   []string{"tmsu init [PATH]"},
+	Description: `Initializes a new local database at .tmsu/db within the directory PATH, or the working directory if PATH is not specified.
+
+TMSU uses the nearest such database found by searching upward from the working directory unless a database is specified by the --database option or the TMSU_DB environment variable.
+
+File paths within the new database are stored relative to PATH so that the directory tree can be moved without breaking the database.`,
+	Examples: []string{"$ tmsu init",
+		"$ tmsu init /mnt/archive"},
+	Options:    Options{},
+	Exec:       initExec,
+	NoDatabase: true,
+}
+
+func initExec(store *storage.Storage, options Options, args []string) error {
+	var dir string
+	switch len(args) {
+	case 0:
+		var err error
+		dir, err = os.Getwd()
+		if err != nil {
+			return fmt.Errorf("could not identify working directory: %v", err)
+		}
+	case 1:
+		dir = args[0]
+	default:
+		return fmt.Errorf("too many arguments.")
+	}
+
+	return initDatabase(filepath.Join(dir, database.DiscoveredPath))
+}
+
+// unexported
+
+func initDatabase(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%v: database already exists.", path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModeDir|0755); err != nil {
+		return fmt.Errorf("%v: could not create directory: %v", filepath.Dir(path), err)
+	}
+
+	log.Infof(2, "%v: creating database.", path)
+
+	localStore, err := storage.OpenAt(path)
+	if err != nil {
+		return err
+	}
+	defer localStore.Close()
+
+	if err := localStore.Begin(); err != nil {
+		return err
+	}
+
+	// the root is the directory containing the .tmsu directory
+	if _, err := localStore.UpdateSetting("root", ".."); err != nil {
+		localStore.Rollback()
+		return fmt.Errorf("could not set root: %v", err)
+	}
+
+	return localStore.Commit()
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"tmsu/storage"
+	"tmsu/storage/database"
+)
+
+func TestInitCreatesDiscoverableDatabase(test *testing.T) {
+	// set-up
+
+	dir := filepath.Join(os.TempDir(), "tmsu_init_test")
+	subDir := filepath.Join(dir, "a", "b")
+	if err := os.MkdirAll(subDir, os.ModeDir|0755); err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// test
+
+	if err := InitCommand.Exec(nil, Options{}, []string{dir}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	path, err := database.FindDatabase(subDir)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if path != filepath.Join(dir, ".tmsu", "db") {
+		test.Fatalf("Expected database to be found at '%v' but was '%v'.", filepath.Join(dir, ".tmsu", "db"), path)
+	}
+
+	store, err := storage.OpenAt(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if store.Root() != dir {
+		test.Fatalf("Expected root '%v' but was '%v'.", dir, store.Root())
+	}
+}
+
+func TestInitRefusesExistingDatabase(test *testing.T) {
+	// set-up
+
+	dir := filepath.Join(os.TempDir(), "tmsu_init_test")
+	if err := os.MkdirAll(dir, os.ModeDir|0755); err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := InitCommand.Exec(nil, Options{}, []string{dir}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	err := InitCommand.Exec(nil, Options{}, []string{dir})
+
+	// validate
+
+	if err == nil {
+		test.Fatal("Existing database was overwritten.")
+	}
+}
@@ -0,0 +1,328 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+// The version of the interchange format written by 'export'.
+const interchangeVersion = 1
+
+// A complete, name-based representation of a database.
+//
+// Database identifiers are not included: tags and values are identified by name and files
+// by path, relative to the root directory where beneath it, so a document can be imported
+// into any database.
+type interchangeDocument struct {
+	Version      uint                     `json:"version"`
+	Settings     []interchangeSetting     `json:"settings"`
+	Tags         []string                 `json:"tags"`
+	Aliases      []interchangeAlias       `json:"aliases"`
+	Properties   []interchangeProperty    `json:"tagProperties"`
+	Values       []string                 `json:"values"`
+	Files        []interchangeFile        `json:"files"`
+	Implications []interchangeImplication `json:"implications"`
+	Queries      []string                 `json:"queries"`
+}
+
+type interchangeSetting struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type interchangeAlias struct {
+	Name string `json:"name"`
+	Tag  string `json:"tag"`
+}
+
+type interchangeProperty struct {
+	Tag   string `json:"tag"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type interchangeFile struct {
+	Path        string               `json:"path"`
+	Fingerprint string               `json:"fingerprint"`
+	ModTime     time.Time            `json:"modTime"`
+	Size        int64                `json:"size"`
+	IsDir       bool                 `json:"isDir"`
+	Tags        []interchangeTagging `json:"tags"`
+}
+
+type interchangeTagging struct {
+	Tag   string `json:"tag"`
+	Value string `json:"value,omitempty"`
+}
+
+type interchangeImplication struct {
+	Tag            string `json:"tag"`
+	Value          string `json:"value,omitempty"`
+	Implied        string `json:"implied"`
+	ImpliedValue   string `json:"impliedValue,omitempty"`
+	PreservesValue bool   `json:"preservesValue,omitempty"`
+}
+
+func buildInterchangeDocument(store *storage.Storage) (*interchangeDocument, error) {
+	document := &interchangeDocument{Version: interchangeVersion}
+
+	settings, err := store.Settings()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve settings: %v", err)
+	}
+	for _, setting := range settings {
+		document.Settings = append(document.Settings, interchangeSetting{setting.Name, setting.Value})
+	}
+
+	tags, err := store.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tags: %v", err)
+	}
+	tagNames := make(map[entities.TagId]string, len(tags))
+	for _, tag := range tags {
+		document.Tags = append(document.Tags, tag.Name)
+		tagNames[tag.Id] = tag.Name
+	}
+
+	aliases, err := store.Aliases()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve aliases: %v", err)
+	}
+	for _, alias := range aliases {
+		document.Aliases = append(document.Aliases, interchangeAlias{alias.Name, alias.Tag.Name})
+	}
+
+	properties, err := store.TagProperties()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tag properties: %v", err)
+	}
+	for _, property := range properties {
+		document.Properties = append(document.Properties, interchangeProperty{tagNames[property.TagId], property.Name, property.Value})
+	}
+
+	values, err := store.Values()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve values: %v", err)
+	}
+	valueNames := make(map[entities.ValueId]string, len(values))
+	for _, value := range values {
+		document.Values = append(document.Values, value.Name)
+		valueNames[value.Id] = value.Name
+	}
+
+	files, err := store.Files()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve files: %v", err)
+	}
+	for _, file := range files {
+		fileTags, err := store.FileTagsByFileId(file.Id, true)
+		if err != nil {
+			return nil, fmt.Errorf("%v: could not retrieve taggings: %v", file.Path(), err)
+		}
+
+		taggings := make([]interchangeTagging, len(fileTags))
+		for index, fileTag := range fileTags {
+			taggings[index] = interchangeTagging{tagNames[fileTag.TagId], valueNames[fileTag.ValueId]}
+		}
+
+		// paths beneath the root are exported relative to it so that they are resolved against
+		// the root of the database imported into
+		path := store.RootRelativePath(file.Path())
+
+		document.Files = append(document.Files, interchangeFile{path, string(file.Fingerprint), file.ModTime, file.Size, file.IsDir, taggings})
+	}
+
+	implications, err := store.Implications()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve implications: %v", err)
+	}
+	for _, implication := range implications {
+		document.Implications = append(document.Implications, interchangeImplication{implication.ImplyingTag.Name,
+			implication.ImplyingValue.Name,
+			implication.ImpliedTag.Name,
+			implication.ImpliedValue.Name,
+			implication.PreservesValue})
+	}
+
+	queries, err := store.Queries()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve queries: %v", err)
+	}
+	for _, query := range queries {
+		document.Queries = append(document.Queries, query.Text)
+	}
+
+	return document, nil
+}
+
+func writeJsonDocument(writer io.Writer, document *interchangeDocument) error {
+	bytes, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(append(bytes, '\n')); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func readJsonDocument(reader io.Reader) (*interchangeDocument, error) {
+	var document interchangeDocument
+	if err := json.NewDecoder(reader).Decode(&document); err != nil {
+		return nil, err
+	}
+
+	if document.Version != interchangeVersion {
+		return nil, fmt.Errorf("unsupported format version %v", document.Version)
+	}
+
+	return &document, nil
+}
+
+// Writes the document as CSV records, the first field of each identifying the record type.
+func writeCsvDocument(writer io.Writer, document *interchangeDocument) error {
+	csvWriter := csv.NewWriter(writer)
+
+	records := [][]string{{"tmsu", strconv.Itoa(interchangeVersion)}}
+
+	for _, setting := range document.Settings {
+		records = append(records, []string{"setting", setting.Name, setting.Value})
+	}
+	for _, tagName := range document.Tags {
+		records = append(records, []string{"tag", tagName})
+	}
+	for _, alias := range document.Aliases {
+		records = append(records, []string{"alias", alias.Name, alias.Tag})
+	}
+	for _, property := range document.Properties {
+		records = append(records, []string{"property", property.Tag, property.Name, property.Value})
+	}
+	for _, valueName := range document.Values {
+		records = append(records, []string{"value", valueName})
+	}
+	for _, file := range document.Files {
+		records = append(records, []string{"file", file.Path, file.Fingerprint, file.ModTime.Format(time.RFC3339Nano), strconv.FormatInt(file.Size, 10), strconv.FormatBool(file.IsDir)})
+
+		for _, tagging := range file.Tags {
+			records = append(records, []string{"filetag", file.Path, tagging.Tag, tagging.Value})
+		}
+	}
+	for _, implication := range document.Implications {
+		record := []string{"implication", implication.Tag, implication.Implied}
+		if implication.Value != "" || implication.ImpliedValue != "" || implication.PreservesValue {
+			record = append(record, implication.Value, implication.ImpliedValue, strconv.FormatBool(implication.PreservesValue))
+		}
+
+		records = append(records, record)
+	}
+	for _, query := range document.Queries {
+		records = append(records, []string{"query", query})
+	}
+
+	if err := csvWriter.WriteAll(records); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func readCsvDocument(reader io.Reader) (*interchangeDocument, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 || len(records[0]) != 2 || records[0][0] != "tmsu" {
+		return nil, fmt.Errorf("missing 'tmsu' header record")
+	}
+	if records[0][1] != strconv.Itoa(interchangeVersion) {
+		return nil, fmt.Errorf("unsupported format version %v", records[0][1])
+	}
+
+	document := &interchangeDocument{Version: interchangeVersion}
+	fileIndices := make(map[string]int)
+
+	for index, record := range records[1:] {
+		line := index + 2
+
+		switch {
+		case record[0] == "setting" && len(record) == 3:
+			document.Settings = append(document.Settings, interchangeSetting{record[1], record[2]})
+		case record[0] == "tag" && len(record) == 2:
+			document.Tags = append(document.Tags, record[1])
+		case record[0] == "alias" && len(record) == 3:
+			document.Aliases = append(document.Aliases, interchangeAlias{record[1], record[2]})
+		case record[0] == "property" && len(record) == 4:
+			document.Properties = append(document.Properties, interchangeProperty{record[1], record[2], record[3]})
+		case record[0] == "value" && len(record) == 2:
+			document.Values = append(document.Values, record[1])
+		case record[0] == "file" && len(record) == 6:
+			modTime, err := time.Parse(time.RFC3339Nano, record[3])
+			if err != nil {
+				return nil, fmt.Errorf("line %v: invalid modification time: %v", line, err)
+			}
+			size, err := strconv.ParseInt(record[4], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %v: invalid size: %v", line, err)
+			}
+			isDir, err := strconv.ParseBool(record[5])
+			if err != nil {
+				return nil, fmt.Errorf("line %v: invalid directory flag: %v", line, err)
+			}
+
+			fileIndices[record[1]] = len(document.Files)
+			document.Files = append(document.Files, interchangeFile{record[1], record[2], modTime, size, isDir, nil})
+		case record[0] == "filetag" && len(record) == 4:
+			fileIndex, found := fileIndices[record[1]]
+			if !found {
+				return nil, fmt.Errorf("line %v: tagging of file '%v' precedes the file", line, record[1])
+			}
+
+			file := &document.Files[fileIndex]
+			file.Tags = append(file.Tags, interchangeTagging{record[2], record[3]})
+		case record[0] == "implication" && len(record) == 3:
+			document.Implications = append(document.Implications, interchangeImplication{record[1], "", record[2], "", false})
+		case record[0] == "implication" && len(record) == 6:
+			preservesValue, err := strconv.ParseBool(record[5])
+			if err != nil {
+				return nil, fmt.Errorf("line %v: invalid value preservation flag: %v", line, err)
+			}
+
+			document.Implications = append(document.Implications, interchangeImplication{record[1], record[3], record[2], record[4], preservesValue})
+		case record[0] == "query" && len(record) == 2:
+			document.Queries = append(document.Queries, record[1])
+		default:
+			return nil, fmt.Errorf("line %v: invalid record", line)
+		}
+	}
+
+	return document, nil
+}
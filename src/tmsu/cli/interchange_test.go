@@ -0,0 +1,279 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/storage"
+	"tmsu/storage/memory"
+)
+
+func TestJsonExportImportRoundTrip(test *testing.T) {
+	testExportImportRoundTrip(test, writeJsonDocument, readJsonDocument)
+}
+
+func TestCsvExportImportRoundTrip(test *testing.T) {
+	testExportImportRoundTrip(test, writeCsvDocument, readCsvDocument)
+}
+
+func TestImportDryRunLeavesDatabaseUnchanged(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false); err != nil {
+		test.Fatal(err)
+	}
+
+	importPath := filepath.Join(os.TempDir(), "tmsu_import_test.csv")
+	defer os.Remove(importPath)
+
+	contents := "tmsu,1\ntag,apple\nfile,/tmp/a,def,2014-01-01T00:00:00Z,123,false\nfiletag,/tmp/a,apple,\n"
+	if err := ioutil.WriteFile(importPath, []byte(contents), 0644); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := store.Begin(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	err = ImportCommand.Exec(store, Options{Option{"--dry-run", "-n", "", false, ""}}, []string{importPath})
+
+	// validate
+
+	if err == nil {
+		test.Fatal("Conflicting fingerprint was not reported.")
+	}
+
+	if err := store.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	tagCount, err := store.TagCount()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if tagCount != 0 {
+		test.Fatalf("Expected no tags after dry run but found %v.", tagCount)
+	}
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, `Settings: 0 added
+Tags: 1 added
+Aliases: 0 added
+Tag properties: 0 added
+Values: 0 added
+Files: 0 added, 1 matched by path, 0 matched by fingerprint
+Taggings: 1 added
+Implications: 0 added
+Queries: 0 added
+Conflicts: 1
+`, string(bytes))
+}
+
+func TestExportImportRelativeToRoot(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	source, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer source.Close()
+
+	if _, err := source.UpdateSetting("root", "/tmp/tmsu_source"); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := source.AddFile("/tmp/tmsu_source/photos/a.jpg", fingerprint.Fingerprint("abc"), time.Now(), 123, false); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := source.AddFile("/tmp/b.jpg", fingerprint.Fingerprint("def"), time.Now(), 123, false); err != nil {
+		test.Fatal(err)
+	}
+
+	dest, err := storage.New(memory.New())
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer dest.Close()
+
+	if _, err := dest.UpdateSetting("root", "/tmp/tmsu_dest"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	document, err := buildInterchangeDocument(source)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := importDocument(dest, document); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if len(document.Files) != 2 || document.Files[0].Path != "/tmp/b.jpg" || document.Files[1].Path != filepath.Join("photos", "a.jpg") {
+		test.Fatalf("Unexpected exported files: %v", document.Files)
+	}
+
+	for _, path := range []string{"/tmp/tmsu_dest/photos/a.jpg", "/tmp/b.jpg"} {
+		file, err := dest.FileByPath(path)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if file == nil {
+			test.Fatalf("File '%v' was not imported.", path)
+		}
+	}
+}
+
+// unexported
+
+func testExportImportRoundTrip(test *testing.T, write func(io.Writer, *interchangeDocument) error, read func(io.Reader) (*interchangeDocument, error)) {
+	// set-up
+
+	sourcePath := filepath.Join(os.TempDir(), "tmsu_export_test.db")
+	defer os.Remove(sourcePath)
+
+	source, err := storage.OpenAt(sourcePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer source.Close()
+
+	file, err := source.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Date(2014, 1, 2, 3, 4, 5, 6, time.UTC), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	appleTag, err := source.AddTag("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+	fruitTag, err := source.AddTag("fruit")
+	if err != nil {
+		test.Fatal(err)
+	}
+	value, err := source.AddValue("green\"crisp\"")
+	if err != nil {
+		test.Fatal(err)
+	}
+	ripeValue, err := source.AddValue("ripe")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := source.AddFileTag(file.Id, appleTag.Id, value.Id); err != nil {
+		test.Fatal(err)
+	}
+	if err := source.AddImplication(appleTag.Id, 0, fruitTag.Id, 0, false); err != nil {
+		test.Fatal(err)
+	}
+	if err := source.AddImplication(appleTag.Id, value.Id, fruitTag.Id, ripeValue.Id, false); err != nil {
+		test.Fatal(err)
+	}
+	if err := source.AddImplication(fruitTag.Id, 0, appleTag.Id, 0, true); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := source.AddAlias("pomme", appleTag.Id); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := source.SetTagProperty(appleTag.Id, "description", "A crisp, \"round\" fruit"); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := source.SetTagProperty(appleTag.Id, "colour", "green"); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := source.AddQuery("apple and fruit"); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := source.UpdateSetting("autoCreateValues", "no"); err != nil {
+		test.Fatal(err)
+	}
+
+	destPath := filepath.Join(os.TempDir(), "tmsu_import_test.db")
+	defer os.Remove(destPath)
+
+	dest, err := storage.OpenAt(destPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer dest.Close()
+
+	// test
+
+	document, err := buildInterchangeDocument(source)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	var buffer bytes.Buffer
+	if err := write(&buffer, document); err != nil {
+		test.Fatal(err)
+	}
+
+	readDocument, err := read(&buffer)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := importDocument(dest, readDocument); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	importedDocument, err := buildInterchangeDocument(dest)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	importedDocument.Files[0].ModTime = importedDocument.Files[0].ModTime.UTC()
+	document.Files[0].ModTime = document.Files[0].ModTime.UTC()
+
+	if !reflect.DeepEqual(document, importedDocument) {
+		test.Fatalf("Imported database differs from the exported one.\nExported: %+v\nImported: %+v", document, importedDocument)
+	}
+}
@@ -24,13 +24,16 @@ import (
 )
 
 var MergeCommand = Command{
-	Name:        "merge",
-	Synopsis:    "Merge tags",
-	Usages:      []string{"tmsu merge TAG... DEST"},
-	Description: `Merges TAGs into tag DEST resulting in a single tag of name DEST.`,
+	Name:     "merge",
+	Synopsis: "Merge tags",
+	Usages:   []string{"tmsu merge [OPTION]... TAG... DEST"},
+	Description: `Merges TAGs into tag DEST resulting in a single tag of name DEST.
+
+With the --alias option each TAG, and any aliases it has, becomes an alias of DEST so that its name continues to refer to the merged tag.`,
 	Examples: []string{`$ tmsu merge cehese cheese`,
-		`$ tmsu merge outdoors outdoor outside`},
-	Options: Options{},
+		`$ tmsu merge outdoors outdoor outside`,
+		`$ tmsu merge --alias photos photo`},
+	Options: Options{Option{"--alias", "-a", "keep the name of each TAG as an alias of DEST", false, ""}},
 	Exec:    mergeExec,
 }
 
@@ -39,6 +42,12 @@ func mergeExec(store *storage.Storage, options Options, args []string) error {
 		return fmt.Errorf("too few arguments")
 	}
 
+	if err := store.AutoBackup(); err != nil {
+		return fmt.Errorf("could not take automatic backup: %v", err)
+	}
+
+	alias := options.HasOption("--alias")
+
 	destTagName := args[len(args)-1]
 	destTag, err := store.TagByName(destTagName)
 	if err != nil {
@@ -65,6 +74,12 @@ func mergeExec(store *storage.Storage, options Options, args []string) error {
 			wereErrors = true
 			continue
 		}
+		if sourceTag.Id == destTag.Id {
+			// either name may be an alias of the other
+			log.Warnf("cannot merge tag '%v' into itself.", sourceTagName)
+			wereErrors = true
+			continue
+		}
 
 		log.Infof(2, "finding files tagged '%v'.", sourceTagName)
 
@@ -82,12 +97,28 @@ func mergeExec(store *storage.Storage, options Options, args []string) error {
 			}
 		}
 
+		if alias {
+			log.Infof(2, "moving the aliases of tag '%v' to tag '%v'.", sourceTag.Name, destTag.Name)
+
+			if err := store.MoveAliases(sourceTag.Id, destTag.Id); err != nil {
+				return fmt.Errorf("could not move aliases of tag '%v': %v", sourceTag.Name, err)
+			}
+		}
+
 		log.Infof(2, "deleting tag '%v'.", sourceTagName)
 
 		err = store.DeleteTag(sourceTag.Id)
 		if err != nil {
 			return fmt.Errorf("could not delete tag '%v': %v", sourceTagName, err)
 		}
+
+		if alias {
+			log.Infof(2, "adding alias '%v' for tag '%v'.", sourceTag.Name, destTag.Name)
+
+			if _, err := store.AddAlias(sourceTag.Name, destTag.Id); err != nil {
+				return fmt.Errorf("could not add alias '%v' for tag '%v': %v", sourceTag.Name, destTag.Name, err)
+			}
+		}
 	}
 
 	if wereErrors {
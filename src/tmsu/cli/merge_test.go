@@ -18,20 +18,15 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package cli
 
 import (
-	"os"
 	"testing"
 	"time"
 	"tmsu/common/fingerprint"
-	"tmsu/storage"
 )
 
 func TestMergeSingleTag(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -116,10 +111,7 @@ func TestMergeSingleTag(test *testing.T) {
 func TestMergeMultipleTags(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -237,10 +229,7 @@ func TestMergeMultipleTags(test *testing.T) {
 func TestMergeNonExistentSourceTag(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -261,10 +250,7 @@ func TestMergeNonExistentSourceTag(test *testing.T) {
 func TestMergeNonExistentDestinationTag(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -285,10 +271,7 @@ func TestMergeNonExistentDestinationTag(test *testing.T) {
 func TestMergeSourceAndDestinationTheSame(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -305,3 +288,104 @@ func TestMergeSourceAndDestinationTheSame(test *testing.T) {
 		test.Fatal("Expected source and destination the same tag to be identified.")
 	}
 }
+
+func TestMergeAliasIntoItsTag(test *testing.T) {
+	// set-up
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	file, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	photoTag, err := store.AddTag("photo")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddAlias("pic", photoTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(file.Id, photoTag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	for _, args := range [][]string{{"pic", "photo"}, {"photo", "pic"}} {
+		if err := MergeCommand.Exec(store, Options{}, args); err == nil {
+			test.Fatalf("Expected merging '%v' into '%v' to be identified as merging a tag into itself.", args[0], args[1])
+		}
+	}
+
+	// validate
+
+	tag, err := store.TagByName("photo")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if tag == nil || tag.Id != photoTag.Id {
+		test.Fatal("Tag 'photo' no longer exists.")
+	}
+
+	expectTags(test, store, file, photoTag)
+}
+
+func TestMergeAsAlias(test *testing.T) {
+	// set-up
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	file, err := store.AddFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	photosTag, err := store.AddTag("photos")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	photoTag, err := store.AddTag("photo")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddAlias("pics", photosTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(file.Id, photosTag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := MergeCommand.Exec(store, Options{Option{"--alias", "-a", "", false, ""}}, []string{"photos", "photo"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	for _, name := range []string{"photos", "pics"} {
+		tag, err := store.TagByName(name)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if tag == nil || tag.Id != photoTag.Id {
+			test.Fatalf("'%v' does not refer to tag 'photo'.", name)
+		}
+	}
+
+	expectTags(test, store, file, photoTag)
+}
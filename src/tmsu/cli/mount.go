@@ -45,12 +45,15 @@ If FILE is not specified but the TMSU_DB environment variable is defined then th
 
 Where neither FILE is specified nor TMSU_DB defined then the default database is mounted.
 
+Hierarchical tags, such as 'music:genre:jazz', are shown as nested directories: the top level of the namespace appears in the tags directory and each further level appears within it prefixed with a colon, e.g. 'tags/music/:genre/:jazz'.
+
 To allow other users access to the mounted filesystem, pass the 'allow_other' FUSE option, e.g. 'tmsu mount --option=allow_other mp'. (FUSE only allows the root user to use this option unless 'user_allow_other' is present in '/etc/fuse.conf'.)`,
 	Examples: []string{"$ tmsu mount mp",
 		"$ tmsu mount /tmp/db mp",
 		"$ tmsu mount --options=allow_other mp"},
-	Options: Options{Option{"--options", "-o", "mount options (passed to fusermount)", true, ""}},
-	Exec:    mountExec,
+	Options:  Options{Option{"--options", "-o", "mount options (passed to fusermount)", true, ""}},
+	Exec:     mountExec,
+	ReadOnly: true,
 }
 
 func mountExec(store *storage.Storage, options Options, args []string) error {
@@ -0,0 +1,96 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"tmsu/common/log"
+	"tmsu/storage"
+)
+
+// Runs a command against several databases at once.
+//
+// Only commands that can merge their results support multiple databases: commands that
+// amend the database are refused as the target database would be ambiguous.
+func runMultiple(commandName string, databasePaths []string, options Options, arguments []string) error {
+	command := findCommand(commands, commandName)
+	if command == nil || command.MultiExec == nil {
+		return fmt.Errorf("the '%v' command requires a single database but %v were specified.", commandName, len(databasePaths))
+	}
+
+	stores := make([]*storage.Storage, 0, len(databasePaths))
+	defer func() {
+		for _, store := range stores {
+			store.Rollback()
+			store.Close()
+		}
+	}()
+
+	for _, databasePath := range databasePaths {
+		if _, err := os.Stat(databasePath); err != nil {
+			return fmt.Errorf("%v: could not open database: %v", databasePath, err)
+		}
+
+		log.Infof(2, "%v: opening database.", databasePath)
+
+		store, err := storage.OpenAt(databasePath)
+		if err != nil {
+			return err
+		}
+
+		if err := store.Begin(); err != nil {
+			store.Close()
+			return fmt.Errorf("%v: could not begin transaction: %v", databasePath, err)
+		}
+
+		stores = append(stores, store)
+	}
+
+	return command.MultiExec(stores, options, arguments)
+}
+
+type labelledEntry struct {
+	label string
+	text  string
+}
+
+// A set of results from several databases, each labelled with the database it is from.
+type labelledEntries []labelledEntry
+
+func (entries labelledEntries) Len() int {
+	return len(entries)
+}
+
+func (entries labelledEntries) Swap(i, j int) {
+	entries[i], entries[j] = entries[j], entries[i]
+}
+
+func (entries labelledEntries) Less(i, j int) bool {
+	if entries[i].text == entries[j].text {
+		return entries[i].label < entries[j].label
+	}
+
+	return entries[i].text < entries[j].text
+}
+
+func (entries labelledEntries) print() {
+	for _, entry := range entries {
+		fmt.Printf("%v: %v\n", entry.label, entry.text)
+	}
+}
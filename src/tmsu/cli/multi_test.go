@@ -0,0 +1,129 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+func TestFilesAcrossDatabases(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	photos := openTaggedDatabase(test, "tmsu_photos_test.db", "/tmp/b/photo", "abc", "holiday")
+	defer closeTestDatabase(photos)
+
+	documents := openTaggedDatabase(test, "tmsu_documents_test.db", "/tmp/a/document", "def", "holiday")
+	defer closeTestDatabase(documents)
+
+	// test
+
+	if err := FilesCommand.MultiExec([]*storage.Storage{photos, documents}, Options{}, []string{"holiday"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, documents.Db.Location()+": /tmp/a/document\n"+photos.Db.Location()+": /tmp/b/photo\n", string(bytes))
+}
+
+func TestDupesAcrossDatabases(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	photos := openTaggedDatabase(test, "tmsu_photos_test.db", "/tmp/b/photo", "abc", "holiday")
+	defer closeTestDatabase(photos)
+
+	backup := openTaggedDatabase(test, "tmsu_backup_test.db", "/tmp/a/photo", "abc", "backup")
+	defer closeTestDatabase(backup)
+
+	// test
+
+	if err := DupesCommand.MultiExec([]*storage.Storage{photos, backup}, Options{}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "Set of 2 duplicates:\n  "+backup.Db.Location()+": /tmp/a/photo\n  "+photos.Db.Location()+": /tmp/b/photo\n", string(bytes))
+}
+
+func TestMutatingCommandRefusesMultipleDatabases(test *testing.T) {
+	// test
+
+	err := runMultiple("tag", []string{"a.db", "b.db"}, Options{}, []string{"/tmp/a", "apple"})
+
+	// validate
+
+	if err == nil {
+		test.Fatal("Mutating command was run against multiple databases.")
+	}
+}
+
+// unexported
+
+func openTaggedDatabase(test *testing.T, name, path, fp, tagName string) *storage.Storage {
+	store, err := storage.OpenAt(filepath.Join(os.TempDir(), name))
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	file, err := store.AddFile(path, fingerprint.Fingerprint(fp), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tag, err := store.AddTag(tagName)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddFileTag(file.Id, tag.Id, entities.ValueId(0)); err != nil {
+		test.Fatal(err)
+	}
+
+	return store
+}
+
+func closeTestDatabase(store *storage.Storage) {
+	store.Close()
+	os.Remove(store.Db.Location())
+}
@@ -18,20 +18,15 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package cli
 
 import (
-	"os"
 	"testing"
 	"time"
 	"tmsu/common/fingerprint"
-	"tmsu/storage"
 )
 
 func TestRenameSuccessful(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -94,10 +89,7 @@ func TestRenameSuccessful(test *testing.T) {
 func TestRenameNonExistentSourceTag(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -117,10 +109,7 @@ func TestRenameNonExistentSourceTag(test *testing.T) {
 func TestRenameInvalidDestTag(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -140,10 +129,7 @@ func TestRenameInvalidDestTag(test *testing.T) {
 func TestRenameDestTagAlreadyExists(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
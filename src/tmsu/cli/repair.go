@@ -201,17 +201,22 @@ func fullRepair(store *storage.Storage, searchPaths []string, limitPath string,
 
 	unmodfied, modified, missing := determineStatuses(dbFiles)
 
+	batch, err := store.NewBatch()
+	if err != nil {
+		return err
+	}
+
 	if recalcUnmodified {
-		if err = repairUnmodified(store, unmodfied, pretend, fingerprintAlgorithm); err != nil {
+		if err = repairUnmodified(batch, unmodfied, pretend, fingerprintAlgorithm); err != nil {
 			return err
 		}
 	}
 
-	if err = repairModified(store, modified, pretend, fingerprintAlgorithm); err != nil {
+	if err = repairModified(batch, modified, pretend, fingerprintAlgorithm); err != nil {
 		return err
 	}
 
-	if err = repairMoved(store, missing, searchPaths, pretend, fingerprintAlgorithm); err != nil {
+	if err = repairMoved(batch, missing, searchPaths, pretend, fingerprintAlgorithm); err != nil {
 		return err
 	}
 
@@ -319,7 +324,7 @@ func determineStatuses(dbFiles entities.Files) (unmodified, modified, missing en
 	return
 }
 
-func repairUnmodified(store *storage.Storage, unmodified entities.Files, pretend bool, fingerprintAlgorithm string) error {
+func repairUnmodified(batch *storage.Batch, unmodified entities.Files, pretend bool, fingerprintAlgorithm string) error {
 	log.Infof(2, "recalculating fingerprints for unmodified files")
 
 	for _, dbFile := range unmodified {
@@ -335,7 +340,7 @@ func repairUnmodified(store *storage.Storage, unmodified entities.Files, pretend
 		}
 
 		if !pretend {
-			_, err := store.UpdateFile(dbFile.Id, dbFile.Path(), fingerprint, stat.ModTime(), stat.Size(), stat.IsDir())
+			_, err := batch.UpdateFile(dbFile.Id, dbFile.Path(), fingerprint, stat.ModTime(), stat.Size(), stat.IsDir())
 			if err != nil {
 				return fmt.Errorf("%v: could not update file in database: %v", dbFile.Path(), err)
 			}
@@ -347,7 +352,7 @@ func repairUnmodified(store *storage.Storage, unmodified entities.Files, pretend
 	return nil
 }
 
-func repairModified(store *storage.Storage, modified entities.Files, pretend bool, fingerprintAlgorithm string) error {
+func repairModified(batch *storage.Batch, modified entities.Files, pretend bool, fingerprintAlgorithm string) error {
 	log.Infof(2, "repairing modified files")
 
 	for _, dbFile := range modified {
@@ -363,7 +368,7 @@ func repairModified(store *storage.Storage, modified entities.Files, pretend boo
 		}
 
 		if !pretend {
-			_, err := store.UpdateFile(dbFile.Id, dbFile.Path(), fingerprint, stat.ModTime(), stat.Size(), stat.IsDir())
+			_, err := batch.UpdateFile(dbFile.Id, dbFile.Path(), fingerprint, stat.ModTime(), stat.Size(), stat.IsDir())
 			if err != nil {
 				return fmt.Errorf("%v: could not update file in database: %v", dbFile.Path(), err)
 			}
@@ -376,7 +381,7 @@ func repairModified(store *storage.Storage, modified entities.Files, pretend boo
 	return nil
 }
 
-func repairMoved(store *storage.Storage, missing entities.Files, searchPaths []string, pretend bool, fingerprintAlgorithm string) error {
+func repairMoved(batch *storage.Batch, missing entities.Files, searchPaths []string, pretend bool, fingerprintAlgorithm string) error {
 	log.Infof(2, "repairing moved files")
 
 	if len(missing) == 0 || len(searchPaths) == 0 {
@@ -396,7 +401,7 @@ func repairMoved(store *storage.Storage, missing entities.Files, searchPaths []s
 		log.Infof(2, "%v: file is of size %v, identified %v files of this size", dbFile.Path(), dbFile.Size, len(pathsOfSize))
 
 		for _, candidatePath := range pathsOfSize {
-			candidateFile, err := store.FileByPath(candidatePath)
+			candidateFile, err := batch.FileByPath(candidatePath)
 			if err != nil {
 				return err
 			}
@@ -417,7 +422,7 @@ func repairMoved(store *storage.Storage, missing entities.Files, searchPaths []s
 
 			if fingerprint == dbFile.Fingerprint {
 				if !pretend {
-					_, err := store.UpdateFile(dbFile.Id, candidatePath, dbFile.Fingerprint, stat.ModTime(), dbFile.Size, dbFile.IsDir)
+					_, err := batch.UpdateFile(dbFile.Id, candidatePath, dbFile.Fingerprint, stat.ModTime(), dbFile.Size, dbFile.IsDir)
 					if err != nil {
 						return fmt.Errorf("%v: could not update file in database: %v", dbFile.Path(), err)
 					}
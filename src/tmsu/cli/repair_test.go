@@ -21,16 +21,12 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
-	"tmsu/storage"
 )
 
 func TestRepairMovedFile(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -74,10 +70,7 @@ func TestRepairMovedFile(test *testing.T) {
 func TestRepairModifiedFile(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -121,16 +114,13 @@ func TestRepairModifiedFile(test *testing.T) {
 func TestReportsMissingFiles(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
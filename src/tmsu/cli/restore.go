@@ -0,0 +1,79 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"tmsu/common/log"
+	"tmsu/storage"
+	"tmsu/storage/database"
+)
+
+var RestoreCommand = Command{
+	Name:     "restore",
+	Synopsis: "Restore the database from a backup",
+	Usages:   []string{"tmsu restore SRC"},
+	Description: `Replaces the contents of the database with the backup SRC.
+
+The backup is checked for corruption and for compatibility with this version of TMSU before anything is changed. A backup taken with an older version of TMSU is upgraded once restored.
+
+If automatic backups are enabled, a snapshot of the database is taken before it is replaced. See the 'autoBackups' setting of the 'config' subcommand.`,
+	Examples:   []string{"$ tmsu restore ~/tmsu-backup.db"},
+	Options:    Options{},
+	Exec:       restoreExec,
+	NoDatabase: true,
+}
+
+func restoreExec(store *storage.Storage, options Options, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("backup to restore must be specified")
+	}
+
+	sourcePath := args[0]
+
+	if len(filepath.SplitList(database.Path)) > 1 {
+		return fmt.Errorf("a single database must be specified")
+	}
+
+	// the database is restored outside of a transaction as the backup must lock it exclusively
+	store, err := storage.Open()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	version, err := database.VerifyDatabase(sourcePath)
+	if err != nil {
+		return fmt.Errorf("%v: cannot restore: %v", sourcePath, err)
+	}
+
+	log.Infof(2, "%v: backup has schema version %v.", sourcePath, version)
+
+	if err := store.AutoBackup(); err != nil {
+		return fmt.Errorf("could not take automatic backup: %v", err)
+	}
+
+	if err := store.Db.Restore(sourcePath); err != nil {
+		return err
+	}
+
+	log.Infof(2, "restored database from '%v'.", sourcePath)
+
+	return nil
+}
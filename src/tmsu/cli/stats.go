@@ -30,6 +30,7 @@ var StatsCommand = Command{
 	Description: "Shows the database statistics.",
 	Options:     Options{Option{"--usage", "-u", "show tag usage breakdown", false, ""}},
 	Exec:        statsExec,
+	ReadOnly:    true,
 }
 
 func statsExec(store *storage.Storage, options Options, args []string) error {
@@ -47,8 +47,9 @@ Note: The 'repair' subcommand can be used to fix problems caused by files that h
 	Examples: []string{"$ tmsu status",
 		"$ tmsu status .",
 		"$ tmsu status --directory *"},
-	Options: Options{Option{"--directory", "-d", "do not examine directory contents (non-recursive)", false, ""}},
-	Exec:    statusExec,
+	Options:  Options{Option{"--directory", "-d", "do not examine directory contents (non-recursive)", false, ""}},
+	Exec:     statusExec,
+	ReadOnly: true,
 }
 
 type Status byte
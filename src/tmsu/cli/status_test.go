@@ -21,16 +21,12 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
-	"tmsu/storage"
 )
 
 func TestStatusReport(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -38,7 +38,9 @@ var TagCommand = Command{
 		"tmsu tag [OPTION]... --create TAG[=VALUE]..."},
 	Description: `Tags the file FILE with the TAGs specified. If no TAG is specified then all tags are listed.
 
-Tag names may consist of one or more letter, number, punctuation and symbol characters (from the corresponding Unicode categories). Tag names may not contain whitespace characters, the comparison operator symbols ('=', '<' and '>"), parentheses ('(' and ')'), commas (',') or the slash symbol ('/'). In addition, the tag names '.' and '..' are not valid.
+Tag names may consist of one or more letter, number, punctuation and symbol characters (from the corresponding Unicode categories). Tag names may not contain whitespace characters, the comparison operator symbols ('=', '<', '>' and '~'), parentheses ('(' and ')'), commas (',') or the slash symbol ('/'). In addition, the tag names '.' and '..' are not valid.
+
+Tags may be organised into a hierarchy of namespaces by separating the levels of the name with a colon, e.g. 'music:genre:jazz'. A query for a tag or namespace also matches the tags beneath it, so 'music:genre' matches files tagged 'music:genre:jazz'. Tag names may not start or end with a colon nor contain an empty level ('::').
 
 Optionally tags applied to files may be attributed with a VALUE using the TAG=VALUE syntax.`,
 	Examples: []string{"$ tmsu tag mountain1.jpg photo landscape holiday good country=france",
@@ -159,6 +161,46 @@ func tagPaths(store *storage.Storage, tagArgs, paths []string, explicit, recursi
 		return err
 	}
 
+	tagValuePairs, wereErrors, err := lookupTagValuePairs(store, tagArgs, autoCreateTags, autoCreateValues)
+	if err != nil {
+		return err
+	}
+
+	batch, err := store.NewBatch()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if err := tagPath(batch, path, tagValuePairs, explicit, recursive, fingerprintAlgorithm); err != nil {
+			switch {
+			case os.IsPermission(err):
+				log.Warnf("%v: permisison denied", path)
+				wereErrors = true
+			case os.IsNotExist(err):
+				log.Warnf("%v: no such file", path)
+				wereErrors = true
+			default:
+				return fmt.Errorf("%v: could not stat file: %v", path, err)
+			}
+		}
+	}
+
+	if err := batch.Flush(); err != nil {
+		return fmt.Errorf("could not apply tags: %v", err)
+	}
+
+	if wereErrors {
+		return errBlank
+	}
+
+	return nil
+}
+
+// Looks up the tags and values of TAG[=VALUE] arguments, creating them if permitted.
+//
+// Missing tags and values that cannot be created are reported and skipped.
+func lookupTagValuePairs(store *storage.Storage, tagArgs []string, autoCreateTags, autoCreateValues bool) ([]TagValuePair, bool, error) {
 	wereErrors := false
 	tagValuePairs := make([]TagValuePair, 0, 10)
 	for _, tagArg := range tagArgs {
@@ -175,13 +217,13 @@ func tagPaths(store *storage.Storage, tagArgs, paths []string, explicit, recursi
 
 		tag, err := getTag(store, tagName)
 		if err != nil {
-			return err
+			return nil, false, err
 		}
 		if tag == nil {
 			if autoCreateTags {
 				tag, err = createTag(store, tagName)
 				if err != nil {
-					return err
+					return nil, false, err
 				}
 			} else {
 				log.Warnf("no such tag '%v'.", tagName)
@@ -190,15 +232,21 @@ func tagPaths(store *storage.Storage, tagArgs, paths []string, explicit, recursi
 			}
 		}
 
+		if err := store.ValidateTagValue(tag.Id, valueName); err != nil {
+			log.Warnf("invalid value for tag '%v': %v.", tagName, err)
+			wereErrors = true
+			continue
+		}
+
 		value, err := getValue(store, valueName)
 		if err != nil {
-			return err
+			return nil, false, err
 		}
 		if value == nil {
 			if autoCreateValues {
 				value, err = createValue(store, valueName)
 				if err != nil {
-					return err
+					return nil, false, err
 				}
 			} else {
 				log.Warnf("no such value '%v'.", valueName)
@@ -210,26 +258,7 @@ func tagPaths(store *storage.Storage, tagArgs, paths []string, explicit, recursi
 		tagValuePairs = append(tagValuePairs, TagValuePair{tag.Id, value.Id})
 	}
 
-	for _, path := range paths {
-		if err := tagPath(store, path, tagValuePairs, explicit, recursive, fingerprintAlgorithm); err != nil {
-			switch {
-			case os.IsPermission(err):
-				log.Warnf("%v: permisison denied", path)
-				wereErrors = true
-			case os.IsNotExist(err):
-				log.Warnf("%v: no such file", path)
-				wereErrors = true
-			default:
-				return fmt.Errorf("%v: could not stat file: %v", path, err)
-			}
-		}
-	}
-
-	if wereErrors {
-		return errBlank
-	}
-
-	return nil
+	return tagValuePairs, wereErrors, nil
 }
 
 func tagFrom(store *storage.Storage, fromPath string, paths []string, explicit, recursive bool) error {
@@ -256,9 +285,14 @@ func tagFrom(store *storage.Storage, fromPath string, paths []string, explicit,
 		tagValuePairs[index] = TagValuePair{fileTag.TagId, fileTag.ValueId}
 	}
 
+	batch, err := store.NewBatch()
+	if err != nil {
+		return err
+	}
+
 	wereErrors := false
 	for _, path := range paths {
-		if err := tagPath(store, path, tagValuePairs, explicit, recursive, fingerprintAlgorithmSetting.Value); err != nil {
+		if err := tagPath(batch, path, tagValuePairs, explicit, recursive, fingerprintAlgorithmSetting.Value); err != nil {
 			switch {
 			case os.IsPermission(err):
 				log.Warnf("%v: permisison denied", path)
@@ -272,6 +306,10 @@ func tagFrom(store *storage.Storage, fromPath string, paths []string, explicit,
 		}
 	}
 
+	if err := batch.Flush(); err != nil {
+		return fmt.Errorf("could not apply tags: %v", err)
+	}
+
 	if wereErrors {
 		return errBlank
 	}
@@ -279,7 +317,7 @@ func tagFrom(store *storage.Storage, fromPath string, paths []string, explicit,
 	return nil
 }
 
-func tagPath(store *storage.Storage, path string, tagValuePairs []TagValuePair, explicit, recursive bool, fingerprintAlgorithm string) error {
+func tagPath(batch *storage.Batch, path string, tagValuePairs []TagValuePair, explicit, recursive bool, fingerprintAlgorithm string) error {
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return fmt.Errorf("%v: could not get absolute path: %v", path, err)
@@ -301,34 +339,32 @@ func tagPath(store *storage.Storage, path string, tagValuePairs []TagValuePair,
 
 	log.Infof(2, "%v: checking if file exists", path)
 
-	file, err := store.FileByPath(absPath)
+	file, err := batch.FileByPath(absPath)
 	if err != nil {
 		return fmt.Errorf("%v: could not retrieve file: %v", path, err)
 	}
 	if file == nil {
-		file, err = addFile(store, absPath, stat.ModTime(), uint(stat.Size()), stat.IsDir(), fingerprintAlgorithm)
+		file, err = addFile(batch, absPath, stat.ModTime(), uint(stat.Size()), stat.IsDir(), fingerprintAlgorithm)
 		if err != nil {
 			return fmt.Errorf("%v: could not add file: %v", path, err)
 		}
 	}
 
-	if !explicit {
-		tagValuePairs, err = removeAlreadyAppliedTagValuePairs(store, tagValuePairs, file)
-		if err != nil {
-			return fmt.Errorf("%v: could not remove applied tags: %v", path, err)
-		}
-	}
-
 	log.Infof(2, "%v: applying tags.", path)
 
-	for _, tagValuePair := range tagValuePairs {
-		if _, err = store.AddFileTag(file.Id, tagValuePair.TagId, tagValuePair.ValueId); err != nil {
-			return fmt.Errorf("%v: could not apply tags: %v", file.Path(), err)
-		}
+	tagIds := make(entities.TagIds, len(tagValuePairs))
+	valueIds := make(entities.ValueIds, len(tagValuePairs))
+	for index, tagValuePair := range tagValuePairs {
+		tagIds[index] = tagValuePair.TagId
+		valueIds[index] = tagValuePair.ValueId
+	}
+
+	if _, err := batch.AddFileTags(file, tagIds, valueIds, explicit); err != nil {
+		return fmt.Errorf("%v: could not apply tags: %v", file.Path(), err)
 	}
 
 	if recursive && stat.IsDir() {
-		if err = tagRecursively(store, path, tagValuePairs, explicit, fingerprintAlgorithm); err != nil {
+		if err = tagRecursively(batch, path, tagValuePairs, explicit, fingerprintAlgorithm); err != nil {
 			return err
 		}
 	}
@@ -336,7 +372,7 @@ func tagPath(store *storage.Storage, path string, tagValuePairs []TagValuePair,
 	return nil
 }
 
-func tagRecursively(store *storage.Storage, path string, tagValuePairs []TagValuePair, explicit bool, fingerprintAlgorithm string) error {
+func tagRecursively(batch *storage.Batch, path string, tagValuePairs []TagValuePair, explicit bool, fingerprintAlgorithm string) error {
 	osFile, err := os.Open(path)
 	if err != nil {
 		return fmt.Errorf("%v: could not open path: %v", path, err)
@@ -351,7 +387,7 @@ func tagRecursively(store *storage.Storage, path string, tagValuePairs []TagValu
 	for _, childName := range childNames {
 		childPath := filepath.Join(path, childName)
 
-		if err = tagPath(store, childPath, tagValuePairs, explicit, true, fingerprintAlgorithm); err != nil {
+		if err = tagPath(batch, childPath, tagValuePairs, explicit, true, fingerprintAlgorithm); err != nil {
 			return err
 		}
 	}
@@ -399,7 +435,7 @@ func createValue(store *storage.Storage, valueName string) (*entities.Value, err
 	return value, nil
 }
 
-func addFile(store *storage.Storage, path string, modTime time.Time, size uint, isDir bool, fingerprintAlgorithm string) (*entities.File, error) {
+func addFile(batch *storage.Batch, path string, modTime time.Time, size uint, isDir bool, fingerprintAlgorithm string) (*entities.File, error) {
 	log.Infof(2, "%v: creating fingerprint", path)
 
 	fingerprint, err := fingerprint.Create(path, fingerprintAlgorithm)
@@ -409,48 +445,10 @@ func addFile(store *storage.Storage, path string, modTime time.Time, size uint,
 
 	log.Infof(2, "%v: adding file.", path)
 
-	file, err := store.AddFile(path, fingerprint, modTime, int64(size), isDir)
+	file, err := batch.AddFile(path, fingerprint, modTime, int64(size), isDir)
 	if err != nil {
 		return nil, fmt.Errorf("%v: could not add file to database: %v", path, err)
 	}
 
 	return file, nil
 }
-
-func removeAlreadyAppliedTagValuePairs(store *storage.Storage, tagValuePairs []TagValuePair, file *entities.File) ([]TagValuePair, error) {
-	log.Infof(2, "%v: determining existing file-tags", file.Path())
-
-	existingFileTags, err := store.FileTagsByFileId(file.Id, false)
-	if err != nil {
-		return nil, fmt.Errorf("%v: could not determine file's tags: %v", file.Path(), err)
-	}
-
-	log.Infof(2, "%v: determining implied tags", file.Path())
-
-	tagIds := make(entities.TagIds, len(tagValuePairs))
-	for index, tagValuePair := range tagValuePairs {
-		tagIds[index] = tagValuePair.TagId
-	}
-
-	newlyImpliedTags, err := store.ImplicationsForTags(tagIds...)
-	if err != nil {
-		return nil, fmt.Errorf("%v: could not determine implied tags: %v", file.Path(), err)
-	}
-
-	log.Infof(2, "%v: revising set of tags to apply", file.Path())
-
-	revisedTagValuePairs := make([]TagValuePair, 0, len(tagValuePairs))
-	for _, tagValuePair := range tagValuePairs {
-		if existingFileTags.Contains(tagValuePair.TagId, tagValuePair.ValueId) {
-			continue
-		}
-
-		if tagValuePair.ValueId == 0 && newlyImpliedTags.Implies(tagValuePair.TagId) {
-			continue
-		}
-
-		revisedTagValuePairs = append(revisedTagValuePairs, tagValuePair)
-	}
-
-	return revisedTagValuePairs, nil
-}
@@ -20,16 +20,12 @@ package cli
 import (
 	"os"
 	"testing"
-	"tmsu/storage"
 )
 
 func TestSingleTag(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -88,10 +84,7 @@ func TestSingleTag(test *testing.T) {
 func TestMultipleTags(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -168,10 +161,7 @@ func TestMultipleTags(test *testing.T) {
 func TestTagMultipleFiles(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -258,3 +248,53 @@ func TestTagMultipleFiles(test *testing.T) {
 }
 
 //TODO recursive
+
+func TestTagRejectsValueOfWrongType(test *testing.T) {
+	// set-up
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	yearTag, err := store.AddTag("year")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.SetTagProperty(yearTag.Id, "type", "integer"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "year=last"}); err == nil {
+		test.Fatal("Expected an error for a value that is not an integer.")
+	}
+
+	// validate
+
+	fileTags, err := store.FileTags()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(fileTags) != 0 {
+		test.Fatalf("Expected no file-tags but are %v", len(fileTags))
+	}
+
+	if _, err := store.SetTagProperty(yearTag.Id, "type", "date"); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "year=2014-03-09"}); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.SetTagProperty(yearTag.Id, "type", "integer"); err == nil {
+		test.Fatal("Expected an error changing the type when existing values do not conform.")
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"tmsu/common/log"
 	"tmsu/common/terminal"
 	"tmsu/common/terminal/ansi"
@@ -41,38 +42,42 @@ When color is turned on, tags are shown in the following colors:
   $CYANCyan$RESET    Tag implied by other tags
   $YELLOWYellow$RESET  Tag is both explicitly applied and implied by other tags
 
-See the 'imply' subcommand for more information on implied tags.`,
+An explicitly applied tag that has been given a colour using the 'describe' subcommand is shown in that colour instead.
+
+See the 'imply' subcommand for more information on implied tags.
+
+Tag names may be arranged into a hierarchy of namespaces by separating the levels with a colon, e.g. 'music:genre:jazz'. The --tree option lists all of the tags in the database as an indented tree of these namespaces.`,
 	Examples: []string{"$ tmsu tags\nmp3  music  opera",
 		"$ tmsu tags tralala.mp3\nmp3  music  opera",
 		"$ tmsu tags tralala.mp3 boom.mp3\n./tralala.mp3: mp3 music opera\n./boom.mp3: mp3 music drum-n-bass",
-		"$ tmsu tags --count tralala.mp3"},
+		"$ tmsu tags --count tralala.mp3",
+		"$ tmsu tags --tree\nmusic\n  genre\n    jazz\n    rock\nphoto"},
 	Options: Options{{"--count", "-c", "lists the number of tags rather than their names", false, ""},
 		{"", "-1", "list one tag per line", false, ""},
-		{"--explicit", "-e", "do not show implied tags", false, ""}},
-	Exec: tagsExec,
+		{"--explicit", "-e", "do not show implied tags", false, ""},
+		{"--tree", "-t", "list all tags as a tree of namespaces", false, ""}},
+	Exec:      tagsExec,
+	MultiExec: tagsMultiExec,
+	ReadOnly:  true,
 }
 
 func tagsExec(store *storage.Storage, options Options, args []string) error {
 	showCount := options.HasOption("--count")
 	onePerLine := options.HasOption("-1")
 	explicitOnly := options.HasOption("--explicit")
+	tree := options.HasOption("--tree")
 
-	var colour bool
-	if options.HasOption("--color") {
-		when := options.Get("--color").Argument
-		switch when {
-		case "auto":
-			colour = terminal.Colour() && terminal.Width() > 0
-		case "":
-		case "always":
-			colour = true
-		case "never":
-			colour = false
-		default:
-			return fmt.Errorf("invalid argument '%v' for '--color'", when)
+	colour, err := colourOption(options)
+	if err != nil {
+		return err
+	}
+
+	if tree {
+		if len(args) > 0 {
+			return fmt.Errorf("the --tree option cannot be used with FILE arguments")
 		}
-	} else {
-		colour = terminal.Colour() && terminal.Width() > 0
+
+		return listTagTree(store)
 	}
 
 	if len(args) == 0 {
@@ -82,6 +87,40 @@ func tagsExec(store *storage.Storage, options Options, args []string) error {
 	return listTagsForPaths(store, args, showCount, onePerLine, explicitOnly, colour)
 }
 
+func tagsMultiExec(stores []*storage.Storage, options Options, args []string) error {
+	showCount := options.HasOption("--count")
+	explicitOnly := options.HasOption("--explicit")
+
+	colour, err := colourOption(options)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return listAllTagsMulti(stores, showCount)
+	}
+
+	return listTagsForPathsMulti(stores, args, showCount, explicitOnly, colour)
+}
+
+func colourOption(options Options) (bool, error) {
+	if !options.HasOption("--color") {
+		return terminal.Colour() && terminal.Width() > 0, nil
+	}
+
+	when := options.Get("--color").Argument
+	switch when {
+	case "auto":
+		return terminal.Colour() && terminal.Width() > 0, nil
+	case "", "never":
+		return false, nil
+	case "always":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid argument '%v' for '--color'", when)
+	}
+}
+
 func listAllTags(store *storage.Storage, showCount, onePerLine, colour bool) error {
 	log.Info(2, "retrieving all tags.")
 
@@ -98,9 +137,17 @@ func listAllTags(store *storage.Storage, showCount, onePerLine, colour bool) err
 			return fmt.Errorf("could not retrieve tags: %v", err)
 		}
 
+		var colours tagColours
+		if colour {
+			colours, err = retrieveTagColours(store)
+			if err != nil {
+				return err
+			}
+		}
+
 		tagNames := make([]string, len(tags))
 		for index, tag := range tags {
-			tagNames[index] = tag.Name
+			tagNames[index] = colours.apply(tag.Name, tag.Name)
 		}
 
 		if onePerLine {
@@ -115,13 +162,61 @@ func listAllTags(store *storage.Storage, showCount, onePerLine, colour bool) err
 	return nil
 }
 
-func listTagsForPaths(store *storage.Storage, paths []string, showCount, onePerLine, explicitOnly, colour bool) error {
-	store, err := storage.Open()
+func listTagTree(store *storage.Storage) error {
+	log.Info(2, "retrieving all tags.")
+
+	tags, err := store.Tags()
 	if err != nil {
-		return fmt.Errorf("could not open storage: %v", err)
+		return fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	tagLevels := make([][]string, len(tags))
+	for index, tag := range tags {
+		tagLevels[index] = entities.TagNameLevels(tag.Name)
+	}
+
+	sort.Sort(tagLevelsByName(tagLevels))
+
+	var previous []string
+	for _, levels := range tagLevels {
+		common := 0
+		for common < len(previous) && common < len(levels) && previous[common] == levels[common] {
+			common++
+		}
+
+		for depth := common; depth < len(levels); depth++ {
+			fmt.Println(strings.Repeat("  ", depth) + levels[depth])
+		}
+
+		previous = levels
+	}
+
+	return nil
+}
+
+type tagLevelsByName [][]string
+
+func (names tagLevelsByName) Len() int {
+	return len(names)
+}
+
+func (names tagLevelsByName) Swap(i, j int) {
+	names[i], names[j] = names[j], names[i]
+}
+
+func (names tagLevelsByName) Less(i, j int) bool {
+	a, b := names[i], names[j]
+
+	for index := 0; index < len(a) && index < len(b); index++ {
+		if a[index] != b[index] {
+			return a[index] < b[index]
+		}
 	}
-	defer store.Close()
 
+	return len(a) < len(b)
+}
+
+func listTagsForPaths(store *storage.Storage, paths []string, showCount, onePerLine, explicitOnly, colour bool) error {
 	wereErrors := false
 	printPath := len(paths) > 1 || terminal.Width() == 0
 
@@ -199,6 +294,95 @@ func listTagsForPaths(store *storage.Storage, paths []string, showCount, onePerL
 	return nil
 }
 
+func listAllTagsMulti(stores []*storage.Storage, showCount bool) error {
+	entries := make(labelledEntries, 0, 100)
+
+	for _, store := range stores {
+		log.Infof(2, "%v: retrieving all tags.", store.Db.Location())
+
+		if showCount {
+			count, err := store.TagCount()
+			if err != nil {
+				return fmt.Errorf("%v: could not retrieve tag count: %v", store.Db.Location(), err)
+			}
+
+			entries = append(entries, labelledEntry{store.Db.Location(), strconv.Itoa(int(count))})
+			continue
+		}
+
+		tags, err := store.Tags()
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve tags: %v", store.Db.Location(), err)
+		}
+
+		for _, tag := range tags {
+			entries = append(entries, labelledEntry{store.Db.Location(), tag.Name})
+		}
+	}
+
+	if !showCount {
+		sort.Sort(entries)
+	}
+
+	entries.print()
+
+	return nil
+}
+
+func listTagsForPathsMulti(stores []*storage.Storage, paths []string, showCount, explicitOnly, colour bool) error {
+	wereErrors := false
+	for _, path := range paths {
+		entries := make(labelledEntries, 0, len(stores))
+
+		for _, store := range stores {
+			log.Infof(2, "%v: %v: retrieving tags.", store.Db.Location(), path)
+
+			file, err := store.FileByPath(path)
+			if err != nil {
+				return fmt.Errorf("%v: %v: could not retrieve file: %v", store.Db.Location(), path, err)
+			}
+			if file == nil {
+				continue
+			}
+
+			tagNames, err := tagNamesForFile(store, file.Id, explicitOnly, colour)
+			if err != nil {
+				return err
+			}
+
+			if showCount {
+				entries = append(entries, labelledEntry{store.Db.Location(), path + ": " + strconv.Itoa(len(tagNames))})
+			} else {
+				entries = append(entries, labelledEntry{store.Db.Location(), path + ": " + strings.Join(tagNames, " ")})
+			}
+		}
+
+		if len(entries) == 0 {
+			if _, err := os.Stat(path); err != nil {
+				switch {
+				case os.IsPermission(err):
+					log.Warnf("%v: permission denied", path)
+				case os.IsNotExist(err):
+					log.Warnf("%v: no such file", path)
+				default:
+					return fmt.Errorf("%v: could not stat file: %v", path, err)
+				}
+
+				wereErrors = true
+				continue
+			}
+		}
+
+		entries.print()
+	}
+
+	if wereErrors {
+		return errBlank
+	}
+
+	return nil
+}
+
 func listTagsForWorkingDirectory(store *storage.Storage, showCount, onePerLine, explicitOnly, colour bool) error {
 	file, err := os.Open(".")
 	if err != nil {
@@ -257,6 +441,14 @@ func tagNamesForFile(store *storage.Storage, fileId entities.FileId, explicitOnl
 		return nil, fmt.Errorf("could not retrieve file-tags for file '%v': %v", fileId, err)
 	}
 
+	var colours tagColours
+	if colour {
+		colours, err = retrieveTagColours(store)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	tagNames := make([]string, len(fileTags))
 
 	for index, fileTag := range fileTags {
@@ -290,6 +482,8 @@ func tagNamesForFile(store *storage.Storage, fileId entities.FileId, explicitOnl
 				} else {
 					tagName = ansi.Cyan(tagName)
 				}
+			} else {
+				tagName = colours.apply(tag.Name, tagName)
 			}
 		}
 
@@ -19,26 +19,22 @@ package cli
 
 import (
 	"io/ioutil"
-	"os"
 	"testing"
 	"time"
 	"tmsu/common/fingerprint"
-	"tmsu/storage"
+	"tmsu/entities"
 )
 
 func TestTagsForSingleFile(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -86,16 +82,13 @@ func TestTagsForSingleFile(test *testing.T) {
 func TestTagsForMultipleFiles(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -153,16 +146,13 @@ func TestTagsForMultipleFiles(test *testing.T) {
 func TestAllTags(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -195,16 +185,13 @@ func TestAllTags(test *testing.T) {
 func TestImpliedTags(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -230,11 +217,11 @@ func TestImpliedTags(test *testing.T) {
 		test.Fatal(err)
 	}
 
-	if err := store.AddImplication(appleTag.Id, fruitTag.Id); err != nil {
+	if err := store.AddImplication(appleTag.Id, 0, fruitTag.Id, 0, false); err != nil {
 		test.Fatal(err)
 	}
 
-	if err := store.AddImplication(fruitTag.Id, foodTag.Id); err != nil {
+	if err := store.AddImplication(fruitTag.Id, 0, foodTag.Id, 0, false); err != nil {
 		test.Fatal(err)
 	}
 
@@ -256,3 +243,177 @@ func TestImpliedTags(test *testing.T) {
 	bytes, err := ioutil.ReadAll(outFile)
 	compareOutput(test, "/tmp/tmsu/a: apple food fruit\n", string(bytes))
 }
+
+func TestImpliedValues(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	fileA, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("123"), time.Now(), 0, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileB, err := store.AddFile("/tmp/tmsu/b", fingerprint.Fingerprint("456"), time.Now(), 0, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tags := make(map[string]*entities.Tag)
+	for _, tagName := range []string{"camera", "composer", "continent", "country", "person", "type"} {
+		tag, err := store.AddTag(tagName)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		tags[tagName] = tag
+	}
+
+	values := make(map[string]*entities.Value)
+	for _, valueName := range []string{"bach", "france", "spain"} {
+		value, err := store.AddValue(valueName)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		values[valueName] = value
+	}
+
+	if err := ImplyCommand.Exec(store, Options{}, []string{"country=france", "continent=europe"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := ImplyCommand.Exec(store, Options{}, []string{"camera", "type=photo"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := ImplyCommand.Exec(store, Options{Option{"--preserve", "-p", "", false, ""}}, []string{"composer", "person"}); err != nil {
+		test.Fatal(err)
+	}
+
+	fileTags := []struct {
+		file  *entities.File
+		tag   *entities.Tag
+		value *entities.Value
+	}{
+		{fileA, tags["composer"], values["bach"]},
+		{fileA, tags["country"], values["france"]},
+		{fileB, tags["camera"], &entities.Value{}},
+		{fileB, tags["country"], values["spain"]},
+	}
+	for _, fileTag := range fileTags {
+		if _, err := store.AddFileTag(fileTag.file.Id, fileTag.tag.Id, fileTag.value.Id); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// test
+
+	if err := ImplyCommand.Exec(store, Options{Option{"--list", "-l", "", false, ""}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+	if err := TagsCommand.Exec(store, Options{}, []string{fileA.Path(), fileB.Path()}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"continent"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := FilesCommand.Exec(store, Options{}, []string{"person"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// verify
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, `        camera => type=photo
+      composer => person=*
+country=france => continent=europe
+/tmp/tmsu/a: composer=bach continent=europe country=france person=bach
+/tmp/tmsu/b: camera country=spain type=photo
+/tmp/tmsu/a
+/tmp/tmsu/a
+`, string(bytes))
+}
+
+func TestImplyAliasOfItself(test *testing.T) {
+	// set-up
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	photoTag, err := store.AddTag("photo")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := store.AddAlias("pic", photoTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := ImplyCommand.Exec(store, Options{}, []string{"pic", "photo"}); err == nil {
+		test.Fatal("Expected an implication of a tag by its alias to be rejected.")
+	}
+	if err := ImplyCommand.Exec(store, Options{}, []string{"pic=a", "photo=b"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	implications, err := store.Implications()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(implications) != 1 {
+		test.Fatalf("Expected a single implication but were %v.", len(implications))
+	}
+}
+
+func TestTagsTree(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	for _, tagName := range []string{"photo", "music:genre:rock", "music-video", "music", "music:genre:jazz", "music:artist:miles-davis"} {
+		if _, err := store.AddTag(tagName); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// test
+
+	if err := TagsCommand.Exec(store, Options{Option{"--tree", "-t", "", false, ""}}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+
+	// verify
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "music\n  artist\n    miles-davis\n  genre\n    jazz\n    rock\nmusic-video\nphoto\n", string(bytes))
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/storage"
+)
+
+var UndoCommand = Command{
+	Name:     "undo",
+	Synopsis: "Undo changes made to the database",
+	Usages: []string{"tmsu undo [OPTION]...",
+		"tmsu undo ID..."},
+	Description: `Undoes the most recent operation that changed the database, restoring any tags, values, implications and taggings it removed and removing any it added.
+
+If operation IDs are specified then those operations are undone instead. The IDs are listed by the 'history' subcommand.
+
+An undo is itself recorded as an operation: undoing it redoes the original changes.
+
+An operation that was followed by other changes to the same entities may not be possible to undo. In this case nothing is changed.`,
+	Examples: []string{"$ tmsu undo",
+		"$ tmsu undo --count 3",
+		"$ tmsu undo 13"},
+	Options: Options{{"--count", "-n", "undo the last N operations", true, ""}},
+	Exec:    undoExec,
+}
+
+func undoExec(store *storage.Storage, options Options, args []string) error {
+	var operationIds entities.OperationIds
+	var err error
+
+	if len(args) > 0 {
+		operationIds, err = parseOperationIds(args)
+	} else {
+		operationIds, err = undoableOperationIds(store, options)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(operationIds) == 0 {
+		return fmt.Errorf("there are no operations to undo")
+	}
+
+	for _, operationId := range operationIds {
+		operation, err := store.Operation(operationId)
+		if err != nil {
+			return fmt.Errorf("could not retrieve operation #%v: %v", operationId, err)
+		}
+		if operation == nil {
+			return fmt.Errorf("no such operation #%v", operationId)
+		}
+
+		log.Infof(2, "undoing operation #%v.", operationId)
+
+		if err := store.Undo(operationId); err != nil {
+			// an undo is all or nothing: discard any changes already made
+			if rollbackErr := store.Rollback(); rollbackErr != nil {
+				return rollbackErr
+			}
+			if beginErr := store.Begin(); beginErr != nil {
+				return beginErr
+			}
+
+			return fmt.Errorf("could not undo operation #%v: %v", operationId, err)
+		}
+
+		fmt.Printf("undid %v: %v\n", operation.Id, operation.Command)
+	}
+
+	return nil
+}
+
+// unexported
+
+func undoableOperationIds(store *storage.Storage, options Options) (entities.OperationIds, error) {
+	count := uint64(1)
+	if options.HasOption("--count") {
+		var err error
+		count, err = strconv.ParseUint(options.Get("--count").Argument, 10, 0)
+		if err != nil || count == 0 {
+			return nil, fmt.Errorf("invalid count '%v'", options.Get("--count").Argument)
+		}
+	}
+
+	operations, err := store.UndoableOperations(uint(count))
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve operations: %v", err)
+	}
+
+	operationIds := make(entities.OperationIds, len(operations))
+	for index, operation := range operations {
+		operationIds[index] = operation.Id
+	}
+
+	return operationIds, nil
+}
+
+// Parses the operation IDs, ordering them newest first so that later changes are undone
+// before the earlier ones they may depend upon.
+func parseOperationIds(args []string) (entities.OperationIds, error) {
+	operationIds := make(entities.OperationIds, len(args))
+	for index, arg := range args {
+		operationId, err := parseOperationId(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		operationIds[index] = operationId
+	}
+
+	sort.Sort(sort.Reverse(operationIds))
+
+	return operationIds, nil
+}
@@ -0,0 +1,389 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/storage"
+)
+
+func TestUndoRestoresDeletedTag(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := store.Begin(); err != nil {
+		test.Fatal(err)
+	}
+
+	file, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	appleTag, err := store.AddTag("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+	fruitTag, err := store.AddTag("fruit")
+	if err != nil {
+		test.Fatal(err)
+	}
+	value, err := store.AddValue("green")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(file.Id, appleTag.Id, value.Id); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.AddImplication(appleTag.Id, 0, fruitTag.Id, 0, false); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddAlias("pomme", appleTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := store.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := store.Begin(); err != nil {
+		test.Fatal(err)
+	}
+	if err := DeleteCommand.Exec(store, Options{}, []string{"apple"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := store.Begin(); err != nil {
+		test.Fatal(err)
+	}
+	if err := UndoCommand.Exec(store, Options{}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	restoredFile, err := store.FileByPath("/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if restoredFile == nil || restoredFile.Id != file.Id {
+		test.Fatal("File was not restored.")
+	}
+
+	tagNames, err := tagNamesForFile(store, file.Id, false, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tagNames) != 2 || tagNames[0] != "apple=green" || tagNames[1] != "fruit" {
+		test.Fatalf("File has unexpected tags: %v", tagNames)
+	}
+
+	alias, err := store.AliasByName("pomme")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if alias == nil || alias.Tag.Id != appleTag.Id {
+		test.Fatal("Alias was not restored.")
+	}
+
+	operations, err := store.Operations()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(operations) != 3 {
+		test.Fatalf("Expected three operations but found %v.", len(operations))
+	}
+	if operations[1].UndoneBy != operations[2].Id {
+		test.Fatalf("Delete was not marked as undone by operation #%v.", operations[2].Id)
+	}
+}
+
+func TestUndoOfUndoRedoes(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := store.Begin(); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddTag("apple"); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := store.Begin(); err != nil {
+		test.Fatal(err)
+	}
+	if err := UndoCommand.Exec(store, Options{}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := store.Begin(); err != nil {
+		test.Fatal(err)
+	}
+	if err := UndoCommand.Exec(store, Options{}, []string{"2"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tag, err := store.TagByName("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if tag == nil {
+		test.Fatal("Tag was not restored.")
+	}
+
+	operation, err := store.Operation(1)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if operation.UndoneBy != 0 {
+		test.Fatalf("Original operation is still marked as undone by #%v.", operation.UndoneBy)
+	}
+
+	undoable, err := store.UndoableOperations(10)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(undoable) != 1 || undoable[0].Id != 1 {
+		test.Fatalf("Expected only the original operation to be undoable but found %v operations.", len(undoable))
+	}
+}
+
+func TestUndoOfRenameKeepsTaggings(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := store.Begin(); err != nil {
+		test.Fatal(err)
+	}
+	file, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	appleTag, err := store.AddTag("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(file.Id, appleTag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := store.Begin(); err != nil {
+		test.Fatal(err)
+	}
+	if err := RenameCommand.Exec(store, Options{}, []string{"apple", "pear"}); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := store.Begin(); err != nil {
+		test.Fatal(err)
+	}
+	if err := UndoCommand.Exec(store, Options{}, []string{}); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tagNames, err := tagNamesForFile(store, file.Id, true, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tagNames) != 1 || tagNames[0] != "apple" {
+		test.Fatalf("File has unexpected tags: %v", tagNames)
+	}
+}
+
+func TestUndoOfChangedRenameIsRefused(test *testing.T) {
+	// set-up
+
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := store.Begin(); err != nil {
+		test.Fatal(err)
+	}
+	file, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	appleTag, err := store.AddTag("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(file.Id, appleTag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	for _, names := range [][]string{{"apple", "pear"}, {"pear", "plum"}} {
+		if err := store.Begin(); err != nil {
+			test.Fatal(err)
+		}
+		if err := RenameCommand.Exec(store, Options{}, names); err != nil {
+			test.Fatal(err)
+		}
+		if err := store.Commit(); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// test
+
+	if err := store.Begin(); err != nil {
+		test.Fatal(err)
+	}
+	err = UndoCommand.Exec(store, Options{}, []string{"2"})
+	if err := store.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if err == nil {
+		test.Fatal("Undo of a rename since renamed again succeeded.")
+	}
+	if !strings.Contains(err.Error(), "operation #3") {
+		test.Fatalf("Error does not name the conflicting operation: %v", err)
+	}
+
+	tagNames, err := tagNamesForFile(store, file.Id, true, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tagNames) != 1 || tagNames[0] != "plum" {
+		test.Fatalf("File has unexpected tags: %v", tagNames)
+	}
+
+	operation, err := store.Operation(2)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if operation.UndoneBy != 0 {
+		test.Fatalf("Operation was marked as undone by operation #%v.", operation.UndoneBy)
+	}
+}
+
+func TestUndoWithNothingToUndo(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabase()
+	defer os.Remove(databasePath)
+
+	store, err := storage.Open()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	// test
+
+	err = UndoCommand.Exec(store, Options{}, []string{})
+
+	// validate
+
+	if err == nil {
+		test.Fatal("Undo with no operations succeeded.")
+	}
+}
@@ -37,6 +37,7 @@ var UnmountCommand = Command{
 	Description: "Unmounts the virtual file-system at MOUNTPOINT.",
 	Options:     Options{{"--all", "-a", "unmounts all mounted TMSU file-systems", false, ""}},
 	Exec:        unmountExec,
+	ReadOnly:    true,
 }
 
 func unmountExec(store *storage.Storage, options Options, args []string) error {
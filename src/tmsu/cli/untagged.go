@@ -35,8 +35,9 @@ var UntaggedCommand = Command{
 Where PATHs are not specified, untagged items under the current working directory are shown.`,
 	Examples: []string{"$ tmsu untagged",
 		"$ tmsu untagged /home/fred/drawings"},
-	Options: Options{Option{"--directory", "-d", "do not examine directory contents (non-recursive)", false, ""}},
-	Exec:    untaggedExec,
+	Options:  Options{Option{"--directory", "-d", "do not examine directory contents (non-recursive)", false, ""}},
+	Exec:     untaggedExec,
+	ReadOnly: true,
 }
 
 func untaggedExec(store *storage.Storage, options Options, args []string) error {
@@ -19,6 +19,7 @@ package cli
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"tmsu/common/log"
 	"tmsu/common/terminal"
@@ -35,7 +36,9 @@ var ValuesCommand = Command{
 		"$ tmsu values --count year\n3"},
 	Options: Options{{"--count", "-c", "lists the number of values rather than their names", false, ""},
 		{"", "-1", "list one value per line", false, ""}},
-	Exec: valuesExec,
+	Exec:      valuesExec,
+	MultiExec: valuesMultiExec,
+	ReadOnly:  true,
 }
 
 func valuesExec(store *storage.Storage, options Options, args []string) error {
@@ -49,6 +52,16 @@ func valuesExec(store *storage.Storage, options Options, args []string) error {
 	return listValues(store, args, showCount, onePerLine)
 }
 
+func valuesMultiExec(stores []*storage.Storage, options Options, args []string) error {
+	showCount := options.HasOption("--count")
+
+	if len(args) == 0 {
+		return listAllValuesMulti(stores, showCount)
+	}
+
+	return listValuesMulti(stores, args, showCount)
+}
+
 func listAllValues(store *storage.Storage, showCount, onePerLine bool) error {
 	log.Info(2, "retrieving all values.")
 
@@ -83,12 +96,6 @@ func listAllValues(store *storage.Storage, showCount, onePerLine bool) error {
 }
 
 func listValues(store *storage.Storage, tagNames []string, showCount, onePerLine bool) error {
-	store, err := storage.Open()
-	if err != nil {
-		return fmt.Errorf("could not open storage: %v", err)
-	}
-	defer store.Close()
-
 	switch len(tagNames) {
 	case 0:
 		return fmt.Errorf("at least one tag must be specified")
@@ -130,7 +137,7 @@ func listValuesForTag(store *storage.Storage, tagName string, showCount, onePerL
 				valueNames[index] = value.Name
 			}
 
-			terminal.PrintColumns(valueNames)
+			terminal.PrintColumnsInOrder(valueNames)
 		}
 	}
 
@@ -183,3 +190,87 @@ func listValuesForTags(store *storage.Storage, tagNames []string, showCount, one
 
 	return nil
 }
+
+func listAllValuesMulti(stores []*storage.Storage, showCount bool) error {
+	entries := make(labelledEntries, 0, 100)
+
+	for _, store := range stores {
+		log.Infof(2, "%v: retrieving all values.", store.Db.Location())
+
+		if showCount {
+			count, err := store.ValueCount()
+			if err != nil {
+				return fmt.Errorf("%v: could not retrieve value count: %v", store.Db.Location(), err)
+			}
+
+			entries = append(entries, labelledEntry{store.Db.Location(), fmt.Sprint(count)})
+			continue
+		}
+
+		values, err := store.Values()
+		if err != nil {
+			return fmt.Errorf("%v: could not retrieve values: %v", store.Db.Location(), err)
+		}
+
+		for _, value := range values {
+			entries = append(entries, labelledEntry{store.Db.Location(), value.Name})
+		}
+	}
+
+	if !showCount {
+		sort.Sort(entries)
+	}
+
+	entries.print()
+
+	return nil
+}
+
+func listValuesMulti(stores []*storage.Storage, tagNames []string, showCount bool) error {
+	wereErrors := false
+	for _, tagName := range tagNames {
+		entries := make(labelledEntries, 0, len(stores))
+
+		for _, store := range stores {
+			tag, err := store.TagByName(tagName)
+			if err != nil {
+				return fmt.Errorf("%v: could not retrieve tag '%v': %v", store.Db.Location(), tagName, err)
+			}
+			if tag == nil {
+				continue
+			}
+
+			log.Infof(2, "%v: retrieving values for tag '%v'.", store.Db.Location(), tagName)
+
+			values, err := store.ValuesByTag(tag.Id)
+			if err != nil {
+				return fmt.Errorf("%v: could not retrieve values for tag '%v': %v", store.Db.Location(), tagName, err)
+			}
+
+			if showCount {
+				entries = append(entries, labelledEntry{store.Db.Location(), fmt.Sprintf("%v: %v", tagName, len(values))})
+			} else {
+				valueNames := make([]string, len(values))
+				for index, value := range values {
+					valueNames[index] = value.Name
+				}
+
+				entries = append(entries, labelledEntry{store.Db.Location(), fmt.Sprintf("%v: %v", tagName, strings.Join(valueNames, " "))})
+			}
+		}
+
+		if len(entries) == 0 {
+			log.Warnf("no such tag, '%v'.", tagName)
+			wereErrors = true
+			continue
+		}
+
+		entries.print()
+	}
+
+	if wereErrors {
+		return errBlank
+	}
+
+	return nil
+}
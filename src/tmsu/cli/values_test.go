@@ -19,26 +19,21 @@ package cli
 
 import (
 	"io/ioutil"
-	"os"
 	"testing"
 	"time"
 	"tmsu/common/fingerprint"
-	"tmsu/storage"
 )
 
 func TestValuesForSingleTag(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -88,11 +83,62 @@ func TestValuesForSingleTag(test *testing.T) {
 	compareOutput(test, "metal\nwood\n", string(bytes))
 }
 
-func TestValuesForMulitpleTags(test *testing.T) {
+func TestValuesForTypedTag(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
+	err := redirectStreams()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer restoreStreams()
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	file, err := store.AddFile("/tmp/tmsu/a", fingerprint.Fingerprint("123"), time.Now(), 0, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	countTag, err := store.AddTag("count")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for _, name := range []string{"100", "9", "10"} {
+		value, err := store.AddValue(name)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if _, err := store.AddFileTag(file.Id, countTag.Id, value.Id); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if _, err := store.SetTagProperty(countTag.Id, "type", "integer"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := ValuesCommand.Exec(store, Options{Option{"", "-1", "", false, ""}}, []string{"count"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// verify
+
+	outFile.Seek(0, 0)
+
+	bytes, err := ioutil.ReadAll(outFile)
+	compareOutput(test, "9\n10\n100\n", string(bytes))
+}
+
+func TestValuesForMulitpleTags(test *testing.T) {
+	// set-up
 
 	err := redirectStreams()
 	if err != nil {
@@ -100,7 +146,7 @@ func TestValuesForMulitpleTags(test *testing.T) {
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -168,16 +214,13 @@ func TestValuesForMulitpleTags(test *testing.T) {
 func TestAllValues(test *testing.T) {
 	// set-up
 
-	databasePath := testDatabase()
-	defer os.Remove(databasePath)
-
 	err := redirectStreams()
 	if err != nil {
 		test.Fatal(err)
 	}
 	defer restoreStreams()
 
-	store, err := storage.Open()
+	store, err := testStorage()
 	if err != nil {
 		test.Fatal(err)
 	}
@@ -31,6 +31,7 @@ var VersionCommand = Command{
 	Description: "Displays version and copyright information.",
 	Options:     Options{},
 	Exec:        versionExec,
+	NoDatabase:  true,
 	Hidden:      true,
 }
 
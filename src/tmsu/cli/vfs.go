@@ -33,9 +33,10 @@ var VfsCommand = Command{
 	Description: `This subcommand is the foreground process which hosts the virtual filesystem. It is run automatically when a virtual filesystem is mounted using the 'mount' subcommand and terminated when the virtual filesystem is unmounted.
 
 It is not normally necessary to issue this subcommand manually unless debugging the virtual filesystem. For debug output use the --verbose option.`,
-	Options: Options{{"--options", "-o", "mount options", true, ""}},
-	Exec:    vfsExec,
-	Hidden:  true,
+	Options:  Options{{"--options", "-o", "mount options", true, ""}},
+	Exec:     vfsExec,
+	Hidden:   true,
+	ReadOnly: true,
 }
 
 func vfsExec(store *storage.Storage, options Options, args []string) error {
@@ -50,6 +51,13 @@ func vfsExec(store *storage.Storage, options Options, args []string) error {
 
 	mountPath := args[0]
 
+	// the file-system begins a short transaction for each operation rather than holding
+	// this one open, and the database locked, for as long as it is mounted
+	if err := store.Rollback(); err != nil {
+		return err
+	}
+	defer store.Begin()
+
 	vfs, err := vfs.MountVfs(store, mountPath, mountOptions)
 	if err != nil {
 		return fmt.Errorf("could not mount virtual filesystem at '%v': %v", mountPath, err)
@@ -0,0 +1,353 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"tmsu/common/log"
+	"tmsu/common/xattr"
+	"tmsu/storage"
+)
+
+// The extended attributes in which tags are stored: TMSU's own and the freedesktop.org
+// convention understood by other desktop tools.
+var tagAttributeNames = []string{"user.tags", "user.xdg.tags"}
+
+var XattrCommand = Command{
+	Name:     "xattr",
+	Synopsis: "Synchronise tags with extended attributes",
+	Usages: []string{"tmsu xattr [OPTION]... --export FILE...",
+		"tmsu xattr [OPTION]... --import FILE...",
+		"tmsu xattr [OPTION]... --export --all",
+		"tmsu xattr [OPTION]... --import --all"},
+	Description: `Synchronises the tags of each FILE with its extended attributes.
+
+With --export the tags applied to each FILE are written to its extended attributes. With --import the tags held in the extended attributes of each FILE are applied to it, adding the file to the database if necessary.
+
+Tags are stored as a comma-separated list, with values in TAG=VALUE form, in both the 'user.tags' attribute and the freedesktop.org 'user.xdg.tags' attribute. Both attributes are read on import. As extended attributes are retained by 'cp -a' and 'rsync -X', tags exported in this way survive files being copied and are visible to other tools.
+
+Only explicitly applied tags are exported. Exporting a file that no longer has any tags removes the attributes.
+
+When --all is specified, every file in the database is synchronised.`,
+	Examples: []string{"$ tmsu xattr --export mountain1.jpg",
+		"$ tmsu xattr --export --recursive photos",
+		"$ tmsu xattr --import --recursive /mnt/backup/photos",
+		"$ tmsu xattr --export --all"},
+	Options: Options{{"--export", "-e", "write tags to extended attributes", false, ""},
+		{"--import", "-i", "apply tags from extended attributes", false, ""},
+		{"--recursive", "-r", "recursively synchronise directory contents", false, ""},
+		{"--all", "-a", "synchronise every file in the database", false, ""}},
+	Exec: xattrExec,
+}
+
+func xattrExec(store *storage.Storage, options Options, args []string) error {
+	export := options.HasOption("--export")
+	import_ := options.HasOption("--import")
+	recursive := options.HasOption("--recursive")
+	all := options.HasOption("--all")
+
+	if export == import_ {
+		return fmt.Errorf("either --export or --import must be specified")
+	}
+
+	var paths []string
+	if all {
+		if len(args) > 0 {
+			return fmt.Errorf("files cannot be specified with --all")
+		}
+
+		files, err := store.Files()
+		if err != nil {
+			return fmt.Errorf("could not retrieve files: %v", err)
+		}
+
+		paths = make([]string, len(files))
+		for index, file := range files {
+			paths[index] = file.Path()
+		}
+
+		// every file is visited so there is no need to descend into directories
+		recursive = false
+	} else {
+		if len(args) == 0 {
+			return fmt.Errorf("files to synchronise must be specified")
+		}
+
+		paths = args
+	}
+
+	var err error
+	if export {
+		err = exportAttributes(store, paths, recursive)
+	} else {
+		err = importAttributes(store, paths, recursive)
+	}
+
+	return err
+}
+
+// unexported
+
+func exportAttributes(store *storage.Storage, paths []string, recursive bool) error {
+	wereErrors := false
+	for _, path := range paths {
+		if err := exportPathAttributes(store, path, recursive, true); err != nil {
+			if !warnAttributeError(path, err) {
+				return err
+			}
+
+			wereErrors = true
+		}
+	}
+
+	if wereErrors {
+		return errBlank
+	}
+
+	return nil
+}
+
+func exportPathAttributes(store *storage.Storage, path string, recursive, explicit bool) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("%v: could not get absolute path: %v", path, err)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	file, err := store.FileByPath(absPath)
+	if err != nil {
+		return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+	}
+
+	if file == nil {
+		if explicit {
+			log.Warnf("%v: file is not tagged", path)
+		}
+	} else {
+		tagNames, err := tagNamesForFile(store, file.Id, true, false)
+		if err != nil {
+			return fmt.Errorf("%v: %v", path, err)
+		}
+
+		if err := writeTagAttributes(path, tagNames); err != nil {
+			return err
+		}
+	}
+
+	if recursive && stat.IsDir() {
+		childPaths, err := directoryEntries(path)
+		if err != nil {
+			return err
+		}
+
+		for _, childPath := range childPaths {
+			if err := exportPathAttributes(store, childPath, true, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeTagAttributes(path string, tagNames []string) error {
+	if len(tagNames) == 0 {
+		log.Infof(2, "%v: removing tag attributes.", path)
+
+		for _, attributeName := range tagAttributeNames {
+			if err := xattr.Remove(path, attributeName); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	log.Infof(2, "%v: writing tag attributes.", path)
+
+	text := strings.Join(tagNames, ",")
+	for _, attributeName := range tagAttributeNames {
+		if err := xattr.Set(path, attributeName, text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func importAttributes(store *storage.Storage, paths []string, recursive bool) error {
+	fingerprintAlgorithm, err := store.SettingAsString("fingerprintAlgorithm")
+	if err != nil {
+		return err
+	}
+
+	autoCreateTags, err := store.SettingAsBool("autoCreateTags")
+	if err != nil {
+		return err
+	}
+
+	autoCreateValues, err := store.SettingAsBool("autoCreateValues")
+	if err != nil {
+		return err
+	}
+
+	batch, err := store.NewBatch()
+	if err != nil {
+		return err
+	}
+
+	wereErrors := false
+	for _, path := range paths {
+		pathErrors, err := importPathAttributes(store, batch, path, recursive, fingerprintAlgorithm, autoCreateTags, autoCreateValues)
+		if err != nil {
+			if !warnAttributeError(path, err) {
+				return err
+			}
+
+			pathErrors = true
+		}
+
+		wereErrors = wereErrors || pathErrors
+	}
+
+	if err := batch.Flush(); err != nil {
+		return fmt.Errorf("could not apply tags: %v", err)
+	}
+
+	if wereErrors {
+		return errBlank
+	}
+
+	return nil
+}
+
+func importPathAttributes(store *storage.Storage, batch *storage.Batch, path string, recursive bool, fingerprintAlgorithm string, autoCreateTags, autoCreateValues bool) (bool, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	tagArgs, wereErrors, err := readTagAttributes(path)
+	if err != nil {
+		return false, err
+	}
+
+	if len(tagArgs) > 0 {
+		tagValuePairs, lookupErrors, err := lookupTagValuePairs(store, tagArgs, autoCreateTags, autoCreateValues)
+		if err != nil {
+			return false, err
+		}
+		wereErrors = wereErrors || lookupErrors
+
+		if err := tagPath(batch, path, tagValuePairs, false, false, fingerprintAlgorithm); err != nil {
+			return false, err
+		}
+	}
+
+	if recursive && stat.IsDir() {
+		childPaths, err := directoryEntries(path)
+		if err != nil {
+			return false, err
+		}
+
+		for _, childPath := range childPaths {
+			childErrors, err := importPathAttributes(store, batch, childPath, true, fingerprintAlgorithm, autoCreateTags, autoCreateValues)
+			if err != nil {
+				return false, err
+			}
+
+			wereErrors = wereErrors || childErrors
+		}
+	}
+
+	return wereErrors, nil
+}
+
+// Reads the TAG[=VALUE] entries from the file's tag attributes.
+//
+// Entries that are not valid tags are reported and skipped.
+func readTagAttributes(path string) ([]string, bool, error) {
+	wereErrors := false
+	tagArgs := make([]string, 0, 10)
+	seen := make(map[string]bool)
+
+	for _, attributeName := range tagAttributeNames {
+		text, present, err := xattr.Get(path, attributeName)
+		if err != nil {
+			return nil, false, err
+		}
+		if !present {
+			continue
+		}
+
+		log.Infof(2, "%v: read attribute '%v'.", path, attributeName)
+
+		for _, entry := range strings.Split(text, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" || seen[entry] {
+				continue
+			}
+			seen[entry] = true
+
+			tagName, valueName := entry, ""
+			if index := strings.Index(entry, "="); index > 0 {
+				tagName, valueName = entry[:index], entry[index+1:]
+			}
+
+			if err := storage.ValidateTagName(tagName); err != nil {
+				log.Warnf("%v: skipping tag '%v' in attribute '%v': %v", path, entry, attributeName, err)
+				wereErrors = true
+				continue
+			}
+			if valueName != "" {
+				if err := storage.ValidateValueName(valueName); err != nil {
+					log.Warnf("%v: skipping tag '%v' in attribute '%v': %v", path, entry, attributeName, err)
+					wereErrors = true
+					continue
+				}
+			}
+
+			tagArgs = append(tagArgs, entry)
+		}
+	}
+
+	return tagArgs, wereErrors, nil
+}
+
+// Reports errors that affect only the one file, returning false for any other error.
+func warnAttributeError(path string, err error) bool {
+	switch {
+	case os.IsPermission(err), xattr.IsPermission(err):
+		log.Warnf("%v: permission denied", path)
+	case os.IsNotExist(err), xattr.IsNotExist(err):
+		log.Warnf("%v: no such file", path)
+	case xattr.IsUnsupported(err):
+		log.Warnf("%v: extended attributes are not supported", path)
+	default:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package cli
+
+import (
+	"os"
+	"testing"
+	"tmsu/common/xattr"
+)
+
+func TestXattrExport(test *testing.T) {
+	// set-up
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	skipUnlessAttributesSupported(test, "/tmp/tmsu/a")
+
+	if err := TagCommand.Exec(store, Options{}, []string{"/tmp/tmsu/a", "country=france", "apple"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := XattrCommand.Exec(store, Options{Option{"--export", "-e", "", false, ""}}, []string{"/tmp/tmsu/a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	for _, attributeName := range tagAttributeNames {
+		text, present, err := xattr.Get("/tmp/tmsu/a", attributeName)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if !present {
+			test.Fatalf("Attribute '%v' was not written.", attributeName)
+		}
+		if text != "apple,country=france" {
+			test.Fatalf("Attribute '%v' has unexpected value '%v'.", attributeName, text)
+		}
+	}
+}
+
+func TestXattrImport(test *testing.T) {
+	// set-up
+
+	store, err := testStorage()
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := createFile("/tmp/tmsu/a", "hello"); err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove("/tmp/tmsu/a")
+
+	skipUnlessAttributesSupported(test, "/tmp/tmsu/a")
+
+	if err := xattr.Set("/tmp/tmsu/a", "user.tags", "apple"); err != nil {
+		test.Fatal(err)
+	}
+	if err := xattr.Set("/tmp/tmsu/a", "user.xdg.tags", "apple, country=france"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := XattrCommand.Exec(store, Options{Option{"--import", "-i", "", false, ""}}, []string{"/tmp/tmsu/a"}); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	file, err := store.FileByPath("/tmp/tmsu/a")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if file == nil {
+		test.Fatal("File was not added.")
+	}
+
+	tagNames, err := tagNamesForFile(store, file.Id, true, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tagNames) != 2 || tagNames[0] != "apple" || tagNames[1] != "country=france" {
+		test.Fatalf("File has unexpected tags: %v", tagNames)
+	}
+}
+
+// unexported
+
+func skipUnlessAttributesSupported(test *testing.T, path string) {
+	if _, _, err := xattr.Get(path, "user.tags"); err != nil {
+		if xattr.IsUnsupported(err) {
+			test.Skip("extended attributes are not supported")
+		}
+
+		test.Fatal(err)
+	}
+}
@@ -70,6 +70,28 @@ func White(text string) string {
 	return WhiteCode + text + ResetCode
 }
 
+// Retrieves the code for the named colour, e.g. 'red'.
+func ColourCode(name string) (string, bool) {
+	code, ok := colourCodes[name]
+	return code, ok
+}
+
+// The names of the colours, in alphabetical order.
+func ColourNames() []string {
+	names := make([]string, 0, len(colourCodes))
+	for name := range colourCodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Applies the colour with the specified code to the text.
+func Colour(code, text string) string {
+	return code + text + ResetCode
+}
+
 func Strip(text string) string {
 	return formatting.ReplaceAllLiteralString(string(text), "")
 }
@@ -80,6 +102,16 @@ func Sort(items []string) {
 
 // unexported
 
+var colourCodes = map[string]string{
+	"red":     RedCode,
+	"green":   GreenCode,
+	"yellow":  YellowCode,
+	"blue":    BlueCode,
+	"magenta": MagentaCode,
+	"cyan":    CyanCode,
+	"white":   WhiteCode,
+}
+
 var formatting = regexp.MustCompile(`\x1b\[[0-9]*(;[0-9]*)*m`)
 
 type ansiString string
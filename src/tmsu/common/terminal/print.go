@@ -31,77 +31,12 @@ func PrintColumns(items []string) {
 
 func PrintColumnsWidth(items []string, width int) {
 	ansi.Sort(items)
+	printColumns(items, width)
+}
 
-	padding := 2 // minimum column padding
-
-	var colWidths []int
-	var calcWidth int
-
-	cols := 0
-	rows := 1
-
-	// add a row until everything fits or we have every item on its own row
-	for calcWidth = width + 1; calcWidth > width && rows <= len(items); rows++ {
-		cols = 0
-		colWidths = make([]int, 0, width)
-		calcWidth = -padding // last column has no padding
-
-		// try to place items into columns
-		for index, item := range items {
-			col := index / rows
-
-			if col >= len(colWidths) {
-				// add column
-				cols++
-				colWidths = append(colWidths, 0)
-				calcWidth += padding
-			}
-
-			itemLength := len(ansi.Strip(item))
-			if itemLength > colWidths[col] {
-				// widen column
-				calcWidth += -colWidths[col] + itemLength
-				colWidths[col] = itemLength
-			}
-
-			if calcWidth > width {
-				// exceeded width
-				break
-			}
-		}
-	}
-	rows--
-
-	// apportion any remaining space between the columns
-	if cols > 2 && rows > 1 {
-		padding = (width-calcWidth)/(cols-1) + 2
-		if padding < 2 {
-			padding = 2
-		}
-	}
-
-	// render
-	for rowIndex := 0; rowIndex < rows; rowIndex++ {
-		for columnIndex := 0; columnIndex < cols; columnIndex++ {
-			itemIndex := rows*columnIndex + rowIndex
-
-			if itemIndex >= len(items) {
-				break
-			}
-
-			item := items[itemIndex]
-
-			fmt.Print(item)
-
-			if columnIndex < cols-1 {
-				itemLength := len(ansi.Strip(item))
-				padding := (colWidths[columnIndex] + padding) - itemLength
-				fmt.Print(strings.Repeat(" ", padding))
-			}
-		}
-
-		fmt.Println()
-	}
+// Prints the items in columns in the order given rather than sorting them.
+func PrintColumnsInOrder(items []string) {
+	printColumns(items, Width())
 }
 
 func PrintWrapped(text string) {
@@ -174,3 +109,78 @@ func PrintWrappedWidth(text string, maxWidth int) {
 
 	fmt.Println()
 }
+
+// unexported
+
+func printColumns(items []string, width int) {
+	padding := 2 // minimum column padding
+
+	var colWidths []int
+	var calcWidth int
+
+	cols := 0
+	rows := 1
+
+	// add a row until everything fits or we have every item on its own row
+	for calcWidth = width + 1; calcWidth > width && rows <= len(items); rows++ {
+		cols = 0
+		colWidths = make([]int, 0, width)
+		calcWidth = -padding // last column has no padding
+
+		// try to place items into columns
+		for index, item := range items {
+			col := index / rows
+
+			if col >= len(colWidths) {
+				// add column
+				cols++
+				colWidths = append(colWidths, 0)
+				calcWidth += padding
+			}
+
+			itemLength := len(ansi.Strip(item))
+			if itemLength > colWidths[col] {
+				// widen column
+				calcWidth += -colWidths[col] + itemLength
+				colWidths[col] = itemLength
+			}
+
+			if calcWidth > width {
+				// exceeded width
+				break
+			}
+		}
+	}
+	rows--
+
+	// apportion any remaining space between the columns
+	if cols > 2 && rows > 1 {
+		padding = (width-calcWidth)/(cols-1) + 2
+		if padding < 2 {
+			padding = 2
+		}
+	}
+
+	// render
+	for rowIndex := 0; rowIndex < rows; rowIndex++ {
+		for columnIndex := 0; columnIndex < cols; columnIndex++ {
+			itemIndex := rows*columnIndex + rowIndex
+
+			if itemIndex >= len(items) {
+				break
+			}
+
+			item := items[itemIndex]
+
+			fmt.Print(item)
+
+			if columnIndex < cols-1 {
+				itemLength := len(ansi.Strip(item))
+				padding := (colWidths[columnIndex] + padding) - itemLength
+				fmt.Print(strings.Repeat(" ", padding))
+			}
+		}
+
+		fmt.Println()
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package xattr
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+var errUnsupported = errors.New("extended attributes are not supported on this platform")
+
+// An error accessing an extended attribute.
+type AttributeError struct {
+	Path string
+	Name string
+	Err  error
+}
+
+func (err *AttributeError) Error() string {
+	return fmt.Sprintf("%v: could not access extended attribute '%v': %v", err.Path, err.Name, err.Err)
+}
+
+// Determines whether the error indicates that the file system does not support
+// extended attributes.
+func IsUnsupported(err error) bool {
+	err = underlyingError(err)
+	return err == errUnsupported || err == syscall.ENOTSUP
+}
+
+// Determines whether the error indicates that the file does not exist.
+func IsNotExist(err error) bool {
+	return os.IsNotExist(underlyingError(err))
+}
+
+// Determines whether the error indicates that access to the file was denied.
+func IsPermission(err error) bool {
+	return os.IsPermission(underlyingError(err))
+}
+
+// unexported
+
+func underlyingError(err error) error {
+	if attributeError, ok := err.(*AttributeError); ok {
+		return attributeError.Err
+	}
+
+	return err
+}
@@ -0,0 +1,80 @@
+// +build linux
+
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package xattr
+
+import (
+	"syscall"
+)
+
+// Retrieves the value of the named extended attribute of the file.
+//
+// The boolean result is false if the file does not have the attribute.
+func Get(path, name string) (string, bool, error) {
+	for {
+		size, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			return getError(path, name, err)
+		}
+		if size == 0 {
+			return "", true, nil
+		}
+
+		data := make([]byte, size)
+		size, err = syscall.Getxattr(path, name, data)
+		if err == syscall.ERANGE {
+			// attribute grew between calls
+			continue
+		}
+		if err != nil {
+			return getError(path, name, err)
+		}
+
+		return string(data[:size]), true, nil
+	}
+}
+
+// Sets the value of the named extended attribute of the file.
+func Set(path, name, value string) error {
+	if err := syscall.Setxattr(path, name, []byte(value), 0); err != nil {
+		return &AttributeError{path, name, err}
+	}
+
+	return nil
+}
+
+// Removes the named extended attribute from the file, if present.
+func Remove(path, name string) error {
+	err := syscall.Removexattr(path, name)
+	if err != nil && err != syscall.ENODATA {
+		return &AttributeError{path, name, err}
+	}
+
+	return nil
+}
+
+// unexported
+
+func getError(path, name string, err error) (string, bool, error) {
+	if err == syscall.ENODATA {
+		return "", false, nil
+	}
+
+	return "", false, &AttributeError{path, name, err}
+}
@@ -0,0 +1,32 @@
+// +build !linux
+
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package xattr
+
+func Get(path, name string) (string, bool, error) {
+	return "", false, &AttributeError{path, name, errUnsupported}
+}
+
+func Set(path, name, value string) error {
+	return &AttributeError{path, name, errUnsupported}
+}
+
+func Remove(path, name string) error {
+	return &AttributeError{path, name, errUnsupported}
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entities
+
+// An alternative name by which a tag may be referred to.
+type Alias struct {
+	Name string
+	Tag  Tag
+}
+
+type Aliases []*Alias
+
+func (aliases Aliases) Len() int {
+	return len(aliases)
+}
+
+func (aliases Aliases) Swap(i, j int) {
+	aliases[i], aliases[j] = aliases[j], aliases[i]
+}
+
+func (aliases Aliases) Less(i, j int) bool {
+	return aliases[i].Name < aliases[j].Name
+}
+
+// Retrieves the alias with the specified name, if any.
+func (aliases Aliases) Find(name string) *Alias {
+	for _, alias := range aliases {
+		if alias.Name == name {
+			return alias
+		}
+	}
+
+	return nil
+}
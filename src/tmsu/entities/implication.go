@@ -17,9 +17,33 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 
 package entities
 
+// A rule that whenever a file is tagged with the implying tag it is also, implicitly,
+// tagged with the implied tag.
+//
+// An implying value restricts the implication to taggings with that value: without one
+// the implication applies whatever the tagging's value. The implied tag is applied with
+// the implied value, if any, or, where the implication preserves values, with the value
+// of the implying tagging.
 type Implication struct {
-	ImplyingTag Tag
-	ImpliedTag  Tag
+	ImplyingTag    Tag
+	ImplyingValue  Value
+	ImpliedTag     Tag
+	ImpliedValue   Value
+	PreservesValue bool
+}
+
+// Determines whether the implication applies to a tagging with the specified tag and value.
+func (implication Implication) AppliesTo(tagId TagId, valueId ValueId) bool {
+	return implication.ImplyingTag.Id == tagId && (implication.ImplyingValue.Id == 0 || implication.ImplyingValue.Id == valueId)
+}
+
+// The value with which the implied tag is applied for a tagging with the specified value.
+func (implication Implication) ImpliedValueId(valueId ValueId) ValueId {
+	if implication.PreservesValue {
+		return valueId
+	}
+
+	return implication.ImpliedValue.Id
 }
 
 type Implications []*Implication
@@ -33,3 +57,18 @@ func (implications Implications) Implies(tagId TagId) bool {
 
 	return false
 }
+
+// Determines whether the set contains an implication between the same tags and values.
+func (implications Implications) Contains(search *Implication) bool {
+	for _, implication := range implications {
+		if implication.ImplyingTag.Id == search.ImplyingTag.Id &&
+			implication.ImplyingValue.Id == search.ImplyingValue.Id &&
+			implication.ImpliedTag.Id == search.ImpliedTag.Id &&
+			implication.ImpliedValue.Id == search.ImpliedValue.Id &&
+			implication.PreservesValue == search.PreservesValue {
+			return true
+		}
+	}
+
+	return false
+}
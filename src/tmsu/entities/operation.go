@@ -0,0 +1,69 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entities
+
+import (
+	"time"
+)
+
+type OperationId uint
+
+type OperationIds []OperationId
+
+func (operationIds OperationIds) Len() int {
+	return len(operationIds)
+}
+
+func (operationIds OperationIds) Less(i, j int) bool {
+	return operationIds[i] < operationIds[j]
+}
+
+func (operationIds OperationIds) Swap(i, j int) {
+	operationIds[i], operationIds[j] = operationIds[j], operationIds[i]
+}
+
+// A command that changed the database.
+type Operation struct {
+	Id          OperationId
+	Time        time.Time
+	Command     string
+	User        string
+	UndoneBy    OperationId
+	ChangeCount uint
+}
+
+type Operations []*Operation
+
+// A change made to a row of the database.
+//
+// An update is recorded as the removal of the old row followed by the insertion of the
+// new one. Columns holds the row's column values in table order.
+type JournalEntry struct {
+	Id          uint
+	OperationId OperationId
+	Table       string
+	Action      string
+	Columns     []interface{}
+}
+
+type JournalEntries []*JournalEntry
+
+const (
+	JournalInsert = "insert"
+	JournalDelete = "delete"
+)
@@ -19,6 +19,7 @@ package entities
 
 import (
 	"sort"
+	"strings"
 )
 
 type TagId uint
@@ -56,6 +57,16 @@ func (tagIds TagIds) Uniq() TagIds {
 	return uniq
 }
 
+func (tagIds TagIds) Contains(tagId TagId) bool {
+	for _, id := range tagIds {
+		if id == tagId {
+			return true
+		}
+	}
+
+	return false
+}
+
 type Tag struct {
 	Id   TagId
 	Name string
@@ -105,6 +116,19 @@ func (tags Tags) Any(predicate func(*Tag) bool) bool {
 	return false
 }
 
+// The separator between the levels of a hierarchical tag name, e.g. 'music:genre:jazz'.
+const TagNamespaceSeparator = ":"
+
+// Splits a hierarchical tag name into its levels.
+func TagNameLevels(name string) []string {
+	return strings.Split(name, TagNamespaceSeparator)
+}
+
+// Determines whether the tag name lies beneath the specified namespace in the hierarchy.
+func IsDescendantTagName(name, namespace string) bool {
+	return strings.HasPrefix(name, namespace+TagNamespaceSeparator)
+}
+
 type TagFileCount struct {
 	Id        TagId
 	Name      string
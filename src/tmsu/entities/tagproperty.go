@@ -0,0 +1,60 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entities
+
+// The names of the tag properties with a special meaning.
+const (
+	TagDescriptionProperty = "description"
+	TagColourProperty      = "colour"
+)
+
+// A named piece of metadata attached to a tag.
+type TagProperty struct {
+	TagId TagId
+	Name  string
+	Value string
+}
+
+type TagProperties []*TagProperty
+
+func (properties TagProperties) Len() int {
+	return len(properties)
+}
+
+func (properties TagProperties) Swap(i, j int) {
+	properties[i], properties[j] = properties[j], properties[i]
+}
+
+func (properties TagProperties) Less(i, j int) bool {
+	if properties[i].TagId != properties[j].TagId {
+		return properties[i].TagId < properties[j].TagId
+	}
+
+	return properties[i].Name < properties[j].Name
+}
+
+// Retrieves the value of the named property, or the empty string if it is not set.
+func (properties TagProperties) Value(name string) string {
+	for _, property := range properties {
+		if property.Name == name {
+			return property.Value
+		}
+	}
+
+	return ""
+}
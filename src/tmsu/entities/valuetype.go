@@ -0,0 +1,243 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entities
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The name of the tag property that declares the type of the tag's values.
+const TagTypeProperty = "type"
+
+// The type of a tag's values, which determines how they are validated, compared and
+// sorted. Values of tags without a declared type are compared as numbers when compared
+// against a number and as text otherwise.
+type ValueType string
+
+const (
+	StringValueType  ValueType = "string"
+	IntegerValueType ValueType = "integer"
+	DecimalValueType ValueType = "decimal"
+	DateValueType    ValueType = "date"
+	VersionValueType ValueType = "version"
+)
+
+var ValueTypes = []ValueType{StringValueType, IntegerValueType, DecimalValueType, DateValueType, VersionValueType}
+
+// The layouts accepted for values of the date type.
+var DateLayouts = []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02T15:04:05", time.RFC3339}
+
+// Parses the name of a value type.
+func ParseValueType(name string) (ValueType, error) {
+	for _, valueType := range ValueTypes {
+		if string(valueType) == name {
+			return valueType, nil
+		}
+	}
+
+	names := make([]string, len(ValueTypes))
+	for index, valueType := range ValueTypes {
+		names[index] = string(valueType)
+	}
+
+	return "", fmt.Errorf("unknown value type '%v': valid types are %v.", name, strings.Join(names, ", "))
+}
+
+// Checks that the value name is valid for the type.
+func (valueType ValueType) Validate(name string) error {
+	if _, ok := valueType.parse(name); !ok {
+		return fmt.Errorf("'%v' is not a valid %v value", name, valueType)
+	}
+
+	return nil
+}
+
+// Compares two value names according to the type, returning a negative number, zero or a
+// positive number as the first is less than, equal to or greater than the second.
+//
+// Names that are not valid for the type are compared as text, after the valid names.
+func (valueType ValueType) Compare(a, b string) int {
+	parsedA, okA := valueType.parse(a)
+	parsedB, okB := valueType.parse(b)
+
+	switch {
+	case okA && okB:
+		return valueType.compareParsed(parsedA, parsedB)
+	case okA:
+		return -1
+	case okB:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+// unexported
+
+var versionPattern = regexp.MustCompile(`^v?[0-9]+(\.[0-9]+)*([-+][0-9A-Za-z.-]+)?$`)
+
+func (valueType ValueType) parse(name string) (interface{}, bool) {
+	switch valueType {
+	case IntegerValueType:
+		number, err := strconv.ParseInt(name, 10, 64)
+		return number, err == nil
+	case DecimalValueType:
+		number, err := strconv.ParseFloat(name, 64)
+		return number, err == nil && !math.IsNaN(number) && !math.IsInf(number, 0)
+	case DateValueType:
+		for _, layout := range DateLayouts {
+			if date, err := time.Parse(layout, name); err == nil {
+				return date, true
+			}
+		}
+
+		return nil, false
+	case VersionValueType:
+		return name, versionPattern.MatchString(name)
+	default:
+		return name, true
+	}
+}
+
+func (valueType ValueType) compareParsed(a, b interface{}) int {
+	switch valueType {
+	case IntegerValueType:
+		return compareInts(a.(int64), b.(int64))
+	case DecimalValueType:
+		return compareFloats(a.(float64), b.(float64))
+	case DateValueType:
+		dateA, dateB := a.(time.Time), b.(time.Time)
+		switch {
+		case dateA.Before(dateB):
+			return -1
+		case dateA.After(dateB):
+			return 1
+		default:
+			return 0
+		}
+	case VersionValueType:
+		return compareVersions(a.(string), b.(string))
+	default:
+		return strings.Compare(a.(string), b.(string))
+	}
+}
+
+// Compares versions component by component, numerically where both components are
+// numbers, so that '1.10' follows '1.9'. Missing components count as zero and a
+// pre-release suffix ('-rc1') precedes the release itself. Build metadata ('+...') is
+// ignored.
+func compareVersions(a, b string) int {
+	releaseA, preReleaseA := splitVersion(a)
+	releaseB, preReleaseB := splitVersion(b)
+
+	if result := compareVersionComponents(releaseA, releaseB, true); result != 0 {
+		return result
+	}
+
+	switch {
+	case preReleaseA == nil && preReleaseB == nil:
+		return 0
+	case preReleaseA == nil:
+		return 1
+	case preReleaseB == nil:
+		return -1
+	default:
+		return compareVersionComponents(preReleaseA, preReleaseB, false)
+	}
+}
+
+func splitVersion(version string) (release, preRelease []string) {
+	version = strings.TrimPrefix(version, "v")
+
+	if index := strings.Index(version, "+"); index != -1 {
+		version = version[:index]
+	}
+
+	if index := strings.Index(version, "-"); index != -1 {
+		preRelease = strings.Split(version[index+1:], ".")
+		version = version[:index]
+	}
+
+	return strings.Split(version, "."), preRelease
+}
+
+// Compares the components of two versions. Where one has fewer components than the other
+// it is either padded with zeros or, otherwise, precedes the other.
+func compareVersionComponents(a, b []string, padWithZeros bool) int {
+	for index := 0; index < len(a) || index < len(b); index++ {
+		if !padWithZeros && (index >= len(a) || index >= len(b)) {
+			return compareInts(int64(len(a)), int64(len(b)))
+		}
+
+		componentA, componentB := "0", "0"
+		if index < len(a) {
+			componentA = a[index]
+		}
+		if index < len(b) {
+			componentB = b[index]
+		}
+
+		numberA, errA := strconv.ParseUint(componentA, 10, 64)
+		numberB, errB := strconv.ParseUint(componentB, 10, 64)
+
+		var result int
+		switch {
+		case errA == nil && errB == nil:
+			result = compareInts(int64(numberA), int64(numberB))
+		case errA == nil:
+			result = -1 // numeric identifiers precede alphanumeric ones
+		case errB == nil:
+			result = 1
+		default:
+			result = strings.Compare(componentA, componentB)
+		}
+
+		if result != 0 {
+			return result
+		}
+	}
+
+	return 0
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
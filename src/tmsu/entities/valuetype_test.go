@@ -0,0 +1,97 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package entities
+
+import (
+	"testing"
+)
+
+func TestValueTypeValidate(test *testing.T) {
+	// set-up
+
+	valid := map[ValueType][]string{
+		IntegerValueType: {"0", "-12", "100"},
+		DecimalValueType: {"1.5", "-0.25", "10"},
+		DateValueType:    {"2014-03-09", "2014-03-09T10:30", "2014-03-09T10:30:15Z"},
+		VersionValueType: {"1", "1.10.2", "v2.0", "1.0-rc1"},
+		StringValueType:  {"anything"},
+	}
+	invalid := map[ValueType][]string{
+		IntegerValueType: {"1.5", "ten"},
+		DecimalValueType: {"1.5kg", "NaN"},
+		DateValueType:    {"2014-13-01", "09/03/2014"},
+		VersionValueType: {"1..2", "beta"},
+	}
+
+	// test & validate
+
+	for valueType, names := range valid {
+		for _, name := range names {
+			if err := valueType.Validate(name); err != nil {
+				test.Fatalf("Expected '%v' to be a valid %v value: %v", name, valueType, err)
+			}
+		}
+	}
+	for valueType, names := range invalid {
+		for _, name := range names {
+			if err := valueType.Validate(name); err == nil {
+				test.Fatalf("Expected '%v' not to be a valid %v value.", name, valueType)
+			}
+		}
+	}
+}
+
+func TestParseValueTypeRejectsUnknownType(test *testing.T) {
+	if _, err := ParseValueType("colour"); err == nil {
+		test.Fatal("Expected an error for an unknown value type.")
+	}
+}
+
+func TestValueTypeCompare(test *testing.T) {
+	// set-up
+
+	less := []struct {
+		valueType ValueType
+		a, b      string
+	}{
+		{IntegerValueType, "9", "10"},
+		{DecimalValueType, "9.5", "10"},
+		{DateValueType, "2013-12-31", "2014-01-01T00:00"},
+		{VersionValueType, "1.9", "1.10"},
+		{VersionValueType, "1.0-rc1", "1.0"},
+		{VersionValueType, "1.0-alpha", "1.0-beta"},
+		{VersionValueType, "v1.2", "1.2.1"},
+		{StringValueType, "10", "9"},
+		{IntegerValueType, "100", "abc"}, // invalid values sort last
+	}
+
+	// test & validate
+
+	for _, pair := range less {
+		if result := pair.valueType.Compare(pair.a, pair.b); result >= 0 {
+			test.Fatalf("Expected %v '%v' to be less than '%v' but comparison was %v.", pair.valueType, pair.a, pair.b, result)
+		}
+		if result := pair.valueType.Compare(pair.b, pair.a); result <= 0 {
+			test.Fatalf("Expected %v '%v' to be greater than '%v' but comparison was %v.", pair.valueType, pair.b, pair.a, result)
+		}
+	}
+
+	if result := VersionValueType.Compare("1.0", "1.0.0+build5"); result != 0 {
+		test.Fatalf("Expected versions differing only in build metadata to be equal but comparison was %v.", result)
+	}
+}
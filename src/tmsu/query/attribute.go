@@ -0,0 +1,245 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package query
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"tmsu/entities"
+)
+
+// The attributes of files that can be compared in queries in place of a tag.
+const (
+	SizeAttribute        = "size"
+	ModTimeAttribute     = "mtime"
+	NameAttribute        = "name"
+	ExtensionAttribute   = "ext"
+	DirectoryAttribute   = "dir"
+	TypeAttribute        = "type"
+	FingerprintAttribute = "fingerprint"
+	TagAttribute         = "tag"
+	TagCountAttribute    = "tagcount"
+)
+
+// The pseudo-tag that matches the files without tags.
+const UntaggedAttribute = "untagged"
+
+var Attributes = []string{SizeAttribute, ModTimeAttribute, NameAttribute, ExtensionAttribute, DirectoryAttribute, TypeAttribute, FingerprintAttribute, TagAttribute, TagCountAttribute}
+
+// Determines whether the name is that of a file attribute.
+//
+// A tag of the same name takes precedence over the attribute.
+func IsAttribute(name string) bool {
+	for _, attribute := range Attributes {
+		if attribute == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Builds a function that determines whether a file satisfies a comparison against one of
+// its attributes.
+func FilePredicate(attribute AttributeExpression, now time.Time) (func(*entities.File) bool, error) {
+	operator, operand := attribute.Operator, attribute.Value.Name
+
+	switch attribute.Name {
+	case ModTimeAttribute:
+		condition, err := ParseTimeCondition(operator, operand, now)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(file *entities.File) bool { return condition.Matches(file.ModTime) }, nil
+	case TypeAttribute:
+		isDir, err := ParseFileType(operand)
+		if err != nil {
+			return nil, err
+		}
+
+		switch operator {
+		case "=", "==":
+			return func(file *entities.File) bool { return file.IsDir == isDir }, nil
+		case "!=":
+			return func(file *entities.File) bool { return file.IsDir != isDir }, nil
+		default:
+			return nil, fmt.Errorf("'%v' can only be compared using '=' or '!='", TypeAttribute)
+		}
+	}
+
+	switch attribute.Name {
+	case SizeAttribute:
+		matches, err := ordering(operator)
+		if err != nil {
+			return nil, err
+		}
+
+		size, err := ParseSize(operand)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(file *entities.File) bool {
+			switch {
+			case file.Size < size:
+				return matches(-1)
+			case file.Size > size:
+				return matches(1)
+			default:
+				return matches(0)
+			}
+		}, nil
+	case NameAttribute:
+		return textPredicate(operator, operand, func(file *entities.File) string { return file.Name })
+	case ExtensionAttribute:
+		if operator != "=~" {
+			operand = NormaliseExtension(operand)
+		}
+
+		return textPredicate(operator, operand, func(file *entities.File) string { return FileExtension(file.Name) })
+	case DirectoryAttribute:
+		return textPredicate(operator, operand, func(file *entities.File) string { return file.Directory })
+	case FingerprintAttribute:
+		return textPredicate(operator, operand, func(file *entities.File) string { return string(file.Fingerprint) })
+	default:
+		return nil, fmt.Errorf("unsupported attribute '%v'", attribute.Name)
+	}
+}
+
+// Builds a function that compares a count, such as that of a file's tags, against the value
+// in a query.
+func CountComparison(operator, operand string) (func(int) bool, error) {
+	matches, err := ordering(operator)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := ParseCount(operand)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(n int) bool {
+		switch {
+		case n < count:
+			return matches(-1)
+		case n > count:
+			return matches(1)
+		default:
+			return matches(0)
+		}
+	}, nil
+}
+
+// Parses a count, which must be a whole number.
+func ParseCount(text string) (int, error) {
+	count, err := strconv.ParseUint(text, 10, 31)
+	if err != nil {
+		return 0, fmt.Errorf("'%v' is not a count: a whole number is expected", text)
+	}
+
+	return int(count), nil
+}
+
+// Parses a size, such as '250', '10MB' or '1.5GiB', into a number of bytes.
+//
+// The units kB, MB, GB and TB are powers of 1000 whilst K, M, G and T are, like KiB, MiB,
+// GiB and TiB, powers of 1024. Units are not case sensitive.
+func ParseSize(text string) (int64, error) {
+	match := sizePattern.FindStringSubmatch(text)
+	if match == nil {
+		return 0, fmt.Errorf("'%v' is not a size, such as 250, 10MB or 1.5GiB", text)
+	}
+
+	multiplier, ok := sizeUnits[strings.ToLower(match[2])]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit '%v' in '%v'", match[2], text)
+	}
+
+	number, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%v': %v", text, err)
+	}
+
+	return int64(number * float64(multiplier)), nil
+}
+
+// Parses a file type, 'file' or 'dir', returning whether it is the latter.
+func ParseFileType(text string) (bool, error) {
+	switch text {
+	case "file":
+		return false, nil
+	case "dir", "directory":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown file type '%v': valid types are file and dir", text)
+	}
+}
+
+// The extension of a file name as compared by the 'ext' attribute: in lower case and
+// without the dot. Names starting with their only dot have no extension.
+func FileExtension(name string) string {
+	extension := filepath.Ext(name)
+	if extension == name {
+		return ""
+	}
+
+	return NormaliseExtension(extension)
+}
+
+// Normalises an extension given in a query so that it can be compared with FileExtension.
+func NormaliseExtension(extension string) string {
+	return strings.ToLower(strings.TrimPrefix(extension, "."))
+}
+
+// unexported
+
+var sizePattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)([A-Za-z]*)$`)
+
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"k":   1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tib": 1 << 40,
+}
+
+// Builds a function that compares, or matches against a pattern, the text of a file's
+// attribute.
+func textPredicate(operator, operand string, text func(*entities.File) string) (func(*entities.File) bool, error) {
+	compare, err := TextComparison(operator, operand)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(file *entities.File) bool { return compare(text(file)) }, nil
+}
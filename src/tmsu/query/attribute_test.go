@@ -0,0 +1,133 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package query
+
+import (
+	"testing"
+	"time"
+	"tmsu/entities"
+)
+
+func TestParseSize(test *testing.T) {
+	// set-up
+
+	sizes := map[string]int64{
+		"250":    250,
+		"250B":   250,
+		"10kB":   10000,
+		"10MB":   10000000,
+		"10mb":   10000000,
+		"2K":     2048,
+		"1.5GiB": 1610612736,
+		"1T":     1 << 40,
+	}
+
+	// test & validate
+
+	for text, expected := range sizes {
+		size, err := ParseSize(text)
+		if err != nil {
+			test.Fatal(err)
+		}
+		if size != expected {
+			test.Fatalf("Expected '%v' to be %v bytes but was %v.", text, expected, size)
+		}
+	}
+
+	for _, text := range []string{"", "MB", "10 MB", "10XB", "-5"} {
+		if _, err := ParseSize(text); err == nil {
+			test.Fatalf("Expected an error parsing size '%v'.", text)
+		}
+	}
+}
+
+func TestFileExtension(test *testing.T) {
+	// set-up
+
+	extensions := map[string]string{
+		"photo.jpg":   "jpg",
+		"PHOTO.JPG":   "jpg",
+		"archive.tar": "tar",
+		"README":      "",
+		".bashrc":     "",
+	}
+
+	// test & validate
+
+	for name, expected := range extensions {
+		if extension := FileExtension(name); extension != expected {
+			test.Fatalf("Expected extension of '%v' to be '%v' but was '%v'.", name, expected, extension)
+		}
+	}
+}
+
+func TestFilePredicate(test *testing.T) {
+	// set-up
+
+	file := &entities.File{Directory: "/home/bob", Name: "IMG_0001.JPG", Fingerprint: "abc", ModTime: time.Now(), Size: 12000000}
+
+	matching := []AttributeExpression{
+		{"size", ">", ValueExpression{"10MB"}},
+		{"size", "<=", ValueExpression{"12MB"}},
+		{"ext", "==", ValueExpression{"jpg"}},
+		{"ext", "=", ValueExpression{".JPG"}},
+		{"name", "<", ValueExpression{"IMG_0002.JPG"}},
+		{"dir", "=", ValueExpression{"/home/bob"}},
+		{"type", "=", ValueExpression{"file"}},
+		{"type", "!=", ValueExpression{"dir"}},
+		{"fingerprint", "=", ValueExpression{"abc"}},
+		{"mtime", ">", ValueExpression{"1h"}},
+	}
+	failing := []AttributeExpression{
+		{"size", ">", ValueExpression{"12MB"}},
+		{"ext", "!=", ValueExpression{"jpg"}},
+		{"type", "=", ValueExpression{"dir"}},
+	}
+	invalid := []AttributeExpression{
+		{"size", ">", ValueExpression{"large"}},
+		{"type", "<", ValueExpression{"file"}},
+		{"type", "=", ValueExpression{"link"}},
+		{"name", "~~", ValueExpression{"x"}},
+	}
+
+	// test & validate
+
+	for _, attribute := range matching {
+		predicate, err := FilePredicate(attribute, time.Now())
+		if err != nil {
+			test.Fatal(err)
+		}
+		if !predicate(file) {
+			test.Fatalf("Expected file to match '%v %v %v'.", attribute.Name, attribute.Operator, attribute.Value.Name)
+		}
+	}
+	for _, attribute := range failing {
+		predicate, err := FilePredicate(attribute, time.Now())
+		if err != nil {
+			test.Fatal(err)
+		}
+		if predicate(file) {
+			test.Fatalf("Expected file not to match '%v %v %v'.", attribute.Name, attribute.Operator, attribute.Value.Name)
+		}
+	}
+	for _, attribute := range invalid {
+		if _, err := FilePredicate(attribute, time.Now()); err == nil {
+			test.Fatalf("Expected an error for '%v %v %v'.", attribute.Name, attribute.Operator, attribute.Value.Name)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"tmsu/entities"
+)
+
+// Builds a function that compares a value name against the value in a query.
+//
+// The comparison is numeric when the value in the query is a number, in which case value
+// names are converted in the manner of SQLite's CAST, otherwise value names are compared
+// as text.
+func ValueComparison(operator, operand string) (func(string) bool, error) {
+	if IsPatternOperator(operator) {
+		return PatternMatch(operator, operand)
+	}
+
+	var compare func(string) int
+
+	if number, err := strconv.ParseFloat(operand, 64); err == nil {
+		compare = func(name string) int {
+			value := castToFloat(name)
+			switch {
+			case value < number:
+				return -1
+			case value > number:
+				return 1
+			default:
+				return 0
+			}
+		}
+	} else {
+		compare = func(name string) int { return strings.Compare(name, operand) }
+	}
+
+	return comparison(operator, compare)
+}
+
+// Builds a function that compares a value name against the value in a query according to
+// the declared type of the tag's values.
+//
+// Tags without a declared type, and patterns, are compared as per ValueComparison. It is an
+// error for the value in the query to be invalid for the type.
+func TypedValueComparison(valueType entities.ValueType, operator, operand string) (func(string) bool, error) {
+	if valueType == "" || IsPatternOperator(operator) {
+		return ValueComparison(operator, operand)
+	}
+
+	if err := valueType.Validate(operand); err != nil {
+		return nil, err
+	}
+
+	return comparison(operator, func(name string) int { return valueType.Compare(name, operand) })
+}
+
+// Builds a function that determines whether a value name satisfies a test of a tag's
+// values: a comparison, set membership, range or value presence expression. Values are
+// compared according to the declared type of the tag's values as per TypedValueComparison.
+//
+// The absence of a value is represented by the empty name, which satisfies only a test for
+// the absence of a value.
+func ValuePredicate(expression Expression, valueType entities.ValueType) (func(string) bool, error) {
+	switch expression.(type) {
+	case ValuedExpression:
+		return func(name string) bool { return name != "" }, nil
+	case UnvaluedExpression:
+		return func(name string) bool { return name == "" }, nil
+	}
+
+	matches, err := valuePredicate(expression, valueType)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(name string) bool { return name != "" && matches(name) }, nil
+}
+
+// Checks that the lower bound of a range does not exceed its upper bound, which would leave
+// the range matching no values. The bounds are compared according to the declared type of
+// the tag's values or, where the tag has no declared type, numerically when both are
+// numbers and as text when neither is.
+func ValidateRange(valueRange RangeExpression, valueType entities.ValueType) error {
+	from, to := valueRange.From.Name, valueRange.To.Name
+
+	var order int
+	if valueType != "" {
+		order = valueType.Compare(from, to)
+	} else {
+		fromNumber, fromErr := strconv.ParseFloat(from, 64)
+		toNumber, toErr := strconv.ParseFloat(to, 64)
+
+		switch {
+		case fromErr == nil && toErr == nil:
+			if fromNumber > toNumber {
+				order = 1
+			}
+		case fromErr != nil && toErr != nil:
+			order = strings.Compare(from, to)
+		}
+	}
+
+	if order > 0 {
+		return fmt.Errorf("invalid range '%v..%v': the lower bound exceeds the upper bound", from, to)
+	}
+
+	return nil
+}
+
+// Builds a function that compares text against the value in a query, or matches it against
+// a pattern. Unlike ValueComparison, the comparison is always textual.
+func TextComparison(operator, operand string) (func(string) bool, error) {
+	if IsPatternOperator(operator) {
+		return PatternMatch(operator, operand)
+	}
+
+	return comparison(operator, func(text string) int { return strings.Compare(text, operand) })
+}
+
+// Determines whether the operator matches text against a pattern rather than comparing
+// it: '~' for a glob and '=~' for a regular expression.
+func IsPatternOperator(operator string) bool {
+	return operator == "~" || operator == "=~"
+}
+
+// Builds a function that determines whether text matches a pattern.
+//
+// Globs follow SQLite's GLOB operator: '*' matches any text, '?' any single character and
+// '[...]' any of the enclosed characters, or, where the first is '^', any other. Matching
+// is case sensitive. Regular expressions use the RE2 syntax and match anywhere within the
+// text unless anchored.
+func PatternMatch(operator, pattern string) (func(string) bool, error) {
+	var expression string
+	switch operator {
+	case "~":
+		var err error
+		expression, err = globToRegexp(pattern)
+		if err != nil {
+			return nil, err
+		}
+	case "=~":
+		expression = pattern
+	default:
+		return nil, fmt.Errorf("unsupported pattern operator '%v'", operator)
+	}
+
+	compiled, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression '%v': %v", pattern, err)
+	}
+
+	return compiled.MatchString, nil
+}
+
+// unexported
+
+// Translates a glob into an equivalent, anchored, regular expression.
+func globToRegexp(glob string) (string, error) {
+	expression := "^"
+
+	runes := []rune(glob)
+	for index := 0; index < len(runes); index++ {
+		switch r := runes[index]; r {
+		case '*':
+			expression += "(?s:.*)"
+		case '?':
+			expression += "(?s:.)"
+		case '[':
+			end := index + 1
+			if end < len(runes) && runes[end] == '^' {
+				end++
+			}
+			if end < len(runes) && runes[end] == ']' {
+				end++ // a leading ']' is part of the set
+			}
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end == len(runes) {
+				return "", fmt.Errorf("invalid glob '%v': unterminated '['", glob)
+			}
+
+			set := string(runes[index+1 : end])
+			negated := strings.HasPrefix(set, "^")
+			set = strings.TrimPrefix(set, "^")
+			set = strings.Replace(strings.Replace(set, `\`, `\\`, -1), "[", `\[`, -1)
+			set = strings.Replace(set, "]", `\]`, -1)
+			if negated {
+				expression += "[^" + set + "]"
+			} else {
+				expression += "[" + set + "]"
+			}
+
+			index = end
+		default:
+			expression += regexp.QuoteMeta(string(r))
+		}
+	}
+
+	return expression + "$", nil
+}
+
+// Builds a function that determines whether a value name satisfies a comparison, set
+// membership or range expression.
+func valuePredicate(expression Expression, valueType entities.ValueType) (func(string) bool, error) {
+	switch exp := expression.(type) {
+	case ComparisonExpression:
+		return TypedValueComparison(valueType, exp.Operator, exp.Value.Name)
+	case InExpression:
+		equalities := make([]func(string) bool, len(exp.Values))
+		for index, value := range exp.Values {
+			equals, err := TypedValueComparison(valueType, "=", value.Name)
+			if err != nil {
+				return nil, err
+			}
+			equalities[index] = equals
+		}
+
+		return func(name string) bool {
+			for _, equals := range equalities {
+				if equals(name) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case RangeExpression:
+		atLeast, err := TypedValueComparison(valueType, ">=", exp.From.Name)
+		if err != nil {
+			return nil, err
+		}
+		atMost, err := TypedValueComparison(valueType, "<=", exp.To.Name)
+		if err != nil {
+			return nil, err
+		}
+		if err := ValidateRange(exp, valueType); err != nil {
+			return nil, err
+		}
+
+		return func(name string) bool { return atLeast(name) && atMost(name) }, nil
+	default:
+		return nil, fmt.Errorf("unsupported expression type %T", expression)
+	}
+}
+
+func comparison(operator string, compare func(string) int) (func(string) bool, error) {
+	matches, err := ordering(operator)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(name string) bool { return matches(compare(name)) }, nil
+}
+
+// Builds a function that determines whether the result of a three-way comparison
+// satisfies the operator.
+func ordering(operator string) (func(int) bool, error) {
+	switch operator {
+	case "=", "==":
+		return func(result int) bool { return result == 0 }, nil
+	case "!=":
+		return func(result int) bool { return result != 0 }, nil
+	case "<":
+		return func(result int) bool { return result < 0 }, nil
+	case ">":
+		return func(result int) bool { return result > 0 }, nil
+	case "<=":
+		return func(result int) bool { return result <= 0 }, nil
+	case ">=":
+		return func(result int) bool { return result >= 0 }, nil
+	default:
+		return nil, fmt.Errorf("unsupported comparison operator '%v'", operator)
+	}
+}
+
+// Converts text to a number in the manner of SQLite's CAST: the longest numeric prefix is
+// used and text without one is zero.
+func castToFloat(text string) float64 {
+	for length := len(text); length > 0; length-- {
+		if number, err := strconv.ParseFloat(text[:length], 64); err == nil {
+			return number
+		}
+	}
+
+	return 0
+}
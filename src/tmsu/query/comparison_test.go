@@ -0,0 +1,221 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package query
+
+import (
+	"testing"
+	"tmsu/entities"
+)
+
+func TestValueComparisonIsNumericForNumbers(test *testing.T) {
+	// set-up
+
+	greaterThanNine, err := ValueComparison(">", "9")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test & validate
+
+	if !greaterThanNine("10") {
+		test.Fatal("Expected '10' to be greater than '9'.")
+	}
+	if !greaterThanNine("9.5kg") {
+		test.Fatal("Expected '9.5kg' to be greater than '9'.")
+	}
+	if greaterThanNine("abc") {
+		test.Fatal("Expected 'abc' to be compared as zero.")
+	}
+}
+
+func TestValueComparisonIsTextualOtherwise(test *testing.T) {
+	// set-up
+
+	beforeMango, err := ValueComparison("<", "mango")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test & validate
+
+	if !beforeMango("apple") {
+		test.Fatal("Expected 'apple' to be less than 'mango'.")
+	}
+	if beforeMango("orange") {
+		test.Fatal("Expected 'orange' not to be less than 'mango'.")
+	}
+}
+
+func TestValueComparisonRejectsUnknownOperator(test *testing.T) {
+	if _, err := ValueComparison("~~", "x"); err == nil {
+		test.Fatal("Expected an error for an unsupported operator.")
+	}
+}
+
+func TestTypedValueComparisonUsesType(test *testing.T) {
+	// set-up
+
+	laterThanNine, err := TypedValueComparison(entities.VersionValueType, ">", "1.9")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test & validate
+
+	if !laterThanNine("1.10") {
+		test.Fatal("Expected version '1.10' to be greater than '1.9'.")
+	}
+	if laterThanNine("1.9-rc1") {
+		test.Fatal("Expected version '1.9-rc1' not to be greater than '1.9'.")
+	}
+}
+
+func TestTypedValueComparisonRejectsInvalidOperand(test *testing.T) {
+	if _, err := TypedValueComparison(entities.DateValueType, "<", "yesterday"); err == nil {
+		test.Fatal("Expected an error for a value that is not a valid date.")
+	}
+}
+
+func TestGlobValueComparison(test *testing.T) {
+	// set-up
+
+	matches, err := ValueComparison("~", "19[0-8]?")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test & validate
+
+	for _, name := range []string{"1900", "1985"} {
+		if !matches(name) {
+			test.Fatalf("Expected '%v' to match the glob.", name)
+		}
+	}
+	for _, name := range []string{"1990", "190", "x1900", "19000"} {
+		if matches(name) {
+			test.Fatalf("Expected '%v' not to match the glob.", name)
+		}
+	}
+}
+
+func TestRegexpValueComparison(test *testing.T) {
+	// set-up
+
+	matches, err := ValueComparison("=~", "^proj-[0-9]+$")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test & validate
+
+	if !matches("proj-12") {
+		test.Fatal("Expected 'proj-12' to match the regular expression.")
+	}
+	if matches("proj-x") {
+		test.Fatal("Expected 'proj-x' not to match the regular expression.")
+	}
+}
+
+func TestInvalidPatterns(test *testing.T) {
+	if _, err := ValueComparison("~", "19[0-"); err == nil {
+		test.Fatal("Expected an error for an unterminated glob set.")
+	}
+	if _, err := ValueComparison("=~", "19(0"); err == nil {
+		test.Fatal("Expected an error for an invalid regular expression.")
+	}
+}
+
+func TestValuePredicateForRangeUsesType(test *testing.T) {
+	// set-up
+
+	valueRange := RangeExpression{TagExpression{"release"}, ValueExpression{"1.9"}, ValueExpression{"1.10"}}
+	inRange, err := ValuePredicate(valueRange, entities.VersionValueType)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test & validate
+
+	if !inRange("1.9.2") {
+		test.Fatal("Expected '1.9.2' to be within the range.")
+	}
+	if inRange("1.2") {
+		test.Fatal("Expected '1.2' not to be within the range.")
+	}
+	if inRange("") {
+		test.Fatal("Expected the absence of a value not to be within the range.")
+	}
+}
+
+func TestValuePredicateRejectsReversedRange(test *testing.T) {
+	for _, reversed := range []struct {
+		from, to  string
+		valueType entities.ValueType
+	}{{"2000", "1990", ""}, {"b", "a", ""}, {"1.10", "1.9", entities.VersionValueType}} {
+		valueRange := RangeExpression{TagExpression{"year"}, ValueExpression{reversed.from}, ValueExpression{reversed.to}}
+		if _, err := ValuePredicate(valueRange, reversed.valueType); err == nil {
+			test.Fatalf("Expected an error for the range '%v..%v'.", reversed.from, reversed.to)
+		}
+	}
+
+	valueRange := RangeExpression{TagExpression{"year"}, ValueExpression{"1990"}, ValueExpression{"1990"}}
+	if _, err := ValuePredicate(valueRange, ""); err != nil {
+		test.Fatal(err)
+	}
+}
+
+func TestValuePredicateForSet(test *testing.T) {
+	// set-up
+
+	in := InExpression{TagExpression{"year"}, []ValueExpression{{"1999"}, {"2001"}}}
+	inSet, err := ValuePredicate(in, "")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test & validate
+
+	if !inSet("2001") || !inSet("1999.0") {
+		test.Fatal("Expected '2001' and '1999.0' to be in the set.")
+	}
+	if inSet("2000") {
+		test.Fatal("Expected '2000' not to be in the set.")
+	}
+}
+
+func TestValuePredicateForValuePresence(test *testing.T) {
+	// set-up
+
+	valued, err := ValuePredicate(ValuedExpression{TagExpression{"year"}}, "")
+	if err != nil {
+		test.Fatal(err)
+	}
+	unvalued, err := ValuePredicate(UnvaluedExpression{TagExpression{"year"}}, "")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test & validate
+
+	if !valued("2001") || valued("") {
+		test.Fatal("Expected only a value to satisfy 'has-value'.")
+	}
+	if unvalued("2001") || !unvalued("") {
+		test.Fatal("Expected only the absence of a value to satisfy 'not-valued'.")
+	}
+}
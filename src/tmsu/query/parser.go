@@ -55,6 +55,47 @@ type ComparisonExpression struct {
 	Value    ValueExpression
 }
 
+// A comparison against an attribute of the files themselves, such as their size or
+// modification time, rather than against their tags.
+type AttributeExpression struct {
+	Name     string
+	Operator string
+	Value    ValueExpression
+}
+
+// Matches the files tagged with the tag with any of the values.
+type InExpression struct {
+	Tag    TagExpression
+	Values []ValueExpression
+}
+
+// Matches the files tagged with the tag with a value within the inclusive range.
+type RangeExpression struct {
+	Tag  TagExpression
+	From ValueExpression
+	To   ValueExpression
+}
+
+// Matches the files tagged with the tag with any value.
+type ValuedExpression struct {
+	Tag TagExpression
+}
+
+// Matches the files tagged with the tag without a value.
+type UnvaluedExpression struct {
+	Tag TagExpression
+}
+
+// Matches the files without tags, which includes the paths within the query's scope that
+// are not in the database.
+type UntaggedExpression struct {
+}
+
+// Matches the files tagged with each of the tags and no others.
+type OnlyExpression struct {
+	Tags []TagExpression
+}
+
 type NotExpression struct {
 	Operand Expression
 }
@@ -221,17 +262,112 @@ func (parser Parser) comparison() (Expression, error) {
 	case ComparisonOperatorToken:
 		parser.scanner.Next()
 
+		token, err := parser.scanner.LookAhead()
+		if err != nil {
+			return nil, err
+		}
+
+		if valueRange, ok := token.(RangeToken); ok {
+			parser.scanner.Next()
+
+			return parser.valueRange(tag, typedToken.operator, valueRange)
+		}
+
 		value, err := parser.value()
 		if err != nil {
 			return nil, err
 		}
 
+		if IsAttribute(tag.Name) {
+			return AttributeExpression{tag.Name, typedToken.operator, value}, nil
+		}
+
 		return ComparisonExpression{tag, typedToken.operator, value}, nil
+	case InOperatorToken:
+		parser.scanner.Next()
+
+		names, err := parser.symbolList()
+		if err != nil {
+			return nil, err
+		}
+
+		values := make([]ValueExpression, len(names))
+		for index, name := range names {
+			values[index] = ValueExpression{name}
+		}
+
+		return InExpression{tag, values}, nil
+	case RangeToken:
+		parser.scanner.Next()
+
+		return RangeExpression{tag, ValueExpression{typedToken.from}, ValueExpression{typedToken.to}}, nil
+	case HasValueOperatorToken:
+		parser.scanner.Next()
+
+		return ValuedExpression{tag}, nil
+	case OpenParenToken:
+		if isFunction(tag.Name) {
+			return parser.function(tag.Name)
+		}
+	}
+
+	if tag.Name == UntaggedAttribute {
+		return UntaggedExpression{}, nil
 	}
 
 	return tag, nil
 }
 
+// Determines whether the name is that of one of the query functions, which take a
+// parenthesised list of tags.
+func isFunction(name string) bool {
+	switch name {
+	case "has-value", "not-valued", "only":
+		return true
+	default:
+		return false
+	}
+}
+
+// Parses the arguments to one of the query functions, such as 'has-value(year)'.
+func (parser Parser) function(name string) (Expression, error) {
+	names, err := parser.symbolList()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]TagExpression, len(names))
+	for index, tagName := range names {
+		tags[index] = TagExpression{tagName}
+	}
+
+	switch name {
+	case "has-value", "not-valued":
+		if len(tags) != 1 {
+			return nil, fmt.Errorf("'%v' takes a single tag.", name)
+		}
+
+		if name == "has-value" {
+			return ValuedExpression{tags[0]}, nil
+		}
+		return UnvaluedExpression{tags[0]}, nil
+	case "only":
+		return OnlyExpression{tags}, nil
+	default:
+		return nil, fmt.Errorf("unknown function '%v'.", name)
+	}
+}
+
+// Builds the expression for a comparison with a range of values, such as 'year = 1990..1999'.
+func (parser Parser) valueRange(tag TagExpression, operator string, valueRange RangeToken) (Expression, error) {
+	switch operator {
+	case "=", "==":
+		return RangeExpression{tag, ValueExpression{valueRange.from}, ValueExpression{valueRange.to}}, nil
+	default:
+		return nil, fmt.Errorf("a range of values can only be compared with '=', not '%v'.", operator)
+	}
+}
+
 func (parser Parser) tag() (TagExpression, error) {
 	token, err := parser.scanner.Next()
 	if err != nil {
@@ -259,3 +395,60 @@ func (parser Parser) value() (ValueExpression, error) {
 		return ValueExpression{}, fmt.Errorf("unexpected token: %v", Type(token))
 	}
 }
+
+// Parses a parenthesised, comma separated, list of tag or value names.
+func (parser Parser) symbolList() ([]string, error) {
+	token, err := parser.scanner.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token.(type) {
+	case OpenParenToken:
+	default:
+		return nil, fmt.Errorf("unexpected token: %v", Type(token))
+	}
+
+	names := make([]string, 0, 10)
+	for {
+		token, err := parser.scanner.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch typedToken := token.(type) {
+		case SymbolToken:
+			names = append(names, typedToken.name)
+		default:
+			return nil, fmt.Errorf("unexpected token: %v", Type(token))
+		}
+
+		token, err = parser.scanner.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch token.(type) {
+		case CommaToken:
+			continue
+		case CloseParenToken:
+			return names, nil
+		default:
+			return nil, fmt.Errorf("unexpected token: %v", Type(token))
+		}
+	}
+}
+
+func (parser Parser) closeParen() error {
+	token, err := parser.scanner.Next()
+	if err != nil {
+		return err
+	}
+
+	switch token.(type) {
+	case CloseParenToken:
+		return nil
+	default:
+		return fmt.Errorf("unexpected token: %v", Type(token))
+	}
+}
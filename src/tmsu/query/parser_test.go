@@ -116,6 +116,179 @@ func TestTagLessThanOrEqualValueParsing(test *testing.T) {
 	validateValue(comparison.Value, "2000", test)
 }
 
+func TestAttributeComparisonParsing(test *testing.T) {
+	scanner := NewScanner("mtime > 7d")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	attribute := expression.(AttributeExpression)
+	if attribute.Name != "mtime" || attribute.Operator != ">" {
+		test.Fatalf("Unexpected attribute comparison %v.", attribute)
+	}
+	validateValue(attribute.Value, "7d", test)
+}
+
+func TestUncomparedAttributeParsing(test *testing.T) {
+	scanner := NewScanner("mtime")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	validateTag(expression, "mtime", test)
+}
+
+func TestInParsing(test *testing.T) {
+	scanner := NewScanner("country in (fr, de, it)")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	in, ok := expression.(InExpression)
+	if !ok {
+		test.Fatalf("Expected set membership expression but was '%T'.", expression)
+	}
+	validateTag(in.Tag, "country", test)
+	if len(in.Values) != 3 {
+		test.Fatalf("Expected 3 values but were %v.", len(in.Values))
+	}
+	validateValue(in.Values[0], "fr", test)
+	validateValue(in.Values[1], "de", test)
+	validateValue(in.Values[2], "it", test)
+}
+
+func TestInvalidInParsing(test *testing.T) {
+	for _, text := range []string{"country in (fr,)", "country in (fr de)", "country in ()", "country in (fr"} {
+		if _, err := Parse(text); err == nil {
+			test.Fatalf("Expected an error parsing '%v'.", text)
+		}
+	}
+}
+
+func TestInAsTagParsing(test *testing.T) {
+	scanner := NewScanner("country in fr")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	and := validateAnd(expression)
+	validateTag(and.RightOperand, "fr", test)
+	and = validateAnd(and.LeftOperand)
+	validateTag(and.LeftOperand, "country", test)
+	validateTag(and.RightOperand, "in", test)
+}
+
+func TestRangeParsing(test *testing.T) {
+	for _, text := range []string{"music year 1990..1999", "music year = 1990..1999"} {
+		scanner := NewScanner(text)
+		parser := NewParser(scanner)
+
+		expression, err := parser.Parse()
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		dump(expression)
+
+		and := validateAnd(expression)
+		validateTag(and.LeftOperand, "music", test)
+		valueRange, ok := and.RightOperand.(RangeExpression)
+		if !ok {
+			test.Fatalf("Expected range expression but was '%T'.", and.RightOperand)
+		}
+		validateTag(valueRange.Tag, "year", test)
+		validateValue(valueRange.From, "1990", test)
+		validateValue(valueRange.To, "1999", test)
+	}
+}
+
+func TestInvalidRangeParsing(test *testing.T) {
+	for _, text := range []string{"year < 1990..1999", "year != 1990..1999", "year = 1990..", "year = ..1999"} {
+		if _, err := Parse(text); err == nil {
+			test.Fatalf("Expected an error parsing '%v'.", text)
+		}
+	}
+}
+
+func TestValuePresenceParsing(test *testing.T) {
+	scanner := NewScanner("year ? and has-value(month) and not-valued(day)")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	and := validateAnd(expression)
+	innerAnd := validateAnd(and.LeftOperand)
+	if innerAnd.LeftOperand != (ValuedExpression{TagExpression{"year"}}) {
+		test.Fatalf("Expected 'year ?' but was '%v'.", innerAnd.LeftOperand)
+	}
+	if innerAnd.RightOperand != (ValuedExpression{TagExpression{"month"}}) {
+		test.Fatalf("Expected 'has-value(month)' but was '%v'.", innerAnd.RightOperand)
+	}
+	if and.RightOperand != (UnvaluedExpression{TagExpression{"day"}}) {
+		test.Fatalf("Expected 'not-valued(day)' but was '%v'.", and.RightOperand)
+	}
+}
+
+func TestTagPredicateParsing(test *testing.T) {
+	scanner := NewScanner("untagged or only(photo, raw) or tagcount < 3")
+	parser := NewParser(scanner)
+
+	expression, err := parser.Parse()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	dump(expression)
+
+	or := validateOr(expression)
+	innerOr := validateOr(or.LeftOperand)
+	if _, ok := innerOr.LeftOperand.(UntaggedExpression); !ok {
+		test.Fatalf("Expected 'untagged' but was '%v'.", innerOr.LeftOperand)
+	}
+	only, ok := innerOr.RightOperand.(OnlyExpression)
+	if !ok || len(only.Tags) != 2 {
+		test.Fatalf("Expected 'only' with two tags but was '%v'.", innerOr.RightOperand)
+	}
+	validateTag(only.Tags[0], "photo", test)
+	validateTag(only.Tags[1], "raw", test)
+	if or.RightOperand != (AttributeExpression{TagCountAttribute, "<", ValueExpression{"3"}}) {
+		test.Fatalf("Expected 'tagcount < 3' but was '%v'.", or.RightOperand)
+	}
+}
+
+func TestFunctionArityParsing(test *testing.T) {
+	for _, text := range []string{"has-value(year, month)", "not-valued()", "only()"} {
+		if _, err := Parse(text); err == nil {
+			test.Fatalf("Expected an error parsing '%v'.", text)
+		}
+	}
+}
+
 func TestNotParsing(test *testing.T) {
 	scanner := NewScanner("not cheese")
 	parser := NewParser(scanner)
@@ -17,6 +17,10 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 
 package query
 
+import (
+	"fmt"
+)
+
 func Parse(query string) (Expression, error) {
 	scanner := NewScanner(query)
 	parser := NewParser(scanner)
@@ -55,6 +59,65 @@ func ValueNames(expression Expression) []string {
 	return names
 }
 
+// Retrieves the set of file attribute names from an expression
+func AttributeNames(expression Expression) []string {
+	names := make([]string, 0, 10)
+	names = attributeNames(expression, names)
+
+	return names
+}
+
+// Retrieves the set of names of the tags whose values are tested by an expression
+func TestedTagNames(expression Expression) []string {
+	names := make([]string, 0, 10)
+	names = testedTagNames(expression, names)
+
+	return names
+}
+
+// Retrieves the tag whose values are tested by a comparison, set membership, range or
+// value presence expression.
+func TestedTag(expression Expression) (TagExpression, bool) {
+	switch exp := expression.(type) {
+	case ComparisonExpression:
+		return exp.Tag, true
+	case InExpression:
+		return exp.Tag, true
+	case RangeExpression:
+		return exp.Tag, true
+	case ValuedExpression:
+		return exp.Tag, true
+	case UnvaluedExpression:
+		return exp.Tag, true
+	default:
+		return TagExpression{}, false
+	}
+}
+
+// Substitutes the tag whose values are tested by a comparison, set membership, range or
+// value presence expression.
+func WithTestedTag(expression Expression, tag TagExpression) Expression {
+	switch exp := expression.(type) {
+	case ComparisonExpression:
+		exp.Tag = tag
+		return exp
+	case InExpression:
+		exp.Tag = tag
+		return exp
+	case RangeExpression:
+		exp.Tag = tag
+		return exp
+	case ValuedExpression:
+		exp.Tag = tag
+		return exp
+	case UnvaluedExpression:
+		exp.Tag = tag
+		return exp
+	default:
+		panic(fmt.Sprintf("unsupported expression type '%T'.", expression))
+	}
+}
+
 // unexported
 
 func tagNames(expression Expression, names []string) []string {
@@ -73,6 +136,20 @@ func tagNames(expression Expression, names []string) []string {
 		names = tagNames(exp.RightOperand, names)
 	case ComparisonExpression:
 		names = append(names, exp.Tag.Name)
+	case InExpression:
+		names = append(names, exp.Tag.Name)
+	case RangeExpression:
+		names = append(names, exp.Tag.Name)
+	case ValuedExpression:
+		names = append(names, exp.Tag.Name)
+	case UnvaluedExpression:
+		names = append(names, exp.Tag.Name)
+	case OnlyExpression:
+		for _, tag := range exp.Tags {
+			names = append(names, tag.Name)
+		}
+	case AttributeExpression, UntaggedExpression:
+		// nowt
 	default:
 		panic("unsupported token type")
 	}
@@ -96,6 +173,69 @@ func valueNames(expression Expression, names []string) []string {
 		names = valueNames(exp.RightOperand, names)
 	case ComparisonExpression:
 		names = append(names, exp.Value.Name)
+	case InExpression:
+		for _, value := range exp.Values {
+			names = append(names, value.Name)
+		}
+	case RangeExpression:
+		names = append(names, exp.From.Name, exp.To.Name)
+	case ValuedExpression, UnvaluedExpression, UntaggedExpression, OnlyExpression:
+		// nowt
+	case AttributeExpression:
+		// nowt
+	default:
+		panic("unsupported token type")
+	}
+
+	return names
+}
+
+func testedTagNames(expression Expression, names []string) []string {
+	switch exp := expression.(type) {
+	case EmptyExpression:
+		// nowt
+	case TagExpression:
+		// nowt
+	case NotExpression:
+		names = testedTagNames(exp.Operand, names)
+	case AndExpression:
+		names = testedTagNames(exp.LeftOperand, names)
+		names = testedTagNames(exp.RightOperand, names)
+	case OrExpression:
+		names = testedTagNames(exp.LeftOperand, names)
+		names = testedTagNames(exp.RightOperand, names)
+	case ComparisonExpression, InExpression, RangeExpression, ValuedExpression, UnvaluedExpression:
+		tag, _ := TestedTag(exp)
+		names = append(names, tag.Name)
+	case AttributeExpression, UntaggedExpression, OnlyExpression:
+		// nowt
+	default:
+		panic("unsupported token type")
+	}
+
+	return names
+}
+
+func attributeNames(expression Expression, names []string) []string {
+	switch exp := expression.(type) {
+	case EmptyExpression:
+		// nowt
+	case TagExpression:
+		// nowt
+	case NotExpression:
+		names = attributeNames(exp.Operand, names)
+	case AndExpression:
+		names = attributeNames(exp.LeftOperand, names)
+		names = attributeNames(exp.RightOperand, names)
+	case OrExpression:
+		names = attributeNames(exp.LeftOperand, names)
+		names = attributeNames(exp.RightOperand, names)
+	case ComparisonExpression, InExpression, RangeExpression, ValuedExpression, UnvaluedExpression, OnlyExpression:
+		// nowt
+	case AttributeExpression:
+		names = append(names, exp.Name)
+	case UntaggedExpression:
+		names = append(names, UntaggedAttribute)
 	default:
 		panic("unsupported token type")
 	}
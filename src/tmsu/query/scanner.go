@@ -45,6 +45,14 @@ func Type(token Token) string {
 		return "'or'"
 	case ComparisonOperatorToken:
 		return typedToken.operator
+	case InOperatorToken:
+		return "'in'"
+	case HasValueOperatorToken:
+		return "'?'"
+	case CommaToken:
+		return "','"
+	case RangeToken:
+		return "range"
 	case EndToken:
 		return "EOF"
 	case nil:
@@ -80,13 +88,31 @@ type ComparisonOperatorToken struct {
 	operator string
 }
 
+type InOperatorToken struct {
+}
+
+type HasValueOperatorToken struct {
+}
+
+type CommaToken struct {
+}
+
+// An inclusive range of values, such as the '1990..1999' in 'year 1990..1999' or
+// 'year = 1990..1999'.
+type RangeToken struct {
+	from string
+	to   string
+}
+
 type Scanner struct {
 	stream    *strings.Reader
 	lookAhead Token
+	previous  Token
+	position  position
 }
 
 func NewScanner(query string) *Scanner {
-	return &Scanner{strings.NewReader(query), nil}
+	return &Scanner{strings.NewReader(query), nil, nil, termPosition}
 }
 
 func (scanner *Scanner) LookAhead() (Token, error) {
@@ -118,7 +144,61 @@ func (scanner *Scanner) Next() (Token, error) {
 
 // unexported
 
+// Where in a query the scanner is, which determines whether some characters are operators
+// or part of a name: '~', for example, is an operator only where it follows a tag so that
+// names such as 'a~b' or '~a' need not be quoted.
+type position int
+
+const (
+	termPosition     position = iota // where a tag or a logical operator is expected
+	operatorPosition                 // after a tag, where an operator may follow
+	valuePosition                    // after a comparison operator
+	listPosition                     // within a parenthesised list of names
+)
+
 func (scanner *Scanner) readToken() (Token, error) {
+	token, err := scanner.readPositionedToken()
+	if err != nil {
+		return nil, err
+	}
+
+	scanner.position = scanner.nextPosition(token)
+	scanner.previous = token
+
+	return token, nil
+}
+
+// Determines where in the query the scanner is after reading the token.
+func (scanner *Scanner) nextPosition(token Token) position {
+	switch token.(type) {
+	case SymbolToken:
+		switch scanner.position {
+		case listPosition:
+			return listPosition
+		case valuePosition:
+			return termPosition
+		default:
+			return operatorPosition
+		}
+	case ComparisonOperatorToken:
+		return valuePosition
+	case CommaToken:
+		return listPosition
+	case OpenParenToken:
+		switch previous := scanner.previous.(type) {
+		case InOperatorToken:
+			return listPosition
+		case SymbolToken:
+			if scanner.position == operatorPosition && isFunction(previous.name) {
+				return listPosition
+			}
+		}
+	}
+
+	return termPosition
+}
+
+func (scanner *Scanner) readPositionedToken() (Token, error) {
 	r, _, err := scanner.stream.ReadRune()
 	for err == nil && unicode.IsSpace(r) {
 		r, _, err = scanner.stream.ReadRune()
@@ -136,8 +216,16 @@ func (scanner *Scanner) readToken() (Token, error) {
 		return OpenParenToken{}, nil
 	case r == rune(')'):
 		return CloseParenToken{}, nil
+	case r == rune(',') && scanner.position == listPosition:
+		return CommaToken{}, nil
+	case r == rune('?') && scanner.position == operatorPosition && scanner.atTermEnd():
+		return HasValueOperatorToken{}, nil
+	case r == rune('~') && scanner.position == operatorPosition:
+		return scanner.readComparisonOperatorToken(r)
 	case r == rune('!'), r == rune('='), r == rune('<'), r == rune('>'):
 		return scanner.readComparisonOperatorToken(r)
+	case r == rune('"') && (scanner.position == valuePosition || scanner.position == listPosition):
+		return scanner.readQuotedToken()
 	case unicode.IsOneOf(symbolChars, r):
 		return scanner.readTextToken(r)
 	default:
@@ -174,20 +262,46 @@ func (scanner *Scanner) readTextToken(r rune) (Token, error) {
 		return ComparisonOperatorToken{">="}, nil
 	}
 
+	if (text == "in" || text == "IN") && scanner.position == operatorPosition && scanner.atList() {
+		return InOperatorToken{}, nil
+	}
+
+	if index := strings.Index(text, ".."); index != -1 {
+		from, to := text[:index], text[index+2:]
+
+		switch scanner.position {
+		case valuePosition:
+			if from == "" || to == "" {
+				return nil, fmt.Errorf("invalid range '%v': a range needs both a lower and an upper bound. Enclose the value in double quotes to compare it as is.", text)
+			}
+
+			return RangeToken{from, to}, nil
+		case operatorPosition:
+			// a range may directly follow the tag, as in 'year 1990..1999'
+			if from != "" && to != "" {
+				return RangeToken{from, to}, nil
+			}
+		}
+	}
+
 	return SymbolToken{text}, nil
 }
 
 func (scanner *Scanner) readComparisonOperatorToken(r rune) (Token, error) {
 	switch r {
+	case rune('~'):
+		return ComparisonOperatorToken{"~"}, nil
 	case rune('='), rune('!'), rune('<'), rune('>'):
 		r2, _, err := scanner.stream.ReadRune()
 		if err != nil {
 			return nil, err
 		}
 
-		switch r2 {
-		case rune('='):
+		switch {
+		case r2 == rune('='):
 			return ComparisonOperatorToken{string(r) + "="}, nil
+		case r == rune('=') && r2 == rune('~'):
+			return ComparisonOperatorToken{"=~"}, nil
 		default:
 			scanner.stream.UnreadRune()
 			return ComparisonOperatorToken{string(r)}, nil
@@ -215,6 +329,9 @@ func (scanner *Scanner) readString(initialRune rune) (string, error) {
 		case unicode.IsSpace(r), r == rune(')'), r == rune('('), r == rune('='), r == rune('!'), r == rune('<'), r == rune('>'):
 			scanner.stream.UnreadRune()
 			return text, nil
+		case r == rune(',') && scanner.position == listPosition:
+			scanner.stream.UnreadRune()
+			return text, nil
 		case unicode.IsOneOf(symbolChars, r):
 			text += string(r)
 		default:
@@ -224,3 +341,59 @@ func (scanner *Scanner) readString(initialRune rune) (string, error) {
 
 	panic("unreachable")
 }
+
+// Determines whether the next character, if any, ends a term: that is whether it is
+// whitespace or a closing parenthesis.
+func (scanner *Scanner) atTermEnd() bool {
+	r, _, err := scanner.stream.ReadRune()
+	if err != nil {
+		return true
+	}
+	scanner.stream.UnreadRune()
+
+	return unicode.IsSpace(r) || r == rune(')')
+}
+
+// Determines whether the next characters, ignoring whitespace, open a parenthesised list.
+func (scanner *Scanner) atList() bool {
+	offset, _ := scanner.stream.Seek(0, io.SeekCurrent)
+	defer scanner.stream.Seek(offset, io.SeekStart)
+
+	r, _, err := scanner.stream.ReadRune()
+	for err == nil && unicode.IsSpace(r) {
+		r, _, err = scanner.stream.ReadRune()
+	}
+
+	return err == nil && r == rune('(')
+}
+
+// Reads text enclosed in double quotes, which may contain any character. A backslash
+// escapes the character following it.
+func (scanner *Scanner) readQuotedToken() (Token, error) {
+	text := ""
+
+	for {
+		r, _, err := scanner.stream.ReadRune()
+		if err == io.EOF {
+			return nil, fmt.Errorf("unterminated quoted text: \"%v", text)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch r {
+		case rune('"'):
+			return SymbolToken{text}, nil
+		case rune('\\'):
+			r, _, err = scanner.stream.ReadRune()
+			if err == io.EOF {
+				return nil, fmt.Errorf("unterminated quoted text: \"%v", text)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		text += string(r)
+	}
+}
@@ -105,6 +105,101 @@ func TestSingleTagWithValue(test *testing.T) {
 	validateEnd(token, test)
 }
 
+func TestPatternOperators(test *testing.T) {
+	scanner := NewScanner(`year ~ 19* name=~"^a (b)\"c"`)
+
+	token, err := scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "year", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateComparisonOperator(token, "~", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "19*", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, "name", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateComparisonOperator(token, "=~", test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateSymbolToken(token, `^a (b)"c`, test)
+
+	token, err = scanner.Next()
+	if err != nil {
+		test.Fatal(err)
+	}
+	validateEnd(token, test)
+}
+
+func TestOperatorCharactersInNames(test *testing.T) {
+	scanner := NewScanner(`~a and b~c or d,e "f" g ~ "1*" h ?`)
+
+	expected := []Token{SymbolToken{"~a"}, AndOperatorToken{}, SymbolToken{"b~c"}, OrOperatorToken{}, SymbolToken{"d,e"},
+		SymbolToken{`"f"`}, SymbolToken{"g"}, ComparisonOperatorToken{"~"}, SymbolToken{"1*"}, SymbolToken{"h"},
+		HasValueOperatorToken{}, EndToken{}}
+
+	for _, expectedToken := range expected {
+		token, err := scanner.Next()
+		if err != nil {
+			test.Fatal(err)
+		}
+		if token != expectedToken {
+			test.Fatalf("Expected %v token '%v' but was %v token '%v'.", Type(expectedToken), expectedToken, Type(token), token)
+		}
+	}
+}
+
+func TestUnterminatedQuotedText(test *testing.T) {
+	scanner := NewScanner(`name = "abc`)
+
+	if _, err := scanner.Next(); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := scanner.Next(); err == nil {
+		test.Fatal("Expected an error for unterminated quoted text.")
+	}
+}
+
+func TestSetAndRangeTokens(test *testing.T) {
+	scanner := NewScanner(`country in (fr,de) year ? year?? year = 1990..1999 year = "1990..1999" 1990..1999 in x year 1..2`)
+
+	expected := []Token{SymbolToken{"country"}, InOperatorToken{}, OpenParenToken{}, SymbolToken{"fr"}, CommaToken{},
+		SymbolToken{"de"}, CloseParenToken{}, SymbolToken{"year"}, HasValueOperatorToken{}, SymbolToken{"year??"},
+		SymbolToken{"year"}, ComparisonOperatorToken{"="}, RangeToken{"1990", "1999"}, SymbolToken{"year"},
+		ComparisonOperatorToken{"="}, SymbolToken{"1990..1999"}, SymbolToken{"1990..1999"}, SymbolToken{"in"},
+		SymbolToken{"x"}, SymbolToken{"year"}, RangeToken{"1", "2"}, EndToken{}}
+
+	for _, expectedToken := range expected {
+		token, err := scanner.Next()
+		if err != nil {
+			test.Fatal(err)
+		}
+		if token != expectedToken {
+			test.Fatalf("Expected %v token '%v' but was %v token '%v'.", Type(expectedToken), expectedToken, Type(token), token)
+		}
+	}
+}
+
 func TestComplexQuery(test *testing.T) {
 	scanner := NewScanner("not cheese and (peas or sweetcorn) and not beans and bestbefore=2014")
 
@@ -0,0 +1,85 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package query
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// The paths to which a query is confined.
+//
+// A file is within the scope if it is, or is beneath, any of the included paths and is
+// not, nor is beneath, any of the excluded paths. A scope without included paths
+// includes every path.
+type PathScope struct {
+	Include []string
+	Exclude []string
+}
+
+// Creates a scope from the specified included and excluded paths, ignoring empty paths.
+func NewPathScope(include, exclude []string) PathScope {
+	return PathScope{cleanPaths(include), cleanPaths(exclude)}
+}
+
+// Determines whether the scope is unconfined.
+func (scope PathScope) IsEmpty() bool {
+	return len(scope.Include) == 0 && len(scope.Exclude) == 0
+}
+
+// Determines whether the specified path lies within the scope.
+func (scope PathScope) Contains(path string) bool {
+	path = filepath.Clean(path)
+
+	included := len(scope.Include) == 0
+	for _, include := range scope.Include {
+		if isWithin(path, include) {
+			included = true
+			break
+		}
+	}
+
+	if !included {
+		return false
+	}
+
+	for _, exclude := range scope.Exclude {
+		if isWithin(path, exclude) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// unexported
+
+func cleanPaths(paths []string) []string {
+	cleaned := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if path != "" {
+			cleaned = append(cleaned, filepath.Clean(path))
+		}
+	}
+
+	return cleaned
+}
+
+func isWithin(path, parent string) bool {
+	return path == parent || strings.HasPrefix(path, strings.TrimSuffix(parent, string(filepath.Separator))+string(filepath.Separator))
+}
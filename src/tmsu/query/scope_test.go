@@ -0,0 +1,57 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package query
+
+import (
+	"testing"
+)
+
+func TestPathScopeContains(test *testing.T) {
+	scope := NewPathScope([]string{"/tmp/a", "/tmp/b/"}, []string{"/tmp/a/x", ""})
+
+	paths := []struct {
+		path     string
+		expected bool
+	}{
+		{"/tmp/a", true},
+		{"/tmp/a/file", true},
+		{"/tmp/ab", false},
+		{"/tmp/b/file", true},
+		{"/tmp/a/x", false},
+		{"/tmp/a/x/file", false},
+		{"/tmp/a/xy", true},
+		{"/tmp/c", false},
+	}
+
+	for _, p := range paths {
+		if scope.Contains(p.path) != p.expected {
+			test.Fatalf("Expected Contains('%v') to be %v.", p.path, p.expected)
+		}
+	}
+}
+
+func TestEmptyPathScopeContainsEverything(test *testing.T) {
+	scope := NewPathScope([]string{""}, nil)
+
+	if !scope.IsEmpty() {
+		test.Fatal("Expected scope to be empty.")
+	}
+	if !scope.Contains("/") || !scope.Contains("/tmp/a") {
+		test.Fatal("Expected empty scope to contain every path.")
+	}
+}
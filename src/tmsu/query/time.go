@@ -0,0 +1,138 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// A condition on a time, as given by comparing a time attribute with a time literal in a
+// query. The time must be at or after From and before Until, where set, or, if the
+// condition is negated, the opposite.
+type TimeCondition struct {
+	From    time.Time
+	Until   time.Time
+	Negated bool
+}
+
+// Parses a comparison against a time literal into a condition on times.
+//
+// A time literal is either a date, optionally with a time, or a duration, such as '7d' or
+// '3months', that denotes the time that long before now. Dates denote a period according
+// to their precision so that, for example, '= 2014-03' matches any time in March 2014 and
+// '> 2014-03' any time after it. Dates without a time zone are in local time.
+func ParseTimeCondition(operator, operand string, now time.Time) (TimeCondition, error) {
+	start, end, err := parseTimeLiteral(operand, now)
+	if err != nil {
+		return TimeCondition{}, err
+	}
+
+	switch operator {
+	case "=", "==":
+		return TimeCondition{start, end, false}, nil
+	case "!=":
+		return TimeCondition{start, end, true}, nil
+	case "<":
+		return TimeCondition{time.Time{}, start, false}, nil
+	case "<=":
+		return TimeCondition{time.Time{}, end, false}, nil
+	case ">":
+		return TimeCondition{end, time.Time{}, false}, nil
+	case ">=":
+		return TimeCondition{start, time.Time{}, false}, nil
+	default:
+		return TimeCondition{}, fmt.Errorf("unsupported comparison operator '%v'", operator)
+	}
+}
+
+// Determines whether the time satisfies the condition.
+func (condition TimeCondition) Matches(t time.Time) bool {
+	matches := (condition.From.IsZero() || !t.Before(condition.From)) &&
+		(condition.Until.IsZero() || t.Before(condition.Until))
+
+	return matches != condition.Negated
+}
+
+// unexported
+
+type timeLayout struct {
+	layout string
+	period func(time.Time) time.Time
+}
+
+var timeLayouts = []timeLayout{
+	{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{"2006-01-02T15:04", func(t time.Time) time.Time { return t.Add(time.Minute) }},
+	{"2006-01-02T15:04:05", func(t time.Time) time.Time { return t.Add(time.Second) }},
+	{time.RFC3339, func(t time.Time) time.Time { return t.Add(time.Second) }},
+}
+
+var durationPattern = regexp.MustCompile(`^([0-9]+)([a-z]+)$`)
+
+var durationUnits = map[string]func(time.Time, int) time.Time{
+	"s":       func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * time.Second) },
+	"sec":     func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * time.Second) },
+	"second":  func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * time.Second) },
+	"seconds": func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * time.Second) },
+	"min":     func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * time.Minute) },
+	"minute":  func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * time.Minute) },
+	"minutes": func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * time.Minute) },
+	"h":       func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * time.Hour) },
+	"hour":    func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * time.Hour) },
+	"hours":   func(t time.Time, n int) time.Time { return t.Add(-time.Duration(n) * time.Hour) },
+	"d":       func(t time.Time, n int) time.Time { return t.AddDate(0, 0, -n) },
+	"day":     func(t time.Time, n int) time.Time { return t.AddDate(0, 0, -n) },
+	"days":    func(t time.Time, n int) time.Time { return t.AddDate(0, 0, -n) },
+	"w":       func(t time.Time, n int) time.Time { return t.AddDate(0, 0, -7*n) },
+	"week":    func(t time.Time, n int) time.Time { return t.AddDate(0, 0, -7*n) },
+	"weeks":   func(t time.Time, n int) time.Time { return t.AddDate(0, 0, -7*n) },
+	"month":   func(t time.Time, n int) time.Time { return t.AddDate(0, -n, 0) },
+	"months":  func(t time.Time, n int) time.Time { return t.AddDate(0, -n, 0) },
+	"y":       func(t time.Time, n int) time.Time { return t.AddDate(-n, 0, 0) },
+	"year":    func(t time.Time, n int) time.Time { return t.AddDate(-n, 0, 0) },
+	"years":   func(t time.Time, n int) time.Time { return t.AddDate(-n, 0, 0) },
+}
+
+// Parses a time literal into the period it denotes. Durations denote an instant, so the
+// period is empty.
+func parseTimeLiteral(text string, now time.Time) (time.Time, time.Time, error) {
+	for _, layout := range timeLayouts {
+		if start, err := time.ParseInLocation(layout.layout, text, time.Local); err == nil {
+			return start, layout.period(start), nil
+		}
+	}
+
+	if match := durationPattern.FindStringSubmatch(text); match != nil {
+		if subtract, ok := durationUnits[match[2]]; ok {
+			count, err := strconv.Atoi(match[1])
+			if err != nil {
+				return time.Time{}, time.Time{}, fmt.Errorf("invalid duration '%v': %v", text, err)
+			}
+
+			instant := subtract(now, count)
+			return instant, instant, nil
+		}
+	}
+
+	return time.Time{}, time.Time{}, fmt.Errorf("'%v' is neither a date, such as 2014-03-09 or 2014-03-09T13:45, nor a duration, such as 7d or 3months", text)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package query
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeConditionForDate(test *testing.T) {
+	// set-up
+
+	now := time.Date(2014, 3, 9, 12, 0, 0, 0, time.Local)
+
+	inMarch, err := ParseTimeCondition("=", "2014-03", now)
+	if err != nil {
+		test.Fatal(err)
+	}
+	afterMarch, err := ParseTimeCondition(">", "2014-03", now)
+	if err != nil {
+		test.Fatal(err)
+	}
+	upToTheNinth, err := ParseTimeCondition("<=", "2014-03-09", now)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test & validate
+
+	if !inMarch.Matches(time.Date(2014, 3, 31, 23, 59, 0, 0, time.Local)) {
+		test.Fatal("Expected the end of March to be in March.")
+	}
+	if inMarch.Matches(time.Date(2014, 4, 1, 0, 0, 0, 0, time.Local)) {
+		test.Fatal("Expected April not to be in March.")
+	}
+	if afterMarch.Matches(time.Date(2014, 3, 20, 0, 0, 0, 0, time.Local)) {
+		test.Fatal("Expected a time in March not to be after March.")
+	}
+	if !afterMarch.Matches(time.Date(2014, 4, 1, 0, 0, 0, 0, time.Local)) {
+		test.Fatal("Expected April to be after March.")
+	}
+	if !upToTheNinth.Matches(time.Date(2014, 3, 9, 18, 0, 0, 0, time.Local)) {
+		test.Fatal("Expected the evening of the ninth to be up to the ninth.")
+	}
+}
+
+func TestTimeConditionForDuration(test *testing.T) {
+	// set-up
+
+	now := time.Date(2014, 3, 9, 12, 0, 0, 0, time.Local)
+
+	lastWeek, err := ParseTimeCondition(">", "7d", now)
+	if err != nil {
+		test.Fatal(err)
+	}
+	olderThanThreeMonths, err := ParseTimeCondition("<", "3months", now)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test & validate
+
+	if !lastWeek.Matches(now.Add(-time.Hour)) {
+		test.Fatal("Expected an hour ago to be within the last seven days.")
+	}
+	if lastWeek.Matches(now.AddDate(0, 0, -8)) {
+		test.Fatal("Expected eight days ago not to be within the last seven days.")
+	}
+	if !olderThanThreeMonths.Matches(time.Date(2013, 12, 1, 0, 0, 0, 0, time.Local)) {
+		test.Fatal("Expected December to be more than three months ago.")
+	}
+	if olderThanThreeMonths.Matches(time.Date(2014, 1, 1, 0, 0, 0, 0, time.Local)) {
+		test.Fatal("Expected January not to be more than three months ago.")
+	}
+}
+
+func TestTimeConditionRejectsInvalidLiteral(test *testing.T) {
+	for _, text := range []string{"yesterday", "7", "7m", "2014-13-01"} {
+		if _, err := ParseTimeCondition(">", text, time.Now()); err == nil {
+			test.Fatalf("Expected an error for time literal '%v'.", text)
+		}
+	}
+}
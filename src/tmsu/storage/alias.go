@@ -0,0 +1,159 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package storage
+
+import (
+	"fmt"
+	"tmsu/entities"
+	"tmsu/query"
+)
+
+// The set of tag aliases.
+func (storage *Storage) Aliases() (entities.Aliases, error) {
+	return storage.Db.Aliases()
+}
+
+// Retrieves the aliases of the specified tag.
+func (storage *Storage) AliasesByTagId(tagId entities.TagId) (entities.Aliases, error) {
+	return storage.Db.AliasesByTagId(tagId)
+}
+
+// Retrieves a specific alias.
+func (storage *Storage) AliasByName(name string) (*entities.Alias, error) {
+	return storage.Db.AliasByName(name)
+}
+
+// Adds an alias by which the specified tag may also be referred to.
+func (storage *Storage) AddAlias(name string, tagId entities.TagId) (*entities.Alias, error) {
+	if err := validateTagName(name); err != nil {
+		return nil, err
+	}
+
+	tag, err := storage.Db.TagByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if tag != nil {
+		return nil, fmt.Errorf("there is already a tag named '%v'", name)
+	}
+
+	alias, err := storage.Db.AliasByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if alias != nil {
+		return nil, fmt.Errorf("'%v' is already an alias of tag '%v'", name, alias.Tag.Name)
+	}
+
+	return storage.Db.InsertAlias(name, tagId)
+}
+
+// Removes the specified alias.
+func (storage *Storage) RemoveAlias(name string) error {
+	return storage.Db.DeleteAlias(name)
+}
+
+// Moves the aliases of one tag to another.
+func (storage *Storage) MoveAliases(sourceTagId, destTagId entities.TagId) error {
+	return storage.Db.UpdateAliasesForTagId(sourceTagId, destTagId)
+}
+
+// Resolves the specified names, which may be tag names or aliases, to tag names.
+func (storage *Storage) CanonicalTagNames(names []string) ([]string, error) {
+	return storage.resolveTagNames(names)
+}
+
+// unexported
+
+// Resolves the specified names, which may be tag names or aliases, to tag names.
+func (storage *Storage) resolveTagNames(names []string) ([]string, error) {
+	aliases, err := storage.Db.AliasesByNames(names)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve aliases: %v", err)
+	}
+
+	tagNames := make([]string, len(names))
+	for index, name := range names {
+		if alias := aliases.Find(name); alias != nil {
+			tagNames[index] = alias.Tag.Name
+		} else {
+			tagNames[index] = name
+		}
+	}
+
+	return tagNames, nil
+}
+
+// Rewrites the tags in the query expression that are referred to by an alias to use the
+// tag's name.
+func (storage *Storage) resolveAliases(expression query.Expression) (query.Expression, error) {
+	names := query.TagNames(expression)
+	if len(names) == 0 {
+		return expression, nil
+	}
+
+	aliases, err := storage.Db.AliasesByNames(names)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve aliases: %v", err)
+	}
+	if len(aliases) == 0 {
+		return expression, nil
+	}
+
+	return resolveAliasesRecursive(expression, aliases), nil
+}
+
+func resolveAliasesRecursive(expression query.Expression, aliases entities.Aliases) query.Expression {
+	switch typedExpression := expression.(type) {
+	case query.OrExpression:
+		typedExpression.LeftOperand = resolveAliasesRecursive(typedExpression.LeftOperand, aliases)
+		typedExpression.RightOperand = resolveAliasesRecursive(typedExpression.RightOperand, aliases)
+		return typedExpression
+	case query.AndExpression:
+		typedExpression.LeftOperand = resolveAliasesRecursive(typedExpression.LeftOperand, aliases)
+		typedExpression.RightOperand = resolveAliasesRecursive(typedExpression.RightOperand, aliases)
+		return typedExpression
+	case query.NotExpression:
+		typedExpression.Operand = resolveAliasesRecursive(typedExpression.Operand, aliases)
+		return typedExpression
+	case query.TagExpression:
+		if alias := aliases.Find(typedExpression.Name); alias != nil {
+			typedExpression.Name = alias.Tag.Name
+		}
+		return typedExpression
+	case query.ComparisonExpression, query.InExpression, query.RangeExpression, query.ValuedExpression, query.UnvaluedExpression:
+		tag, _ := query.TestedTag(typedExpression)
+		if alias := aliases.Find(tag.Name); alias != nil {
+			return query.WithTestedTag(typedExpression, query.TagExpression{alias.Tag.Name})
+		}
+		return typedExpression
+	case query.OnlyExpression:
+		tags := make([]query.TagExpression, len(typedExpression.Tags))
+		for index, tag := range typedExpression.Tags {
+			if alias := aliases.Find(tag.Name); alias != nil {
+				tag.Name = alias.Tag.Name
+			}
+			tags[index] = tag
+		}
+		return query.OnlyExpression{tags}
+	case query.UntaggedExpression, query.ValueExpression, query.AttributeExpression, query.EmptyExpression:
+		return expression
+	default:
+		panic(fmt.Sprintf("unsupported expression type '%T'.", typedExpression))
+	}
+}
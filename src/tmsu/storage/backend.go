@@ -0,0 +1,168 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package storage
+
+import (
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/entities"
+	"tmsu/query"
+)
+
+// The persistence operations the storage layer is built upon.
+//
+// Paths passed to and returned by a backend are stored paths: the storage layer is
+// responsible for mapping them to and from paths on this host. Backends are not safe for
+// concurrent use.
+type Backend interface {
+	// A description of where the data is held, such as the path of the database file.
+	Location() string
+
+	Begin() error
+	BeginWrite() error // a transaction that takes the write lock up front
+	Commit() error
+	Rollback() error
+	Close() error
+
+	Backup(path string) error
+	BackupRotated(basePath string, keep uint) (string, error)
+	Restore(path string) error
+
+	// files
+
+	FileCount() (uint, error)
+	Files() (entities.Files, error)
+	File(id entities.FileId) (*entities.File, error)
+	FileByPath(path string) (*entities.File, error)
+	FilesByDirectory(path string) (entities.Files, error)
+	FilesInDirectory(path string) (entities.Files, error)
+	FileCountByFingerprint(fingerprint fingerprint.Fingerprint) (uint, error)
+	FilesByFingerprint(fingerprint fingerprint.Fingerprint) (entities.Files, error)
+	UntaggedFiles() (entities.Files, error)
+	QueryFileCount(expression query.Expression, scope query.PathScope) (uint, error)
+	QueryFiles(expression query.Expression, scope query.PathScope) (entities.Files, error)
+	DuplicateFiles() ([]entities.Files, error)
+	InsertFile(path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error)
+	InsertFiles(files entities.Files) error
+	UpdateFile(fileId entities.FileId, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error)
+	DeleteFile(fileId entities.FileId) error
+	DeleteUntaggedFiles(fileIds entities.FileIds) error
+
+	// tags
+
+	TagCount() (uint, error)
+	Tags() (entities.Tags, error)
+	Tag(id entities.TagId) (*entities.Tag, error)
+	TagsByIds(ids entities.TagIds) (entities.Tags, error)
+	TagByName(name string) (*entities.Tag, error)
+	TagsByNames(names []string) (entities.Tags, error)
+	DuplicateTags() (entities.Tags, error)
+	InsertTag(name string) (*entities.Tag, error)
+	RenameTag(tagId entities.TagId, name string) (*entities.Tag, error)
+	DeleteTag(tagId entities.TagId) error
+	TagUsage() ([]entities.TagFileCount, error)
+
+	// values
+
+	ValueCount() (uint, error)
+	Values() (entities.Values, error)
+	Value(id entities.ValueId) (*entities.Value, error)
+	ValuesByIds(ids entities.ValueIds) (entities.Values, error)
+	UnusedValues() (entities.Values, error)
+	ValueByName(name string) (*entities.Value, error)
+	ValuesByNames(names []string) (entities.Values, error)
+	ValuesByTagId(tagId entities.TagId) (entities.Values, error)
+	InsertValue(name string) (*entities.Value, error)
+	DeleteValue(valueId entities.ValueId) error
+	DeleteUnusedValues(valueIds entities.ValueIds) error
+
+	// file tags
+
+	FileTagExists(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (bool, error)
+	FileTagCount() (uint, error)
+	FileTags() (entities.FileTags, error)
+	FileTagCountByFileId(fileId entities.FileId) (uint, error)
+	FileTagCountByTagId(tagId entities.TagId) (uint, error)
+	FileTagsByTagId(tagId entities.TagId) (entities.FileTags, error)
+	FileTagCountByValueId(valueId entities.ValueId) (uint, error)
+	FileTagsByValueId(valueId entities.ValueId) (entities.FileTags, error)
+	FileTagsByFileId(fileId entities.FileId) (entities.FileTags, error)
+	DanglingFileTags() (entities.FileTags, error)
+	AddFileTag(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (*entities.FileTag, error)
+	AddFileTags(fileTags entities.FileTags) error
+	DeleteFileTag(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) error
+	DeleteFileTagsByFileId(fileId entities.FileId) error
+	DeleteFileTagsByTagId(tagId entities.TagId) error
+	DeleteDanglingFileTags() error
+	CopyFileTags(sourceTagId entities.TagId, destTagId entities.TagId) error
+
+	// implications
+
+	Implications() (entities.Implications, error)
+	ImplicationsForTags(tagIds entities.TagIds) (entities.Implications, error)
+	DanglingImplications() (entities.Implications, error)
+	UpdateImplicationsForTagId(implyingTagId, impliedTagId entities.TagId) error
+	AddImplication(tagId entities.TagId, valueId entities.ValueId, impliedTagId entities.TagId, impliedValueId entities.ValueId, preservesValue bool) error
+	DeleteImplication(tagId entities.TagId, valueId entities.ValueId, impliedTagId entities.TagId, impliedValueId entities.ValueId, preservesValue bool) error
+	DeleteImplicationsForTagId(tagId entities.TagId) error
+	DeleteDanglingImplications() error
+
+	// aliases
+
+	Aliases() (entities.Aliases, error)
+	AliasesByTagId(tagId entities.TagId) (entities.Aliases, error)
+	AliasByName(name string) (*entities.Alias, error)
+	AliasesByNames(names []string) (entities.Aliases, error)
+	InsertAlias(name string, tagId entities.TagId) (*entities.Alias, error)
+	DeleteAlias(name string) error
+	UpdateAliasesForTagId(sourceTagId, destTagId entities.TagId) error
+
+	// tag properties
+
+	TagProperties() (entities.TagProperties, error)
+	TagPropertiesByTagId(tagId entities.TagId) (entities.TagProperties, error)
+	UpdateTagProperty(tagId entities.TagId, name, value string) (*entities.TagProperty, error)
+	DeleteTagProperty(tagId entities.TagId, name string) error
+	CopyTagProperties(sourceTagId, destTagId entities.TagId) error
+
+	// queries
+
+	Queries() (entities.Queries, error)
+	Query(text string) (*entities.Query, error)
+	InsertQuery(text string) (*entities.Query, error)
+	DeleteQuery(text string) error
+
+	// settings
+
+	Settings() (entities.Settings, error)
+	Setting(name string) (*entities.Setting, error)
+	UpdateSetting(name, value string) (*entities.Setting, error)
+
+	// journal
+
+	Operations() (entities.Operations, error)
+	Operation(operationId entities.OperationId) (*entities.Operation, error)
+	UndoableOperations(count uint) (entities.Operations, error)
+	InsertOperation(time time.Time, command, user string) (*entities.Operation, error)
+	UpdateOperationUndoneBy(operationId, undoneBy entities.OperationId) error
+	ReinstateOperationsUndoneBy(operationId entities.OperationId) error
+	JournalEntries(operationId entities.OperationId) (entities.JournalEntries, error)
+	PendingJournalEntryCount() (uint, error)
+	AssignPendingJournalEntries(operationId entities.OperationId) error
+	RevertJournalEntries(entries entities.JournalEntries) error
+}
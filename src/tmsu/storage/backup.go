@@ -0,0 +1,62 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"tmsu/common/log"
+)
+
+// Backs up the database to the specified path.
+func (storage *Storage) Backup(path string) error {
+	return storage.Db.Backup(path)
+}
+
+// Backs up the database to a timestamped path, keeping only the newest 'keep' backups.
+func (storage *Storage) BackupRotated(basePath string, keep uint) (string, error) {
+	return storage.Db.BackupRotated(basePath, keep)
+}
+
+// Takes a snapshot of the database ahead of a destructive operation if automatic backups
+// are enabled by the 'autoBackups' setting, which specifies how many to keep.
+//
+// The snapshots are stored alongside the database.
+func (storage *Storage) AutoBackup() error {
+	value, err := storage.SettingAsString("autoBackups")
+	if err != nil {
+		return err
+	}
+
+	keep, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return fmt.Errorf("setting 'autoBackups' has an invalid value '%v': expected a number.", value)
+	}
+	if keep == 0 {
+		return nil
+	}
+
+	path, err := storage.Db.BackupRotated(storage.Db.Location()+".backup", uint(keep))
+	if err != nil {
+		return err
+	}
+
+	log.Infof(2, "took automatic backup '%v'.", path)
+
+	return nil
+}
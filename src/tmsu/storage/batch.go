@@ -0,0 +1,258 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package storage
+
+import (
+	"path/filepath"
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/entities"
+)
+
+// The number of files, or file tags, to accumulate before they are written to the
+// database.
+const batchSize = 1000
+
+// Adds and tags files in bulk, as when tagging a large directory tree or importing a
+// tag database.
+//
+// The tag implications are retrieved once, when the batch is created, and new files
+// and file tags are accumulated and written several to a statement. The batch must be
+// flushed before the transaction is committed.
+type Batch struct {
+	storage      *Storage
+	implications implicationIndex
+	newFiles     map[*entities.File]bool
+	files        []pendingFile
+	filesByPath  map[string]*entities.File
+	fileTags     []pendingFileTag
+
+	// the tracked files of the directory last looked up, by stored name
+	directory      string
+	directoryFiles map[string]*entities.File
+}
+
+// Creates a batch upon the storage.
+func (storage *Storage) NewBatch() (*Batch, error) {
+	implications, err := storage.Implications()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Batch{storage,
+		indexImplications(implications),
+		make(map[*entities.File]bool),
+		make([]pendingFile, 0, batchSize),
+		make(map[string]*entities.File, batchSize),
+		make([]pendingFileTag, 0, batchSize),
+		"",
+		nil}, nil
+}
+
+// Retrieves the file with the specified path, including files added to the batch.
+//
+// The tracked files of the file's directory are retrieved together so that looking up
+// the other files within the same directory does not require further queries.
+func (batch *Batch) FileByPath(path string) (*entities.File, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, AbsolutePathResolutionError{path, err}
+	}
+
+	if file, ok := batch.filesByPath[absPath]; ok {
+		return file, nil
+	}
+
+	storedPath := batch.storage.paths.toStored(absPath)
+	directory := filepath.Dir(storedPath)
+
+	if directory != batch.directory || batch.directoryFiles == nil {
+		files, err := batch.storage.Db.FilesInDirectory(directory)
+		if err != nil {
+			return nil, err
+		}
+
+		batch.directory = directory
+		batch.directoryFiles = make(map[string]*entities.File, len(files))
+		for _, file := range files {
+			batch.directoryFiles[file.Name] = file
+		}
+	}
+
+	file, ok := batch.directoryFiles[filepath.Base(storedPath)]
+	if !ok {
+		return nil, nil
+	}
+
+	// a copy, so that the cached file is not mapped more than once
+	mappedFile := *file
+	return batch.storage.paths.mapFile(&mappedFile), nil
+}
+
+// Adds a file to the batch.
+//
+// The file is not assigned an identifier until it is written to the database but may
+// be tagged in the meantime.
+func (batch *Batch) AddFile(path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, AbsolutePathResolutionError{path, err}
+	}
+
+	if len(batch.files) >= batchSize {
+		if err := batch.Flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	storedPath := batch.storage.paths.toStored(absPath)
+
+	file := &entities.File{0, filepath.Dir(absPath), filepath.Base(absPath), fingerprint, modTime, size, isDir}
+	storedFile := &entities.File{0, filepath.Dir(storedPath), filepath.Base(storedPath), fingerprint, modTime, size, isDir}
+
+	batch.files = append(batch.files, pendingFile{file, storedFile})
+	batch.filesByPath[absPath] = file
+	batch.newFiles[file] = true
+
+	return file, nil
+}
+
+// Updates a file in the database.
+//
+// Updates are not accumulated but are made immediately.
+func (batch *Batch) UpdateFile(fileId entities.FileId, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
+	batch.directoryFiles = nil
+
+	return batch.storage.UpdateFile(fileId, path, fingerprint, modTime, size, isDir)
+}
+
+// Applies the specified tags, and their values, to a file, returning the number of
+// file tags added.
+//
+// Tags that the file already has are skipped. Unless explicit, so too are tags that
+// are implied by the file's existing tags or by the other tags being applied.
+func (batch *Batch) AddFileTags(file *entities.File, tagIds entities.TagIds, valueIds entities.ValueIds, explicit bool) (uint, error) {
+	existingFileTags := make(entities.FileTags, 0, len(tagIds))
+
+	for _, fileTag := range batch.fileTags {
+		if fileTag.file == file || (file.Id != 0 && fileTag.file.Id == file.Id) {
+			existingFileTags = append(existingFileTags, &entities.FileTag{file.Id, fileTag.tagId, fileTag.valueId, true, false})
+		}
+	}
+
+	if !batch.newFiles[file] {
+		fileTags, err := batch.storage.Db.FileTagsByFileId(file.Id)
+		if err != nil {
+			return 0, err
+		}
+
+		existingFileTags = append(existingFileTags, fileTags...)
+	}
+
+	if !explicit {
+		existingFileTags = batch.implications.apply(existingFileTags)
+	}
+
+	var newlyImplied entities.FileTags
+	if !explicit {
+		newlyImplied = make(entities.FileTags, len(tagIds))
+		for index, tagId := range tagIds {
+			newlyImplied[index] = &entities.FileTag{file.Id, tagId, valueIds[index], true, false}
+		}
+
+		newlyImplied = batch.implications.apply(newlyImplied)
+	}
+
+	count := uint(0)
+	for index, tagId := range tagIds {
+		valueId := valueIds[index]
+
+		if existingFileTags.Contains(tagId, valueId) {
+			continue
+		}
+
+		if impliedFileTag := newlyImplied.Find(file.Id, tagId, valueId); impliedFileTag != nil && impliedFileTag.Implicit {
+			continue
+		}
+
+		batch.fileTags = append(batch.fileTags, pendingFileTag{file, tagId, valueId})
+		existingFileTags = append(existingFileTags, &entities.FileTag{file.Id, tagId, valueId, true, false})
+		count++
+	}
+
+	if len(batch.fileTags) >= batchSize {
+		if err := batch.Flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	return count, nil
+}
+
+// Writes the accumulated files and file tags to the database.
+func (batch *Batch) Flush() error {
+	if len(batch.files) > 0 {
+		storedFiles := make(entities.Files, len(batch.files))
+		for index, pending := range batch.files {
+			storedFiles[index] = pending.storedFile
+		}
+
+		if err := batch.storage.Db.InsertFiles(storedFiles); err != nil {
+			return err
+		}
+
+		for _, pending := range batch.files {
+			pending.file.Id = pending.storedFile.Id
+			delete(batch.filesByPath, pending.file.Path())
+			delete(batch.newFiles, pending.file)
+		}
+
+		batch.files = batch.files[:0]
+		batch.directoryFiles = nil
+	}
+
+	if len(batch.fileTags) > 0 {
+		fileTags := make(entities.FileTags, len(batch.fileTags))
+		for index, pending := range batch.fileTags {
+			fileTags[index] = &entities.FileTag{pending.file.Id, pending.tagId, pending.valueId, true, false}
+		}
+
+		if err := batch.storage.Db.AddFileTags(fileTags); err != nil {
+			return err
+		}
+
+		batch.fileTags = batch.fileTags[:0]
+	}
+
+	return nil
+}
+
+// unexported
+
+// A file added to the batch, alongside the same file with its path as it is stored.
+type pendingFile struct {
+	file       *entities.File
+	storedFile *entities.File
+}
+
+// A file tag for a file that may not yet have been assigned an identifier.
+type pendingFileTag struct {
+	file    *entities.File
+	tagId   entities.TagId
+	valueId entities.ValueId
+}
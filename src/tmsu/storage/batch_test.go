@@ -0,0 +1,246 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"tmsu/entities"
+	"tmsu/storage/memory"
+)
+
+func TestBatchSkipsAppliedAndImpliedTags(test *testing.T) {
+	// set-up
+
+	store, err := New(memory.New())
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	file, err := store.AddFile("/tmp/tmsu/a", "abc", time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	appleTag, err := store.AddTag("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+	fruitTag, err := store.AddTag("fruit")
+	if err != nil {
+		test.Fatal(err)
+	}
+	redTag, err := store.AddTag("red")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := store.AddFileTag(file.Id, appleTag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+	if err := store.AddImplication(appleTag.Id, 0, fruitTag.Id, 0, false); err != nil {
+		test.Fatal(err)
+	}
+
+	batch, err := store.NewBatch()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	count, err := batch.AddFileTags(file, entities.TagIds{appleTag.Id, fruitTag.Id, redTag.Id}, entities.ValueIds{0, 0, 0}, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := batch.Flush(); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if count != 1 {
+		test.Fatalf("Expected 1 file tag to be added but were %v.", count)
+	}
+
+	fileTags, err := store.FileTagsByFileId(file.Id, true)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(fileTags) != 2 || !fileTags.Contains(appleTag.Id, 0) || !fileTags.Contains(redTag.Id, 0) {
+		test.Fatalf("Expected file to be tagged 'apple' and 'red' but has %v file tags.", len(fileTags))
+	}
+}
+
+func TestBatchAddsFileTagsBeyondBatchSize(test *testing.T) {
+	// set-up
+
+	store, err := New(memory.New())
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	tag, err := store.AddTag("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	batch, err := store.NewBatch()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	fileCount := batchSize + batchSize/2
+	for index := 0; index < fileCount; index++ {
+		file, err := batch.AddFile(fmt.Sprintf("/tmp/tmsu/%v", index), "", time.Now(), 0, false)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		if _, err := batch.AddFileTags(file, entities.TagIds{tag.Id}, entities.ValueIds{0}, false); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := batch.Flush(); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	count, err := store.FileTagCount()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if count != uint(fileCount) {
+		test.Fatalf("Expected %v file tags but were %v.", fileCount, count)
+	}
+}
+
+// Tags files one at a time, as the tag command did before batches.
+func BenchmarkTagFilesIndividually(benchmark *testing.B) {
+	benchmarkTagFiles(benchmark, func(store *Storage, tagId entities.TagId, paths []string) error {
+		for _, path := range paths {
+			file, err := store.FileByPath(path)
+			if err != nil {
+				return err
+			}
+			if file == nil {
+				file, err = store.AddFile(path, "", time.Now(), 0, false)
+				if err != nil {
+					return err
+				}
+			}
+
+			fileTags, err := store.FileTagsByFileId(file.Id, false)
+			if err != nil {
+				return err
+			}
+			if fileTags.Contains(tagId, 0) {
+				continue
+			}
+
+			if _, err := store.ImplicationsForTags(tagId); err != nil {
+				return err
+			}
+
+			if _, err := store.AddFileTag(file.Id, tagId, 0); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func BenchmarkTagFilesInBatch(benchmark *testing.B) {
+	benchmarkTagFiles(benchmark, func(store *Storage, tagId entities.TagId, paths []string) error {
+		batch, err := store.NewBatch()
+		if err != nil {
+			return err
+		}
+
+		for _, path := range paths {
+			file, err := batch.FileByPath(path)
+			if err != nil {
+				return err
+			}
+			if file == nil {
+				file, err = batch.AddFile(path, "", time.Now(), 0, false)
+				if err != nil {
+					return err
+				}
+			}
+
+			if _, err := batch.AddFileTags(file, entities.TagIds{tagId}, entities.ValueIds{0}, false); err != nil {
+				return err
+			}
+		}
+
+		return batch.Flush()
+	})
+}
+
+// unexported
+
+func benchmarkTagFiles(benchmark *testing.B, tagFiles func(*Storage, entities.TagId, []string) error) {
+	databasePath := filepath.Join(os.TempDir(), "tmsu_storage_benchmark.db")
+
+	paths := make([]string, 5000)
+	for index := range paths {
+		paths[index] = fmt.Sprintf("/tmp/tmsu/benchmark/%v/%v", index/100, index)
+	}
+
+	for iteration := 0; iteration < benchmark.N; iteration++ {
+		benchmark.StopTimer()
+
+		os.Remove(databasePath)
+		store, err := OpenAt(databasePath)
+		if err != nil {
+			benchmark.Fatal(err)
+		}
+
+		if err := store.BeginWrite(); err != nil {
+			benchmark.Fatal(err)
+		}
+
+		tag, err := store.AddTag("apple")
+		if err != nil {
+			benchmark.Fatal(err)
+		}
+
+		benchmark.StartTimer()
+
+		if err := tagFiles(store, tag.Id, paths); err != nil {
+			benchmark.Fatal(err)
+		}
+
+		if err := store.Commit(); err != nil {
+			benchmark.Fatal(err)
+		}
+
+		benchmark.StopTimer()
+
+		store.Close()
+	}
+
+	os.Remove(databasePath)
+}
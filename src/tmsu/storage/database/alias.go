@@ -0,0 +1,180 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"tmsu/entities"
+)
+
+// The set of tag aliases.
+func (db *Database) Aliases() (entities.Aliases, error) {
+	sql := `SELECT alias.name, tag.id, tag.name
+            FROM alias
+            INNER JOIN tag ON alias.tag_id = tag.id
+            ORDER BY alias.name`
+
+	rows, err := db.ExecQuery(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readAliases(rows, make(entities.Aliases, 0, 10))
+}
+
+// Retrieves the aliases of the specified tag.
+func (db *Database) AliasesByTagId(tagId entities.TagId) (entities.Aliases, error) {
+	sql := `SELECT alias.name, tag.id, tag.name
+            FROM alias
+            INNER JOIN tag ON alias.tag_id = tag.id
+            WHERE alias.tag_id = ?
+            ORDER BY alias.name`
+
+	rows, err := db.ExecQuery(sql, tagId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readAliases(rows, make(entities.Aliases, 0, 10))
+}
+
+// Retrieves a specific alias.
+func (db *Database) AliasByName(name string) (*entities.Alias, error) {
+	sql := `SELECT alias.name, tag.id, tag.name
+            FROM alias
+            INNER JOIN tag ON alias.tag_id = tag.id
+            WHERE alias.name = ?`
+
+	rows, err := db.ExecQuery(sql, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readAlias(rows)
+}
+
+// Retrieves the set of named aliases.
+func (db *Database) AliasesByNames(names []string) (entities.Aliases, error) {
+	if len(names) == 0 {
+		return make(entities.Aliases, 0), nil
+	}
+
+	sql := `SELECT alias.name, tag.id, tag.name
+            FROM alias
+            INNER JOIN tag ON alias.tag_id = tag.id
+            WHERE alias.name IN (?`
+	sql += strings.Repeat(",?", len(names)-1)
+	sql += ")"
+
+	params := make([]interface{}, len(names))
+	for index, name := range names {
+		params[index] = name
+	}
+
+	rows, err := db.ExecQuery(sql, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readAliases(rows, make(entities.Aliases, 0, len(names)))
+}
+
+// Adds an alias for the specified tag.
+func (db *Database) InsertAlias(name string, tagId entities.TagId) (*entities.Alias, error) {
+	sql := `INSERT INTO alias (name, tag_id)
+            VALUES (?, ?)`
+
+	if _, err := db.Exec(sql, name, tagId); err != nil {
+		return nil, err
+	}
+
+	return db.AliasByName(name)
+}
+
+// Deletes the specified alias.
+func (db *Database) DeleteAlias(name string) error {
+	sql := `DELETE FROM alias
+            WHERE name = ?`
+
+	result, err := db.Exec(sql, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return NoSuchAliasError{name}
+	}
+
+	return nil
+}
+
+// Moves the aliases of one tag to another.
+func (db *Database) UpdateAliasesForTagId(sourceTagId, destTagId entities.TagId) error {
+	sql := `UPDATE alias
+            SET tag_id = ?2
+            WHERE tag_id = ?1`
+
+	if _, err := db.Exec(sql, sourceTagId, destTagId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+func readAlias(rows *sql.Rows) (*entities.Alias, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var alias entities.Alias
+	if err := rows.Scan(&alias.Name, &alias.Tag.Id, &alias.Tag.Name); err != nil {
+		return nil, err
+	}
+
+	return &alias, nil
+}
+
+func readAliases(rows *sql.Rows, aliases entities.Aliases) (entities.Aliases, error) {
+	for {
+		alias, err := readAlias(rows)
+		if err != nil {
+			return nil, err
+		}
+		if alias == nil {
+			break
+		}
+
+		aliases = append(aliases, alias)
+	}
+
+	return aliases, nil
+}
@@ -0,0 +1,274 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"tmsu/common/log"
+)
+
+// The format of the timestamp appended to the paths of rotated backups.
+const backupTimestampFormat = "20060102-150405.000"
+
+// Copies the database to the specified path using SQLite's online backup API.
+//
+// The copy is a consistent snapshot of the committed state of the database, even whilst
+// other processes are writing to it. Changes made within the current transaction are not
+// included.
+func (db *Database) Backup(path string) error {
+	log.Infof(2, "backing up database to '%v'.", path)
+
+	// the backup is written alongside the destination and moved into place once complete so
+	// that an existing backup is never left half-overwritten
+	tempPath := path + ".tmp"
+	os.Remove(tempPath)
+
+	dest, err := sql.Open("sqlite3", fileUri(tempPath))
+	if err != nil {
+		return DatabaseAccessError{tempPath, err}
+	}
+
+	err = copyDatabase(db.connection, dest)
+	if err == nil {
+		// the copy inherits write-ahead logging from the database: revert to a rollback
+		// journal so that the backup is a single, self-contained, file
+		_, err = dest.Exec("PRAGMA journal_mode = DELETE")
+	}
+	dest.Close()
+	if err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("could not back up database to '%v': %v", path, err)
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("could not back up database to '%v': %v", path, err)
+	}
+
+	return nil
+}
+
+// Backs up the database to a timestamped path, removing all but the newest 'keep' of the
+// backups that share the base path.
+//
+// Returns the path of the new backup.
+func (db *Database) BackupRotated(basePath string, keep uint) (string, error) {
+	path := basePath + "." + time.Now().Format(backupTimestampFormat)
+
+	if err := db.Backup(path); err != nil {
+		return "", err
+	}
+
+	paths, err := RotatedBackups(basePath)
+	if err != nil {
+		return "", err
+	}
+
+	for len(paths) > int(keep) {
+		log.Infof(2, "removing old backup '%v'.", paths[0])
+
+		if err := os.Remove(paths[0]); err != nil {
+			return "", fmt.Errorf("could not remove old backup '%v': %v", paths[0], err)
+		}
+
+		paths = paths[1:]
+	}
+
+	return path, nil
+}
+
+// Lists the timestamped backups that share the base path, oldest first.
+func RotatedBackups(basePath string) ([]string, error) {
+	candidates, err := filepath.Glob(basePath + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		timestamp := strings.TrimPrefix(candidate, basePath+".")
+		if _, err := time.Parse(backupTimestampFormat, timestamp); err == nil {
+			paths = append(paths, candidate)
+		}
+	}
+
+	// the timestamp format sorts chronologically
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// Checks that the database at the specified path is intact and can be used by this version
+// of TMSU, returning its schema version.
+func VerifyDatabase(path string) (uint, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, DatabaseAccessError{path, err}
+	}
+
+	connection, err := sql.Open("sqlite3", readOnlyUri(path))
+	if err != nil {
+		return 0, DatabaseAccessError{path, err}
+	}
+	defer connection.Close()
+
+	rows, err := connection.Query("PRAGMA integrity_check")
+	if err != nil {
+		return 0, DatabaseAccessError{path, err}
+	}
+
+	problems := make([]string, 0, 1)
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	rows.Close()
+
+	if len(problems) > 0 {
+		return 0, DatabaseIntegrityError{path, problems}
+	}
+
+	// query the version directly: SchemaVersion would create the table in a read-only database
+	var tableCount uint
+	if err := connection.QueryRow("SELECT count(1) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'").Scan(&tableCount); err != nil {
+		return 0, DatabaseAccessError{path, err}
+	}
+
+	version := uint(0)
+	if tableCount > 0 {
+		if err := connection.QueryRow("SELECT coalesce(max(version), 0) FROM schema_version").Scan(&version); err != nil {
+			return 0, DatabaseAccessError{path, err}
+		}
+	}
+
+	if version > LatestSchemaVersion {
+		return 0, SchemaVersionError{path, version, LatestSchemaVersion}
+	}
+
+	return version, nil
+}
+
+// Replaces the contents of the database with those of the database at the specified path.
+//
+// The source database is verified first and, if it has an older schema version, upgraded
+// once restored. This must not be called within a transaction.
+func (db *Database) Restore(path string) error {
+	if db.transaction != nil {
+		return fmt.Errorf("could not restore database: there is an open transaction")
+	}
+
+	if _, err := VerifyDatabase(path); err != nil {
+		return err
+	}
+
+	log.Infof(2, "restoring database from '%v'.", path)
+
+	source, err := sql.Open("sqlite3", readOnlyUri(path))
+	if err != nil {
+		return DatabaseAccessError{path, err}
+	}
+
+	err = copyDatabase(source, db.connection)
+	source.Close()
+	if err != nil {
+		return fmt.Errorf("could not restore database from '%v': %v", path, err)
+	}
+
+	if err := db.BeginWrite(); err != nil {
+		return err
+	}
+
+	if err := db.Upgrade(); err != nil {
+		db.Rollback()
+		return err
+	}
+
+	return db.Commit()
+}
+
+// unexported
+
+// Builds the URI with which to open the database at the specified path for reading only.
+//
+// The database is not opened as immutable as SQLite would then ignore any write-ahead log
+// beside it, and with it the changes it holds.
+func readOnlyUri(path string) string {
+	return fileUri(path) + "?mode=ro"
+}
+
+// Builds the URI of the database at the specified path.
+//
+// The path is escaped as characters such as '?', '#' and '%' would otherwise be taken as part
+// of the URI syntax, whether or not the 'file:' scheme is given.
+func fileUri(path string) string {
+	segments := strings.Split(filepath.ToSlash(path), "/")
+	for index, segment := range segments {
+		segments[index] = url.PathEscape(segment)
+	}
+
+	return "file:" + strings.Join(segments, "/")
+}
+
+// Copies the main database of the source connection pool over that of the destination.
+func copyDatabase(source, dest *sql.DB) error {
+	ctx := context.Background()
+
+	sourceConnection, err := source.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer sourceConnection.Close()
+
+	destConnection, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConnection.Close()
+
+	return destConnection.Raw(func(destDriverConnection interface{}) error {
+		return sourceConnection.Raw(func(sourceDriverConnection interface{}) error {
+			backup, err := destDriverConnection.(*sqlite3.SQLiteConn).Backup("main", sourceDriverConnection.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+
+			// a single step copies every page under one read lock, giving a consistent snapshot
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+
+			return backup.Finish()
+		})
+	})
+}
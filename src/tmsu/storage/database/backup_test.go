@@ -0,0 +1,312 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package database
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupAndRestore(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	backupPath := filepath.Join(os.TempDir(), "tmsu_backup_test.db")
+	defer os.Remove(backupPath)
+
+	db, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.InsertTag("apple"); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := db.Backup(backupPath); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := db.InsertTag("banana"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := db.Restore(backupPath); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tags, err := db.Tags()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Name != "apple" {
+		test.Fatalf("Expected only tag 'apple' after restore but found %v tags.", len(tags))
+	}
+}
+
+func TestBackupIsSelfContained(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	backupPath := filepath.Join(os.TempDir(), "tmsu_backup_test.db")
+	defer os.Remove(backupPath)
+
+	db, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.InsertTag("apple"); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := db.Backup(backupPath); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if _, err := VerifyDatabase(backupPath); err != nil {
+		test.Fatal(err)
+	}
+	if err := db.Restore(backupPath); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if _, err := os.Stat(backupPath + suffix); err == nil {
+			os.Remove(backupPath + suffix)
+			test.Fatalf("Expected no '%v' file beside the backup.", suffix)
+		}
+	}
+
+	connection, err := sql.Open("sqlite3", backupPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer connection.Close()
+
+	var journalMode string
+	if err := connection.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil {
+		test.Fatal(err)
+	}
+	if journalMode != "delete" {
+		test.Fatalf("Expected the backup to use a rollback journal but journal mode was '%v'.", journalMode)
+	}
+}
+
+func TestRestoreFromPathNeedingEscaping(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	backupPath := filepath.Join(os.TempDir(), "tmsu_backup_test?#%41.db")
+	defer os.Remove(backupPath)
+
+	db, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.InsertTag("apple"); err != nil {
+		test.Fatal(err)
+	}
+
+	if err := db.Backup(backupPath); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := db.InsertTag("banana"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := db.Restore(backupPath); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tags, err := db.Tags()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Name != "apple" {
+		test.Fatalf("Expected only tag 'apple' after restore but found %v tags.", len(tags))
+	}
+}
+
+func TestRestoreIncludesWriteAheadLog(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	sourcePath := filepath.Join(os.TempDir(), "tmsu_backup_test.db")
+	defer func() {
+		for _, path := range []string{sourcePath, sourcePath + "-wal", sourcePath + "-shm"} {
+			os.Remove(path)
+		}
+	}()
+
+	db, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	// whilst the source is open its changes remain in its write-ahead log
+	source, err := OpenAt(sourcePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer source.Close()
+
+	if _, err := source.InsertTag("apple"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := db.Restore(sourcePath); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tag, err := db.TagByName("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if tag == nil {
+		test.Fatal("Changes in the write-ahead log were not restored.")
+	}
+}
+
+func TestRestoreRefusesCorruptDatabase(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	backupPath := filepath.Join(os.TempDir(), "tmsu_backup_test.db")
+	defer os.Remove(backupPath)
+
+	if err := ioutil.WriteFile(backupPath, []byte("not a database"), 0644); err != nil {
+		test.Fatal(err)
+	}
+
+	db, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.InsertTag("apple"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	err = db.Restore(backupPath)
+
+	// validate
+
+	if err == nil {
+		test.Fatal("Corrupt database was restored.")
+	}
+
+	tag, err := db.TagByName("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if tag == nil {
+		test.Fatal("Database was altered by the failed restore.")
+	}
+}
+
+func TestBackupRotatedRemovesOldestBackups(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	dir, err := ioutil.TempDir("", "tmsu_backup_test")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	basePath := filepath.Join(dir, "tmsu.db")
+
+	for _, timestamp := range []string{"20140101-000000.000", "20140102-000000.000"} {
+		if err := ioutil.WriteFile(basePath+"."+timestamp, []byte{}, 0644); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	unrelatedPath := basePath + ".notes"
+	if err := ioutil.WriteFile(unrelatedPath, []byte{}, 0644); err != nil {
+		test.Fatal(err)
+	}
+
+	db, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	// test
+
+	path, err := db.BackupRotated(basePath, 2)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	paths, err := RotatedBackups(basePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(paths) != 2 || paths[0] != basePath+".20140102-000000.000" || paths[1] != path {
+		test.Fatalf("Unexpected backups remain: %v", paths)
+	}
+
+	if _, err := os.Stat(unrelatedPath); err != nil {
+		test.Fatal("Unrelated file was removed.")
+	}
+}
@@ -0,0 +1,771 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"tmsu/entities"
+	"tmsu/query"
+)
+
+// Compiles query expressions to SQL.
+//
+// The tags and values named by an expression are resolved to their identifiers before
+// the SQL is built so that each term becomes a simple lookup against the file_tag table.
+// Terms are combined using the INTERSECT, UNION and EXCEPT set operators.
+//
+// The values of tags with a declared value type are compared according to that type by way
+// of the value_compare function registered with each connection.
+type queryCompiler struct {
+	tagIds     map[string]entities.TagId
+	valueIds   map[string]entities.ValueId
+	valueTypes map[entities.TagId]entities.ValueType
+	now        time.Time
+}
+
+func (db *Database) newQueryCompiler(expression query.Expression) (*queryCompiler, error) {
+	tags, err := db.TagsByNames(uniqueNames(query.TagNames(expression)))
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	tagIds := make(map[string]entities.TagId, len(tags))
+	for _, tag := range tags {
+		if _, ok := tagIds[tag.Name]; !ok {
+			tagIds[tag.Name] = tag.Id
+		}
+	}
+
+	values, err := db.ValuesByNames(uniqueNames(query.ValueNames(expression)))
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve values: %v", err)
+	}
+
+	valueIds := make(map[string]entities.ValueId, len(values))
+	for _, value := range values {
+		valueIds[value.Name] = value.Id
+	}
+
+	valueTypes, err := db.valueTypes(uniqueNames(query.TestedTagNames(expression)), tagIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &queryCompiler{tagIds, valueIds, valueTypes, time.Now()}, nil
+}
+
+// Builds a query for the count of files matching the expression within the scope.
+func (compiler *queryCompiler) buildCountQuery(expression query.Expression, scope query.PathScope) (*SqlBuilder, error) {
+	builder := NewBuilder()
+
+	builder.AppendSql("SELECT count(id) FROM file WHERE 1 == 1")
+	if err := compiler.buildConditions(expression, scope, &builder); err != nil {
+		return nil, err
+	}
+
+	return &builder, nil
+}
+
+// Builds a query for the files matching the expression within the scope.
+func (compiler *queryCompiler) buildQuery(expression query.Expression, scope query.PathScope) (*SqlBuilder, error) {
+	builder := NewBuilder()
+
+	builder.AppendSql("SELECT id, directory, name, fingerprint, mod_time, size, is_dir FROM file WHERE 1 == 1")
+	if err := compiler.buildConditions(expression, scope, &builder); err != nil {
+		return nil, err
+	}
+	builder.AppendSql("ORDER BY directory || '/' || name")
+
+	return &builder, nil
+}
+
+// unexported
+
+func (compiler *queryCompiler) buildConditions(expression query.Expression, scope query.PathScope, builder *SqlBuilder) error {
+	if _, ok := expression.(query.EmptyExpression); !ok {
+		builder.AppendSql("AND id IN (")
+		if err := compiler.buildSet(expression, builder); err != nil {
+			return err
+		}
+		builder.AppendSql(")")
+	}
+
+	buildScopeClause(scope, builder)
+
+	return nil
+}
+
+// Builds a query for the identifiers of the files matching the expression.
+func (compiler *queryCompiler) buildSet(expression query.Expression, builder *SqlBuilder) error {
+	switch exp := expression.(type) {
+	case query.EmptyExpression:
+		builder.AppendSql("SELECT id FROM file")
+	case query.TagExpression:
+		compiler.buildTagSet([]query.TagExpression{exp}, builder)
+	case query.ComparisonExpression:
+		return compiler.buildComparisonSet(exp, builder)
+	case query.InExpression:
+		return compiler.buildInSet(exp, builder)
+	case query.RangeExpression:
+		return compiler.buildRangeSet(exp, builder)
+	case query.ValuedExpression:
+		compiler.buildValuePresenceSet(exp.Tag, true, builder)
+	case query.UnvaluedExpression:
+		compiler.buildValuePresenceSet(exp.Tag, false, builder)
+	case query.AttributeExpression:
+		return compiler.buildAttributeSet(exp, builder)
+	case query.UntaggedExpression:
+		builder.AppendSql("SELECT id FROM file WHERE id NOT IN (SELECT file_id FROM file_tag)")
+	case query.OnlyExpression:
+		compiler.buildOnlySet(exp, builder)
+	case query.NotExpression:
+		builder.AppendSql("SELECT id FROM file EXCEPT")
+		return compiler.buildOperand(exp.Operand, builder)
+	case query.AndExpression:
+		return compiler.buildIntersection(andTerms(exp, nil), builder)
+	case query.OrExpression:
+		return compiler.buildUnion(orTerms(exp, nil), builder)
+	default:
+		return fmt.Errorf("unsupported expression type %T", expression)
+	}
+
+	return nil
+}
+
+// Builds the set for an operand of a set operator, which must be wrapped in a
+// sub-query if it is itself compound.
+func (compiler *queryCompiler) buildOperand(expression query.Expression, builder *SqlBuilder) error {
+	if !isCompound(expression) {
+		return compiler.buildSet(expression, builder)
+	}
+
+	builder.AppendSql("SELECT * FROM (")
+	if err := compiler.buildSet(expression, builder); err != nil {
+		return err
+	}
+	builder.AppendSql(")")
+
+	return nil
+}
+
+func (compiler *queryCompiler) buildIntersection(terms []query.Expression, builder *SqlBuilder) error {
+	positive := make([]query.Expression, 0, len(terms))
+	negative := make([]query.Expression, 0, len(terms))
+	for _, term := range terms {
+		if not, ok := term.(query.NotExpression); ok {
+			negative = append(negative, not.Operand)
+		} else {
+			positive = append(positive, term)
+		}
+	}
+
+	if len(positive) == 0 {
+		builder.AppendSql("SELECT id FROM file")
+	}
+
+	for index, term := range positive {
+		if index > 0 {
+			builder.AppendSql("INTERSECT")
+		}
+		if err := compiler.buildOperand(term, builder); err != nil {
+			return err
+		}
+	}
+
+	for _, term := range negative {
+		builder.AppendSql("EXCEPT")
+		if err := compiler.buildOperand(term, builder); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (compiler *queryCompiler) buildUnion(terms []query.Expression, builder *SqlBuilder) error {
+	tags := make([]query.TagExpression, 0, len(terms))
+	others := make([]query.Expression, 0, len(terms))
+	for _, term := range terms {
+		if tag, ok := term.(query.TagExpression); ok {
+			tags = append(tags, tag)
+		} else {
+			others = append(others, term)
+		}
+	}
+
+	if len(tags) > 0 {
+		compiler.buildTagSet(tags, builder)
+	}
+
+	for index, term := range others {
+		if index > 0 || len(tags) > 0 {
+			builder.AppendSql("UNION")
+		}
+		if err := compiler.buildOperand(term, builder); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Builds the set of files tagged with any of the specified tags.
+func (compiler *queryCompiler) buildTagSet(tags []query.TagExpression, builder *SqlBuilder) {
+	tagIds := make([]entities.TagId, 0, len(tags))
+	for _, tag := range tags {
+		if tagId, ok := compiler.tagIds[tag.Name]; ok {
+			tagIds = append(tagIds, tagId)
+		}
+	}
+
+	switch len(tagIds) {
+	case 0:
+		builder.AppendSql("SELECT file_id FROM file_tag WHERE 0")
+	case 1:
+		builder.AppendSql("SELECT file_id FROM file_tag WHERE tag_id =")
+		builder.AppendParam(tagIds[0])
+	default:
+		builder.AppendSql("SELECT file_id FROM file_tag WHERE tag_id IN (")
+		for _, tagId := range tagIds {
+			builder.AppendParam(tagId)
+		}
+		builder.AppendSql(")")
+	}
+}
+
+// Builds the set of files tagged with the tag with a value satisfying the comparison.
+func (compiler *queryCompiler) buildComparisonSet(comparison query.ComparisonExpression, builder *SqlBuilder) error {
+	operator, err := sqlTextOperator(comparison.Operator, comparison.Value.Name)
+	if err != nil {
+		return err
+	}
+
+	tagId, ok := compiler.tagIds[comparison.Tag.Name]
+	if !ok {
+		builder.AppendSql("SELECT file_id FROM file_tag WHERE 0")
+		return nil
+	}
+
+	builder.AppendSql("SELECT file_id FROM file_tag WHERE tag_id =")
+	builder.AppendParam(tagId)
+
+	if valueType, ok := compiler.valueTypes[tagId]; ok {
+		return buildTypedValueCondition(comparison, valueType, builder)
+	}
+
+	number, err := strconv.ParseFloat(comparison.Value.Name, 64)
+	isNumeric := err == nil && !query.IsPatternOperator(comparison.Operator)
+
+	switch {
+	case operator == "=" && !isNumeric:
+		valueId, ok := compiler.valueIds[comparison.Value.Name]
+		if !ok {
+			builder.AppendSql("AND 0")
+			return nil
+		}
+
+		builder.AppendSql("AND value_id =")
+		builder.AppendParam(valueId)
+	case isNumeric:
+		builder.AppendSql("AND value_id IN (SELECT id FROM value WHERE CAST(name AS float) " + operator)
+		builder.AppendParam(number)
+		builder.AppendSql(")")
+	default:
+		builder.AppendSql("AND value_id IN (SELECT id FROM value WHERE name " + operator)
+		builder.AppendParam(comparison.Value.Name)
+		builder.AppendSql(")")
+	}
+
+	return nil
+}
+
+// Builds the set of files tagged with the tag with any of the values.
+func (compiler *queryCompiler) buildInSet(in query.InExpression, builder *SqlBuilder) error {
+	tagId, ok := compiler.tagIds[in.Tag.Name]
+	if !ok {
+		builder.AppendSql("SELECT file_id FROM file_tag WHERE 0")
+		return nil
+	}
+
+	builder.AppendSql("SELECT file_id FROM file_tag WHERE tag_id =")
+	builder.AppendParam(tagId)
+
+	if valueType, ok := compiler.valueTypes[tagId]; ok {
+		return buildTypedValueCondition(in, valueType, builder)
+	}
+
+	// numbers are compared numerically, as for the '=' operator
+	valueIds := make(entities.ValueIds, 0, len(in.Values))
+	numbers := make([]float64, 0, len(in.Values))
+	for _, value := range in.Values {
+		if number, err := strconv.ParseFloat(value.Name, 64); err == nil {
+			numbers = append(numbers, number)
+		} else if valueId, ok := compiler.valueIds[value.Name]; ok {
+			valueIds = append(valueIds, valueId)
+		}
+	}
+
+	builder.AppendSql("AND (0")
+	if len(valueIds) > 0 {
+		builder.AppendSql("OR value_id IN (")
+		for _, valueId := range valueIds {
+			builder.AppendParam(valueId)
+		}
+		builder.AppendSql(")")
+	}
+	if len(numbers) > 0 {
+		builder.AppendSql("OR value_id IN (SELECT id FROM value WHERE CAST(name AS float) IN (")
+		for _, number := range numbers {
+			builder.AppendParam(number)
+		}
+		builder.AppendSql("))")
+	}
+	builder.AppendSql(")")
+
+	return nil
+}
+
+// Builds the set of files tagged with the tag with a value within the range. The bounds
+// are compared numerically when both are numbers.
+func (compiler *queryCompiler) buildRangeSet(valueRange query.RangeExpression, builder *SqlBuilder) error {
+	tagId, ok := compiler.tagIds[valueRange.Tag.Name]
+	if !ok {
+		builder.AppendSql("SELECT file_id FROM file_tag WHERE 0")
+		return nil
+	}
+
+	builder.AppendSql("SELECT file_id FROM file_tag WHERE tag_id =")
+	builder.AppendParam(tagId)
+
+	if valueType, ok := compiler.valueTypes[tagId]; ok {
+		return buildTypedValueCondition(valueRange, valueType, builder)
+	}
+
+	if err := query.ValidateRange(valueRange, ""); err != nil {
+		return err
+	}
+
+	from, fromErr := strconv.ParseFloat(valueRange.From.Name, 64)
+	to, toErr := strconv.ParseFloat(valueRange.To.Name, 64)
+
+	switch {
+	case fromErr == nil && toErr == nil:
+		builder.AppendSql("AND value_id IN (SELECT id FROM value WHERE CAST(name AS float) BETWEEN")
+		builder.AppendParam(from)
+		builder.AppendSql("AND")
+		builder.AppendParam(to)
+		builder.AppendSql(")")
+	case fromErr != nil && toErr != nil:
+		builder.AppendSql("AND value_id IN (SELECT id FROM value WHERE name BETWEEN")
+		builder.AppendParam(valueRange.From.Name)
+		builder.AppendSql("AND")
+		builder.AppendParam(valueRange.To.Name)
+		builder.AppendSql(")")
+	default:
+		// each bound is compared as for the '>=' and '<=' operators
+		builder.AppendSql("AND value_id IN (SELECT id FROM value WHERE")
+		appendBound(">=", valueRange.From.Name, builder)
+		builder.AppendSql("AND")
+		appendBound("<=", valueRange.To.Name, builder)
+		builder.AppendSql(")")
+	}
+
+	return nil
+}
+
+// Builds the set of files tagged with the tag with, or without, a value.
+func (compiler *queryCompiler) buildValuePresenceSet(tag query.TagExpression, valued bool, builder *SqlBuilder) {
+	tagId, ok := compiler.tagIds[tag.Name]
+	if !ok {
+		builder.AppendSql("SELECT file_id FROM file_tag WHERE 0")
+		return
+	}
+
+	builder.AppendSql("SELECT file_id FROM file_tag WHERE tag_id =")
+	builder.AppendParam(tagId)
+
+	if valued {
+		builder.AppendSql("AND value_id != 0")
+	} else {
+		builder.AppendSql("AND value_id = 0")
+	}
+}
+
+// Builds the set of files tagged with each of the tags and no others.
+func (compiler *queryCompiler) buildOnlySet(only query.OnlyExpression, builder *SqlBuilder) {
+	tagIds := make(entities.TagIds, 0, len(only.Tags))
+	for _, tag := range only.Tags {
+		tagId, ok := compiler.tagIds[tag.Name]
+		if !ok {
+			builder.AppendSql("SELECT file_id FROM file_tag WHERE 0")
+			return
+		}
+		if !tagIds.Contains(tagId) {
+			tagIds = append(tagIds, tagId)
+		}
+	}
+
+	builder.AppendSql("SELECT file_id FROM file_tag GROUP BY file_id HAVING count(DISTINCT tag_id) =")
+	builder.AppendParam(len(tagIds))
+	builder.AppendSql("AND min(tag_id IN (")
+	for _, tagId := range tagIds {
+		builder.AppendParam(tagId)
+	}
+	builder.AppendSql(")) = 1")
+}
+
+// Builds the set of files whose attribute satisfies the comparison.
+func (compiler *queryCompiler) buildAttributeSet(attribute query.AttributeExpression, builder *SqlBuilder) error {
+	switch attribute.Name {
+	case query.ModTimeAttribute:
+		return compiler.buildModTimeSet(attribute, builder)
+	case query.TypeAttribute:
+		isDir, err := query.ParseFileType(attribute.Value.Name)
+		if err != nil {
+			return err
+		}
+
+		switch attribute.Operator {
+		case "=", "==":
+			builder.AppendSql("SELECT id FROM file WHERE is_dir =")
+		case "!=":
+			builder.AppendSql("SELECT id FROM file WHERE is_dir !=")
+		default:
+			return fmt.Errorf("'%v' can only be compared using '=' or '!='", query.TypeAttribute)
+		}
+		builder.AppendParam(isDir)
+
+		return nil
+	}
+
+	if attribute.Name == query.TagCountAttribute {
+		operator, err := sqlOperator(attribute.Operator)
+		if err != nil {
+			return err
+		}
+
+		count, err := query.ParseCount(attribute.Value.Name)
+		if err != nil {
+			return err
+		}
+
+		builder.AppendSql("SELECT id FROM file WHERE (SELECT count(DISTINCT tag_id) FROM file_tag WHERE file_id = file.id) " + operator)
+		builder.AppendParam(count)
+
+		return nil
+	}
+
+	if attribute.Name == query.SizeAttribute {
+		operator, err := sqlOperator(attribute.Operator)
+		if err != nil {
+			return err
+		}
+
+		size, err := query.ParseSize(attribute.Value.Name)
+		if err != nil {
+			return err
+		}
+
+		builder.AppendSql("SELECT id FROM file WHERE size " + operator)
+		builder.AppendParam(size)
+
+		return nil
+	}
+
+	operator, err := sqlTextOperator(attribute.Operator, attribute.Value.Name)
+	if err != nil {
+		return err
+	}
+
+	switch attribute.Name {
+	case query.NameAttribute:
+		builder.AppendSql("SELECT id FROM file WHERE name " + operator)
+		builder.AppendParam(attribute.Value.Name)
+	case query.ExtensionAttribute:
+		extension := attribute.Value.Name
+		if operator != "REGEXP" {
+			extension = query.NormaliseExtension(extension)
+		}
+
+		builder.AppendSql("SELECT id FROM file WHERE file_extension(name) " + operator)
+		builder.AppendParam(extension)
+	case query.DirectoryAttribute:
+		builder.AppendSql("SELECT id FROM file WHERE directory " + operator)
+		builder.AppendParam(attribute.Value.Name)
+	case query.FingerprintAttribute:
+		builder.AppendSql("SELECT id FROM file WHERE fingerprint " + operator)
+		builder.AppendParam(attribute.Value.Name)
+	default:
+		return fmt.Errorf("unsupported attribute '%v'", attribute.Name)
+	}
+
+	return nil
+}
+
+// Builds the set of files whose modification time satisfies the comparison. Times are
+// compared as Julian day numbers as they are stored with the local time zone offset.
+func (compiler *queryCompiler) buildModTimeSet(attribute query.AttributeExpression, builder *SqlBuilder) error {
+	condition, err := query.ParseTimeCondition(attribute.Operator, attribute.Value.Name, compiler.now)
+	if err != nil {
+		return err
+	}
+
+	builder.AppendSql("SELECT id FROM file WHERE")
+	if condition.Negated {
+		builder.AppendSql("NOT")
+	}
+	builder.AppendSql("(1 == 1")
+	if !condition.From.IsZero() {
+		builder.AppendSql("AND julianday(mod_time) >= julianday(")
+		builder.AppendParam(sqlTime(condition.From))
+		builder.AppendSql(")")
+	}
+	if !condition.Until.IsZero() {
+		builder.AppendSql("AND julianday(mod_time) < julianday(")
+		builder.AppendParam(sqlTime(condition.Until))
+		builder.AppendSql(")")
+	}
+	builder.AppendSql(")")
+
+	return nil
+}
+
+// Retrieves the declared value type of each of the named tags that has one.
+func (db *Database) valueTypes(tagNames []string, tagIds map[string]entities.TagId) (map[entities.TagId]entities.ValueType, error) {
+	valueTypes := make(map[entities.TagId]entities.ValueType)
+
+	for _, tagName := range tagNames {
+		tagId, ok := tagIds[tagName]
+		if !ok {
+			continue
+		}
+
+		properties, err := db.TagPropertiesByTagId(tagId)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve properties for tag '%v': %v", tagName, err)
+		}
+
+		valueType := entities.ValueType(properties.Value(entities.TagTypeProperty))
+		if valueType != "" {
+			valueTypes[tagId] = valueType
+		}
+	}
+
+	return valueTypes, nil
+}
+
+// Builds the condition for the value satisfying the test of a tag with a declared value type.
+func buildTypedValueCondition(test query.Expression, valueType entities.ValueType, builder *SqlBuilder) error {
+	// reports values in the query that are invalid for the type
+	if _, err := query.ValuePredicate(test, valueType); err != nil {
+		return err
+	}
+
+	builder.AppendSql("AND value_id IN (SELECT id FROM value WHERE")
+
+	switch exp := test.(type) {
+	case query.ComparisonExpression:
+		if query.IsPatternOperator(exp.Operator) {
+			operator, err := sqlTextOperator(exp.Operator, exp.Value.Name)
+			if err != nil {
+				return err
+			}
+
+			builder.AppendSql("name " + operator)
+			builder.AppendParam(exp.Value.Name)
+		} else {
+			operator, err := sqlOperator(exp.Operator)
+			if err != nil {
+				return err
+			}
+
+			appendValueComparison(valueType, exp.Value.Name, operator, builder)
+		}
+	case query.InExpression:
+		builder.AppendSql("0")
+		for _, value := range exp.Values {
+			builder.AppendSql("OR")
+			appendValueComparison(valueType, value.Name, "=", builder)
+		}
+	case query.RangeExpression:
+		appendValueComparison(valueType, exp.From.Name, ">=", builder)
+		builder.AppendSql("AND")
+		appendValueComparison(valueType, exp.To.Name, "<=", builder)
+	default:
+		return fmt.Errorf("unsupported expression type %T", test)
+	}
+
+	builder.AppendSql(")")
+
+	return nil
+}
+
+// Appends a condition comparing the value name against the operand according to the type.
+func appendValueComparison(valueType entities.ValueType, operand, operator string, builder *SqlBuilder) {
+	builder.AppendSql("value_compare(")
+	builder.AppendParam(string(valueType))
+	builder.AppendSql(", name,")
+	builder.AppendParam(operand)
+	builder.AppendSql(") " + operator + " 0")
+}
+
+// Appends a condition comparing the value name against a bound of a range, numerically where
+// the bound is a number.
+func appendBound(operator, bound string, builder *SqlBuilder) {
+	if number, err := strconv.ParseFloat(bound, 64); err == nil {
+		builder.AppendSql("CAST(name AS float) " + operator)
+		builder.AppendParam(number)
+	} else {
+		builder.AppendSql("name " + operator)
+		builder.AppendParam(bound)
+	}
+}
+
+// Builds the clause that confines the files to the scope.
+func buildScopeClause(scope query.PathScope, builder *SqlBuilder) {
+	if len(scope.Include) > 0 {
+		builder.AppendSql("AND (")
+		for index, path := range scope.Include {
+			if index > 0 {
+				builder.AppendSql("OR")
+			}
+			buildPathCondition(path, builder)
+		}
+		builder.AppendSql(")")
+	}
+
+	for _, path := range scope.Exclude {
+		builder.AppendSql("AND NOT")
+		buildPathCondition(path, builder)
+	}
+}
+
+// Builds the condition for a file being, or being beneath, the specified path.
+func buildPathCondition(path string, builder *SqlBuilder) {
+	path = filepath.Clean(path)
+	dir, name := filepath.Split(path)
+	dir = filepath.Clean(dir)
+
+	separator := string(filepath.Separator)
+	pattern := escapeLike(strings.TrimSuffix(path, separator)) + separator + "%"
+
+	builder.AppendSql("(directory =")
+	builder.AppendParam(path)
+	builder.AppendSql("OR directory LIKE")
+	builder.AppendParam(pattern)
+	builder.AppendSql(`ESCAPE '\' OR (directory =`)
+	builder.AppendParam(dir)
+	builder.AppendSql("AND name =")
+	builder.AppendParam(name)
+	builder.AppendSql("))")
+}
+
+// Escapes the LIKE wildcards in the text so that it is matched literally.
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+}
+
+// Formats the time as SQLite's date and time functions expect.
+func sqlTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05.999999999") + "Z"
+}
+
+// Maps a comparison operator to SQL, including the pattern operators, which are valid only
+// for text. Patterns are checked here so that invalid ones are reported as such rather than
+// by SQLite.
+func sqlTextOperator(operator, operand string) (string, error) {
+	switch operator {
+	case "~", "=~":
+		if _, err := query.PatternMatch(operator, operand); err != nil {
+			return "", err
+		}
+
+		if operator == "~" {
+			return "GLOB", nil
+		}
+		return "REGEXP", nil
+	default:
+		return sqlOperator(operator)
+	}
+}
+
+func sqlOperator(operator string) (string, error) {
+	switch operator {
+	case "=", "==":
+		return "=", nil
+	case "!=", "<", ">", "<=", ">=":
+		return operator, nil
+	default:
+		return "", fmt.Errorf("unsupported comparison operator '%v'", operator)
+	}
+}
+
+// Determines whether the SQL for the expression is a compound select.
+func isCompound(expression query.Expression) bool {
+	switch exp := expression.(type) {
+	case query.NotExpression, query.AndExpression:
+		return true
+	case query.OrExpression:
+		for _, term := range orTerms(exp, nil) {
+			if _, ok := term.(query.TagExpression); !ok {
+				return true
+			}
+		}
+
+		return false
+	default:
+		return false
+	}
+}
+
+// Flattens nested 'and' expressions into their terms.
+func andTerms(expression query.Expression, terms []query.Expression) []query.Expression {
+	if and, ok := expression.(query.AndExpression); ok {
+		terms = andTerms(and.LeftOperand, terms)
+		return andTerms(and.RightOperand, terms)
+	}
+
+	return append(terms, expression)
+}
+
+// Flattens nested 'or' expressions into their terms.
+func orTerms(expression query.Expression, terms []query.Expression) []query.Expression {
+	if or, ok := expression.(query.OrExpression); ok {
+		terms = orTerms(or.LeftOperand, terms)
+		return orTerms(or.RightOperand, terms)
+	}
+
+	return append(terms, expression)
+}
+
+func uniqueNames(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	unique := make([]string, 0, len(names))
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+
+	return unique
+}
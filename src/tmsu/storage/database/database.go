@@ -18,24 +18,73 @@ along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 	"os"
 	"os/user"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
 	"tmsu/common/log"
+	"tmsu/entities"
+	"tmsu/query"
 )
 
 var Path string
 
+// Describes how the database path was chosen.
+var PathReason string
+
+// The location of a database within the directory it is discovered from.
+var DiscoveredPath = filepath.Join(".tmsu", "db")
+
+// How long to wait for another process to release its lock on the database before giving up.
+var BusyTimeout = 5 * time.Second
+
+// The name of the SQLite driver variant that enforces foreign keys and provides the
+// functions used by queries.
+const driverName = "sqlite3_tmsu"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		// these settings are per connection so must be applied to every connection in the pool
+		ConnectHook: func(connection *sqlite3.SQLiteConn) error {
+			if _, err := connection.Exec("PRAGMA foreign_keys = ON", nil); err != nil {
+				return err
+			}
+
+			// used to compare file extensions in queries
+			if err := connection.RegisterFunc("file_extension", query.FileExtension, true); err != nil {
+				return err
+			}
+
+			// used by the REGEXP operator in queries
+			if err := connection.RegisterFunc("regexp", matchRegexp, true); err != nil {
+				return err
+			}
+
+			// used to compare the values of tags with a declared value type in queries
+			if err := connection.RegisterFunc("value_compare", compareValues, true); err != nil {
+				return err
+			}
+
+			_, err := connection.Exec(fmt.Sprintf("PRAGMA busy_timeout = %v", int64(BusyTimeout/time.Millisecond)), nil)
+			return err
+		},
+	})
+}
+
 type Database struct {
 	Path string
 
 	// unexported
 	connection  *sql.DB
-	transaction *sql.Tx
+	transaction *transaction
 }
 
 // Opens the database
@@ -60,29 +109,71 @@ func OpenAt(path string) (*Database, error) {
 		}
 	}
 
-	connection, err := sql.Open("sqlite3", path)
+	connection, err := sql.Open(driverName, path)
 	if err != nil {
 		return nil, DatabaseAccessError{path, err}
 	}
 
 	database := &Database{path, connection, nil}
 
-	if err := database.Begin(); err != nil {
+	database.enableWriteAheadLog()
+
+	if err := database.BeginWrite(); err != nil {
+		connection.Close()
 		return nil, err
 	}
 
-	if err := database.CreateSchema(); err != nil {
+	if err := database.Upgrade(); err != nil {
+		database.Rollback()
+		connection.Close()
 		return nil, err
 	}
 
 	if err := database.Commit(); err != nil {
+		connection.Close()
 		return nil, err
 	}
 
 	return database, nil
 }
 
+// Searches the specified directory and its ancestors for a database, returning the
+// path of the nearest one found or an empty string if there is none.
+func FindDatabase(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		path := filepath.Join(dir, DiscoveredPath)
+
+		info, err := os.Stat(path)
+		if err == nil && !info.IsDir() {
+			return path, nil
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+
+		dir = parent
+	}
+}
+
+// The path of the database file.
+func (db *Database) Location() string {
+	return db.Path
+}
+
 // Executes a SQL query.
+//
+// Should the database be locked by another process the query waits for up to the busy
+// timeout. Within a transaction the statement is prepared once and reused.
 func (db *Database) Exec(query string, args ...interface{}) (sql.Result, error) {
 	if log.Verbosity >= 3 {
 		log.Infof(3, "executing update\n"+query)
@@ -94,9 +185,8 @@ func (db *Database) Exec(query string, args ...interface{}) (sql.Result, error)
 
 	var result sql.Result
 	var err error
-
 	if db.transaction != nil {
-		result, err = db.transaction.Exec(query, args...)
+		result, err = db.transaction.exec(query, args...)
 	} else {
 		result, err = db.connection.Exec(query, args...)
 	}
@@ -109,6 +199,9 @@ func (db *Database) Exec(query string, args ...interface{}) (sql.Result, error)
 }
 
 // Executes a SQL query returning rows.
+//
+// Should the database be locked by another process the query waits for up to the busy
+// timeout. Within a transaction the statement is prepared once and reused.
 func (db *Database) ExecQuery(query string, args ...interface{}) (*sql.Rows, error) {
 	if log.Verbosity >= 3 {
 		log.Infof(3, "executing query\n"+query)
@@ -120,9 +213,8 @@ func (db *Database) ExecQuery(query string, args ...interface{}) (*sql.Rows, err
 
 	var rows *sql.Rows
 	var err error
-
 	if db.transaction != nil {
-		rows, err = db.transaction.Query(query, args...)
+		rows, err = db.transaction.query(query, args...)
 	} else {
 		rows, err = db.connection.Query(query, args...)
 	}
@@ -135,21 +227,20 @@ func (db *Database) ExecQuery(query string, args ...interface{}) (*sql.Rows, err
 }
 
 // Start a transaction
+//
+// The transaction does not lock the database until it is first read from, and does not
+// prevent other processes from writing to it whilst it is only read from.
 func (db *Database) Begin() error {
-	if db.transaction != nil {
-		panic("could not begin transaction: there is already an open transaction")
-	}
-
-	log.Info(2, "beginning new transaction")
-
-	transaction, err := db.connection.Begin()
-	if err != nil {
-		return DatabaseTransactionError{db.Path, err}
-	}
-
-	db.transaction = transaction
+	return db.begin("BEGIN")
+}
 
-	return nil
+// Start a transaction that writes to the database
+//
+// The database is locked for writing immediately, waiting for up to the busy timeout for
+// other processes to finish writing, so that the transaction cannot subsequently fail
+// because another process wrote to the database first.
+func (db *Database) BeginWrite() error {
+	return db.begin("BEGIN IMMEDIATE")
 }
 
 // Commits the current transaction
@@ -160,12 +251,12 @@ func (db *Database) Commit() error {
 
 	log.Info(2, "committing transaction")
 
-	if err := db.transaction.Commit(); err != nil {
+	if err := db.endTransaction("COMMIT"); err != nil {
+		// a transaction that could not be committed is abandoned
+		db.endTransaction("ROLLBACK")
 		return DatabaseTransactionError{db.Path, err}
 	}
 
-	db.transaction = nil
-
 	return nil
 }
 
@@ -177,12 +268,10 @@ func (db *Database) Rollback() error {
 
 	log.Info(2, "rolling back transaction")
 
-	if err := db.transaction.Rollback(); err != nil {
+	if err := db.endTransaction("ROLLBACK"); err != nil {
 		return DatabaseTransactionError{db.Path, err}
 	}
 
-	db.transaction = nil
-
 	return nil
 }
 
@@ -190,6 +279,12 @@ func (db *Database) Rollback() error {
 func (db *Database) Close() error {
 	log.Info(3, "closing database")
 
+	if db.transaction != nil {
+		// an uncommitted transaction is rolled back when its connection is closed
+		db.transaction.close()
+		db.transaction = nil
+	}
+
 	if err := db.connection.Close(); err != nil {
 		return DatabaseAccessError{db.Path, err}
 	}
@@ -200,19 +295,218 @@ func (db *Database) Close() error {
 // unexported
 
 func init() {
+	if timeout := os.Getenv("TMSU_BUSY_TIMEOUT"); timeout != "" {
+		log.Info(3, "TMSU_BUSY_TIMEOUT=", timeout)
+
+		milliseconds, err := strconv.ParseUint(timeout, 10, 0)
+		if err != nil {
+			log.Warnf("ignoring invalid TMSU_BUSY_TIMEOUT '%v': expected a number of milliseconds", timeout)
+		} else {
+			BusyTimeout = time.Duration(milliseconds) * time.Millisecond
+		}
+	}
+
 	if path := os.Getenv("TMSU_DB"); path != "" {
 		log.Info(3, "TMSU_DB=", path)
 		Path = path
-	} else {
-		u, err := user.Current()
+		PathReason = "specified by the TMSU_DB environment variable"
+		return
+	}
+
+	if workingDirectory, err := os.Getwd(); err == nil {
+		path, err := FindDatabase(workingDirectory)
 		if err != nil {
-			panic(fmt.Sprintf("Could not identify current user: %v", err))
+			log.Warnf("could not search for database: %v", err)
+		}
+		if path != "" {
+			Path = path
+			PathReason = "found by searching upward from the working directory"
+			return
+		}
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		panic(fmt.Sprintf("Could not identify current user: %v", err))
+	}
+
+	Path = filepath.Join(u.HomeDir, ".tmsu", "default.db")
+	PathReason = "default database"
+}
+
+// Switches the database to write-ahead logging, which allows it to be read whilst another
+// process is writing to it. The journal mode is persistent so this need only succeed once.
+func (db *Database) enableWriteAheadLog() {
+	rows, err := db.ExecQuery("PRAGMA journal_mode = WAL")
+	if err != nil {
+		log.Warnf("could not enable write-ahead logging: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	var mode string
+	if rows.Next() {
+		rows.Scan(&mode)
+	}
+
+	if mode != "wal" {
+		log.Infof(2, "database is using journal mode '%v'.", mode)
+	}
+}
+
+func (db *Database) begin(statement string) error {
+	if db.transaction != nil {
+		panic("could not begin transaction: there is already an open transaction")
+	}
+
+	log.Info(2, "beginning new transaction")
+
+	// the transaction is begun explicitly, rather than with sql.DB.Begin, so that the kind of
+	// transaction can be chosen
+	connection, err := db.connection.Conn(context.Background())
+	if err != nil {
+		return DatabaseTransactionError{db.Path, err}
+	}
+
+	if _, err := connection.ExecContext(context.Background(), statement); err != nil {
+		connection.Close()
+		return DatabaseTransactionError{db.Path, err}
+	}
+
+	db.transaction = &transaction{connection, make(map[string]*preparedStatement)}
+
+	return nil
+}
+
+func (db *Database) endTransaction(statement string) error {
+	_, err := db.transaction.connection.ExecContext(context.Background(), statement)
+
+	if err == nil || statement == "ROLLBACK" {
+		db.transaction.close()
+		db.transaction = nil
+	}
+
+	return err
+}
+
+// The most statements to keep prepared for reuse within a transaction.
+const maxPreparedStatements = 100
+
+// A transaction, bound to a single connection from the pool, and the statements that have
+// been prepared upon that connection.
+type transaction struct {
+	connection *sql.Conn
+	statements map[string]*preparedStatement
+}
+
+// A statement prepared for reuse and the rows it most recently returned, if any.
+//
+// Whilst those rows are open the statement is in use: executing it again would reset the
+// rows' cursor and closing it would end them early, silently truncating the results.
+type preparedStatement struct {
+	statement *sql.Stmt
+	rows      *sql.Rows
+}
+
+func (prepared *preparedStatement) inUse() bool {
+	if prepared.rows == nil {
+		return false
+	}
+
+	// the columns are unavailable only once the rows are closed, which happens
+	// automatically once they have been read to the end
+	if _, err := prepared.rows.Columns(); err != nil {
+		prepared.rows = nil
+		return false
+	}
+
+	return true
+}
+
+func (transaction *transaction) exec(query string, args ...interface{}) (sql.Result, error) {
+	prepared, err := transaction.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	if prepared == nil {
+		return transaction.connection.ExecContext(context.Background(), query, args...)
+	}
+
+	return prepared.statement.Exec(args...)
+}
+
+func (transaction *transaction) query(query string, args ...interface{}) (*sql.Rows, error) {
+	prepared, err := transaction.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	if prepared == nil {
+		// the statement is in use by rows still being read so a separate, single use,
+		// statement is prepared, which is closed along with the rows
+		return transaction.connection.QueryContext(context.Background(), query, args...)
+	}
+
+	rows, err := prepared.statement.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	prepared.rows = rows
+
+	return rows, nil
+}
+
+// Retrieves the prepared statement for a query, preparing it if it has not been used
+// before within the transaction.
+//
+// No statement is returned if the query's statement is in use or cannot be kept, in which
+// case the query should be executed without reuse.
+func (transaction *transaction) prepare(query string) (*preparedStatement, error) {
+	if prepared, ok := transaction.statements[query]; ok {
+		if prepared.inUse() {
+			return nil, nil
+		}
+
+		return prepared, nil
+	}
+
+	if len(transaction.statements) >= maxPreparedStatements {
+		// queries built for a single use, such as those for file queries, would
+		// otherwise accumulate: make room by discarding those not in use
+		transaction.closeStatements(false)
+
+		if len(transaction.statements) >= maxPreparedStatements {
+			return nil, nil
+		}
+	}
+
+	statement, err := transaction.connection.PrepareContext(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+
+	prepared := &preparedStatement{statement, nil}
+	transaction.statements[query] = prepared
+
+	return prepared, nil
+}
+
+// Closes the prepared statements, other than those in use unless all is specified.
+func (transaction *transaction) closeStatements(all bool) {
+	for query, prepared := range transaction.statements {
+		if !all && prepared.inUse() {
+			continue
 		}
 
-		Path = filepath.Join(u.HomeDir, ".tmsu", "default.db")
+		prepared.statement.Close()
+		delete(transaction.statements, query)
 	}
 }
 
+func (transaction *transaction) close() {
+	transaction.closeStatements(true)
+	transaction.connection.Close()
+}
+
 func readCount(rows *sql.Rows) (uint, error) {
 	if !rows.Next() {
 		return 0, errors.New("Could not get count.")
@@ -229,3 +523,37 @@ func readCount(rows *sql.Rows) (uint, error) {
 
 	return count, nil
 }
+
+// The regular expressions compiled for the REGEXP operator, which is evaluated for every row.
+var regexps = struct {
+	sync.Mutex
+	compiled map[string]*regexp.Regexp
+}{compiled: make(map[string]*regexp.Regexp)}
+
+// Implements SQLite's REGEXP operator: 'X REGEXP Y' calls regexp(Y, X).
+func matchRegexp(pattern, text string) (bool, error) {
+	regexps.Lock()
+	defer regexps.Unlock()
+
+	expression, ok := regexps.compiled[pattern]
+	if !ok {
+		var err error
+		expression, err = regexp.Compile(pattern)
+		if err != nil {
+			return false, err
+		}
+
+		if len(regexps.compiled) >= 100 {
+			regexps.compiled = make(map[string]*regexp.Regexp)
+		}
+		regexps.compiled[pattern] = expression
+	}
+
+	return expression.MatchString(text), nil
+}
+
+// Compares two value names according to a declared value type: 'value_compare(T, X, Y)' is
+// negative, zero or positive as X is less than, equal to or greater than Y.
+func compareValues(valueType, a, b string) int {
+	return entities.ValueType(valueType).Compare(a, b)
+}
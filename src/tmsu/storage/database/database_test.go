@@ -0,0 +1,234 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package database
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestOpenEnablesWriteAheadLog(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	// test
+
+	db, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	// validate
+
+	rows, err := db.ExecQuery("PRAGMA journal_mode")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer rows.Close()
+
+	var mode string
+	if rows.Next() {
+		if err := rows.Scan(&mode); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if mode != "wal" {
+		test.Fatalf("Expected journal mode 'wal' but was '%v'.", mode)
+	}
+}
+
+func TestWriteWaitsForOtherWriter(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	first, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer first.Close()
+
+	second, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer second.Close()
+
+	if err := first.BeginWrite(); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := first.InsertTag("apple"); err != nil {
+		test.Fatal(err)
+	}
+
+	committed := make(chan error)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		committed <- first.Commit()
+	}()
+
+	// test
+
+	if err := second.BeginWrite(); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := second.InsertTag("banana"); err != nil {
+		test.Fatal(err)
+	}
+	if err := second.Commit(); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	if err := <-committed; err != nil {
+		test.Fatal(err)
+	}
+
+	tags, err := second.Tags()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tags) != 2 {
+		test.Fatalf("Expected 2 tags but were %v.", len(tags))
+	}
+}
+
+func TestReadDuringOtherWrite(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	writer, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer writer.Close()
+
+	reader, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer reader.Close()
+
+	if err := writer.BeginWrite(); err != nil {
+		test.Fatal(err)
+	}
+	defer writer.Rollback()
+
+	if _, err := writer.InsertTag("apple"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := reader.Begin(); err != nil {
+		test.Fatal(err)
+	}
+	defer reader.Rollback()
+
+	count, err := reader.TagCount()
+
+	// validate
+
+	if err != nil {
+		test.Fatal(err)
+	}
+	if count != 0 {
+		test.Fatalf("Expected uncommitted tag to be invisible but tag count was %v.", count)
+	}
+}
+
+func TestRowsSurvivePreparingManyStatements(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	db, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.BeginWrite(); err != nil {
+		test.Fatal(err)
+	}
+	defer db.Rollback()
+
+	tagCount := 10
+	for index := 0; index < tagCount; index++ {
+		if _, err := db.InsertTag(fmt.Sprintf("tag%v", index)); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	// test
+
+	rows, err := db.ExecQuery("SELECT id FROM tag ORDER BY id")
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		count++
+
+		// more distinct statements than are kept prepared
+		for index := 0; index <= maxPreparedStatements; index++ {
+			innerRows, err := db.ExecQuery(fmt.Sprintf("SELECT %v FROM tag", index))
+			if err != nil {
+				test.Fatal(err)
+			}
+			innerRows.Close()
+		}
+
+		// the same statement whilst its rows are still being read
+		innerRows, err := db.ExecQuery("SELECT id FROM tag ORDER BY id")
+		if err != nil {
+			test.Fatal(err)
+		}
+		innerCount := 0
+		for innerRows.Next() {
+			innerCount++
+		}
+		innerRows.Close()
+
+		if innerCount != tagCount {
+			test.Fatalf("Expected %v tags from the nested query but were %v.", tagCount, innerCount)
+		}
+	}
+
+	// validate
+
+	if err := rows.Err(); err != nil {
+		test.Fatal(err)
+	}
+	if count != tagCount {
+		test.Fatalf("Expected %v tags but were %v.", tagCount, count)
+	}
+}
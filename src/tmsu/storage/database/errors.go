@@ -20,6 +20,7 @@ package database
 import (
 	"fmt"
 	_ "github.com/mattn/go-sqlite3"
+	"strings"
 	"tmsu/entities"
 )
 
@@ -51,6 +52,35 @@ func (err DatabaseQueryError) Error() string {
 	return fmt.Sprintf("database query failed: %v", err.Reason)
 }
 
+type DatabaseIntegrityError struct {
+	DatabasePath string
+	Problems     []string
+}
+
+func (err DatabaseIntegrityError) Error() string {
+	return fmt.Sprintf("database at '%v' is corrupt: %v", err.DatabasePath, strings.Join(err.Problems, "; "))
+}
+
+type SchemaVersionError struct {
+	DatabasePath  string
+	Version       uint
+	LatestVersion uint
+}
+
+func (err SchemaVersionError) Error() string {
+	return fmt.Sprintf("database at '%v' has schema version %v but this version of TMSU only supports up to version %v: upgrade TMSU to use this database", err.DatabasePath, err.Version, err.LatestVersion)
+}
+
+type SchemaMigrationError struct {
+	DatabasePath string
+	Version      uint
+	Reason       error
+}
+
+func (err SchemaMigrationError) Error() string {
+	return fmt.Sprintf("could not upgrade database to schema version %v: %v", err.Version, err.Reason)
+}
+
 type NoSuchFileError struct {
 	FileId entities.FileId
 }
@@ -86,10 +116,37 @@ func (err NoSuchFileTagError) Error() string {
 }
 
 type NoSuchImplicationError struct {
-	TagId        entities.TagId
-	ImpliedTagId entities.TagId
+	TagId          entities.TagId
+	ValueId        entities.ValueId
+	ImpliedTagId   entities.TagId
+	ImpliedValueId entities.ValueId
 }
 
 func (err NoSuchImplicationError) Error() string {
-	return fmt.Sprintf("no such implication where tag #%v implies tag #%v", err.TagId, err.ImpliedTagId)
+	return fmt.Sprintf("no such implication where tag #%v (value #%v) implies tag #%v (value #%v)", err.TagId, err.ValueId, err.ImpliedTagId, err.ImpliedValueId)
+}
+
+type NoSuchAliasError struct {
+	Name string
+}
+
+func (err NoSuchAliasError) Error() string {
+	return fmt.Sprintf("no such alias '%v'", err.Name)
+}
+
+type NoSuchTagPropertyError struct {
+	TagId entities.TagId
+	Name  string
+}
+
+func (err NoSuchTagPropertyError) Error() string {
+	return fmt.Sprintf("no such property '%v' for tag #%v", err.Name, err.TagId)
+}
+
+type NoSuchOperationError struct {
+	OperationId entities.OperationId
+}
+
+func (err NoSuchOperationError) Error() string {
+	return fmt.Sprintf("no such operation #%v", err.OperationId)
 }
@@ -20,7 +20,6 @@ package database
 import (
 	"database/sql"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 	"tmsu/common/fingerprint"
@@ -28,6 +27,10 @@ import (
 	"tmsu/query"
 )
 
+// The most files to add with a single statement, keeping within SQLite's limit on the
+// number of statement parameters.
+const filesPerStatement = 150
+
 // Retrieves the total number of tracked files.
 func (db *Database) FileCount() (uint, error) {
 	sql := `SELECT count(1)
@@ -108,6 +111,22 @@ func (db *Database) FilesByDirectory(path string) (entities.Files, error) {
 	return readFiles(rows, make(entities.Files, 0, 10))
 }
 
+// Retrieves the files that are directly within the specified directory.
+func (db *Database) FilesInDirectory(path string) (entities.Files, error) {
+	sql := `SELECT id, directory, name, fingerprint, mod_time, size, is_dir
+            FROM file
+            WHERE directory = ?
+            ORDER BY name`
+
+	rows, err := db.ExecQuery(sql, filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFiles(rows, make(entities.Files, 0, 10))
+}
+
 // Retrieves the number of files with the specified fingerprint.
 func (db *Database) FileCountByFingerprint(fingerprint fingerprint.Fingerprint) (uint, error) {
 	sql := `SELECT count(id)
@@ -155,9 +174,17 @@ func (db *Database) UntaggedFiles() (entities.Files, error) {
 	return readFiles(rows, make(entities.Files, 0, 10))
 }
 
-// Retrieves the count of files matching the specified query and matching the specified path.
-func (db *Database) QueryFileCount(expression query.Expression, path string) (uint, error) {
-	builder := buildCountQuery(expression, path)
+// Retrieves the count of files matching the specified query within the specified scope.
+func (db *Database) QueryFileCount(expression query.Expression, scope query.PathScope) (uint, error) {
+	compiler, err := db.newQueryCompiler(expression)
+	if err != nil {
+		return 0, err
+	}
+
+	builder, err := compiler.buildCountQuery(expression, scope)
+	if err != nil {
+		return 0, err
+	}
 
 	rows, err := db.ExecQuery(builder.Sql, builder.Params...)
 	if err != nil {
@@ -168,9 +195,18 @@ func (db *Database) QueryFileCount(expression query.Expression, path string) (ui
 	return readCount(rows)
 }
 
-// Retrieves the set of files matching the specified query and matching the specified path.
-func (db *Database) QueryFiles(expression query.Expression, path string) (entities.Files, error) {
-	builder := buildQuery(expression, path)
+// Retrieves the set of files matching the specified query within the specified scope.
+func (db *Database) QueryFiles(expression query.Expression, scope query.PathScope) (entities.Files, error) {
+	compiler, err := db.newQueryCompiler(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	builder, err := compiler.buildQuery(expression, scope)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := db.ExecQuery(builder.Sql, builder.Params...)
 	if err != nil {
 		return nil, err
@@ -268,6 +304,45 @@ func (db *Database) InsertFile(path string, fingerprint fingerprint.Fingerprint,
 	return &entities.File{entities.FileId(id), directory, name, fingerprint, modTime, size, isDir}, nil
 }
 
+// Adds files to the database in bulk, several to a statement, setting the identifier of
+// each.
+func (db *Database) InsertFiles(files entities.Files) error {
+	for len(files) > 0 {
+		count := len(files)
+		if count > filesPerStatement {
+			count = filesPerStatement
+		}
+
+		sql := `INSERT INTO file (directory, name, fingerprint, mod_time, size, is_dir)
+                VALUES ` + strings.Repeat("(?, ?, ?, ?, ?, ?), ", count-1) + "(?, ?, ?, ?, ?, ?)"
+
+		args := make([]interface{}, 0, count*6)
+		for _, file := range files[:count] {
+			args = append(args, file.Directory, file.Name, string(file.Fingerprint), file.ModTime, file.Size, file.IsDir)
+		}
+
+		result, err := db.Exec(sql, args...)
+		if err != nil {
+			return err
+		}
+
+		lastId, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		// the rows of a statement are inserted in order, each with an identifier one
+		// greater than that of the row before
+		for index, file := range files[:count] {
+			file.Id = entities.FileId(lastId - int64(count-1-index))
+		}
+
+		files = files[count:]
+	}
+
+	return nil
+}
+
 // Updates a file in the database.
 func (db *Database) UpdateFile(fileId entities.FileId, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
 	directory := filepath.Dir(path)
@@ -385,89 +460,3 @@ func readFiles(rows *sql.Rows, files entities.Files) (entities.Files, error) {
 
 	return files, nil
 }
-
-func buildCountQuery(expression query.Expression, path string) *SqlBuilder {
-	builder := NewBuilder()
-	pBuilder := &builder
-
-	pBuilder.AppendSql("SELECT count(id) FROM file WHERE 1 == 1 AND\n")
-	buildQueryBranch(expression, pBuilder)
-	buildPathClause(path, pBuilder)
-
-	return pBuilder
-}
-
-func buildQuery(expression query.Expression, path string) *SqlBuilder {
-	builder := NewBuilder()
-	pBuilder := &builder
-
-	pBuilder.AppendSql("SELECT id, directory, name, fingerprint, mod_time, size, is_dir FROM file WHERE 1==1 AND\n")
-	buildQueryBranch(expression, pBuilder)
-	buildPathClause(path, pBuilder)
-
-	pBuilder.AppendSql("ORDER BY directory || '/' || name")
-
-	return pBuilder
-}
-
-func buildQueryBranch(expression query.Expression, builder *SqlBuilder) {
-	switch exp := expression.(type) {
-	case query.TagExpression:
-		builder.AppendSql(`id IN (SELECT file_id
-FROM file_tag
-WHERE tag_id = (SELECT id
-                FROM tag
-                WHERE name = `)
-		builder.AppendParam(exp.Name)
-		builder.AppendSql(`))`)
-	case query.ComparisonExpression:
-		var valueExpression string
-		_, err := strconv.ParseFloat(exp.Value.Name, 64)
-		if err == nil {
-			valueExpression = "CAST(name AS float)"
-		} else {
-			valueExpression = "name"
-		}
-
-		builder.AppendSql(`id IN (SELECT file_id
-FROM file_tag
-WHERE tag_id = (SELECT id
-                FROM tag
-                WHERE name = `)
-		builder.AppendParam(exp.Tag.Name)
-		builder.AppendSql(`)
-AND value_id IN (SELECT id
-                 FROM value
-                 WHERE ` + valueExpression + ` ` + exp.Operator + ` `)
-		builder.AppendParam(exp.Value.Name)
-		builder.AppendSql(`))`)
-	case query.NotExpression:
-		builder.AppendSql("\nNOT\n")
-		buildQueryBranch(exp.Operand, builder)
-	case query.AndExpression:
-		buildQueryBranch(exp.LeftOperand, builder)
-		builder.AppendSql("\nAND\n")
-		buildQueryBranch(exp.RightOperand, builder)
-	case query.OrExpression:
-		builder.AppendSql("(\n")
-		buildQueryBranch(exp.LeftOperand, builder)
-		builder.AppendSql("\nOR\n")
-		buildQueryBranch(exp.RightOperand, builder)
-		builder.AppendSql(")\n")
-	case query.EmptyExpression:
-		builder.AppendSql("1 == 1\n")
-	default:
-		panic("Unsupported expression type.")
-	}
-}
-
-func buildPathClause(path string, builder *SqlBuilder) {
-	path = filepath.Clean(path)
-
-	dir, name := filepath.Split(path)
-	dir = filepath.Clean(dir)
-
-	if path != "" {
-		builder.AppendSql("AND (directory = '" + path + "' OR directory LIKE '" + filepath.Join(path, "%") + "' OR (directory = '" + dir + "' AND name = '" + name + "'))\n")
-	}
-}
@@ -0,0 +1,249 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package database
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+	"tmsu/entities"
+	"tmsu/query"
+)
+
+func TestInsertFilesAssignsIdentifiers(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	db, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.InsertFile("/tmp/tmsu/existing", "abc", time.Now(), 123, false); err != nil {
+		test.Fatal(err)
+	}
+
+	files := make(entities.Files, filesPerStatement+10)
+	for index := range files {
+		files[index] = &entities.File{0, "/tmp/tmsu", fmt.Sprintf("file%v", index), "", time.Now(), 0, false}
+	}
+
+	// test
+
+	if err := db.InsertFiles(files); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	for _, file := range files {
+		stored, err := db.FileByPath(file.Path())
+		if err != nil {
+			test.Fatal(err)
+		}
+		if stored == nil || stored.Id != file.Id {
+			test.Fatalf("%v: expected file to have identifier %v.", file.Path(), file.Id)
+		}
+	}
+}
+
+func TestQueryFiles(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	db, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	files := make(entities.Files, 5)
+	for index, path := range []string{"/tmp/tmsu/a", "/tmp/tmsu/b", "/tmp/tmsu/dir/c", "/tmp/other/d", "/tmp/other/e"} {
+		file, err := db.InsertFile(path, "", time.Now(), 0, false)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		files[index] = file
+	}
+
+	tags := make(map[string]*entities.Tag)
+	for _, name := range []string{"apple", "banana", "cherry", "weight", "colour"} {
+		tag, err := db.InsertTag(name)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		tags[name] = tag
+	}
+
+	values := make(map[string]*entities.Value)
+	for _, name := range []string{"9", "10", "red", "green"} {
+		value, err := db.InsertValue(name)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		values[name] = value
+	}
+
+	fileTags := []struct {
+		file  *entities.File
+		tag   string
+		value string
+	}{
+		{files[0], "apple", ""},
+		{files[0], "weight", "9"},
+		{files[0], "colour", "red"},
+		{files[1], "weight", "10"},
+		{files[1], "banana", ""},
+		{files[1], "colour", "green"},
+		{files[2], "apple", ""},
+		{files[2], "banana", ""},
+		{files[3], "apple", ""},
+		{files[3], "cherry", ""},
+		{files[4], "colour", ""},
+	}
+	for _, fileTag := range fileTags {
+		var valueId entities.ValueId
+		if fileTag.value != "" {
+			valueId = values[fileTag.value].Id
+		}
+
+		if _, err := db.AddFileTag(fileTag.file.Id, tags[fileTag.tag].Id, valueId); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	queries := []struct {
+		text     string
+		include  []string
+		exclude  []string
+		expected []string
+	}{
+		{"apple", nil, nil, []string{"/tmp/other/d", "/tmp/tmsu/a", "/tmp/tmsu/dir/c"}},
+		{"apple", []string{"/tmp/tmsu"}, nil, []string{"/tmp/tmsu/a", "/tmp/tmsu/dir/c"}},
+		{"apple", []string{"/tmp/tmsu/a"}, nil, []string{"/tmp/tmsu/a"}},
+		{"apple", []string{"/tmp/tmsu/a", "/tmp/other"}, nil, []string{"/tmp/other/d", "/tmp/tmsu/a"}},
+		{"apple", []string{"/tmp"}, []string{"/tmp/tmsu/dir"}, []string{"/tmp/other/d", "/tmp/tmsu/a"}},
+		{"apple", nil, []string{"/tmp/tmsu/a", "/tmp/other"}, []string{"/tmp/tmsu/dir/c"}},
+		{"apple", []string{"/"}, nil, []string{"/tmp/other/d", "/tmp/tmsu/a", "/tmp/tmsu/dir/c"}},
+		{"not apple", nil, nil, []string{"/tmp/other/e", "/tmp/tmsu/b"}},
+		{"not not apple", nil, nil, []string{"/tmp/other/d", "/tmp/tmsu/a", "/tmp/tmsu/dir/c"}},
+		{"apple and banana", nil, nil, []string{"/tmp/tmsu/dir/c"}},
+		{"apple and not banana and not cherry", nil, nil, []string{"/tmp/tmsu/a"}},
+		{"not apple and not banana", nil, nil, []string{"/tmp/other/e"}},
+		{"banana or cherry", nil, nil, []string{"/tmp/other/d", "/tmp/tmsu/b", "/tmp/tmsu/dir/c"}},
+		{"banana or cherry or weight < 10", nil, nil, []string{"/tmp/other/d", "/tmp/tmsu/a", "/tmp/tmsu/b", "/tmp/tmsu/dir/c"}},
+		{"(apple or banana) and not (cherry or weight)", nil, nil, []string{"/tmp/tmsu/dir/c"}},
+		{"apple and (banana or weight) and not (cherry and apple)", nil, nil, []string{"/tmp/tmsu/a", "/tmp/tmsu/dir/c"}},
+		{"weight > 9", nil, nil, []string{"/tmp/tmsu/b"}},
+		{"weight >= 9", nil, nil, []string{"/tmp/tmsu/a", "/tmp/tmsu/b"}},
+		{"weight == 10.0", nil, nil, []string{"/tmp/tmsu/b"}},
+		{"colour == red", nil, nil, []string{"/tmp/tmsu/a"}},
+		{"colour != red", nil, nil, []string{"/tmp/tmsu/b"}},
+		{"colour == blue", nil, nil, []string{}},
+		{"colour < red", nil, nil, []string{"/tmp/tmsu/b"}},
+		{"durian", nil, nil, []string{}},
+		{"durian or apple", nil, nil, []string{"/tmp/other/d", "/tmp/tmsu/a", "/tmp/tmsu/dir/c"}},
+		{"not durian", []string{"/tmp/other"}, nil, []string{"/tmp/other/d", "/tmp/other/e"}},
+		{"", nil, []string{"/tmp/tmsu"}, []string{"/tmp/other/d", "/tmp/other/e"}},
+	}
+
+	for _, q := range queries {
+		expression, err := query.Parse(q.text)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		scope := query.NewPathScope(q.include, q.exclude)
+
+		// test
+
+		matches, err := db.QueryFiles(expression, scope)
+		if err != nil {
+			test.Fatalf("Query '%v' failed: %v", q.text, err)
+		}
+
+		count, err := db.QueryFileCount(expression, scope)
+		if err != nil {
+			test.Fatalf("Query '%v' failed: %v", q.text, err)
+		}
+
+		// validate
+
+		if len(matches) != len(q.expected) || int(count) != len(q.expected) {
+			test.Fatalf("Query '%v' in %v matched %v files (count %v) but expected %v.", q.text, scope, len(matches), count, len(q.expected))
+		}
+		for index, file := range matches {
+			if file.Path() != q.expected[index] {
+				test.Fatalf("Query '%v' in %v matched '%v' but expected '%v'.", q.text, scope, file.Path(), q.expected[index])
+			}
+		}
+	}
+}
+
+func TestQueryFilesScopeMatchesPathsLiterally(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	db, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, path := range []string{"/tmp/a_b/file", "/tmp/axb/file", "/tmp/100%/file", "/tmp/100x/file", "/tmp/it's/file", `/tmp/back\slash/file`} {
+		if _, err := db.InsertFile(path, "", time.Now(), 0, false); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	scopes := []struct {
+		path     string
+		expected string
+	}{
+		{"/tmp/a_b", "/tmp/a_b/file"},
+		{"/tmp/100%", "/tmp/100%/file"},
+		{"/tmp/it's", "/tmp/it's/file"},
+		{`/tmp/back\slash`, `/tmp/back\slash/file`},
+	}
+
+	for _, scope := range scopes {
+		// test
+
+		files, err := db.QueryFiles(query.EmptyExpression{}, query.NewPathScope([]string{scope.path}, nil))
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		// validate
+
+		if len(files) != 1 || files[0].Path() != scope.expected {
+			test.Fatalf("Scope '%v' matched %v but expected only '%v'.", scope.path, files, scope.expected)
+		}
+	}
+}
@@ -19,9 +19,14 @@ package database
 
 import (
 	"database/sql"
+	"strings"
 	"tmsu/entities"
 )
 
+// The most file tags to add with a single statement, keeping within SQLite's limit on
+// the number of statement parameters.
+const fileTagsPerStatement = 300
+
 // Determines whether the specified file has the specified tag applied.
 func (db *Database) FileTagExists(fileId entities.FileId, tagId entities.TagId, value_id entities.ValueId) (bool, error) {
 	sql := `SELECT count(1)
@@ -164,6 +169,24 @@ func (db *Database) FileTagsByFileId(fileId entities.FileId) (entities.FileTags,
 	return readFileTags(rows, make(entities.FileTags, 0, 10))
 }
 
+// Retrieves the set of file tags that refer to a file, tag or value that does not exist.
+func (db *Database) DanglingFileTags() (entities.FileTags, error) {
+	sql := `SELECT file_id, tag_id, value_id
+            FROM file_tag
+            WHERE file_id NOT IN (SELECT id FROM file)
+            OR tag_id NOT IN (SELECT id FROM tag)
+            OR (value_id != 0 AND value_id NOT IN (SELECT id FROM value))
+            ORDER BY file_id, tag_id, value_id`
+
+	rows, err := db.ExecQuery(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readFileTags(rows, make(entities.FileTags, 0, 10))
+}
+
 // Adds a file tag.
 func (db *Database) AddFileTag(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (*entities.FileTag, error) {
 	sql := `INSERT OR IGNORE INTO file_tag (file_id, tag_id, value_id)
@@ -177,6 +200,33 @@ func (db *Database) AddFileTag(fileId entities.FileId, tagId entities.TagId, val
 	return &entities.FileTag{fileId, tagId, valueId, true, false}, nil
 }
 
+// Adds file tags in bulk, several to a statement. File tags that already exist are
+// ignored.
+func (db *Database) AddFileTags(fileTags entities.FileTags) error {
+	for len(fileTags) > 0 {
+		count := len(fileTags)
+		if count > fileTagsPerStatement {
+			count = fileTagsPerStatement
+		}
+
+		sql := `INSERT OR IGNORE INTO file_tag (file_id, tag_id, value_id)
+                VALUES ` + strings.Repeat("(?, ?, ?), ", count-1) + "(?, ?, ?)"
+
+		args := make([]interface{}, 0, count*3)
+		for _, fileTag := range fileTags[:count] {
+			args = append(args, fileTag.FileId, fileTag.TagId, fileTag.ValueId)
+		}
+
+		if _, err := db.Exec(sql, args...); err != nil {
+			return err
+		}
+
+		fileTags = fileTags[count:]
+	}
+
+	return nil
+}
+
 // Removes a file tag.
 func (db *Database) DeleteFileTag(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) error {
 	sql := `DELETE FROM file_tag
@@ -227,6 +277,21 @@ func (db *Database) DeleteFileTagsByTagId(tagId entities.TagId) error {
 	return nil
 }
 
+// Removes the file tags that refer to a file, tag or value that does not exist.
+func (db *Database) DeleteDanglingFileTags() error {
+	sql := `DELETE FROM file_tag
+            WHERE file_id NOT IN (SELECT id FROM file)
+            OR tag_id NOT IN (SELECT id FROM tag)
+            OR (value_id != 0 AND value_id NOT IN (SELECT id FROM value))`
+
+	_, err := db.Exec(sql)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // Copies file tags from one tag to another.
 func (db *Database) CopyFileTags(sourceTagId entities.TagId, destTagId entities.TagId) error {
 	sql := `INSERT INTO file_tag (file_id, tag_id, value_id)
@@ -25,11 +25,13 @@ import (
 
 // Retrieves the complete set of tag implications.
 func (db *Database) Implications() (entities.Implications, error) {
-	sql := `SELECT t1.id, t1.name, t2.id, t2.name
-            FROM implication, tag t1, tag t2
-            WHERE implication.tag_id = t1.id
-            AND implication.implied_tag_id = t2.id
-            ORDER BY t1.name, t2.name`
+	sql := `SELECT t1.id, t1.name, implication.value_id, coalesce(v1.name, ''), t2.id, t2.name, implication.implied_value_id, coalesce(v2.name, ''), implication.preserve_value
+            FROM implication
+            INNER JOIN tag t1 ON implication.tag_id = t1.id
+            INNER JOIN tag t2 ON implication.implied_tag_id = t2.id
+            LEFT JOIN value v1 ON implication.value_id = v1.id
+            LEFT JOIN value v2 ON implication.implied_value_id = v2.id
+            ORDER BY t1.name, v1.name, t2.name, v2.name`
 
 	result, err := db.ExecQuery(sql)
 	if err != nil {
@@ -46,13 +48,15 @@ func (db *Database) Implications() (entities.Implications, error) {
 
 // Retrieves the set of tags implied by the specified tags.
 func (db *Database) ImplicationsForTags(tagIds entities.TagIds) (entities.Implications, error) {
-	sql := `SELECT t1.id, t1.name, t2.id, t2.name
-            FROM implication, tag t1, tag t2
+	sql := `SELECT t1.id, t1.name, implication.value_id, coalesce(v1.name, ''), t2.id, t2.name, implication.implied_value_id, coalesce(v2.name, ''), implication.preserve_value
+            FROM implication
+            INNER JOIN tag t1 ON implication.tag_id = t1.id
+            INNER JOIN tag t2 ON implication.implied_tag_id = t2.id
+            LEFT JOIN value v1 ON implication.value_id = v1.id
+            LEFT JOIN value v2 ON implication.implied_value_id = v2.id
             WHERE implication.tag_id IN (?`
 	sql += strings.Repeat(",?", len(tagIds)-1)
-	sql += `)
-	        AND implication.tag_id = t1.id
-	        AND implication.implied_tag_id = t2.id`
+	sql += ")"
 
 	params := make([]interface{}, len(tagIds))
 	for index, tagId := range tagIds {
@@ -72,6 +76,33 @@ func (db *Database) ImplicationsForTags(tagIds entities.TagIds) (entities.Implic
 	return implications, nil
 }
 
+// Retrieves the set of implications that refer to a tag that does not exist.
+//
+// The name of a missing tag is reported as empty.
+func (db *Database) DanglingImplications() (entities.Implications, error) {
+	sql := `SELECT implication.tag_id, coalesce(t1.name, ''), implication.value_id, coalesce(v1.name, ''), implication.implied_tag_id, coalesce(t2.name, ''), implication.implied_value_id, coalesce(v2.name, ''), implication.preserve_value
+            FROM implication
+            LEFT JOIN tag t1 ON implication.tag_id = t1.id
+            LEFT JOIN tag t2 ON implication.implied_tag_id = t2.id
+            LEFT JOIN value v1 ON implication.value_id = v1.id
+            LEFT JOIN value v2 ON implication.implied_value_id = v2.id
+            WHERE t1.id IS NULL OR t2.id IS NULL
+            ORDER BY implication.tag_id, implication.implied_tag_id`
+
+	result, err := db.ExecQuery(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer result.Close()
+
+	implications, err := readImplications(result, make(entities.Implications, 0, 10))
+	if err != nil {
+		return nil, err
+	}
+
+	return implications, nil
+}
+
 // Updates implications featuring the specified tag.
 func (db Database) UpdateImplicationsForTagId(implyingTagId, impliedTagId entities.TagId) error {
 	// prevent a tag implying itself
@@ -85,7 +116,7 @@ func (db Database) UpdateImplicationsForTagId(implyingTagId, impliedTagId entiti
 		return err
 	}
 
-	sql = `UPDATE implication
+	sql = `UPDATE OR IGNORE implication
            SET tag_id = ?2
            WHERE tag_id = ?1`
 
@@ -94,7 +125,7 @@ func (db Database) UpdateImplicationsForTagId(implyingTagId, impliedTagId entiti
 		return err
 	}
 
-	sql = `UPDATE implication
+	sql = `UPDATE OR IGNORE implication
            SET implied_tag_id = ?2
            WHERE implied_tag_id = ?1`
 
@@ -103,15 +134,16 @@ func (db Database) UpdateImplicationsForTagId(implyingTagId, impliedTagId entiti
 		return err
 	}
 
-	return nil
+	// remove those that duplicated an existing implication
+	return db.DeleteImplicationsForTagId(implyingTagId)
 }
 
-// Adds the specified implications
-func (db Database) AddImplication(tagId, impliedTagId entities.TagId) error {
-	sql := `INSERT OR IGNORE INTO implication (tag_id, implied_tag_id)
-	        VALUES (?1, ?2)`
+// Adds the specified implication.
+func (db Database) AddImplication(tagId entities.TagId, valueId entities.ValueId, impliedTagId entities.TagId, impliedValueId entities.ValueId, preservesValue bool) error {
+	sql := `INSERT OR IGNORE INTO implication (tag_id, value_id, implied_tag_id, implied_value_id, preserve_value)
+	        VALUES (?1, ?2, ?3, ?4, ?5)`
 
-	_, err := db.Exec(sql, tagId, impliedTagId)
+	_, err := db.Exec(sql, tagId, valueId, impliedTagId, impliedValueId, preservesValue)
 	if err != nil {
 		return err
 	}
@@ -119,12 +151,12 @@ func (db Database) AddImplication(tagId, impliedTagId entities.TagId) error {
 	return nil
 }
 
-// Deletes the specified implications
-func (db Database) DeleteImplication(tagId, impliedTagId entities.TagId) error {
+// Deletes the specified implication.
+func (db Database) DeleteImplication(tagId entities.TagId, valueId entities.ValueId, impliedTagId entities.TagId, impliedValueId entities.ValueId, preservesValue bool) error {
 	sql := `DELETE FROM implication
-            WHERE tag_id = ?1 AND implied_tag_id = ?2`
+            WHERE tag_id = ?1 AND value_id = ?2 AND implied_tag_id = ?3 AND implied_value_id = ?4 AND preserve_value = ?5`
 
-	result, err := db.Exec(sql, tagId, impliedTagId)
+	result, err := db.Exec(sql, tagId, valueId, impliedTagId, impliedValueId, preservesValue)
 	if err != nil {
 		return err
 	}
@@ -135,7 +167,7 @@ func (db Database) DeleteImplication(tagId, impliedTagId entities.TagId) error {
 	}
 
 	if rowsAffected == 0 {
-		return NoSuchImplicationError{tagId, impliedTagId}
+		return NoSuchImplicationError{tagId, valueId, impliedTagId, impliedValueId}
 	}
 	if rowsAffected > 1 {
 		panic("expected exactly one row to be affected")
@@ -157,6 +189,20 @@ func (db Database) DeleteImplicationsForTagId(tagId entities.TagId) error {
 	return nil
 }
 
+// Deletes the implications that refer to a tag that does not exist.
+func (db Database) DeleteDanglingImplications() error {
+	sql := `DELETE FROM implication
+            WHERE tag_id NOT IN (SELECT id FROM tag)
+            OR implied_tag_id NOT IN (SELECT id FROM tag)`
+
+	_, err := db.Exec(sql)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 // unexported
 
 func readImplication(rows *sql.Rows) (*entities.Implication, error) {
@@ -167,16 +213,21 @@ func readImplication(rows *sql.Rows) (*entities.Implication, error) {
 		return nil, rows.Err()
 	}
 
-	var implyingTagId entities.TagId
-	var implyingTagName string
-	var impliedTagId entities.TagId
-	var impliedTagName string
-	err := rows.Scan(&implyingTagId, &implyingTagName, &impliedTagId, &impliedTagName)
+	var implication entities.Implication
+	err := rows.Scan(&implication.ImplyingTag.Id,
+		&implication.ImplyingTag.Name,
+		&implication.ImplyingValue.Id,
+		&implication.ImplyingValue.Name,
+		&implication.ImpliedTag.Id,
+		&implication.ImpliedTag.Name,
+		&implication.ImpliedValue.Id,
+		&implication.ImpliedValue.Name,
+		&implication.PreservesValue)
 	if err != nil {
 		return nil, err
 	}
 
-	return &entities.Implication{entities.Tag{implyingTagId, implyingTagName}, entities.Tag{impliedTagId, impliedTagName}}, nil
+	return &implication, nil
 }
 
 func readImplications(rows *sql.Rows, implications entities.Implications) (entities.Implications, error) {
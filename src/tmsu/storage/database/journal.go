@@ -0,0 +1,578 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"tmsu/entities"
+)
+
+// The number of column values a journal entry can hold.
+const journalColumnCount = 7
+
+type journalledTable struct {
+	columns  []string
+	keyCount int // the leading columns that identify a row
+}
+
+// The tables whose changes are journalled.
+var journalledTables = map[string]journalledTable{
+	"file":         {[]string{"id", "directory", "name", "fingerprint", "mod_time", "size", "is_dir"}, 1},
+	"tag":          {[]string{"id", "name"}, 1},
+	"value":        {[]string{"id", "name"}, 1},
+	"file_tag":     {[]string{"file_id", "tag_id", "value_id"}, 3},
+	"implication":  {[]string{"tag_id", "implied_tag_id", "value_id", "implied_value_id", "preserve_value"}, 5},
+	"query":        {[]string{"text"}, 1},
+	"setting":      {[]string{"name", "value"}, 1},
+	"alias":        {[]string{"name", "tag_id"}, 1},
+	"tag_property": {[]string{"tag_id", "name", "value"}, 2},
+}
+
+// The complete set of operations, oldest first.
+func (db *Database) Operations() (entities.Operations, error) {
+	sql := `SELECT id, time, command, user, coalesce(undone_by, 0), (SELECT count(1) FROM journal WHERE operation_id = operation.id)
+            FROM operation
+            ORDER BY id`
+
+	rows, err := db.ExecQuery(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readOperations(rows, make(entities.Operations, 0, 10))
+}
+
+// Retrieves the specified operation.
+func (db *Database) Operation(operationId entities.OperationId) (*entities.Operation, error) {
+	sql := `SELECT id, time, command, user, coalesce(undone_by, 0), (SELECT count(1) FROM journal WHERE operation_id = operation.id)
+            FROM operation
+            WHERE id = ?`
+
+	rows, err := db.ExecQuery(sql, operationId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readOperation(rows)
+}
+
+// Retrieves the most recent operations that can be undone, newest first.
+//
+// Operations that have already been undone and operations that undid others are excluded.
+func (db *Database) UndoableOperations(count uint) (entities.Operations, error) {
+	sql := `SELECT id, time, command, user, coalesce(undone_by, 0), (SELECT count(1) FROM journal WHERE operation_id = operation.id)
+            FROM operation
+            WHERE undone_by IS NULL AND
+                  NOT EXISTS (SELECT 1 FROM operation undone WHERE undone.undone_by = operation.id)
+            ORDER BY id DESC
+            LIMIT ?`
+
+	rows, err := db.ExecQuery(sql, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readOperations(rows, make(entities.Operations, 0, count))
+}
+
+// Adds an operation.
+func (db *Database) InsertOperation(time time.Time, command, user string) (*entities.Operation, error) {
+	sql := `INSERT INTO operation (time, command, user)
+            VALUES (?, ?, ?)`
+
+	result, err := db.Exec(sql, time, command, user)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &entities.Operation{entities.OperationId(id), time, command, user, 0, 0}, nil
+}
+
+// Records that an operation was undone by another.
+func (db *Database) UpdateOperationUndoneBy(operationId, undoneBy entities.OperationId) error {
+	sql := `UPDATE operation
+            SET undone_by = ?
+            WHERE id = ?`
+
+	result, err := db.Exec(sql, undoneBy, operationId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return NoSuchOperationError{operationId}
+	}
+
+	return nil
+}
+
+// Clears the undone state of the operations undone by the specified operation.
+func (db *Database) ReinstateOperationsUndoneBy(operationId entities.OperationId) error {
+	sql := `UPDATE operation
+            SET undone_by = NULL
+            WHERE undone_by = ?`
+
+	if _, err := db.Exec(sql, operationId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Retrieves the journal entries of the specified operation in the order the changes were made.
+func (db *Database) JournalEntries(operationId entities.OperationId) (entities.JournalEntries, error) {
+	sql := `SELECT id, operation_id, table_name, action, column1, column2, column3, column4, column5, column6, column7
+            FROM journal
+            WHERE operation_id = ?
+            ORDER BY id`
+
+	rows, err := db.ExecQuery(sql, operationId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readJournalEntries(rows, make(entities.JournalEntries, 0, 10))
+}
+
+// Retrieves the number of journal entries not yet attributed to an operation.
+func (db *Database) PendingJournalEntryCount() (uint, error) {
+	sql := `SELECT count(1)
+            FROM journal
+            WHERE operation_id IS NULL`
+
+	rows, err := db.ExecQuery(sql)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	return readCount(rows)
+}
+
+// Attributes the journal entries not yet attributed to an operation to the specified operation.
+func (db *Database) AssignPendingJournalEntries(operationId entities.OperationId) error {
+	sql := `UPDATE journal
+            SET operation_id = ?
+            WHERE operation_id IS NULL`
+
+	if _, err := db.Exec(sql, operationId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Removes the journal entries not attributed to an operation.
+func (db *Database) DeletePendingJournalEntries() error {
+	sql := `DELETE FROM journal
+            WHERE operation_id IS NULL`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Reverses the changes recorded by the journal entries, newest first.
+//
+// An update, which is journalled as a deletion immediately followed by an insertion of the
+// same row, is reverted in place so that rows depending upon it are not removed by
+// cascading deletes.
+func (db *Database) RevertJournalEntries(entries entities.JournalEntries) error {
+	for index := len(entries) - 1; index >= 0; index-- {
+		entry := entries[index]
+
+		if err := db.checkJournalledRow(entry); err != nil {
+			return fmt.Errorf("could not revert change #%v: %v", entry.Id, err)
+		}
+
+		var err error
+		if index > 0 && isJournalledUpdate(entries[index-1], entry) {
+			err = db.revertJournalledUpdate(entries[index-1])
+			index--
+		} else {
+			err = db.revertJournalEntry(entry)
+		}
+
+		if err != nil {
+			return fmt.Errorf("could not revert change #%v: %v", entry.Id, err)
+		}
+	}
+
+	return nil
+}
+
+// unexported
+
+// Checks that the row changed by a journal entry still holds what the entry left in it, so
+// that a change made since by another operation is not silently overwritten.
+func (db *Database) checkJournalledRow(entry *entities.JournalEntry) error {
+	table, ok := journalledTables[entry.Table]
+	if !ok {
+		// reported when the entry is reverted
+		return nil
+	}
+
+	var sql string
+	var args []interface{}
+	var expected uint
+
+	switch entry.Action {
+	case entities.JournalInsert:
+		sql = `SELECT count(1)
+               FROM ` + entry.Table + `
+               WHERE ` + rowConditions(table)
+		args = entry.Columns[:len(table.columns)]
+		expected = 1
+	case entities.JournalDelete:
+		sql = `SELECT count(1)
+               FROM ` + entry.Table + `
+               WHERE ` + keyConditions(table)
+		args = entry.Columns[:table.keyCount]
+		expected = 0
+	default:
+		return nil
+	}
+
+	rows, err := db.ExecQuery(sql, args...)
+	if err != nil {
+		return err
+	}
+	count, err := readCount(rows)
+	rows.Close()
+	if err != nil {
+		return err
+	}
+	if count == expected {
+		return nil
+	}
+
+	operationId, err := db.conflictingOperationId(entry, table)
+	if err != nil {
+		return err
+	}
+
+	description := strings.Replace(entry.Table, "_", " ", -1)
+	if operationId == 0 {
+		return fmt.Errorf("the %v has since been changed", description)
+	}
+
+	return fmt.Errorf("the %v has since been changed by operation #%v", description, operationId)
+}
+
+// Retrieves the most recent operation, other than the one that made it, to have changed the
+// row changed by a journal entry.
+func (db *Database) conflictingOperationId(entry *entities.JournalEntry, table journalledTable) (entities.OperationId, error) {
+	conditions := make([]string, table.keyCount)
+	for index := range conditions {
+		conditions[index] = fmt.Sprintf("column%v = ?", index+1)
+	}
+
+	sql := `SELECT operation_id
+            FROM journal
+            WHERE table_name = ? AND ` + strings.Join(conditions, " AND ") + ` AND id > ? AND operation_id NOT IN (0, ?)
+            ORDER BY id DESC
+            LIMIT 1`
+
+	args := []interface{}{entry.Table}
+	args = append(args, entry.Columns[:table.keyCount]...)
+	args = append(args, entry.Id, entry.OperationId)
+
+	rows, err := db.ExecQuery(sql, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+
+	var operationId entities.OperationId
+	if err := rows.Scan(&operationId); err != nil {
+		return 0, err
+	}
+
+	return operationId, nil
+}
+
+// Reverses the change recorded by a journal entry.
+func (db *Database) revertJournalEntry(entry *entities.JournalEntry) error {
+	table, ok := journalledTables[entry.Table]
+	if !ok {
+		return fmt.Errorf("journal entry #%v refers to unknown table '%v'", entry.Id, entry.Table)
+	}
+
+	var sql string
+	var args []interface{}
+
+	switch entry.Action {
+	case entities.JournalInsert:
+		sql = `DELETE FROM ` + entry.Table + `
+               WHERE ` + keyConditions(table)
+		args = entry.Columns[:table.keyCount]
+	case entities.JournalDelete:
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(table.columns)), ", ")
+
+		sql = `INSERT INTO ` + entry.Table + ` (` + strings.Join(table.columns, ", ") + `)
+               VALUES (` + placeholders + `)`
+		args = entry.Columns[:len(table.columns)]
+	default:
+		return fmt.Errorf("journal entry #%v has unknown action '%v'", entry.Id, entry.Action)
+	}
+
+	if _, err := db.Exec(sql, args...); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Restores a row to the values recorded by the deletion journalled for its update.
+func (db *Database) revertJournalledUpdate(deleted *entities.JournalEntry) error {
+	table := journalledTables[deleted.Table]
+	if table.keyCount == len(table.columns) {
+		// the row was updated to itself
+		return nil
+	}
+
+	assignments := make([]string, 0, len(table.columns)-table.keyCount)
+	for _, column := range table.columns[table.keyCount:] {
+		assignments = append(assignments, column+" = ?")
+	}
+
+	sql := `UPDATE ` + deleted.Table + `
+            SET ` + strings.Join(assignments, ", ") + `
+            WHERE ` + keyConditions(table)
+
+	args := make([]interface{}, 0, len(table.columns))
+	args = append(args, deleted.Columns[table.keyCount:len(table.columns)]...)
+	args = append(args, deleted.Columns[:table.keyCount]...)
+
+	if _, err := db.Exec(sql, args...); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Determines whether a pair of consecutive journal entries records the update of a row.
+func isJournalledUpdate(previous, entry *entities.JournalEntry) bool {
+	if previous.Action != entities.JournalDelete || entry.Action != entities.JournalInsert || previous.Table != entry.Table {
+		return false
+	}
+
+	table, ok := journalledTables[entry.Table]
+	if !ok {
+		return false
+	}
+
+	for index := 0; index < table.keyCount; index++ {
+		if fmt.Sprint(previous.Columns[index]) != fmt.Sprint(entry.Columns[index]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func keyConditions(table journalledTable) string {
+	conditions := make([]string, table.keyCount)
+	for index, column := range table.columns[:table.keyCount] {
+		conditions[index] = column + " = ?"
+	}
+
+	return strings.Join(conditions, " AND ")
+}
+
+// The conditions matching a row on every column, null or not.
+func rowConditions(table journalledTable) string {
+	conditions := make([]string, len(table.columns))
+	for index, column := range table.columns {
+		conditions[index] = column + " IS ?"
+	}
+
+	return strings.Join(conditions, " AND ")
+}
+
+// Creates the triggers that journal the changes made to the table.
+//
+// An update is journalled as a deletion of the old row followed by an insertion of the new.
+func (db *Database) createJournalTriggers(table string, columns []string) error {
+	if len(columns) > journalColumnCount {
+		panic(fmt.Sprintf("table '%v' has too many columns to journal", table))
+	}
+
+	journalColumns := make([]string, len(columns))
+	oldValues := make([]string, len(columns))
+	newValues := make([]string, len(columns))
+	for index, column := range columns {
+		journalColumns[index] = fmt.Sprintf("column%v", index+1)
+		oldValues[index] = "OLD." + column
+		newValues[index] = "NEW." + column
+	}
+
+	insertSql := func(action string, values []string) string {
+		return `INSERT INTO journal (table_name, action, ` + strings.Join(journalColumns, ", ") + `)
+                VALUES ('` + table + `', '` + action + `', ` + strings.Join(values, ", ") + `);`
+	}
+
+	sql := `CREATE TRIGGER trg_journal_` + table + `_insert
+            AFTER INSERT ON ` + table + `
+            BEGIN
+                ` + insertSql(entities.JournalInsert, newValues) + `
+            END`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE TRIGGER trg_journal_` + table + `_update
+           AFTER UPDATE ON ` + table + `
+           BEGIN
+               ` + insertSql(entities.JournalDelete, oldValues) + `
+               ` + insertSql(entities.JournalInsert, newValues) + `
+           END`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE TRIGGER trg_journal_` + table + `_delete
+           AFTER DELETE ON ` + table + `
+           BEGIN
+               ` + insertSql(entities.JournalDelete, oldValues) + `
+           END`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Removes the triggers that journal the changes made to the table.
+func (db *Database) dropJournalTriggers(table string) error {
+	for _, event := range []string{"insert", "update", "delete"} {
+		sql := `DROP TRIGGER IF EXISTS trg_journal_` + table + `_` + event
+
+		if _, err := db.Exec(sql); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readOperation(rows *sql.Rows) (*entities.Operation, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var id, undoneBy entities.OperationId
+	var time time.Time
+	var command, user string
+	var changeCount uint
+	err := rows.Scan(&id, &time, &command, &user, &undoneBy, &changeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entities.Operation{id, time, command, user, undoneBy, changeCount}, nil
+}
+
+func readOperations(rows *sql.Rows, operations entities.Operations) (entities.Operations, error) {
+	for {
+		operation, err := readOperation(rows)
+		if err != nil {
+			return nil, err
+		}
+		if operation == nil {
+			break
+		}
+
+		operations = append(operations, operation)
+	}
+
+	return operations, nil
+}
+
+func readJournalEntry(rows *sql.Rows) (*entities.JournalEntry, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	entry := entities.JournalEntry{Columns: make([]interface{}, journalColumnCount)}
+
+	destinations := []interface{}{&entry.Id, &entry.OperationId, &entry.Table, &entry.Action}
+	for index := range entry.Columns {
+		destinations = append(destinations, &entry.Columns[index])
+	}
+
+	if err := rows.Scan(destinations...); err != nil {
+		return nil, err
+	}
+
+	// text must be restored as text, not as a blob
+	for index, column := range entry.Columns {
+		if bytes, ok := column.([]byte); ok {
+			entry.Columns[index] = string(bytes)
+		}
+	}
+
+	return &entry, nil
+}
+
+func readJournalEntries(rows *sql.Rows, entries entities.JournalEntries) (entities.JournalEntries, error) {
+	for {
+		entry, err := readJournalEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
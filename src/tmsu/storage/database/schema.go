@@ -22,6 +22,10 @@ import (
 	"tmsu/common/log"
 )
 
+// Creates the initial (version 1) schema.
+//
+// The statements here must not be altered: subsequent schema changes are applied by
+// the migrations in upgrade.go.
 func (db *Database) CreateSchema() error {
 	log.Info(2, "creating schema")
 
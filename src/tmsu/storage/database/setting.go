@@ -51,6 +51,27 @@ func (db *Database) Setting(name string) (*entities.Setting, error) {
 	return readSetting(rows)
 }
 
+// Updates the specified setting, adding it if it does not yet exist.
+func (db *Database) UpdateSetting(name, value string) (*entities.Setting, error) {
+	// the row is replaced explicitly, rather than with INSERT OR REPLACE, so that the
+	// change is journalled: REPLACE does not fire delete triggers
+	sql := `DELETE FROM setting
+            WHERE name = ?`
+
+	if _, err := db.Exec(sql, name); err != nil {
+		return nil, err
+	}
+
+	sql = `INSERT INTO setting (name, value)
+           VALUES (?, ?)`
+
+	if _, err := db.Exec(sql, name, value); err != nil {
+		return nil, err
+	}
+
+	return &entities.Setting{name, value}, nil
+}
+
 // unexported
 
 func readSetting(rows *sql.Rows) (*entities.Setting, error) {
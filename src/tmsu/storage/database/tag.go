@@ -139,6 +139,25 @@ func (db *Database) TagsByNames(names []string) (entities.Tags, error) {
 	return tags, nil
 }
 
+// Retrieves the set of tags that share their name with another tag.
+func (db *Database) DuplicateTags() (entities.Tags, error) {
+	sql := `SELECT id, name
+            FROM tag
+            WHERE name IN (SELECT name
+                           FROM tag
+                           GROUP BY name
+                           HAVING count(1) > 1)
+            ORDER BY name, id`
+
+	rows, err := db.ExecQuery(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTags(rows, make(entities.Tags, 0, 10))
+}
+
 // Adds a tag.
 func (db *Database) InsertTag(name string) (*entities.Tag, error) {
 	sql := `INSERT INTO tag (name)
@@ -0,0 +1,142 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package database
+
+import (
+	"database/sql"
+	"tmsu/entities"
+)
+
+// The complete set of tag properties.
+func (db *Database) TagProperties() (entities.TagProperties, error) {
+	sql := `SELECT tag_id, name, value
+            FROM tag_property
+            ORDER BY tag_id, name`
+
+	rows, err := db.ExecQuery(sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTagProperties(rows, make(entities.TagProperties, 0, 10))
+}
+
+// Retrieves the properties of the specified tag.
+func (db *Database) TagPropertiesByTagId(tagId entities.TagId) (entities.TagProperties, error) {
+	sql := `SELECT tag_id, name, value
+            FROM tag_property
+            WHERE tag_id = ?
+            ORDER BY name`
+
+	rows, err := db.ExecQuery(sql, tagId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return readTagProperties(rows, make(entities.TagProperties, 0, 10))
+}
+
+// Sets the value of a tag property, adding the property if necessary.
+func (db *Database) UpdateTagProperty(tagId entities.TagId, name, value string) (*entities.TagProperty, error) {
+	sql := `DELETE FROM tag_property
+            WHERE tag_id = ? AND name = ?`
+
+	if _, err := db.Exec(sql, tagId, name); err != nil {
+		return nil, err
+	}
+
+	sql = `INSERT INTO tag_property (tag_id, name, value)
+           VALUES (?, ?, ?)`
+
+	if _, err := db.Exec(sql, tagId, name, value); err != nil {
+		return nil, err
+	}
+
+	return &entities.TagProperty{tagId, name, value}, nil
+}
+
+// Deletes a tag property.
+func (db *Database) DeleteTagProperty(tagId entities.TagId, name string) error {
+	sql := `DELETE FROM tag_property
+            WHERE tag_id = ? AND name = ?`
+
+	result, err := db.Exec(sql, tagId, name)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return NoSuchTagPropertyError{tagId, name}
+	}
+
+	return nil
+}
+
+// Copies the properties of one tag to another.
+func (db *Database) CopyTagProperties(sourceTagId, destTagId entities.TagId) error {
+	sql := `INSERT INTO tag_property (tag_id, name, value)
+            SELECT ?2, name, value
+            FROM tag_property
+            WHERE tag_id = ?1`
+
+	if _, err := db.Exec(sql, sourceTagId, destTagId); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+func readTagProperty(rows *sql.Rows) (*entities.TagProperty, error) {
+	if !rows.Next() {
+		return nil, nil
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	var property entities.TagProperty
+	if err := rows.Scan(&property.TagId, &property.Name, &property.Value); err != nil {
+		return nil, err
+	}
+
+	return &property, nil
+}
+
+func readTagProperties(rows *sql.Rows, properties entities.TagProperties) (entities.TagProperties, error) {
+	for {
+		property, err := readTagProperty(rows)
+		if err != nil {
+			return nil, err
+		}
+		if property == nil {
+			break
+		}
+
+		properties = append(properties, property)
+	}
+
+	return properties, nil
+}
@@ -0,0 +1,587 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package database
+
+import (
+	"tmsu/common/log"
+	"tmsu/entities"
+)
+
+type migration struct {
+	version     uint
+	description string
+	apply       func(*Database) error
+}
+
+// The ordered set of schema migrations.
+//
+// Each migration takes the schema from the previous version to its own version. Migrations
+// must never be edited once released: changes to the schema require a new migration.
+var migrations = []migration{
+	{1, "initial schema", (*Database).CreateSchema},
+	{2, "foreign keys with cascading deletes", (*Database).migrateForeignKeys},
+	{3, "operation journal", (*Database).migrateJournal},
+	{4, "implications with values", (*Database).migrateImplicationValues},
+	{5, "tag aliases", (*Database).migrateAliases},
+	{6, "tag properties", (*Database).migrateTagProperties},
+	{7, "hierarchical tag names", (*Database).checkHierarchicalTagNames},
+}
+
+// The schema version of the newest migration.
+var LatestSchemaVersion = migrations[len(migrations)-1].version
+
+// Retrieves the schema version of the database.
+//
+// Databases that predate schema versioning report version zero.
+func (db *Database) SchemaVersion() (uint, error) {
+	if err := db.CreateSchemaVersionTable(); err != nil {
+		return 0, err
+	}
+
+	sql := `SELECT version
+            FROM schema_version`
+
+	rows, err := db.ExecQuery(sql)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var version uint
+	if rows.Next() {
+		if err := rows.Scan(&version); err != nil {
+			return 0, err
+		}
+	}
+
+	// an iteration error must not be mistaken for an unversioned database, which would
+	// re-run every migration
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// Brings the database schema up to date by applying any outstanding migrations.
+//
+// This must be called within a transaction so that a failed migration leaves the
+// database untouched.
+func (db *Database) Upgrade() error {
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if version > LatestSchemaVersion {
+		return SchemaVersionError{db.Path, version, LatestSchemaVersion}
+	}
+
+	if version == LatestSchemaVersion {
+		log.Infof(2, "database schema is up to date at version %v.", version)
+		return nil
+	}
+
+	if version > 0 {
+		log.Warnf("upgrading database schema from version %v to %v.", version, LatestSchemaVersion)
+	}
+
+	for _, migration := range migrations {
+		if migration.version <= version {
+			continue
+		}
+
+		log.Infof(2, "applying schema migration %v: %v.", migration.version, migration.description)
+
+		if err := migration.apply(db); err != nil {
+			return SchemaMigrationError{db.Path, migration.version, err}
+		}
+
+		if err := db.updateSchemaVersion(migration.version); err != nil {
+			return err
+		}
+	}
+
+	// changes made by the migrations themselves are not operations that can be undone
+	if err := db.DeletePendingJournalEntries(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (db *Database) CreateSchemaVersionTable() error {
+	sql := `CREATE TABLE IF NOT EXISTS schema_version (
+                version INTEGER NOT NULL
+            )`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// unexported
+
+func (db *Database) updateSchemaVersion(version uint) error {
+	sql := `DELETE FROM schema_version`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `INSERT INTO schema_version (version)
+           VALUES (?)`
+
+	if _, err := db.Exec(sql, version); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Rebuilds the file_tag and implication tables with enforced foreign keys.
+//
+// SQLite cannot add constraints to an existing table so each table is copied into a
+// replacement, dropping any rows that would violate the new constraints.
+//
+// As value_id zero denotes the absence of a value it cannot be a foreign key. Instead the
+// trg_file_tag_value_insert and trg_file_tag_value_update triggers reject taggings with an
+// unknown value and the trg_value_delete trigger removes the taggings of a deleted value.
+func (db *Database) migrateForeignKeys() error {
+	// trg_value_delete is created once file_tag has been replaced: drop any existing one,
+	// which would refer to the table being replaced, so that it can be created afresh
+	sql := `DROP TRIGGER IF EXISTS trg_value_delete`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE TABLE file_tag_new (
+                file_id INTEGER NOT NULL,
+                tag_id INTEGER NOT NULL,
+                value_id INTEGER NOT NULL,
+                PRIMARY KEY (file_id, tag_id, value_id),
+                FOREIGN KEY (file_id) REFERENCES file(id) ON DELETE CASCADE,
+                FOREIGN KEY (tag_id) REFERENCES tag(id) ON DELETE CASCADE
+            )`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `INSERT INTO file_tag_new (file_id, tag_id, value_id)
+           SELECT file_id, tag_id, value_id
+           FROM file_tag
+           WHERE file_id IN (SELECT id FROM file) AND
+                 tag_id IN (SELECT id FROM tag) AND
+                 (value_id = 0 OR value_id IN (SELECT id FROM value))`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	if err := db.replaceTable("file_tag"); err != nil {
+		return err
+	}
+
+	sql = `CREATE INDEX idx_file_tag_file_id
+           ON file_tag(file_id)`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE INDEX idx_file_tag_tag_id
+           ON file_tag(tag_id)`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE INDEX idx_file_tag_value_id
+           ON file_tag(value_id)`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	// value_id zero denotes the absence of a value so cannot be a foreign key: the
+	// equivalent constraint and cascade are instead provided by triggers
+	sql = `CREATE TRIGGER trg_file_tag_value_insert
+           BEFORE INSERT ON file_tag
+           WHEN NEW.value_id != 0 AND NOT EXISTS (SELECT 1 FROM value WHERE id = NEW.value_id)
+           BEGIN
+               SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed');
+           END`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE TRIGGER trg_file_tag_value_update
+           BEFORE UPDATE OF value_id ON file_tag
+           WHEN NEW.value_id != 0 AND NOT EXISTS (SELECT 1 FROM value WHERE id = NEW.value_id)
+           BEGIN
+               SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed');
+           END`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE TRIGGER trg_value_delete
+           AFTER DELETE ON value
+           BEGIN
+               DELETE FROM file_tag WHERE value_id = OLD.id;
+           END`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE TABLE implication_new (
+                tag_id INTEGER NOT NULL,
+                implied_tag_id INTEGER NOT NULL,
+                PRIMARY KEY (tag_id, implied_tag_id),
+                FOREIGN KEY (tag_id) REFERENCES tag(id) ON DELETE CASCADE,
+                FOREIGN KEY (implied_tag_id) REFERENCES tag(id) ON DELETE CASCADE
+            )`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `INSERT INTO implication_new (tag_id, implied_tag_id)
+           SELECT tag_id, implied_tag_id
+           FROM implication
+           WHERE tag_id IN (SELECT id FROM tag) AND
+                 implied_tag_id IN (SELECT id FROM tag)`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	if err := db.replaceTable("implication"); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Adds the operation and journal tables along with the triggers that record each change
+// to the journal.
+func (db *Database) migrateJournal() error {
+	// the value trigger is replaced with one that runs before the value is deleted so
+	// that the removal of the value's taggings is journalled first and thus undone last
+	sql := `DROP TRIGGER IF EXISTS trg_value_delete`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE TRIGGER trg_value_delete
+           BEFORE DELETE ON value
+           BEGIN
+               DELETE FROM file_tag WHERE value_id = OLD.id;
+           END`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE TABLE IF NOT EXISTS operation (
+               id INTEGER PRIMARY KEY,
+               time DATETIME NOT NULL,
+               command TEXT NOT NULL,
+               user TEXT NOT NULL,
+               undone_by INTEGER,
+               FOREIGN KEY (undone_by) REFERENCES operation(id) ON DELETE SET NULL
+           )`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	// entries are attributed to an operation when the transaction is committed
+	sql = `CREATE TABLE IF NOT EXISTS journal (
+               id INTEGER PRIMARY KEY,
+               operation_id INTEGER,
+               table_name TEXT NOT NULL,
+               action TEXT NOT NULL,
+               column1, column2, column3, column4, column5, column6, column7,
+               FOREIGN KEY (operation_id) REFERENCES operation(id) ON DELETE CASCADE
+           )`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE INDEX IF NOT EXISTS idx_journal_operation_id
+           ON journal(operation_id)`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	tables := []struct {
+		name    string
+		columns []string
+	}{
+		{"file", []string{"id", "directory", "name", "fingerprint", "mod_time", "size", "is_dir"}},
+		{"tag", []string{"id", "name"}},
+		{"value", []string{"id", "name"}},
+		{"file_tag", []string{"file_id", "tag_id", "value_id"}},
+		{"implication", []string{"tag_id", "implied_tag_id"}},
+		{"query", []string{"text"}},
+		{"setting", []string{"name", "value"}},
+	}
+
+	for _, table := range tables {
+		if err := db.dropJournalTriggers(table.name); err != nil {
+			return err
+		}
+
+		if err := db.createJournalTriggers(table.name, table.columns); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rebuilds the implication table with the values of the implying and implied tags.
+//
+// Existing implications apply whatever the value of the implying tag and imply the tag
+// without a value. Journalled implications are given the same values so that they can
+// still be undone.
+func (db *Database) migrateImplicationValues() error {
+	sql := `CREATE TABLE implication_new (
+                tag_id INTEGER NOT NULL,
+                value_id INTEGER NOT NULL,
+                implied_tag_id INTEGER NOT NULL,
+                implied_value_id INTEGER NOT NULL,
+                preserve_value INTEGER NOT NULL,
+                PRIMARY KEY (tag_id, value_id, implied_tag_id, implied_value_id, preserve_value),
+                FOREIGN KEY (tag_id) REFERENCES tag(id) ON DELETE CASCADE,
+                FOREIGN KEY (implied_tag_id) REFERENCES tag(id) ON DELETE CASCADE
+            )`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `INSERT INTO implication_new (tag_id, value_id, implied_tag_id, implied_value_id, preserve_value)
+           SELECT tag_id, 0, implied_tag_id, 0, 0
+           FROM implication`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	if err := db.replaceTable("implication"); err != nil {
+		return err
+	}
+
+	sql = `UPDATE journal
+           SET column3 = 0, column4 = 0, column5 = 0
+           WHERE table_name = 'implication'`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	// as for file_tag, value zero denotes the absence of a value so the constraints on
+	// the values are provided by triggers
+	sql = `CREATE TRIGGER trg_implication_value_insert
+           BEFORE INSERT ON implication
+           WHEN (NEW.value_id != 0 AND NOT EXISTS (SELECT 1 FROM value WHERE id = NEW.value_id)) OR
+                (NEW.implied_value_id != 0 AND NOT EXISTS (SELECT 1 FROM value WHERE id = NEW.implied_value_id))
+           BEGIN
+               SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed');
+           END`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE TRIGGER trg_implication_value_update
+           BEFORE UPDATE OF value_id, implied_value_id ON implication
+           WHEN (NEW.value_id != 0 AND NOT EXISTS (SELECT 1 FROM value WHERE id = NEW.value_id)) OR
+                (NEW.implied_value_id != 0 AND NOT EXISTS (SELECT 1 FROM value WHERE id = NEW.implied_value_id))
+           BEGIN
+               SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed');
+           END`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `DROP TRIGGER IF EXISTS trg_value_delete`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE TRIGGER trg_value_delete
+           BEFORE DELETE ON value
+           BEGIN
+               DELETE FROM file_tag WHERE value_id = OLD.id;
+               DELETE FROM implication WHERE value_id = OLD.id OR implied_value_id = OLD.id;
+           END`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	columns := []string{"tag_id", "implied_tag_id", "value_id", "implied_value_id", "preserve_value"}
+	if err := db.createJournalTriggers("implication", columns); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Adds the alias table, which holds the alternative names of tags.
+func (db *Database) migrateAliases() error {
+	sql := `CREATE TABLE IF NOT EXISTS alias (
+                name TEXT PRIMARY KEY,
+                tag_id INTEGER NOT NULL,
+                FOREIGN KEY (tag_id) REFERENCES tag(id) ON DELETE CASCADE
+            )`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `CREATE INDEX IF NOT EXISTS idx_alias_tag_id
+           ON alias(tag_id)`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	if err := db.dropJournalTriggers("alias"); err != nil {
+		return err
+	}
+
+	if err := db.createJournalTriggers("alias", []string{"name", "tag_id"}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Adds the tag_property table, which holds the descriptions, colours and other metadata of tags.
+func (db *Database) migrateTagProperties() error {
+	sql := `CREATE TABLE IF NOT EXISTS tag_property (
+                tag_id INTEGER NOT NULL,
+                name TEXT NOT NULL,
+                value TEXT NOT NULL,
+                PRIMARY KEY (tag_id, name),
+                FOREIGN KEY (tag_id) REFERENCES tag(id) ON DELETE CASCADE
+            )`
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	if err := db.dropJournalTriggers("tag_property"); err != nil {
+		return err
+	}
+
+	if err := db.createJournalTriggers("tag_property", []string{"tag_id", "name", "value"}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Lists the existing tags whose names contain a colon, which now separates the levels of a
+// hierarchical tag name, so that tags not intended to be hierarchical can be renamed.
+//
+// The schema is unchanged.
+func (db *Database) checkHierarchicalTagNames() error {
+	sql := `SELECT name
+            FROM tag
+            WHERE instr(name, ?) > 0
+            ORDER BY name`
+
+	rows, err := db.ExecQuery(sql, entities.TagNamespaceSeparator)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	names := make([]string, 0, 10)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	log.Warnf("tags containing a colon are now hierarchical, 'a:b' lying beneath 'a'. Rename any of the following that should not be with 'tmsu rename':")
+	for _, name := range names {
+		if hasEmptyTagNameLevel(name) {
+			// e.g. 'a::b' or 'a:', which are no longer valid tag names
+			log.Warnf("  %v (invalid: it has an empty level)", name)
+		} else {
+			log.Warnf("  %v", name)
+		}
+	}
+
+	return nil
+}
+
+// Replaces the named table with its '_new' counterpart.
+func (db *Database) replaceTable(name string) error {
+	sql := `DROP TABLE ` + name
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	sql = `ALTER TABLE ` + name + `_new RENAME TO ` + name
+
+	if _, err := db.Exec(sql); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func hasEmptyTagNameLevel(name string) bool {
+	for _, level := range entities.TagNameLevels(name) {
+		if level == "" {
+			return true
+		}
+	}
+
+	return false
+}
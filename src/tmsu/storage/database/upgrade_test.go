@@ -0,0 +1,383 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package database
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"tmsu/common/fingerprint"
+)
+
+func TestNewDatabaseHasLatestSchemaVersion(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	// test
+
+	db, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	// validate
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if version != LatestSchemaVersion {
+		test.Fatalf("Expected schema version %v but was %v.", LatestSchemaVersion, version)
+	}
+}
+
+func TestUnversionedDatabaseIsUpgraded(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	db, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := db.InsertTag("cheese"); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := db.Exec("DROP TABLE schema_version"); err != nil {
+		test.Fatal(err)
+	}
+
+	db.Close()
+
+	// test
+
+	db, err = OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	// validate
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if version != LatestSchemaVersion {
+		test.Fatalf("Expected schema version %v but was %v.", LatestSchemaVersion, version)
+	}
+
+	tag, err := db.TagByName("cheese")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if tag == nil {
+		test.Fatal("Tag was lost during upgrade.")
+	}
+}
+
+func TestNewerDatabaseIsRefused(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	db, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if err := db.updateSchemaVersion(LatestSchemaVersion + 1); err != nil {
+		test.Fatal(err)
+	}
+
+	db.Close()
+
+	// test
+
+	_, err = OpenAt(databasePath)
+
+	// validate
+
+	if err == nil {
+		test.Fatal("Database with a newer schema version was opened.")
+	}
+	if _, ok := err.(SchemaVersionError); !ok {
+		test.Fatalf("Expected schema version error but got: %v", err)
+	}
+}
+
+func TestUpgradeListsTagsThatBecomeHierarchical(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	db, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	for _, name := range []string{"photo", "music:jazz", "time:"} {
+		if _, err := db.Exec("INSERT INTO tag (name) VALUES (?)", name); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	if err := db.updateSchemaVersion(6); err != nil {
+		test.Fatal(err)
+	}
+
+	db.Close()
+
+	errPath := filepath.Join(os.TempDir(), "tmsu_upgrade_test.err")
+	errFile, err := os.Create(errPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer os.Remove(errPath)
+	defer errFile.Close()
+
+	stderr := os.Stderr
+	os.Stderr = errFile
+
+	// test
+
+	db, err = OpenAt(databasePath)
+	os.Stderr = stderr
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	// validate
+
+	bytes, err := ioutil.ReadFile(errPath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	warnings := string(bytes)
+
+	if !strings.Contains(warnings, "  music:jazz\n") || !strings.Contains(warnings, "  time: (invalid") {
+		test.Fatalf("Expected the tags containing a colon to be listed but warnings were: %v", warnings)
+	}
+	if strings.Contains(warnings, "photo") {
+		test.Fatalf("Expected only the tags containing a colon to be listed but warnings were: %v", warnings)
+	}
+
+	tag, err := db.TagByName("music:jazz")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if tag == nil {
+		test.Fatal("Tag was lost during upgrade.")
+	}
+}
+
+func TestVersionOneDatabaseIsMigratedToForeignKeys(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	// foreign keys are not enforced by the plain driver, allowing broken rows to be created
+	connection, err := sql.Open("sqlite3", databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	db := &Database{databasePath, connection, nil}
+
+	if err := db.CreateSchema(); err != nil {
+		test.Fatal(err)
+	}
+	if err := db.CreateSchemaVersionTable(); err != nil {
+		test.Fatal(err)
+	}
+	if err := db.updateSchemaVersion(1); err != nil {
+		test.Fatal(err)
+	}
+
+	file, err := db.InsertFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	appleTag, err := db.InsertTag("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	bananaTag, err := db.InsertTag("banana")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := db.AddFileTag(file.Id, appleTag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := db.AddFileTag(file.Id, 99, 0); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO implication (tag_id, implied_tag_id) VALUES (?1, ?2)", appleTag.Id, bananaTag.Id); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO implication (tag_id, implied_tag_id) VALUES (?1, 99)", appleTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	db.Close()
+
+	// test
+
+	db, err = OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	// validate
+
+	fileTags, err := db.FileTags()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(fileTags) != 1 || fileTags[0].TagId != appleTag.Id {
+		test.Fatalf("Expected only the tagging with tag #%v to survive but found %v.", appleTag.Id, len(fileTags))
+	}
+
+	implications, err := db.Implications()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(implications) != 1 || implications[0].ImpliedTag.Id != bananaTag.Id {
+		test.Fatalf("Expected only the implication of tag #%v to survive but found %v.", bananaTag.Id, len(implications))
+	}
+
+	implications, err = db.DanglingImplications()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(implications) != 0 {
+		test.Fatalf("Expected no broken implications to survive but found %v.", len(implications))
+	}
+
+	if _, err := db.AddFileTag(file.Id, 99, 0); err == nil {
+		test.Fatal("Tagging with a missing tag was permitted.")
+	}
+	if _, err := db.AddFileTag(file.Id, appleTag.Id, 99); err == nil {
+		test.Fatal("Tagging with a missing value was permitted.")
+	}
+}
+
+func TestDeletesCascade(test *testing.T) {
+	// set-up
+
+	databasePath := testDatabasePath()
+	defer os.Remove(databasePath)
+
+	db, err := OpenAt(databasePath)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer db.Close()
+
+	fileA, err := db.InsertFile("/tmp/a", fingerprint.Fingerprint("abc"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileB, err := db.InsertFile("/tmp/b", fingerprint.Fingerprint("def"), time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	appleTag, err := db.InsertTag("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	bananaTag, err := db.InsertTag("banana")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	value, err := db.InsertValue("ripe")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := db.AddFileTag(fileA.Id, appleTag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := db.AddFileTag(fileA.Id, bananaTag.Id, value.Id); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := db.AddFileTag(fileB.Id, bananaTag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+	if err := db.AddImplication(appleTag.Id, 0, bananaTag.Id, 0, false); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := db.DeleteTag(appleTag.Id); err != nil {
+		test.Fatal(err)
+	}
+	if err := db.DeleteValue(value.Id); err != nil {
+		test.Fatal(err)
+	}
+	if err := db.DeleteFile(fileB.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	fileTagCount, err := db.FileTagCount()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if fileTagCount != 0 {
+		test.Fatalf("Expected no taggings to remain but found %v.", fileTagCount)
+	}
+
+	implications, err := db.Implications()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(implications) != 0 {
+		test.Fatalf("Expected no implications to remain but found %v.", len(implications))
+	}
+}
+
+// unexported
+
+func testDatabasePath() string {
+	return filepath.Join(os.TempDir(), "tmsu_database_test.db")
+}
@@ -93,12 +93,17 @@ func (db *Database) ValuesByIds(ids entities.ValueIds) (entities.Values, error)
 	return tags, nil
 }
 
-// Retrieves the set of unused values.
+// Retrieves the set of values used by neither a tagging nor an implication.
 func (db *Database) UnusedValues() (entities.Values, error) {
 	sql := `SELECT id, name
             FROM value
             WHERE id NOT IN (SELECT distinct(value_id)
-                             FROM file_tag)`
+                             FROM file_tag)
+            AND id NOT IN (SELECT value_id
+                           FROM implication
+                           UNION
+                           SELECT implied_value_id
+                           FROM implication)`
 
 	rows, err := db.ExecQuery(sql)
 	if err != nil {
@@ -223,7 +228,7 @@ func (db *Database) DeleteValue(valueId entities.ValueId) error {
 	return nil
 }
 
-// Deletes all unused values.
+// Deletes those of the specified values used by neither a tagging nor an implication.
 func (db *Database) DeleteUnusedValues(valueIds entities.ValueIds) error {
 	if len(valueIds) == 0 {
 		return nil
@@ -237,7 +242,12 @@ func (db *Database) DeleteUnusedValues(valueIds entities.ValueIds) error {
                            FROM file_tag
                            WHERE id IN (?`
 	sql += strings.Repeat(",?", len(valueIds)-1)
-	sql += "))"
+	sql += `))
+            AND id NOT IN (SELECT value_id
+                           FROM implication
+                           UNION
+                           SELECT implied_value_id
+                           FROM implication)`
 
 	params := make([]interface{}, len(valueIds)*2)
 	for index, valueId := range valueIds {
@@ -247,7 +257,7 @@ func (db *Database) DeleteUnusedValues(valueIds entities.ValueIds) error {
 
 	_, err := db.Exec(sql, params...)
 	if err != nil {
-		return nil
+		return err
 	}
 
 	return nil
@@ -19,9 +19,11 @@ package storage
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"time"
 	"tmsu/common/fingerprint"
+	"tmsu/common/log"
 	"tmsu/entities"
 	"tmsu/query"
 )
@@ -33,12 +35,22 @@ func (storage *Storage) FileCount() (uint, error) {
 
 // The complete set of tracked files.
 func (storage *Storage) Files() (entities.Files, error) {
-	return storage.Db.Files()
+	files, err := storage.Db.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.paths.mapFiles(files), nil
 }
 
 // Retrieves a specific file.
 func (storage *Storage) File(id entities.FileId) (*entities.File, error) {
-	return storage.Db.File(id)
+	file, err := storage.Db.File(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.paths.mapFile(file), nil
 }
 
 // Retrieves the file with the specified path.
@@ -48,12 +60,32 @@ func (storage *Storage) FileByPath(path string) (*entities.File, error) {
 		return nil, AbsolutePathResolutionError{path, err}
 	}
 
-	return storage.Db.FileByPath(absPath)
+	file, err := storage.Db.FileByPath(storage.paths.toStored(absPath))
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.paths.mapFile(file), nil
 }
 
 // Retrieves all files that are under the specified directory.
 func (storage *Storage) FilesByDirectory(path string) (entities.Files, error) {
-	return storage.Db.FilesByDirectory(path)
+	storedPath, filter := storage.paths.toStoredScope(path)
+	if filter {
+		files, err := storage.Files()
+		if err != nil {
+			return nil, err
+		}
+
+		return filterFilesByDirectory(files, path), nil
+	}
+
+	files, err := storage.Db.FilesByDirectory(storedPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.paths.mapFiles(files), nil
 }
 
 // Retrieves all file that are under the specified directories.
@@ -61,7 +93,7 @@ func (storage *Storage) FilesByDirectories(paths []string) (entities.Files, erro
 	files := make(entities.Files, 0, 100)
 
 	for _, path := range paths {
-		pathFiles, err := storage.Db.FilesByDirectory(path)
+		pathFiles, err := storage.FilesByDirectory(path)
 		if err != nil {
 			return nil, fmt.Errorf("'%v': could not retrieve files for directory: %v", path, err)
 		}
@@ -79,83 +111,166 @@ func (storage *Storage) FileCountByFingerprint(fingerprint fingerprint.Fingerpri
 
 // Retrieves the set of files with the specified fingerprint.
 func (storage *Storage) FilesByFingerprint(fingerprint fingerprint.Fingerprint) (entities.Files, error) {
-	return storage.Db.FilesByFingerprint(fingerprint)
+	files, err := storage.Db.FilesByFingerprint(fingerprint)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.paths.mapFiles(files), nil
 }
 
 // Retrieves the set of untagged files.
 func (storage *Storage) UntaggedFiles() (entities.Files, error) {
-	return storage.Db.UntaggedFiles()
+	files, err := storage.Db.UntaggedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.paths.mapFiles(files), nil
 }
 
 // Retrieves the count of files with the specified tags and matching the specified path.
 func (storage *Storage) FileCountWithTags(tagNames []string, path string, explicitOnly bool) (uint, error) {
-	expression := query.HasAll(tagNames)
-
-	if !explicitOnly {
-		var err error
-		expression, err = storage.addImpliedTags(expression)
-		if err != nil {
-			return 0, err
-		}
+	expression, err := storage.prepareQuery(query.HasAll(tagNames), explicitOnly)
+	if err != nil {
+		return 0, err
 	}
 
-	return storage.Db.QueryFileCount(expression, path)
+	return storage.queryFileCount(expression, query.NewPathScope([]string{path}, nil))
 }
 
 // Retrieves the set of files with the specified tags and matching the specified path.
 func (storage *Storage) FilesWithTags(tagNames []string, path string, explicitOnly bool) (entities.Files, error) {
-	expression := query.HasAll(tagNames)
+	expression, err := storage.prepareQuery(query.HasAll(tagNames), explicitOnly)
+	if err != nil {
+		return nil, err
+	}
 
-	if !explicitOnly {
-		var err error
-		expression, err = storage.addImpliedTags(expression)
-		if err != nil {
-			return nil, err
-		}
+	return storage.queryFiles(expression, query.NewPathScope([]string{path}, nil))
+}
+
+// Retrieves the count of files that match the specified query within the specified scope.
+func (storage *Storage) QueryFileCount(expression query.Expression, scope query.PathScope, explicitOnly bool) (uint, error) {
+	expression, err := storage.prepareQuery(expression, explicitOnly)
+	if err != nil {
+		return 0, err
 	}
 
-	return storage.Db.QueryFiles(expression, path)
+	return storage.queryFileCount(expression, scope)
 }
 
-// Retrieves the count of files that match the specified query and matching the specified path.
-func (storage *Storage) QueryFileCount(expression query.Expression, path string, explicitOnly bool) (uint, error) {
-	if !explicitOnly {
-		var err error
-		expression, err = storage.addImpliedTags(expression)
+// Retrieves the set of files that match the specified query within the specified scope.
+func (storage *Storage) QueryFiles(expression query.Expression, scope query.PathScope, explicitOnly bool) (entities.Files, error) {
+	expression, err := storage.prepareQuery(expression, explicitOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.queryFiles(expression, scope)
+}
+
+// Retrieves the paths within the specified scope that are not in the database and that
+// match the query, which would otherwise only consider the files in the database. The
+// paths under the scope's included paths, or where there are none the current working
+// directory, are examined as for the 'untagged' subcommand.
+//
+// As these paths have no tags they match 'untagged' and comparisons against their own
+// attributes only. They are returned as files without an identifier.
+func (storage *Storage) QueryUntaggedFiles(expression query.Expression, scope query.PathScope, explicitOnly bool) (entities.Files, error) {
+	expression, err := storage.prepareQuery(expression, explicitOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	if !containsUntagged(expression) {
+		return entities.Files{}, nil
+	}
+
+	matches, err := untaggedFileMatcher(expression, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	roots := scope.Include
+	if len(roots) == 0 {
+		workingDirectory, err := os.Getwd()
 		if err != nil {
-			return 0, err
+			return nil, fmt.Errorf("could not determine working directory: %v", err)
 		}
+
+		roots = []string{workingDirectory}
 	}
 
-	return storage.Db.QueryFileCount(expression, path)
-}
+	files := make(entities.Files, 0, 10)
+	for _, root := range roots {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				log.Warnf("%v: could not examine: %v", path, err)
+				return nil
+			}
 
-// Retrieves the set of files that match the specified query.
-func (storage *Storage) QueryFiles(expression query.Expression, path string, explicitOnly bool) (entities.Files, error) {
-	if !explicitOnly {
-		var err error
-		expression, err = storage.addImpliedTags(expression)
+			if !scope.Contains(path) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			file, err := storage.FileByPath(path)
+			if err != nil {
+				return fmt.Errorf("%v: could not retrieve file: %v", path, err)
+			}
+			if file != nil {
+				return nil
+			}
+
+			file = &entities.File{0, filepath.Dir(path), filepath.Base(path), fingerprint.Fingerprint(""), info.ModTime(), info.Size(), info.IsDir()}
+			if matches(file) {
+				files = append(files, file)
+			}
+
+			return nil
+		})
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	return storage.Db.QueryFiles(expression, path)
+	return files, nil
 }
 
 // Retrieves the sets of duplicate files within the database.
 func (storage *Storage) DuplicateFiles() ([]entities.Files, error) {
-	return storage.Db.DuplicateFiles()
+	fileSets, err := storage.Db.DuplicateFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, files := range fileSets {
+		storage.paths.mapFiles(files)
+	}
+
+	return fileSets, nil
 }
 
 // Adds a file to the database.
 func (storage *Storage) AddFile(path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
-	return storage.Db.InsertFile(path, fingerprint, modTime, size, isDir)
+	file, err := storage.Db.InsertFile(storage.paths.toStored(path), fingerprint, modTime, size, isDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.paths.mapFile(file), nil
 }
 
 // Updates a file in the database.
 func (storage *Storage) UpdateFile(fileId entities.FileId, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
-	return storage.Db.UpdateFile(fileId, path, fingerprint, modTime, size, isDir)
+	file, err := storage.Db.UpdateFile(fileId, storage.paths.toStored(path), fingerprint, modTime, size, isDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.paths.mapFile(file), nil
 }
 
 // Deletes a file from the database.
@@ -185,73 +300,496 @@ func (storage *Storage) DeleteUntaggedFiles(fileIds entities.FileIds) error {
 
 // unexported
 
+func (storage *Storage) queryFileCount(expression query.Expression, scope query.PathScope) (uint, error) {
+	storedScope, filter := storage.paths.toStoredPathScope(scope)
+	if filter {
+		files, err := storage.queryFiles(expression, scope)
+		if err != nil {
+			return 0, err
+		}
+
+		return uint(len(files)), nil
+	}
+
+	return storage.Db.QueryFileCount(expression, storedScope)
+}
+
+func (storage *Storage) queryFiles(expression query.Expression, scope query.PathScope) (entities.Files, error) {
+	storedScope, filter := storage.paths.toStoredPathScope(scope)
+
+	files, err := storage.Db.QueryFiles(expression, storedScope)
+	if err != nil {
+		return nil, err
+	}
+
+	files = storage.paths.mapFiles(files)
+
+	if filter {
+		files = filterFilesByScope(files, scope)
+	}
+
+	return files, nil
+}
+
+// Determines whether the query expression refers to the files without tags.
+func containsUntagged(expression query.Expression) bool {
+	switch typedExpression := expression.(type) {
+	case query.UntaggedExpression:
+		return true
+	case query.NotExpression:
+		return containsUntagged(typedExpression.Operand)
+	case query.AndExpression:
+		return containsUntagged(typedExpression.LeftOperand) || containsUntagged(typedExpression.RightOperand)
+	case query.OrExpression:
+		return containsUntagged(typedExpression.LeftOperand) || containsUntagged(typedExpression.RightOperand)
+	default:
+		return false
+	}
+}
+
+// Builds a function that determines whether a file that is not in the database, and so
+// has no tags, matches the query expression.
+func untaggedFileMatcher(expression query.Expression, now time.Time) (func(*entities.File) bool, error) {
+	switch typedExpression := expression.(type) {
+	case query.UntaggedExpression, query.EmptyExpression:
+		return func(*entities.File) bool { return true }, nil
+	case query.AttributeExpression:
+		if typedExpression.Name == query.TagCountAttribute {
+			compare, err := query.CountComparison(typedExpression.Operator, typedExpression.Value.Name)
+			if err != nil {
+				return nil, err
+			}
+
+			return func(*entities.File) bool { return compare(0) }, nil
+		}
+
+		return query.FilePredicate(typedExpression, now)
+	case query.NotExpression:
+		operand, err := untaggedFileMatcher(typedExpression.Operand, now)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(file *entities.File) bool { return !operand(file) }, nil
+	case query.AndExpression:
+		left, err := untaggedFileMatcher(typedExpression.LeftOperand, now)
+		if err != nil {
+			return nil, err
+		}
+		right, err := untaggedFileMatcher(typedExpression.RightOperand, now)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(file *entities.File) bool { return left(file) && right(file) }, nil
+	case query.OrExpression:
+		left, err := untaggedFileMatcher(typedExpression.LeftOperand, now)
+		if err != nil {
+			return nil, err
+		}
+		right, err := untaggedFileMatcher(typedExpression.RightOperand, now)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(file *entities.File) bool { return left(file) || right(file) }, nil
+	case query.TagExpression, query.ComparisonExpression, query.InExpression, query.RangeExpression, query.ValuedExpression, query.UnvaluedExpression, query.OnlyExpression:
+		return func(*entities.File) bool { return false }, nil
+	default:
+		return nil, fmt.Errorf("unsupported expression type '%T'", typedExpression)
+	}
+}
+
+// Resolves the aliases in the query expression and, unless only explicit taggings are to
+// be matched, expands it to match the files tagged by way of implications.
+func (storage *Storage) prepareQuery(expression query.Expression, explicitOnly bool) (query.Expression, error) {
+	expression, err := storage.resolveAttributes(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	expression, err = storage.resolveTagAttributes(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	expression, err = storage.resolveAliases(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	expression, err = storage.addDescendantTags(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	if explicitOnly {
+		return expression, nil
+	}
+
+	return storage.addImpliedTags(expression)
+}
+
+// Rewrites the comparisons against file attributes in the query expression as comparisons
+// against tags where there is a tag of the same name, which takes precedence.
+func (storage *Storage) resolveAttributes(expression query.Expression) (query.Expression, error) {
+	names := query.AttributeNames(expression)
+	if len(names) == 0 {
+		return expression, nil
+	}
+
+	unknownNames, err := storage.UnknownTagNames(names)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	tagNames := make(map[string]bool, len(names))
+	for _, name := range names {
+		tagNames[name] = true
+	}
+	for _, name := range unknownNames {
+		delete(tagNames, name)
+	}
+	if len(tagNames) == 0 {
+		return expression, nil
+	}
+
+	return resolveAttributesRecursive(expression, tagNames), nil
+}
+
+func resolveAttributesRecursive(expression query.Expression, tagNames map[string]bool) query.Expression {
+	switch typedExpression := expression.(type) {
+	case query.OrExpression:
+		typedExpression.LeftOperand = resolveAttributesRecursive(typedExpression.LeftOperand, tagNames)
+		typedExpression.RightOperand = resolveAttributesRecursive(typedExpression.RightOperand, tagNames)
+		return typedExpression
+	case query.AndExpression:
+		typedExpression.LeftOperand = resolveAttributesRecursive(typedExpression.LeftOperand, tagNames)
+		typedExpression.RightOperand = resolveAttributesRecursive(typedExpression.RightOperand, tagNames)
+		return typedExpression
+	case query.NotExpression:
+		typedExpression.Operand = resolveAttributesRecursive(typedExpression.Operand, tagNames)
+		return typedExpression
+	case query.AttributeExpression:
+		if tagNames[typedExpression.Name] {
+			return query.ComparisonExpression{query.TagExpression{typedExpression.Name}, typedExpression.Operator, typedExpression.Value}
+		}
+		return typedExpression
+	case query.UntaggedExpression:
+		if tagNames[query.UntaggedAttribute] {
+			return query.TagExpression{query.UntaggedAttribute}
+		}
+		return typedExpression
+	case query.TagExpression, query.ComparisonExpression, query.InExpression, query.RangeExpression, query.ValuedExpression, query.UnvaluedExpression, query.OnlyExpression, query.ValueExpression, query.EmptyExpression:
+		return expression
+	default:
+		panic(fmt.Sprintf("unsupported expression type '%T'.", typedExpression))
+	}
+}
+
+// Rewrites the comparisons against the names of the files' tags in the query expression as
+// the set of tags whose names satisfy them.
+func (storage *Storage) resolveTagAttributes(expression query.Expression) (query.Expression, error) {
+	found := false
+	for _, name := range query.AttributeNames(expression) {
+		if name == query.TagAttribute {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return expression, nil
+	}
+
+	tags, err := storage.Db.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	return resolveTagAttributesRecursive(expression, tags)
+}
+
+func resolveTagAttributesRecursive(expression query.Expression, tags entities.Tags) (query.Expression, error) {
+	var err error
+
+	switch typedExpression := expression.(type) {
+	case query.OrExpression:
+		if typedExpression.LeftOperand, err = resolveTagAttributesRecursive(typedExpression.LeftOperand, tags); err != nil {
+			return nil, err
+		}
+		if typedExpression.RightOperand, err = resolveTagAttributesRecursive(typedExpression.RightOperand, tags); err != nil {
+			return nil, err
+		}
+		return typedExpression, nil
+	case query.AndExpression:
+		if typedExpression.LeftOperand, err = resolveTagAttributesRecursive(typedExpression.LeftOperand, tags); err != nil {
+			return nil, err
+		}
+		if typedExpression.RightOperand, err = resolveTagAttributesRecursive(typedExpression.RightOperand, tags); err != nil {
+			return nil, err
+		}
+		return typedExpression, nil
+	case query.NotExpression:
+		if typedExpression.Operand, err = resolveTagAttributesRecursive(typedExpression.Operand, tags); err != nil {
+			return nil, err
+		}
+		return typedExpression, nil
+	case query.AttributeExpression:
+		if typedExpression.Name != query.TagAttribute {
+			return typedExpression, nil
+		}
+
+		compare, err := query.TextComparison(typedExpression.Operator, typedExpression.Value.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		var expanded query.Expression
+		for _, tag := range tags {
+			if !compare(tag.Name) {
+				continue
+			}
+
+			if expanded == nil {
+				expanded = query.TagExpression{tag.Name}
+			} else {
+				expanded = query.OrExpression{expanded, query.TagExpression{tag.Name}}
+			}
+		}
+		if expanded == nil {
+			return query.NotExpression{query.EmptyExpression{}}, nil // matches nothing
+		}
+
+		return expanded, nil
+	case query.TagExpression, query.ComparisonExpression, query.InExpression, query.RangeExpression, query.ValuedExpression, query.UnvaluedExpression, query.UntaggedExpression, query.OnlyExpression, query.ValueExpression, query.EmptyExpression:
+		return expression, nil
+	default:
+		panic(fmt.Sprintf("unsupported expression type '%T'.", typedExpression))
+	}
+}
+
+// Expands each tag in the expression so that it also matches the tags beneath it in the hierarchy.
+func (storage *Storage) addDescendantTags(expression query.Expression) (query.Expression, error) {
+	if len(query.TagNames(expression)) == 0 {
+		return expression, nil
+	}
+
+	tags, err := storage.Db.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tags: %v", err)
+	}
+
+	return addDescendantTagsRecursive(expression, tags), nil
+}
+
+func addDescendantTagsRecursive(expression query.Expression, tags entities.Tags) query.Expression {
+	switch typedExpression := expression.(type) {
+	case query.OrExpression:
+		typedExpression.LeftOperand = addDescendantTagsRecursive(typedExpression.LeftOperand, tags)
+		typedExpression.RightOperand = addDescendantTagsRecursive(typedExpression.RightOperand, tags)
+		return typedExpression
+	case query.AndExpression:
+		typedExpression.LeftOperand = addDescendantTagsRecursive(typedExpression.LeftOperand, tags)
+		typedExpression.RightOperand = addDescendantTagsRecursive(typedExpression.RightOperand, tags)
+		return typedExpression
+	case query.NotExpression:
+		typedExpression.Operand = addDescendantTagsRecursive(typedExpression.Operand, tags)
+		return typedExpression
+	case query.TagExpression:
+		var expanded query.Expression = typedExpression
+		for _, descendant := range descendantTags(tags, typedExpression.Name) {
+			expanded = query.OrExpression{expanded, query.TagExpression{descendant.Name}}
+		}
+		return expanded
+	case query.ComparisonExpression, query.InExpression, query.RangeExpression, query.ValuedExpression, query.UnvaluedExpression:
+		tag, _ := query.TestedTag(typedExpression)
+
+		var expanded query.Expression = typedExpression
+		for _, descendant := range descendantTags(tags, tag.Name) {
+			expanded = query.OrExpression{expanded, query.WithTestedTag(typedExpression, query.TagExpression{descendant.Name})}
+		}
+		return expanded
+	case query.UntaggedExpression, query.OnlyExpression, query.ValueExpression, query.AttributeExpression, query.EmptyExpression:
+		return expression
+	default:
+		panic(fmt.Sprintf("unsupported expression type '%T'.", typedExpression))
+	}
+}
+
 func (storage *Storage) addImpliedTags(expression query.Expression) (query.Expression, error) {
 	implications, err := storage.Implications()
 	if err != nil {
-		fmt.Errorf("could not retrieve tag implications: %v", err)
+		return nil, fmt.Errorf("could not retrieve tag implications: %v", err)
 	}
 
-	impliersByTag := make(map[string][]string, len(implications))
+	impliersByTag := make(map[string]entities.Implications, len(implications))
 	for _, implication := range implications {
-		impliers, ok := impliersByTag[implication.ImpliedTag.Name]
-		if !ok {
-			impliers = make([]string, 0, 1)
-		}
+		tagName := implication.ImpliedTag.Name
+		impliersByTag[tagName] = append(impliersByTag[tagName], implication)
+	}
 
-		impliersByTag[implication.ImpliedTag.Name] = append(impliers, implication.ImplyingTag.Name)
+	valueTypes, err := storage.valueTypesByTagName()
+	if err != nil {
+		return nil, err
 	}
 
-	return addImpliedTagsRecursive(expression, impliersByTag), nil
+	return addImpliedTagsRecursive(expression, impliersByTag, valueTypes), nil
 }
 
-func addImpliedTagsRecursive(expression query.Expression, impliersByTag map[string][]string) query.Expression {
+func addImpliedTagsRecursive(expression query.Expression, impliersByTag map[string]entities.Implications, valueTypes map[string]entities.ValueType) query.Expression {
 	switch typedExpression := expression.(type) {
 	case query.OrExpression:
-		typedExpression.LeftOperand = addImpliedTagsRecursive(typedExpression.LeftOperand, impliersByTag)
-		typedExpression.RightOperand = addImpliedTagsRecursive(typedExpression.RightOperand, impliersByTag)
+		typedExpression.LeftOperand = addImpliedTagsRecursive(typedExpression.LeftOperand, impliersByTag, valueTypes)
+		typedExpression.RightOperand = addImpliedTagsRecursive(typedExpression.RightOperand, impliersByTag, valueTypes)
 		return typedExpression
 	case query.AndExpression:
-		typedExpression.LeftOperand = addImpliedTagsRecursive(typedExpression.LeftOperand, impliersByTag)
-		typedExpression.RightOperand = addImpliedTagsRecursive(typedExpression.RightOperand, impliersByTag)
+		typedExpression.LeftOperand = addImpliedTagsRecursive(typedExpression.LeftOperand, impliersByTag, valueTypes)
+		typedExpression.RightOperand = addImpliedTagsRecursive(typedExpression.RightOperand, impliersByTag, valueTypes)
 		return typedExpression
 	case query.NotExpression:
-		typedExpression.Operand = addImpliedTagsRecursive(typedExpression.Operand, impliersByTag)
+		typedExpression.Operand = addImpliedTagsRecursive(typedExpression.Operand, impliersByTag, valueTypes)
 		return typedExpression
 	case query.TagExpression:
 		return applyImplicationsForTag(typedExpression, impliersByTag)
-	case query.ValueExpression, query.EmptyExpression, query.ComparisonExpression:
+	case query.ComparisonExpression, query.InExpression, query.RangeExpression, query.ValuedExpression, query.UnvaluedExpression:
+		return applyImplicationsForValueTest(typedExpression, impliersByTag, valueTypes)
+	case query.UntaggedExpression, query.OnlyExpression, query.ValueExpression, query.AttributeExpression, query.EmptyExpression:
 		return expression
 	default:
 		panic(fmt.Sprintf("unsupported expression type '%T'.", typedExpression))
 	}
 }
 
-func applyImplicationsForTag(tagExpression query.TagExpression, impliersByTag map[string][]string) query.Expression {
-	implyingTags, ok := impliersByTag[tagExpression.Name]
-	if !ok {
-		return tagExpression
-	}
+func applyImplicationsForTag(tagExpression query.TagExpression, impliersByTag map[string]entities.Implications) query.Expression {
+	terms := implyingTerms(tagValueTerm{tagExpression.Name, ""}, impliersByTag)
 
 	var expression query.Expression = tagExpression
+	for _, term := range terms[1:] {
+		expression = query.OrExpression{expression, term.expression()}
+	}
 
-	for index := 0; index < len(implyingTags); index++ {
-		implyingTag := implyingTags[index]
+	return expression
+}
 
-		expression = query.OrExpression{expression, query.TagExpression{implyingTag}}
+// Expands the test of a tag's values, such as a comparison, to also match the files that
+// have the tag, with a satisfying value, by way of implications.
+func applyImplicationsForValueTest(test query.Expression, impliersByTag map[string]entities.Implications, valueTypes map[string]entities.ValueType) query.Expression {
+	tag, _ := query.TestedTag(test)
+
+	matches, err := query.ValuePredicate(test, valueTypes[tag.Name])
+	if err != nil {
+		// leave the unsupported operator or invalid value for the query compiler to report
+		return test
+	}
 
-		for _, furtherImplyingTag := range impliersByTag[implyingTag] {
-			if furtherImplyingTag != tagExpression.Name && !containsTagName(implyingTags, furtherImplyingTag) {
-				implyingTags = append(implyingTags, furtherImplyingTag)
+	tagNames := []string{tag.Name}
+	terms := make([]tagValueTerm, 0)
+
+	for index := 0; index < len(tagNames); index++ {
+		for _, implication := range impliersByTag[tagNames[index]] {
+			implier := tagValueTerm{implication.ImplyingTag.Name, implication.ImplyingValue.Name}
+
+			switch {
+			case implication.PreservesValue && implier.valueName == "":
+				if !containsName(tagNames, implier.tagName) {
+					tagNames = append(tagNames, implier.tagName)
+				}
+			case implication.PreservesValue:
+				if matches(implier.valueName) {
+					terms = appendTerms(terms, implyingTerms(implier, impliersByTag))
+				}
+			default:
+				if matches(implication.ImpliedValue.Name) {
+					terms = appendTerms(terms, implyingTerms(implier, impliersByTag))
+				}
 			}
 		}
 	}
 
+	var expression query.Expression = test
+	for _, tagName := range tagNames[1:] {
+		expression = query.OrExpression{expression, query.WithTestedTag(test, query.TagExpression{tagName})}
+	}
+	for _, term := range terms {
+		expression = query.OrExpression{expression, term.expression()}
+	}
+
 	return expression
 }
 
-func containsTagName(tagNames []string, tagName string) bool {
-	for _, tn := range tagNames {
-		if tn == tagName {
+// A tag and, optionally, a specific value of that tag.
+type tagValueTerm struct {
+	tagName   string
+	valueName string
+}
+
+func (term tagValueTerm) expression() query.Expression {
+	if term.valueName == "" {
+		return query.TagExpression{term.tagName}
+	}
+
+	return query.ComparisonExpression{query.TagExpression{term.tagName}, "==", query.ValueExpression{term.valueName}}
+}
+
+// Determines the terms that imply, directly or transitively, the specified term. The
+// specified term is the first of those returned.
+func implyingTerms(term tagValueTerm, impliersByTag map[string]entities.Implications) []tagValueTerm {
+	terms := []tagValueTerm{term}
+
+	for index := 0; index < len(terms); index++ {
+		for _, implication := range impliersByTag[terms[index].tagName] {
+			implier, ok := implyingTerm(implication, terms[index].valueName)
+			if ok && !containsTerm(terms, implier) {
+				terms = append(terms, implier)
+			}
+		}
+	}
+
+	return terms
+}
+
+// Determines the term by which the implication applies the implied tag with the specified
+// value, or with any value if none is specified.
+func implyingTerm(implication *entities.Implication, valueName string) (tagValueTerm, bool) {
+	implier := tagValueTerm{implication.ImplyingTag.Name, implication.ImplyingValue.Name}
+
+	switch {
+	case valueName == "":
+		return implier, true
+	case implication.PreservesValue:
+		if implier.valueName == "" {
+			implier.valueName = valueName
+		}
+
+		return implier, implier.valueName == valueName
+	default:
+		return implier, implication.ImpliedValue.Name == valueName
+	}
+}
+
+func appendTerms(terms []tagValueTerm, additionalTerms []tagValueTerm) []tagValueTerm {
+	for _, term := range additionalTerms {
+		if !containsTerm(terms, term) {
+			terms = append(terms, term)
+		}
+	}
+
+	return terms
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsTerm(terms []tagValueTerm, term tagValueTerm) bool {
+	for _, t := range terms {
+		if t == term {
 			return true
 		}
 	}
@@ -119,6 +119,11 @@ func (storage *Storage) FileTagsByFileId(fileId entities.FileId, explicitOnly bo
 	return fileTags, nil
 }
 
+// Retrieves the file tags that refer to a missing file, tag or value.
+func (storage *Storage) DanglingFileTags() (entities.FileTags, error) {
+	return storage.Db.DanglingFileTags()
+}
+
 // Adds a file tag.
 func (storage *Storage) AddFileTag(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (*entities.FileTag, error) {
 	return storage.Db.AddFileTag(fileId, tagId, valueId)
@@ -193,6 +198,11 @@ func (storage *Storage) DeleteFileTagsByTagId(tagId entities.TagId) error {
 	return nil
 }
 
+// Deletes the file tags that refer to a missing file, tag or value.
+func (storage *Storage) DeleteDanglingFileTags() error {
+	return storage.Db.DeleteDanglingFileTags()
+}
+
 // Copies file tags from one tag to another.
 func (storage *Storage) CopyFileTags(sourceTagId, destTagId entities.TagId) error {
 	return storage.Db.CopyFileTags(sourceTagId, destTagId)
@@ -201,32 +211,10 @@ func (storage *Storage) CopyFileTags(sourceTagId, destTagId entities.TagId) erro
 // unexported
 
 func (storage *Storage) addImpliedFileTags(fileTags entities.FileTags) (entities.FileTags, error) {
-	tagIds := make(entities.TagIds, 0, len(fileTags))
-	for _, fileTag := range fileTags {
-		tagIds = append(tagIds, fileTag.TagId)
-	}
-
-	implications, err := storage.ImplicationsForTags(tagIds...)
+	implications, err := storage.ImplicationsForTags(fileTags.TagIds()...)
 	if err != nil {
 		return nil, err
 	}
 
-	for index := 0; index < len(fileTags); index++ {
-		fileTag := fileTags[index]
-
-		for _, implication := range implications {
-			if implication.ImplyingTag.Id == fileTag.TagId {
-				//TODO consider values in implied tags
-				impliedFileTag := fileTags.Find(fileTag.FileId, implication.ImpliedTag.Id, 0)
-				if impliedFileTag != nil {
-					impliedFileTag.Implicit = true
-				} else {
-					impliedFileTag := entities.FileTag{fileTag.FileId, implication.ImpliedTag.Id, 0, false, true}
-					fileTags = append(fileTags, &impliedFileTag)
-				}
-			}
-		}
-	}
-
-	return fileTags, nil
+	return indexImplications(implications).apply(fileTags), nil
 }
@@ -41,7 +41,7 @@ func (storage *Storage) ImplicationsForTags(tagIds ...entities.TagId) (entities.
 
 		impliedTagIds = make(entities.TagIds, 0)
 		for _, implication := range implications {
-			if !containsImplication(resultantImplications, implication) {
+			if !resultantImplications.Contains(implication) {
 				resultantImplications = append(resultantImplications, implication)
 				impliedTagIds = append(impliedTagIds, implication.ImpliedTag.Id)
 			}
@@ -51,9 +51,18 @@ func (storage *Storage) ImplicationsForTags(tagIds ...entities.TagId) (entities.
 	return resultantImplications, nil
 }
 
+// Retrieves the implications that refer to a missing tag.
+func (storage *Storage) DanglingImplications() (entities.Implications, error) {
+	return storage.Db.DanglingImplications()
+}
+
 // Adds the specified implication.
-func (storage Storage) AddImplication(tagId, impliedTagId entities.TagId) error {
-	return storage.Db.AddImplication(tagId, impliedTagId)
+//
+// Where a value is specified for the implying tag the implication applies only to
+// taggings with that value. The implied tag is applied with the implied value or, if the
+// implication preserves values, with the implying tagging's value.
+func (storage Storage) AddImplication(tagId entities.TagId, valueId entities.ValueId, impliedTagId entities.TagId, impliedValueId entities.ValueId, preservesValue bool) error {
+	return storage.Db.AddImplication(tagId, valueId, impliedTagId, impliedValueId, preservesValue)
 }
 
 // Updates implications featuring the specified tag.
@@ -62,8 +71,12 @@ func (storage Storage) UpdateImplicationsForTagId(tagId, impliedTagId entities.T
 }
 
 // Removes the specified implication
-func (storage Storage) RemoveImplication(tagId, impliedTagId entities.TagId) error {
-	return storage.Db.DeleteImplication(tagId, impliedTagId)
+func (storage Storage) RemoveImplication(tagId entities.TagId, valueId entities.ValueId, impliedTagId entities.TagId, impliedValueId entities.ValueId, preservesValue bool) error {
+	if err := storage.Db.DeleteImplication(tagId, valueId, impliedTagId, impliedValueId, preservesValue); err != nil {
+		return err
+	}
+
+	return storage.DeleteUnusedValues(entities.ValueIds{valueId, impliedValueId})
 }
 
 // Removes implications featuring the specified tag.
@@ -71,14 +84,48 @@ func (storage Storage) RemoveImplicationsForTagId(tagId entities.TagId) error {
 	return storage.Db.DeleteImplicationsForTagId(tagId)
 }
 
+// Removes the implications that refer to a missing tag.
+func (storage Storage) RemoveDanglingImplications() error {
+	return storage.Db.DeleteDanglingImplications()
+}
+
 // unexported
 
-func containsImplication(implications entities.Implications, implication *entities.Implication) bool {
-	for index := 0; index < len(implications); index++ {
-		if implications[index].ImplyingTag.Id == implication.ImplyingTag.Id && implications[index].ImpliedTag.Id == implication.ImpliedTag.Id {
-			return true
+// Implications indexed by the implying tag.
+type implicationIndex map[entities.TagId]entities.Implications
+
+func indexImplications(implications entities.Implications) implicationIndex {
+	index := make(implicationIndex, len(implications))
+	for _, implication := range implications {
+		tagId := implication.ImplyingTag.Id
+		index[tagId] = append(index[tagId], implication)
+	}
+
+	return index
+}
+
+// Adds the file tags implied, directly or transitively, by the specified file tags.
+//
+// Implied file tags that are also explicit are marked as implicit.
+func (index implicationIndex) apply(fileTags entities.FileTags) entities.FileTags {
+	for position := 0; position < len(fileTags); position++ {
+		fileTag := fileTags[position]
+
+		for _, implication := range index[fileTag.TagId] {
+			if !implication.AppliesTo(fileTag.TagId, fileTag.ValueId) {
+				continue
+			}
+
+			valueId := implication.ImpliedValueId(fileTag.ValueId)
+
+			impliedFileTag := fileTags.Find(fileTag.FileId, implication.ImpliedTag.Id, valueId)
+			if impliedFileTag != nil {
+				impliedFileTag.Implicit = true
+			} else {
+				fileTags = append(fileTags, &entities.FileTag{fileTag.FileId, implication.ImpliedTag.Id, valueId, false, true})
+			}
 		}
 	}
 
-	return false
+	return fileTags
 }
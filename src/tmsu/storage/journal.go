@@ -0,0 +1,151 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package storage
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+	"tmsu/entities"
+)
+
+// The complete set of operations, oldest first.
+func (storage *Storage) Operations() (entities.Operations, error) {
+	return storage.Db.Operations()
+}
+
+// Retrieves the specified operation.
+func (storage *Storage) Operation(operationId entities.OperationId) (*entities.Operation, error) {
+	return storage.Db.Operation(operationId)
+}
+
+// Retrieves the most recent operations that can be undone, newest first.
+func (storage *Storage) UndoableOperations(count uint) (entities.Operations, error) {
+	return storage.Db.UndoableOperations(count)
+}
+
+// Retrieves the changes made by the specified operation.
+func (storage *Storage) JournalEntries(operationId entities.OperationId) (entities.JournalEntries, error) {
+	return storage.Db.JournalEntries(operationId)
+}
+
+// Reverses the changes made by the specified operation.
+//
+// The undo is itself an operation so can in turn be undone.
+func (storage *Storage) Undo(operationId entities.OperationId) error {
+	operation, err := storage.Db.Operation(operationId)
+	if err != nil {
+		return err
+	}
+	if operation == nil {
+		return fmt.Errorf("no such operation #%v", operationId)
+	}
+	if operation.UndoneBy != 0 {
+		return fmt.Errorf("operation #%v has already been undone by operation #%v", operationId, operation.UndoneBy)
+	}
+
+	undo, err := storage.currentOperation()
+	if err != nil {
+		return err
+	}
+
+	entries, err := storage.Db.JournalEntries(operationId)
+	if err != nil {
+		return err
+	}
+
+	if err := storage.Db.RevertJournalEntries(entries); err != nil {
+		return fmt.Errorf("could not undo operation #%v: %v", operationId, err)
+	}
+
+	// undoing an undo reinstates the operations it undid
+	if err := storage.Db.ReinstateOperationsUndoneBy(operationId); err != nil {
+		return err
+	}
+
+	if err := storage.Db.UpdateOperationUndoneBy(operationId, undo.Id); err != nil {
+		return err
+	}
+
+	// the settings may have changed
+	paths, err := loadPathMapper(storage.Db)
+	if err != nil {
+		return err
+	}
+	storage.paths = paths
+
+	return nil
+}
+
+// unexported
+
+// Retrieves the operation for the current transaction, creating it if necessary.
+func (storage *Storage) currentOperation() (*entities.Operation, error) {
+	if storage.operation == nil {
+		operation, err := storage.Db.InsertOperation(time.Now(), commandLine(), userName())
+		if err != nil {
+			return nil, err
+		}
+
+		storage.operation = operation
+	}
+
+	return storage.operation, nil
+}
+
+// Attributes the changes journalled during the current transaction to its operation.
+func (storage *Storage) recordOperation() error {
+	count, err := storage.Db.PendingJournalEntryCount()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+
+	operation, err := storage.currentOperation()
+	if err != nil {
+		return err
+	}
+
+	return storage.Db.AssignPendingJournalEntries(operation.Id)
+}
+
+func commandLine() string {
+	args := make([]string, len(os.Args))
+	for index, arg := range os.Args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\") {
+			arg = strconv.Quote(arg)
+		}
+
+		args[index] = arg
+	}
+
+	return strings.Join(args, " ")
+}
+
+func userName() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	return os.Getenv("USER")
+}
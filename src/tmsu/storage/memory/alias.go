@@ -0,0 +1,111 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package memory
+
+import (
+	"errors"
+	"sort"
+	"tmsu/entities"
+	"tmsu/storage/database"
+)
+
+var errUniqueAlias = errors.New("UNIQUE constraint failed: alias.name")
+
+// The set of tag aliases.
+func (db *Database) Aliases() (entities.Aliases, error) {
+	return db.aliasesWhere(func(string, entities.TagId) bool { return true }), nil
+}
+
+// Retrieves the aliases of the specified tag.
+func (db *Database) AliasesByTagId(tagId entities.TagId) (entities.Aliases, error) {
+	return db.aliasesWhere(func(name string, aliasTagId entities.TagId) bool { return aliasTagId == tagId }), nil
+}
+
+// Retrieves a specific alias.
+func (db *Database) AliasByName(name string) (*entities.Alias, error) {
+	aliases := db.aliasesWhere(func(aliasName string, tagId entities.TagId) bool { return aliasName == name })
+	if len(aliases) == 0 {
+		return nil, nil
+	}
+
+	return aliases[0], nil
+}
+
+// Retrieves the set of named aliases.
+func (db *Database) AliasesByNames(names []string) (entities.Aliases, error) {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	return db.aliasesWhere(func(name string, tagId entities.TagId) bool { return wanted[name] }), nil
+}
+
+// Adds an alias for the specified tag.
+func (db *Database) InsertAlias(name string, tagId entities.TagId) (*entities.Alias, error) {
+	if _, ok := db.data.aliases[name]; ok {
+		return nil, errUniqueAlias
+	}
+	if _, ok := db.data.tags[tagId]; !ok {
+		return nil, errForeignKey
+	}
+
+	db.putAlias(name, tagId)
+
+	return db.AliasByName(name)
+}
+
+// Deletes the specified alias.
+func (db *Database) DeleteAlias(name string) error {
+	if !db.removeAlias(name) {
+		return database.NoSuchAliasError{name}
+	}
+
+	return nil
+}
+
+// Moves the aliases of one tag to another.
+func (db *Database) UpdateAliasesForTagId(sourceTagId, destTagId entities.TagId) error {
+	if _, ok := db.data.tags[destTagId]; !ok {
+		return errForeignKey
+	}
+
+	for name, tagId := range db.data.aliases {
+		if tagId == sourceTagId {
+			db.removeAlias(name)
+			db.putAlias(name, destTagId)
+		}
+	}
+
+	return nil
+}
+
+// unexported
+
+// Retrieves the aliases satisfying the predicate in name order.
+func (db *Database) aliasesWhere(predicate func(string, entities.TagId) bool) entities.Aliases {
+	aliases := make(entities.Aliases, 0, 10)
+	for name, tagId := range db.data.aliases {
+		if predicate(name, tagId) {
+			aliases = append(aliases, &entities.Alias{name, db.data.tags[tagId]})
+		}
+	}
+	sort.Sort(aliases)
+
+	return aliases
+}
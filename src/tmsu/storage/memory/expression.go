@@ -0,0 +1,199 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package memory
+
+import (
+	"fmt"
+	"time"
+	"tmsu/entities"
+	"tmsu/query"
+)
+
+// unexported
+
+type fileMatcher func(entities.FileId) bool
+
+// Compiles a query expression into a function that determines whether a file matches.
+//
+// The semantics follow those of the SQLite backend: only explicit taggings are considered
+// and a comparison is numeric when the value in the query is a number, unless the tag
+// declares a value type.
+func (db *Database) compile(expression query.Expression) (fileMatcher, error) {
+	switch exp := expression.(type) {
+	case query.TagExpression:
+		fileIds := db.fileIdsWhere(exp.Name, func(entities.ValueId) bool { return true })
+
+		return func(fileId entities.FileId) bool { return fileIds[fileId] }, nil
+	case query.ComparisonExpression, query.InExpression, query.RangeExpression:
+		tag, _ := query.TestedTag(exp)
+
+		matches, err := query.ValuePredicate(exp, db.valueType(tag.Name))
+		if err != nil {
+			return nil, err
+		}
+
+		fileIds := db.fileIdsWhere(tag.Name, func(valueId entities.ValueId) bool {
+			value, ok := db.data.values[valueId]
+			return ok && matches(value.Name)
+		})
+
+		return func(fileId entities.FileId) bool { return fileIds[fileId] }, nil
+	case query.ValuedExpression:
+		fileIds := db.fileIdsWhere(exp.Tag.Name, func(valueId entities.ValueId) bool { return valueId != 0 })
+
+		return func(fileId entities.FileId) bool { return fileIds[fileId] }, nil
+	case query.UnvaluedExpression:
+		fileIds := db.fileIdsWhere(exp.Tag.Name, func(valueId entities.ValueId) bool { return valueId == 0 })
+
+		return func(fileId entities.FileId) bool { return fileIds[fileId] }, nil
+	case query.AttributeExpression:
+		return db.compileAttribute(exp)
+	case query.UntaggedExpression:
+		tagIdsByFile := db.tagIdsByFile()
+
+		return func(fileId entities.FileId) bool { return len(tagIdsByFile[fileId]) == 0 }, nil
+	case query.OnlyExpression:
+		tagIds := make(map[entities.TagId]bool, len(exp.Tags))
+		for _, tagExpression := range exp.Tags {
+			tag, _ := db.TagByName(tagExpression.Name)
+			if tag == nil {
+				return func(entities.FileId) bool { return false }, nil
+			}
+			tagIds[tag.Id] = true
+		}
+
+		tagIdsByFile := db.tagIdsByFile()
+
+		return func(fileId entities.FileId) bool {
+			fileTagIds := tagIdsByFile[fileId]
+			if len(fileTagIds) != len(tagIds) {
+				return false
+			}
+			for tagId := range fileTagIds {
+				if !tagIds[tagId] {
+					return false
+				}
+			}
+			return true
+		}, nil
+	case query.NotExpression:
+		operand, err := db.compile(exp.Operand)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(fileId entities.FileId) bool { return !operand(fileId) }, nil
+	case query.AndExpression:
+		left, right, err := db.compileOperands(exp.LeftOperand, exp.RightOperand)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(fileId entities.FileId) bool { return left(fileId) && right(fileId) }, nil
+	case query.OrExpression:
+		left, right, err := db.compileOperands(exp.LeftOperand, exp.RightOperand)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(fileId entities.FileId) bool { return left(fileId) || right(fileId) }, nil
+	case query.EmptyExpression:
+		return func(entities.FileId) bool { return true }, nil
+	default:
+		return nil, fmt.Errorf("unsupported expression type %T", expression)
+	}
+}
+
+func (db *Database) compileAttribute(attribute query.AttributeExpression) (fileMatcher, error) {
+	if attribute.Name == query.TagCountAttribute {
+		compare, err := query.CountComparison(attribute.Operator, attribute.Value.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		tagIdsByFile := db.tagIdsByFile()
+
+		return func(fileId entities.FileId) bool { return compare(len(tagIdsByFile[fileId])) }, nil
+	}
+
+	predicate, err := query.FilePredicate(attribute, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return func(fileId entities.FileId) bool {
+		file, ok := db.data.files[fileId]
+		return ok && predicate(&file)
+	}, nil
+}
+
+func (db *Database) compileOperands(leftOperand, rightOperand query.Expression) (fileMatcher, fileMatcher, error) {
+	left, err := db.compile(leftOperand)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	right, err := db.compile(rightOperand)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return left, right, nil
+}
+
+// Retrieves the declared type of the named tag's values, if any.
+func (db *Database) valueType(tagName string) entities.ValueType {
+	tag, _ := db.TagByName(tagName)
+	if tag == nil {
+		return ""
+	}
+
+	return entities.ValueType(db.data.properties[tagPropertyKey{tag.Id, entities.TagTypeProperty}])
+}
+
+// Identifies the distinct tags applied to each file.
+func (db *Database) tagIdsByFile() map[entities.FileId]map[entities.TagId]bool {
+	tagIdsByFile := make(map[entities.FileId]map[entities.TagId]bool)
+
+	for key := range db.data.fileTags {
+		if tagIdsByFile[key.fileId] == nil {
+			tagIdsByFile[key.fileId] = make(map[entities.TagId]bool)
+		}
+		tagIdsByFile[key.fileId][key.tagId] = true
+	}
+
+	return tagIdsByFile
+}
+
+// Identifies the files tagged with the named tag with a value satisfying the predicate.
+func (db *Database) fileIdsWhere(tagName string, predicate func(entities.ValueId) bool) map[entities.FileId]bool {
+	fileIds := make(map[entities.FileId]bool)
+
+	tag, _ := db.TagByName(tagName)
+	if tag == nil {
+		return fileIds
+	}
+
+	for key := range db.data.fileTags {
+		if key.tagId == tag.Id && predicate(key.valueId) {
+			fileIds[key.fileId] = true
+		}
+	}
+
+	return fileIds
+}
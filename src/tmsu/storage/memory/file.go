@@ -0,0 +1,263 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package memory
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/entities"
+	"tmsu/query"
+	"tmsu/storage/database"
+)
+
+// Retrieves the total number of tracked files.
+func (db *Database) FileCount() (uint, error) {
+	return uint(len(db.data.files)), nil
+}
+
+// The complete set of tracked files.
+func (db *Database) Files() (entities.Files, error) {
+	return db.filesWhere(func(*entities.File) bool { return true }), nil
+}
+
+// Retrieves a specific file.
+func (db *Database) File(id entities.FileId) (*entities.File, error) {
+	file, ok := db.data.files[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return &file, nil
+}
+
+// Retrieves the file with the specified path.
+func (db *Database) FileByPath(path string) (*entities.File, error) {
+	directory := filepath.Dir(path)
+	name := filepath.Base(path)
+
+	for _, file := range db.data.files {
+		if file.Directory == directory && file.Name == name {
+			return &file, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Retrieves all files that are under the specified directory.
+func (db *Database) FilesByDirectory(path string) (entities.Files, error) {
+	path = filepath.Clean(path)
+
+	return db.filesWhere(func(file *entities.File) bool {
+		return isWithin(file.Directory, path)
+	}), nil
+}
+
+// Retrieves the files that are directly within the specified directory.
+func (db *Database) FilesInDirectory(path string) (entities.Files, error) {
+	path = filepath.Clean(path)
+
+	return db.filesWhere(func(file *entities.File) bool {
+		return file.Directory == path
+	}), nil
+}
+
+// Retrieves the number of files with the specified fingerprint.
+func (db *Database) FileCountByFingerprint(fingerprint fingerprint.Fingerprint) (uint, error) {
+	files, err := db.FilesByFingerprint(fingerprint)
+	return uint(len(files)), err
+}
+
+// Retrieves the set of files with the specified fingerprint.
+func (db *Database) FilesByFingerprint(fingerprint fingerprint.Fingerprint) (entities.Files, error) {
+	return db.filesWhere(func(file *entities.File) bool {
+		return file.Fingerprint == fingerprint
+	}), nil
+}
+
+// Retrieves the set of untagged files.
+func (db *Database) UntaggedFiles() (entities.Files, error) {
+	tagged := db.taggedFileIds()
+
+	return db.filesWhere(func(file *entities.File) bool {
+		return !tagged[file.Id]
+	}), nil
+}
+
+// Retrieves the count of files matching the specified query within the specified scope.
+func (db *Database) QueryFileCount(expression query.Expression, scope query.PathScope) (uint, error) {
+	files, err := db.QueryFiles(expression, scope)
+	return uint(len(files)), err
+}
+
+// Retrieves the set of files matching the specified query within the specified scope.
+func (db *Database) QueryFiles(expression query.Expression, scope query.PathScope) (entities.Files, error) {
+	matcher, err := db.compile(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.filesWhere(func(file *entities.File) bool {
+		return scope.Contains(file.Path()) && matcher(file.Id)
+	}), nil
+}
+
+// Retrieves the sets of duplicate files within the database.
+func (db *Database) DuplicateFiles() ([]entities.Files, error) {
+	filesByFingerprint := make(map[fingerprint.Fingerprint]entities.Files)
+	fingerprints := make([]string, 0, 10)
+
+	for _, file := range db.filesWhere(func(file *entities.File) bool { return file.Fingerprint != "" }) {
+		files, ok := filesByFingerprint[file.Fingerprint]
+		if !ok {
+			fingerprints = append(fingerprints, string(file.Fingerprint))
+		}
+
+		filesByFingerprint[file.Fingerprint] = append(files, file)
+	}
+
+	sort.Strings(fingerprints)
+
+	fileSets := make([]entities.Files, 0, 10)
+	for _, fp := range fingerprints {
+		if files := filesByFingerprint[fingerprint.Fingerprint(fp)]; len(files) > 1 {
+			fileSets = append(fileSets, files)
+		}
+	}
+
+	return fileSets, nil
+}
+
+// Adds a file to the database.
+func (db *Database) InsertFile(path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
+	directory := filepath.Dir(path)
+	name := filepath.Base(path)
+
+	if existing, _ := db.FileByPath(path); existing != nil {
+		return nil, fmt.Errorf("file '%v' already exists", path)
+	}
+
+	file := entities.File{db.data.lastFileId + 1, directory, name, fingerprint, modTime, size, isDir}
+	db.putFile(file)
+
+	return &file, nil
+}
+
+// Adds files to the database in bulk, setting the identifier of each.
+func (db *Database) InsertFiles(files entities.Files) error {
+	for _, file := range files {
+		inserted, err := db.InsertFile(file.Path(), file.Fingerprint, file.ModTime, file.Size, file.IsDir)
+		if err != nil {
+			return err
+		}
+
+		file.Id = inserted.Id
+	}
+
+	return nil
+}
+
+// Updates a file in the database.
+func (db *Database) UpdateFile(fileId entities.FileId, path string, fingerprint fingerprint.Fingerprint, modTime time.Time, size int64, isDir bool) (*entities.File, error) {
+	directory := filepath.Dir(path)
+	name := filepath.Base(path)
+
+	if _, ok := db.data.files[fileId]; !ok {
+		return nil, database.NoSuchFileError{fileId}
+	}
+
+	if existing, _ := db.FileByPath(path); existing != nil && existing.Id != fileId {
+		return nil, fmt.Errorf("file '%v' already exists", path)
+	}
+
+	file := entities.File{fileId, directory, name, fingerprint, modTime, size, isDir}
+	db.replaceFile(file)
+
+	return &file, nil
+}
+
+// Removes a file from the database.
+func (db *Database) DeleteFile(fileId entities.FileId) error {
+	if !db.removeFile(fileId) {
+		return database.NoSuchFileError{fileId}
+	}
+
+	return nil
+}
+
+// Deletes the specified files if they are untagged
+func (db *Database) DeleteUntaggedFiles(fileIds entities.FileIds) error {
+	tagged := db.taggedFileIds()
+
+	for _, fileId := range fileIds {
+		if !tagged[fileId] {
+			db.removeFile(fileId)
+		}
+	}
+
+	return nil
+}
+
+// unexported
+
+// Retrieves the files satisfying the predicate in path order.
+func (db *Database) filesWhere(predicate func(*entities.File) bool) entities.Files {
+	files := make(entities.Files, 0, 10)
+	for _, file := range db.data.files {
+		file := file
+		if predicate(&file) {
+			files = append(files, &file)
+		}
+	}
+
+	sort.Sort(filesByPath(files))
+
+	return files
+}
+
+func (db *Database) taggedFileIds() map[entities.FileId]bool {
+	tagged := make(map[entities.FileId]bool)
+	for key := range db.data.fileTags {
+		tagged[key.fileId] = true
+	}
+
+	return tagged
+}
+
+// Determines whether the directory is, or is beneath, the specified path.
+func isWithin(directory, path string) bool {
+	return directory == path || strings.HasPrefix(directory, strings.TrimSuffix(path, string(filepath.Separator))+string(filepath.Separator))
+}
+
+type filesByPath entities.Files
+
+func (files filesByPath) Len() int {
+	return len(files)
+}
+
+func (files filesByPath) Less(i, j int) bool {
+	return files[i].Directory+"/"+files[i].Name < files[j].Directory+"/"+files[j].Name
+}
+
+func (files filesByPath) Swap(i, j int) {
+	files[i], files[j] = files[j], files[i]
+}
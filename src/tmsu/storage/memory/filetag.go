@@ -0,0 +1,208 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package memory
+
+import (
+	"errors"
+	"sort"
+	"tmsu/entities"
+	"tmsu/storage/database"
+)
+
+var errForeignKey = errors.New("FOREIGN KEY constraint failed")
+
+// Determines whether the specified file has the specified tag applied.
+func (db *Database) FileTagExists(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (bool, error) {
+	return db.data.fileTags[fileTagKey{fileId, tagId, valueId}], nil
+}
+
+// Retrieves the total count of file tags in the database.
+func (db *Database) FileTagCount() (uint, error) {
+	return uint(len(db.data.fileTags)), nil
+}
+
+// Retrieves the complete set of file tags.
+func (db *Database) FileTags() (entities.FileTags, error) {
+	return db.fileTagsWhere(func(fileTagKey) bool { return true }), nil
+}
+
+// Retrieves the count of file tags for the specified file.
+func (db *Database) FileTagCountByFileId(fileId entities.FileId) (uint, error) {
+	return uint(len(db.fileTagsWhere(func(key fileTagKey) bool { return key.fileId == fileId }))), nil
+}
+
+// Retrieves the count of file tags for the specified tag.
+func (db *Database) FileTagCountByTagId(tagId entities.TagId) (uint, error) {
+	return uint(len(db.fileTagsWhere(func(key fileTagKey) bool { return key.tagId == tagId }))), nil
+}
+
+// Retrieves the file tags with the specified tag.
+func (db *Database) FileTagsByTagId(tagId entities.TagId) (entities.FileTags, error) {
+	return db.fileTagsWhere(func(key fileTagKey) bool { return key.tagId == tagId }), nil
+}
+
+// Retrieves the count of file tags for the specified value.
+func (db *Database) FileTagCountByValueId(valueId entities.ValueId) (uint, error) {
+	return uint(len(db.fileTagsWhere(func(key fileTagKey) bool { return key.valueId == valueId }))), nil
+}
+
+// Retrieves the file tags with the specified value.
+func (db *Database) FileTagsByValueId(valueId entities.ValueId) (entities.FileTags, error) {
+	return db.fileTagsWhere(func(key fileTagKey) bool { return key.valueId == valueId }), nil
+}
+
+// Retrieves the file tags for the specified file.
+func (db *Database) FileTagsByFileId(fileId entities.FileId) (entities.FileTags, error) {
+	return db.fileTagsWhere(func(key fileTagKey) bool { return key.fileId == fileId }), nil
+}
+
+// Retrieves the file tags that refer to a file, tag or value that does not exist.
+//
+// Referential integrity is enforced so there are never any.
+func (db *Database) DanglingFileTags() (entities.FileTags, error) {
+	return make(entities.FileTags, 0), nil
+}
+
+// Adds a file tag.
+func (db *Database) AddFileTag(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) (*entities.FileTag, error) {
+	key := fileTagKey{fileId, tagId, valueId}
+	if !db.isReferenced(key) {
+		return nil, errForeignKey
+	}
+
+	db.putFileTag(key)
+
+	return &entities.FileTag{fileId, tagId, valueId, true, false}, nil
+}
+
+// Adds file tags in bulk. File tags that already exist are ignored.
+func (db *Database) AddFileTags(fileTags entities.FileTags) error {
+	for _, fileTag := range fileTags {
+		if _, err := db.AddFileTag(fileTag.FileId, fileTag.TagId, fileTag.ValueId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Removes a file tag.
+func (db *Database) DeleteFileTag(fileId entities.FileId, tagId entities.TagId, valueId entities.ValueId) error {
+	if !db.removeFileTag(fileTagKey{fileId, tagId, valueId}) {
+		return database.NoSuchFileTagError{fileId, tagId, valueId}
+	}
+
+	return nil
+}
+
+// Removes all of the file tags for the specified file.
+func (db *Database) DeleteFileTagsByFileId(fileId entities.FileId) error {
+	for key := range db.data.fileTags {
+		if key.fileId == fileId {
+			db.removeFileTag(key)
+		}
+	}
+
+	return nil
+}
+
+// Removes all of the file tags for the specified tag.
+func (db *Database) DeleteFileTagsByTagId(tagId entities.TagId) error {
+	for key := range db.data.fileTags {
+		if key.tagId == tagId {
+			db.removeFileTag(key)
+		}
+	}
+
+	return nil
+}
+
+// Removes the file tags that refer to a file, tag or value that does not exist.
+func (db *Database) DeleteDanglingFileTags() error {
+	return nil
+}
+
+// Copies file tags from one tag to another.
+func (db *Database) CopyFileTags(sourceTagId entities.TagId, destTagId entities.TagId) error {
+	if _, ok := db.data.tags[destTagId]; !ok {
+		return errForeignKey
+	}
+
+	for _, fileTag := range db.fileTagsWhere(func(key fileTagKey) bool { return key.tagId == sourceTagId }) {
+		db.putFileTag(fileTagKey{fileTag.FileId, destTagId, fileTag.ValueId})
+	}
+
+	return nil
+}
+
+// unexported
+
+// Retrieves the file tags satisfying the predicate ordered by file, tag and value.
+func (db *Database) fileTagsWhere(predicate func(fileTagKey) bool) entities.FileTags {
+	keys := make([]fileTagKey, 0, 10)
+	for key := range db.data.fileTags {
+		if predicate(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Sort(fileTagKeys(keys))
+
+	fileTags := make(entities.FileTags, len(keys))
+	for index, key := range keys {
+		fileTags[index] = &entities.FileTag{key.fileId, key.tagId, key.valueId, true, false}
+	}
+
+	return fileTags
+}
+
+// Determines whether the file, tag and value a file tag refers to all exist.
+func (db *Database) isReferenced(key fileTagKey) bool {
+	if _, ok := db.data.files[key.fileId]; !ok {
+		return false
+	}
+	if _, ok := db.data.tags[key.tagId]; !ok {
+		return false
+	}
+	if _, ok := db.data.values[key.valueId]; !ok && key.valueId != 0 {
+		return false
+	}
+
+	return true
+}
+
+type fileTagKeys []fileTagKey
+
+func (keys fileTagKeys) Len() int {
+	return len(keys)
+}
+
+func (keys fileTagKeys) Less(i, j int) bool {
+	switch {
+	case keys[i].fileId != keys[j].fileId:
+		return keys[i].fileId < keys[j].fileId
+	case keys[i].tagId != keys[j].tagId:
+		return keys[i].tagId < keys[j].tagId
+	default:
+		return keys[i].valueId < keys[j].valueId
+	}
+}
+
+func (keys fileTagKeys) Swap(i, j int) {
+	keys[i], keys[j] = keys[j], keys[i]
+}
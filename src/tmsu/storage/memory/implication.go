@@ -0,0 +1,163 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package memory
+
+import (
+	"sort"
+	"tmsu/entities"
+	"tmsu/storage/database"
+)
+
+// Retrieves the complete set of tag implications.
+func (db *Database) Implications() (entities.Implications, error) {
+	return db.implicationsWhere(func(implicationKey) bool { return true }), nil
+}
+
+// Retrieves the set of implications for the specified tags.
+func (db *Database) ImplicationsForTags(tagIds entities.TagIds) (entities.Implications, error) {
+	wanted := make(map[entities.TagId]bool, len(tagIds))
+	for _, tagId := range tagIds {
+		wanted[tagId] = true
+	}
+
+	return db.implicationsWhere(func(key implicationKey) bool { return wanted[key.tagId] }), nil
+}
+
+// Retrieves the implications that refer to a tag that does not exist.
+//
+// Referential integrity is enforced so there are never any.
+func (db *Database) DanglingImplications() (entities.Implications, error) {
+	return make(entities.Implications, 0), nil
+}
+
+// Updates implications featuring the specified tag.
+func (db *Database) UpdateImplicationsForTagId(implyingTagId, impliedTagId entities.TagId) error {
+	for key := range db.data.implications {
+		switch {
+		case key.tagId == implyingTagId && key.impliedTagId == impliedTagId,
+			key.tagId == impliedTagId && key.impliedTagId == implyingTagId:
+			// prevent a tag implying itself
+			db.removeImplication(key)
+		case key.tagId == implyingTagId:
+			db.removeImplication(key)
+			db.putImplication(implicationKey{impliedTagId, key.valueId, key.impliedTagId, key.impliedValueId, key.preservesValue})
+		case key.impliedTagId == implyingTagId:
+			db.removeImplication(key)
+			db.putImplication(implicationKey{key.tagId, key.valueId, impliedTagId, key.impliedValueId, key.preservesValue})
+		}
+	}
+
+	return nil
+}
+
+// Adds the specified implication.
+func (db *Database) AddImplication(tagId entities.TagId, valueId entities.ValueId, impliedTagId entities.TagId, impliedValueId entities.ValueId, preservesValue bool) error {
+	key := implicationKey{tagId, valueId, impliedTagId, impliedValueId, preservesValue}
+	if !db.isImplicationReferenced(key) {
+		return errForeignKey
+	}
+
+	db.putImplication(key)
+
+	return nil
+}
+
+// Deletes the specified implication.
+func (db *Database) DeleteImplication(tagId entities.TagId, valueId entities.ValueId, impliedTagId entities.TagId, impliedValueId entities.ValueId, preservesValue bool) error {
+	if !db.removeImplication(implicationKey{tagId, valueId, impliedTagId, impliedValueId, preservesValue}) {
+		return database.NoSuchImplicationError{tagId, valueId, impliedTagId, impliedValueId}
+	}
+
+	return nil
+}
+
+// Deletes implications featuring the specified tag.
+func (db *Database) DeleteImplicationsForTagId(tagId entities.TagId) error {
+	for key := range db.data.implications {
+		if key.tagId == tagId || key.impliedTagId == tagId {
+			db.removeImplication(key)
+		}
+	}
+
+	return nil
+}
+
+// Deletes implications that refer to a tag that does not exist.
+func (db *Database) DeleteDanglingImplications() error {
+	return nil
+}
+
+// unexported
+
+func (db *Database) isImplicationReferenced(key implicationKey) bool {
+	if _, ok := db.data.tags[key.tagId]; !ok {
+		return false
+	}
+	if _, ok := db.data.tags[key.impliedTagId]; !ok {
+		return false
+	}
+	if _, ok := db.data.values[key.valueId]; !ok && key.valueId != 0 {
+		return false
+	}
+	if _, ok := db.data.values[key.impliedValueId]; !ok && key.impliedValueId != 0 {
+		return false
+	}
+
+	return true
+}
+
+// Retrieves the implications satisfying the predicate ordered by tag names.
+func (db *Database) implicationsWhere(predicate func(implicationKey) bool) entities.Implications {
+	implications := make(entities.Implications, 0, 10)
+	for key := range db.data.implications {
+		if predicate(key) {
+			implications = append(implications, &entities.Implication{db.data.tags[key.tagId],
+				db.data.values[key.valueId],
+				db.data.tags[key.impliedTagId],
+				db.data.values[key.impliedValueId],
+				key.preservesValue})
+		}
+	}
+
+	sort.Sort(implicationsByName(implications))
+
+	return implications
+}
+
+type implicationsByName entities.Implications
+
+func (implications implicationsByName) Len() int {
+	return len(implications)
+}
+
+func (implications implicationsByName) Less(i, j int) bool {
+	switch {
+	case implications[i].ImplyingTag.Name != implications[j].ImplyingTag.Name:
+		return implications[i].ImplyingTag.Name < implications[j].ImplyingTag.Name
+	case implications[i].ImplyingValue.Name != implications[j].ImplyingValue.Name:
+		return implications[i].ImplyingValue.Name < implications[j].ImplyingValue.Name
+	case implications[i].ImpliedTag.Name != implications[j].ImpliedTag.Name:
+		return implications[i].ImpliedTag.Name < implications[j].ImpliedTag.Name
+	default:
+		return implications[i].ImpliedValue.Name < implications[j].ImpliedValue.Name
+	}
+}
+
+func (implications implicationsByName) Swap(i, j int) {
+	implications[i], implications[j] = implications[j], implications[i]
+}
@@ -0,0 +1,529 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"tmsu/entities"
+)
+
+// The complete set of operations, oldest first.
+func (db *Database) Operations() (entities.Operations, error) {
+	operations := make(entities.Operations, 0, len(db.data.operations))
+	for id := range db.data.operations {
+		operations = append(operations, db.operation(id))
+	}
+
+	sort.Sort(operationsById(operations))
+
+	return operations, nil
+}
+
+// Retrieves the specified operation.
+func (db *Database) Operation(operationId entities.OperationId) (*entities.Operation, error) {
+	if _, ok := db.data.operations[operationId]; !ok {
+		return nil, nil
+	}
+
+	return db.operation(operationId), nil
+}
+
+// Retrieves the most recent operations that can be undone, newest first.
+//
+// Operations that have already been undone and operations that undid others are excluded.
+func (db *Database) UndoableOperations(count uint) (entities.Operations, error) {
+	undoers := make(map[entities.OperationId]bool)
+	for _, operation := range db.data.operations {
+		if operation.UndoneBy != 0 {
+			undoers[operation.UndoneBy] = true
+		}
+	}
+
+	operations, err := db.Operations()
+	if err != nil {
+		return nil, err
+	}
+
+	undoable := make(entities.Operations, 0, count)
+	for index := len(operations) - 1; index >= 0 && uint(len(undoable)) < count; index-- {
+		operation := operations[index]
+		if operation.UndoneBy == 0 && !undoers[operation.Id] {
+			undoable = append(undoable, operation)
+		}
+	}
+
+	return undoable, nil
+}
+
+// Adds an operation.
+func (db *Database) InsertOperation(time time.Time, command, user string) (*entities.Operation, error) {
+	db.data.lastOperationId++
+	operation := entities.Operation{db.data.lastOperationId, time, command, user, 0, 0}
+	db.data.operations[operation.Id] = operation
+
+	return &operation, nil
+}
+
+// Records that an operation was undone by another.
+func (db *Database) UpdateOperationUndoneBy(operationId, undoneBy entities.OperationId) error {
+	operation, ok := db.data.operations[operationId]
+	if !ok {
+		return nil
+	}
+
+	operation.UndoneBy = undoneBy
+	db.data.operations[operationId] = operation
+
+	return nil
+}
+
+// Marks the operations undone by the specified operation as no longer undone.
+func (db *Database) ReinstateOperationsUndoneBy(operationId entities.OperationId) error {
+	for id, operation := range db.data.operations {
+		if operation.UndoneBy == operationId {
+			operation.UndoneBy = 0
+			db.data.operations[id] = operation
+		}
+	}
+
+	return nil
+}
+
+// Retrieves the changes made by the specified operation in the order they were made.
+func (db *Database) JournalEntries(operationId entities.OperationId) (entities.JournalEntries, error) {
+	entries := make(entities.JournalEntries, 0, 10)
+	for index := range db.data.journal {
+		if db.data.journal[index].OperationId == operationId {
+			entry := db.data.journal[index]
+			entries = append(entries, &entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// Retrieves the number of journal entries not yet attributed to an operation.
+func (db *Database) PendingJournalEntryCount() (uint, error) {
+	var count uint
+	for _, entry := range db.data.journal {
+		if entry.OperationId == 0 {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Attributes the journal entries not yet attributed to an operation to the specified
+// operation.
+func (db *Database) AssignPendingJournalEntries(operationId entities.OperationId) error {
+	for index := range db.data.journal {
+		if db.data.journal[index].OperationId == 0 {
+			db.data.journal[index].OperationId = operationId
+		}
+	}
+
+	return nil
+}
+
+// Reverses the changes recorded by the journal entries, newest first.
+//
+// An update, which is journalled as a deletion immediately followed by an insertion of the
+// same row, is reverted in place so that rows depending upon it are not removed.
+func (db *Database) RevertJournalEntries(entries entities.JournalEntries) error {
+	for index := len(entries) - 1; index >= 0; index-- {
+		entry := entries[index]
+
+		if err := db.checkJournalledRow(entry); err != nil {
+			return fmt.Errorf("could not revert change #%v: %v", entry.Id, err)
+		}
+
+		var err error
+		if index > 0 && isJournalledUpdate(entries[index-1], entry) {
+			err = db.revertJournalledUpdate(entries[index-1])
+			index--
+		} else {
+			err = db.revertJournalEntry(entry)
+		}
+
+		if err != nil {
+			return fmt.Errorf("could not revert change #%v: %v", entry.Id, err)
+		}
+	}
+
+	return nil
+}
+
+// unexported
+
+// The number of leading columns that identify a row of each journalled table.
+var journalKeyCounts = map[string]int{
+	"file":         1,
+	"tag":          1,
+	"value":        1,
+	"file_tag":     3,
+	"implication":  5,
+	"query":        1,
+	"setting":      1,
+	"alias":        1,
+	"tag_property": 2,
+}
+
+// Checks that the row changed by a journal entry still holds what the entry left in it, so
+// that a change made since by another operation is not silently overwritten.
+func (db *Database) checkJournalledRow(entry *entities.JournalEntry) error {
+	keyCount, ok := journalKeyCounts[entry.Table]
+	if !ok || len(entry.Columns) < keyCount {
+		// reported when the entry is reverted
+		return nil
+	}
+
+	columns, exists := db.journalledRow(entry.Table, entry.Columns[:keyCount])
+
+	switch entry.Action {
+	case entities.JournalInsert:
+		if exists && equalColumns(columns, entry.Columns) {
+			return nil
+		}
+	case entities.JournalDelete:
+		if !exists {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	description := strings.Replace(entry.Table, "_", " ", -1)
+	if operationId := db.conflictingOperationId(entry, keyCount); operationId != 0 {
+		return fmt.Errorf("the %v has since been changed by operation #%v", description, operationId)
+	}
+
+	return fmt.Errorf("the %v has since been changed", description)
+}
+
+// Retrieves the columns, in journalled form, of the row of the table having the key.
+func (db *Database) journalledRow(table string, key []interface{}) ([]interface{}, bool) {
+	switch table {
+	case "file":
+		fileId, _ := key[0].(uint)
+		if file, ok := db.data.files[entities.FileId(fileId)]; ok {
+			return fileColumns(file), true
+		}
+	case "tag":
+		tagId, _ := key[0].(uint)
+		if tag, ok := db.data.tags[entities.TagId(tagId)]; ok {
+			return []interface{}{uint(tag.Id), tag.Name}, true
+		}
+	case "value":
+		valueId, _ := key[0].(uint)
+		if value, ok := db.data.values[entities.ValueId(valueId)]; ok {
+			return []interface{}{uint(value.Id), value.Name}, true
+		}
+	case "file_tag":
+		fileId, _ := key[0].(uint)
+		tagId, _ := key[1].(uint)
+		valueId, _ := key[2].(uint)
+		if db.data.fileTags[fileTagKey{entities.FileId(fileId), entities.TagId(tagId), entities.ValueId(valueId)}] {
+			return key, true
+		}
+	case "implication":
+		tagId, _ := key[0].(uint)
+		impliedTagId, _ := key[1].(uint)
+		valueId, _ := key[2].(uint)
+		impliedValueId, _ := key[3].(uint)
+		preservesValue, _ := key[4].(bool)
+		if db.data.implications[implicationKey{entities.TagId(tagId), entities.ValueId(valueId), entities.TagId(impliedTagId), entities.ValueId(impliedValueId), preservesValue}] {
+			return key, true
+		}
+	case "query":
+		text, _ := key[0].(string)
+		if db.data.queries[text] {
+			return key, true
+		}
+	case "setting":
+		name, _ := key[0].(string)
+		if value, ok := db.data.settings[name]; ok {
+			return []interface{}{name, value}, true
+		}
+	case "alias":
+		name, _ := key[0].(string)
+		if tagId, ok := db.data.aliases[name]; ok {
+			return []interface{}{name, uint(tagId)}, true
+		}
+	case "tag_property":
+		tagId, _ := key[0].(uint)
+		name, _ := key[1].(string)
+		if value, ok := db.data.properties[tagPropertyKey{entities.TagId(tagId), name}]; ok {
+			return []interface{}{uint(tagId), name, value}, true
+		}
+	}
+
+	return nil, false
+}
+
+// Retrieves the most recent operation, other than the one that made it, to have changed the
+// row changed by a journal entry.
+func (db *Database) conflictingOperationId(entry *entities.JournalEntry, keyCount int) entities.OperationId {
+	for index := len(db.data.journal) - 1; index >= 0; index-- {
+		later := db.data.journal[index]
+		if later.Id <= entry.Id {
+			break
+		}
+		if later.OperationId == 0 || later.OperationId == entry.OperationId || later.Table != entry.Table || len(later.Columns) < keyCount {
+			continue
+		}
+
+		if equalColumns(later.Columns[:keyCount], entry.Columns[:keyCount]) {
+			return later.OperationId
+		}
+	}
+
+	return 0
+}
+
+func equalColumns(columns, otherColumns []interface{}) bool {
+	if len(columns) != len(otherColumns) {
+		return false
+	}
+
+	for index := range columns {
+		if columns[index] != otherColumns[index] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Reverses the change recorded by a journal entry.
+func (db *Database) revertJournalEntry(entry *entities.JournalEntry) error {
+	if entry.Action != entities.JournalInsert && entry.Action != entities.JournalDelete {
+		return fmt.Errorf("journal entry #%v has unknown action '%v'", entry.Id, entry.Action)
+	}
+	insert := entry.Action == entities.JournalInsert
+
+	columns := entry.Columns
+
+	switch entry.Table {
+	case "file":
+		file, err := fileFromColumns(columns)
+		if err != nil {
+			return fmt.Errorf("journal entry #%v: %v", entry.Id, err)
+		}
+
+		if insert {
+			db.removeFile(file.Id)
+		} else {
+			db.putFile(file)
+		}
+	case "tag":
+		tag, err := tagFromColumns(columns)
+		if err != nil {
+			return fmt.Errorf("journal entry #%v: %v", entry.Id, err)
+		}
+
+		if insert {
+			db.removeTag(tag.Id)
+		} else {
+			db.putTag(tag)
+		}
+	case "value":
+		value, err := valueFromColumns(columns)
+		if err != nil {
+			return fmt.Errorf("journal entry #%v: %v", entry.Id, err)
+		}
+
+		if insert {
+			db.removeValue(value.Id)
+		} else {
+			db.putValue(value)
+		}
+	case "file_tag":
+		fileId, fileIdOk := columns[0].(uint)
+		tagId, tagIdOk := columns[1].(uint)
+		valueId, valueIdOk := columns[2].(uint)
+		if !fileIdOk || !tagIdOk || !valueIdOk {
+			return fmt.Errorf("journal entry #%v has unexpected column types", entry.Id)
+		}
+
+		key := fileTagKey{entities.FileId(fileId), entities.TagId(tagId), entities.ValueId(valueId)}
+		if insert {
+			db.removeFileTag(key)
+		} else {
+			db.putFileTag(key)
+		}
+	case "implication":
+		tagId, tagIdOk := columns[0].(uint)
+		impliedTagId, impliedTagIdOk := columns[1].(uint)
+		valueId, valueIdOk := columns[2].(uint)
+		impliedValueId, impliedValueIdOk := columns[3].(uint)
+		preservesValue, preservesValueOk := columns[4].(bool)
+		if !tagIdOk || !impliedTagIdOk || !valueIdOk || !impliedValueIdOk || !preservesValueOk {
+			return fmt.Errorf("journal entry #%v has unexpected column types", entry.Id)
+		}
+
+		key := implicationKey{entities.TagId(tagId), entities.ValueId(valueId), entities.TagId(impliedTagId), entities.ValueId(impliedValueId), preservesValue}
+		if insert {
+			db.removeImplication(key)
+		} else {
+			db.putImplication(key)
+		}
+	case "query":
+		text, ok := columns[0].(string)
+		if !ok {
+			return fmt.Errorf("journal entry #%v has unexpected column types", entry.Id)
+		}
+
+		if insert {
+			db.removeQuery(text)
+		} else {
+			db.putQuery(text)
+		}
+	case "setting":
+		name, nameOk := columns[0].(string)
+		value, valueOk := columns[1].(string)
+		if !nameOk || !valueOk {
+			return fmt.Errorf("journal entry #%v has unexpected column types", entry.Id)
+		}
+
+		if insert {
+			db.removeSetting(name)
+		} else {
+			db.putSetting(name, value)
+		}
+	case "alias":
+		name, nameOk := columns[0].(string)
+		tagId, tagIdOk := columns[1].(uint)
+		if !nameOk || !tagIdOk {
+			return fmt.Errorf("journal entry #%v has unexpected column types", entry.Id)
+		}
+
+		if insert {
+			db.removeAlias(name)
+		} else {
+			db.putAlias(name, entities.TagId(tagId))
+		}
+	case "tag_property":
+		tagId, tagIdOk := columns[0].(uint)
+		name, nameOk := columns[1].(string)
+		value, valueOk := columns[2].(string)
+		if !tagIdOk || !nameOk || !valueOk {
+			return fmt.Errorf("journal entry #%v has unexpected column types", entry.Id)
+		}
+
+		key := tagPropertyKey{entities.TagId(tagId), name}
+		if insert {
+			db.removeTagProperty(key)
+		} else {
+			db.putTagProperty(key, value)
+		}
+	default:
+		return fmt.Errorf("journal entry #%v refers to unknown table '%v'", entry.Id, entry.Table)
+	}
+
+	return nil
+}
+
+// Restores a row to the values recorded by the deletion journalled for its update.
+func (db *Database) revertJournalledUpdate(deleted *entities.JournalEntry) error {
+	switch deleted.Table {
+	case "file":
+		file, err := fileFromColumns(deleted.Columns)
+		if err != nil {
+			return fmt.Errorf("journal entry #%v: %v", deleted.Id, err)
+		}
+
+		db.replaceFile(file)
+	case "tag":
+		tag, err := tagFromColumns(deleted.Columns)
+		if err != nil {
+			return fmt.Errorf("journal entry #%v: %v", deleted.Id, err)
+		}
+
+		db.replaceTag(tag)
+	default:
+		// nothing depends upon the rows of the other tables
+		inserted := *deleted
+		inserted.Action = entities.JournalInsert
+
+		if err := db.revertJournalEntry(&inserted); err != nil {
+			return err
+		}
+		if err := db.revertJournalEntry(deleted); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Determines whether a pair of consecutive journal entries records the update of a row.
+func isJournalledUpdate(previous, entry *entities.JournalEntry) bool {
+	if previous.Action != entities.JournalDelete || entry.Action != entities.JournalInsert || previous.Table != entry.Table {
+		return false
+	}
+
+	keyCount, ok := journalKeyCounts[entry.Table]
+	if !ok || len(previous.Columns) < keyCount || len(entry.Columns) < keyCount {
+		return false
+	}
+
+	for index := 0; index < keyCount; index++ {
+		if previous.Columns[index] != entry.Columns[index] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Records a change to a table as a journal entry pending attribution to an operation.
+func (db *Database) journal(table, action string, columns ...interface{}) {
+	db.data.lastJournalId++
+	db.data.journal = append(db.data.journal, entities.JournalEntry{db.data.lastJournalId, 0, table, action, columns})
+}
+
+func (db *Database) operation(operationId entities.OperationId) *entities.Operation {
+	operation := db.data.operations[operationId]
+
+	operation.ChangeCount = 0
+	for _, entry := range db.data.journal {
+		if entry.OperationId == operationId {
+			operation.ChangeCount++
+		}
+	}
+
+	return &operation
+}
+
+type operationsById entities.Operations
+
+func (operations operationsById) Len() int {
+	return len(operations)
+}
+
+func (operations operationsById) Less(i, j int) bool {
+	return operations[i].Id < operations[j].Id
+}
+
+func (operations operationsById) Swap(i, j int) {
+	operations[i], operations[j] = operations[j], operations[i]
+}
@@ -0,0 +1,518 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package memory provides a storage backend that holds its data entirely in memory.
+//
+// It is intended for embedding and for tests: nothing is persisted once the database is
+// closed.
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"tmsu/common/fingerprint"
+	"tmsu/common/log"
+	"tmsu/entities"
+)
+
+// The location reported for in-memory databases.
+const Location = ":memory:"
+
+var errUnsupported = errors.New("not supported by the in-memory database")
+
+type Database struct {
+	// unexported
+	data     *tables
+	snapshot *tables // the data as it was at the start of the transaction
+}
+
+// Creates a new, empty, in-memory database.
+func New() *Database {
+	return &Database{newTables(), nil}
+}
+
+func (db *Database) Location() string {
+	return Location
+}
+
+// Start a transaction
+func (db *Database) Begin() error {
+	if db.snapshot != nil {
+		panic("could not begin transaction: there is already an open transaction")
+	}
+
+	log.Info(2, "beginning new transaction")
+
+	db.snapshot = db.data.clone()
+
+	return nil
+}
+
+// Start a transaction that writes to the database
+//
+// As the database is private to this process this is no different to Begin.
+func (db *Database) BeginWrite() error {
+	return db.Begin()
+}
+
+// Commits the current transaction
+func (db *Database) Commit() error {
+	if db.snapshot == nil {
+		return fmt.Errorf("could not commit transaction: there is no open transaction")
+	}
+
+	log.Info(2, "committing transaction")
+
+	db.snapshot = nil
+
+	return nil
+}
+
+// Rolls back the current transaction
+func (db *Database) Rollback() error {
+	if db.snapshot == nil {
+		return fmt.Errorf("could not rollback transaction: there is no open transaction")
+	}
+
+	log.Info(2, "rolling back transaction")
+
+	db.data = db.snapshot
+	db.snapshot = nil
+
+	return nil
+}
+
+// Closes the database, discarding its contents.
+func (db *Database) Close() error {
+	db.data = newTables()
+	db.snapshot = nil
+
+	return nil
+}
+
+// In-memory databases cannot be backed up.
+func (db *Database) Backup(path string) error {
+	return errUnsupported
+}
+
+// In-memory databases cannot be backed up.
+func (db *Database) BackupRotated(basePath string, keep uint) (string, error) {
+	return "", errUnsupported
+}
+
+// In-memory databases cannot be restored.
+func (db *Database) Restore(path string) error {
+	return errUnsupported
+}
+
+// unexported
+
+type fileTagKey struct {
+	fileId  entities.FileId
+	tagId   entities.TagId
+	valueId entities.ValueId
+}
+
+type implicationKey struct {
+	tagId          entities.TagId
+	valueId        entities.ValueId
+	impliedTagId   entities.TagId
+	impliedValueId entities.ValueId
+	preservesValue bool
+}
+
+type tagPropertyKey struct {
+	tagId entities.TagId
+	name  string
+}
+
+// The rows of each table.
+type tables struct {
+	files        map[entities.FileId]entities.File
+	tags         map[entities.TagId]entities.Tag
+	values       map[entities.ValueId]entities.Value
+	fileTags     map[fileTagKey]bool
+	implications map[implicationKey]bool
+	queries      map[string]bool
+	settings     map[string]string
+	aliases      map[string]entities.TagId
+	properties   map[tagPropertyKey]string
+	operations   map[entities.OperationId]entities.Operation
+	journal      []entities.JournalEntry
+
+	lastFileId      entities.FileId
+	lastTagId       entities.TagId
+	lastValueId     entities.ValueId
+	lastOperationId entities.OperationId
+	lastJournalId   uint
+}
+
+func newTables() *tables {
+	return &tables{
+		files:        make(map[entities.FileId]entities.File),
+		tags:         make(map[entities.TagId]entities.Tag),
+		values:       make(map[entities.ValueId]entities.Value),
+		fileTags:     make(map[fileTagKey]bool),
+		implications: make(map[implicationKey]bool),
+		queries:      make(map[string]bool),
+		settings:     make(map[string]string),
+		aliases:      make(map[string]entities.TagId),
+		properties:   make(map[tagPropertyKey]string),
+		operations:   make(map[entities.OperationId]entities.Operation),
+	}
+}
+
+func (data *tables) clone() *tables {
+	duplicate := *data
+
+	duplicate.files = make(map[entities.FileId]entities.File, len(data.files))
+	for id, file := range data.files {
+		duplicate.files[id] = file
+	}
+
+	duplicate.tags = make(map[entities.TagId]entities.Tag, len(data.tags))
+	for id, tag := range data.tags {
+		duplicate.tags[id] = tag
+	}
+
+	duplicate.values = make(map[entities.ValueId]entities.Value, len(data.values))
+	for id, value := range data.values {
+		duplicate.values[id] = value
+	}
+
+	duplicate.fileTags = make(map[fileTagKey]bool, len(data.fileTags))
+	for key := range data.fileTags {
+		duplicate.fileTags[key] = true
+	}
+
+	duplicate.implications = make(map[implicationKey]bool, len(data.implications))
+	for key := range data.implications {
+		duplicate.implications[key] = true
+	}
+
+	duplicate.queries = make(map[string]bool, len(data.queries))
+	for text := range data.queries {
+		duplicate.queries[text] = true
+	}
+
+	duplicate.settings = make(map[string]string, len(data.settings))
+	for name, value := range data.settings {
+		duplicate.settings[name] = value
+	}
+
+	duplicate.aliases = make(map[string]entities.TagId, len(data.aliases))
+	for name, tagId := range data.aliases {
+		duplicate.aliases[name] = tagId
+	}
+
+	duplicate.properties = make(map[tagPropertyKey]string, len(data.properties))
+	for key, value := range data.properties {
+		duplicate.properties[key] = value
+	}
+
+	duplicate.operations = make(map[entities.OperationId]entities.Operation, len(data.operations))
+	for id, operation := range data.operations {
+		duplicate.operations[id] = operation
+	}
+
+	// the column values of journal entries are never modified so can be shared
+	duplicate.journal = append([]entities.JournalEntry(nil), data.journal...)
+
+	return &duplicate
+}
+
+// The primitive row operations below are the only places the tables are modified: they
+// journal each change in the same form as the SQLite triggers do so that it can be undone.
+
+func (db *Database) putFile(file entities.File) {
+	db.data.files[file.Id] = file
+	if file.Id > db.data.lastFileId {
+		db.data.lastFileId = file.Id
+	}
+
+	db.journal("file", entities.JournalInsert, fileColumns(file)...)
+}
+
+func (db *Database) removeFile(fileId entities.FileId) bool {
+	file, ok := db.data.files[fileId]
+	if !ok {
+		return false
+	}
+
+	for key := range db.data.fileTags {
+		if key.fileId == fileId {
+			db.removeFileTag(key)
+		}
+	}
+
+	delete(db.data.files, fileId)
+	db.journal("file", entities.JournalDelete, fileColumns(file)...)
+
+	return true
+}
+
+// Updates a file in place, without disturbing its taggings.
+func (db *Database) replaceFile(file entities.File) {
+	previous := db.data.files[file.Id]
+	db.data.files[file.Id] = file
+
+	db.journal("file", entities.JournalDelete, fileColumns(previous)...)
+	db.journal("file", entities.JournalInsert, fileColumns(file)...)
+}
+
+func (db *Database) putTag(tag entities.Tag) {
+	db.data.tags[tag.Id] = tag
+	if tag.Id > db.data.lastTagId {
+		db.data.lastTagId = tag.Id
+	}
+
+	db.journal("tag", entities.JournalInsert, uint(tag.Id), tag.Name)
+}
+
+func (db *Database) removeTag(tagId entities.TagId) bool {
+	tag, ok := db.data.tags[tagId]
+	if !ok {
+		return false
+	}
+
+	for key := range db.data.fileTags {
+		if key.tagId == tagId {
+			db.removeFileTag(key)
+		}
+	}
+
+	for key := range db.data.implications {
+		if key.tagId == tagId || key.impliedTagId == tagId {
+			db.removeImplication(key)
+		}
+	}
+
+	for name, aliasTagId := range db.data.aliases {
+		if aliasTagId == tagId {
+			db.removeAlias(name)
+		}
+	}
+
+	for key := range db.data.properties {
+		if key.tagId == tagId {
+			db.removeTagProperty(key)
+		}
+	}
+
+	delete(db.data.tags, tagId)
+	db.journal("tag", entities.JournalDelete, uint(tag.Id), tag.Name)
+
+	return true
+}
+
+// Updates a tag in place, without disturbing its taggings, implications, aliases or properties.
+func (db *Database) replaceTag(tag entities.Tag) {
+	previous := db.data.tags[tag.Id]
+	db.data.tags[tag.Id] = tag
+
+	db.journal("tag", entities.JournalDelete, uint(previous.Id), previous.Name)
+	db.journal("tag", entities.JournalInsert, uint(tag.Id), tag.Name)
+}
+
+func (db *Database) putValue(value entities.Value) {
+	db.data.values[value.Id] = value
+	if value.Id > db.data.lastValueId {
+		db.data.lastValueId = value.Id
+	}
+
+	db.journal("value", entities.JournalInsert, uint(value.Id), value.Name)
+}
+
+func (db *Database) removeValue(valueId entities.ValueId) bool {
+	value, ok := db.data.values[valueId]
+	if !ok {
+		return false
+	}
+
+	for key := range db.data.fileTags {
+		if key.valueId == valueId {
+			db.removeFileTag(key)
+		}
+	}
+
+	for key := range db.data.implications {
+		if key.valueId == valueId || key.impliedValueId == valueId {
+			db.removeImplication(key)
+		}
+	}
+
+	delete(db.data.values, valueId)
+	db.journal("value", entities.JournalDelete, uint(value.Id), value.Name)
+
+	return true
+}
+
+func (db *Database) putFileTag(key fileTagKey) {
+	if db.data.fileTags[key] {
+		return
+	}
+
+	db.data.fileTags[key] = true
+	db.journal("file_tag", entities.JournalInsert, uint(key.fileId), uint(key.tagId), uint(key.valueId))
+}
+
+func (db *Database) removeFileTag(key fileTagKey) bool {
+	if !db.data.fileTags[key] {
+		return false
+	}
+
+	delete(db.data.fileTags, key)
+	db.journal("file_tag", entities.JournalDelete, uint(key.fileId), uint(key.tagId), uint(key.valueId))
+
+	return true
+}
+
+func (db *Database) putImplication(key implicationKey) {
+	if db.data.implications[key] {
+		return
+	}
+
+	db.data.implications[key] = true
+	db.journal("implication", entities.JournalInsert, uint(key.tagId), uint(key.impliedTagId), uint(key.valueId), uint(key.impliedValueId), key.preservesValue)
+}
+
+func (db *Database) removeImplication(key implicationKey) bool {
+	if !db.data.implications[key] {
+		return false
+	}
+
+	delete(db.data.implications, key)
+	db.journal("implication", entities.JournalDelete, uint(key.tagId), uint(key.impliedTagId), uint(key.valueId), uint(key.impliedValueId), key.preservesValue)
+
+	return true
+}
+
+func (db *Database) putQuery(text string) {
+	db.data.queries[text] = true
+	db.journal("query", entities.JournalInsert, text)
+}
+
+func (db *Database) removeQuery(text string) bool {
+	if !db.data.queries[text] {
+		return false
+	}
+
+	delete(db.data.queries, text)
+	db.journal("query", entities.JournalDelete, text)
+
+	return true
+}
+
+func (db *Database) putSetting(name, value string) {
+	db.data.settings[name] = value
+	db.journal("setting", entities.JournalInsert, name, value)
+}
+
+func (db *Database) removeSetting(name string) bool {
+	value, ok := db.data.settings[name]
+	if !ok {
+		return false
+	}
+
+	delete(db.data.settings, name)
+	db.journal("setting", entities.JournalDelete, name, value)
+
+	return true
+}
+
+func (db *Database) putAlias(name string, tagId entities.TagId) {
+	db.data.aliases[name] = tagId
+	db.journal("alias", entities.JournalInsert, name, uint(tagId))
+}
+
+func (db *Database) removeAlias(name string) bool {
+	tagId, ok := db.data.aliases[name]
+	if !ok {
+		return false
+	}
+
+	delete(db.data.aliases, name)
+	db.journal("alias", entities.JournalDelete, name, uint(tagId))
+
+	return true
+}
+
+func (db *Database) putTagProperty(key tagPropertyKey, value string) {
+	db.data.properties[key] = value
+	db.journal("tag_property", entities.JournalInsert, uint(key.tagId), key.name, value)
+}
+
+func (db *Database) removeTagProperty(key tagPropertyKey) bool {
+	value, ok := db.data.properties[key]
+	if !ok {
+		return false
+	}
+
+	delete(db.data.properties, key)
+	db.journal("tag_property", entities.JournalDelete, uint(key.tagId), key.name, value)
+
+	return true
+}
+
+func fileColumns(file entities.File) []interface{} {
+	return []interface{}{uint(file.Id), file.Directory, file.Name, string(file.Fingerprint), file.ModTime, file.Size, file.IsDir}
+}
+
+func fileFromColumns(columns []interface{}) (entities.File, error) {
+	if len(columns) < 7 {
+		return entities.File{}, fmt.Errorf("expected 7 columns but there are %v", len(columns))
+	}
+
+	id, idOk := columns[0].(uint)
+	directory, directoryOk := columns[1].(string)
+	name, nameOk := columns[2].(string)
+	fp, fingerprintOk := columns[3].(string)
+	modTime, modTimeOk := columns[4].(time.Time)
+	size, sizeOk := columns[5].(int64)
+	isDir, isDirOk := columns[6].(bool)
+
+	if !idOk || !directoryOk || !nameOk || !fingerprintOk || !modTimeOk || !sizeOk || !isDirOk {
+		return entities.File{}, fmt.Errorf("unexpected column types")
+	}
+
+	return entities.File{entities.FileId(id), directory, name, fingerprint.Fingerprint(fp), modTime, size, isDir}, nil
+}
+
+func tagFromColumns(columns []interface{}) (entities.Tag, error) {
+	id, name, err := idAndNameFromColumns(columns)
+	return entities.Tag{entities.TagId(id), name}, err
+}
+
+func valueFromColumns(columns []interface{}) (entities.Value, error) {
+	id, name, err := idAndNameFromColumns(columns)
+	return entities.Value{entities.ValueId(id), name}, err
+}
+
+func idAndNameFromColumns(columns []interface{}) (uint, string, error) {
+	if len(columns) < 2 {
+		return 0, "", fmt.Errorf("expected 2 columns but there are %v", len(columns))
+	}
+
+	id, idOk := columns[0].(uint)
+	name, nameOk := columns[1].(string)
+	if !idOk || !nameOk {
+		return 0, "", fmt.Errorf("unexpected column types")
+	}
+
+	return id, name, nil
+}
@@ -0,0 +1,287 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package memory
+
+import (
+	"testing"
+	"time"
+	"tmsu/entities"
+	"tmsu/query"
+	"tmsu/storage"
+)
+
+var _ storage.Backend = New()
+
+func TestRollbackDiscardsChanges(test *testing.T) {
+	// set-up
+
+	db := New()
+
+	if _, err := db.InsertTag("apple"); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := db.Begin(); err != nil {
+		test.Fatal(err)
+	}
+	if _, err := db.InsertTag("banana"); err != nil {
+		test.Fatal(err)
+	}
+	if err := db.Rollback(); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	tags, err := db.Tags()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(tags) != 1 || tags[0].Name != "apple" {
+		test.Fatalf("Expected only tag 'apple' after rollback but found %v tags.", len(tags))
+	}
+}
+
+func TestDeleteTagCascades(test *testing.T) {
+	// set-up
+
+	db := New()
+
+	file, err := db.InsertFile("/tmp/tmsu/a", "abc", time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	appleTag, err := db.InsertTag("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+	fruitTag, err := db.InsertTag("fruit")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := db.AddFileTag(file.Id, appleTag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+	if err := db.AddImplication(appleTag.Id, 0, fruitTag.Id, 0, false); err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := db.DeleteTag(appleTag.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	count, err := db.FileTagCount()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if count != 0 {
+		test.Fatalf("Expected no file tags but there are %v.", count)
+	}
+
+	implications, err := db.Implications()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(implications) != 0 {
+		test.Fatalf("Expected no implications but there are %v.", len(implications))
+	}
+}
+
+func TestAddFileTagRequiresTag(test *testing.T) {
+	// set-up
+
+	db := New()
+
+	file, err := db.InsertFile("/tmp/tmsu/a", "abc", time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	_, err = db.AddFileTag(file.Id, 99, 0)
+
+	// validate
+
+	if err == nil {
+		test.Fatal("File was tagged with a tag that does not exist.")
+	}
+}
+
+func TestQueryFiles(test *testing.T) {
+	// set-up
+
+	db := New()
+
+	files := make(entities.Files, 4)
+	for index, path := range []string{"/tmp/tmsu/a", "/tmp/tmsu/b", "/tmp/tmsu/dir/c", "/tmp/other/d"} {
+		file, err := db.InsertFile(path, "", time.Now(), 0, false)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		files[index] = file
+	}
+
+	appleTag, err := db.InsertTag("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+	weightTag, err := db.InsertTag("weight")
+	if err != nil {
+		test.Fatal(err)
+	}
+	nineValue, err := db.InsertValue("9")
+	if err != nil {
+		test.Fatal(err)
+	}
+	tenValue, err := db.InsertValue("10")
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	fileTags := []struct {
+		file    *entities.File
+		tagId   entities.TagId
+		valueId entities.ValueId
+	}{
+		{files[0], appleTag.Id, 0},
+		{files[0], weightTag.Id, nineValue.Id},
+		{files[1], weightTag.Id, tenValue.Id},
+		{files[2], appleTag.Id, 0},
+		{files[3], appleTag.Id, 0},
+	}
+	for _, fileTag := range fileTags {
+		if _, err := db.AddFileTag(fileTag.file.Id, fileTag.tagId, fileTag.valueId); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	queries := []struct {
+		text     string
+		path     string
+		expected []string
+	}{
+		{"apple", "", []string{"/tmp/other/d", "/tmp/tmsu/a", "/tmp/tmsu/dir/c"}},
+		{"apple", "/tmp/tmsu", []string{"/tmp/tmsu/a", "/tmp/tmsu/dir/c"}},
+		{"apple", "/tmp/tmsu/a", []string{"/tmp/tmsu/a"}},
+		{"not apple", "", []string{"/tmp/tmsu/b"}},
+		{"weight > 9", "", []string{"/tmp/tmsu/b"}},
+		{"weight < 10 or apple", "/tmp/tmsu", []string{"/tmp/tmsu/a", "/tmp/tmsu/dir/c"}},
+		{"apple and weight", "", []string{"/tmp/tmsu/a"}},
+		{"", "", []string{"/tmp/other/d", "/tmp/tmsu/a", "/tmp/tmsu/b", "/tmp/tmsu/dir/c"}},
+	}
+
+	for _, q := range queries {
+		expression, err := query.Parse(q.text)
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		// test
+
+		matches, err := db.QueryFiles(expression, query.NewPathScope([]string{q.path}, nil))
+		if err != nil {
+			test.Fatal(err)
+		}
+
+		// validate
+
+		if len(matches) != len(q.expected) {
+			test.Fatalf("Query '%v' in '%v' matched %v files but expected %v.", q.text, q.path, len(matches), len(q.expected))
+		}
+		for index, file := range matches {
+			if file.Path() != q.expected[index] {
+				test.Fatalf("Query '%v' in '%v' matched '%v' but expected '%v'.", q.text, q.path, file.Path(), q.expected[index])
+			}
+		}
+	}
+}
+
+func TestRevertRenameKeepsTaggings(test *testing.T) {
+	// set-up
+
+	db := New()
+
+	file, err := db.InsertFile("/tmp/tmsu/a", "abc", time.Now(), 123, false)
+	if err != nil {
+		test.Fatal(err)
+	}
+	tag, err := db.InsertTag("apple")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if _, err := db.AddFileTag(file.Id, tag.Id, 0); err != nil {
+		test.Fatal(err)
+	}
+
+	setUp, err := db.InsertOperation(time.Now(), "set-up", "test")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := db.AssignPendingJournalEntries(setUp.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	if _, err := db.RenameTag(tag.Id, "pear"); err != nil {
+		test.Fatal(err)
+	}
+
+	rename, err := db.InsertOperation(time.Now(), "rename", "test")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := db.AssignPendingJournalEntries(rename.Id); err != nil {
+		test.Fatal(err)
+	}
+
+	entries, err := db.JournalEntries(rename.Id)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	// test
+
+	if err := db.RevertJournalEntries(entries); err != nil {
+		test.Fatal(err)
+	}
+
+	// validate
+
+	revertedTag, err := db.Tag(tag.Id)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if revertedTag == nil || revertedTag.Name != "apple" {
+		test.Fatal("Tag was not renamed back.")
+	}
+
+	exists, err := db.FileTagExists(file.Id, tag.Id, 0)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if !exists {
+		test.Fatal("Tagging was lost.")
+	}
+}
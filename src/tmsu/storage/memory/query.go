@@ -0,0 +1,70 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"tmsu/entities"
+	"tmsu/storage/database"
+)
+
+// Retrieves the complete set of queries.
+func (db *Database) Queries() (entities.Queries, error) {
+	texts := make([]string, 0, len(db.data.queries))
+	for text := range db.data.queries {
+		texts = append(texts, text)
+	}
+	sort.Strings(texts)
+
+	queries := make(entities.Queries, len(texts))
+	for index, text := range texts {
+		queries[index] = &entities.Query{text}
+	}
+
+	return queries, nil
+}
+
+// Retrieves the specified query.
+func (db *Database) Query(text string) (*entities.Query, error) {
+	if !db.data.queries[text] {
+		return nil, nil
+	}
+
+	return &entities.Query{text}, nil
+}
+
+// Adds a query to the database.
+func (db *Database) InsertQuery(text string) (*entities.Query, error) {
+	if db.data.queries[text] {
+		return nil, fmt.Errorf("query '%v' already exists", text)
+	}
+
+	db.putQuery(text)
+
+	return &entities.Query{text}, nil
+}
+
+// Removes a query from the database.
+func (db *Database) DeleteQuery(text string) error {
+	if !db.removeQuery(text) {
+		return database.NoSuchQueryError{text}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package memory
+
+import (
+	"sort"
+	"tmsu/entities"
+)
+
+// Retrieves the complete set of settings.
+func (db *Database) Settings() (entities.Settings, error) {
+	names := make([]string, 0, len(db.data.settings))
+	for name := range db.data.settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	settings := make(entities.Settings, len(names))
+	for index, name := range names {
+		settings[index] = &entities.Setting{name, db.data.settings[name]}
+	}
+
+	return settings, nil
+}
+
+// Retrieves the specified setting.
+func (db *Database) Setting(name string) (*entities.Setting, error) {
+	value, ok := db.data.settings[name]
+	if !ok {
+		return nil, nil
+	}
+
+	return &entities.Setting{name, value}, nil
+}
+
+// Updates the specified setting.
+func (db *Database) UpdateSetting(name, value string) (*entities.Setting, error) {
+	db.removeSetting(name)
+	db.putSetting(name, value)
+
+	return &entities.Setting{name, value}, nil
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package memory
+
+import (
+	"sort"
+	"tmsu/entities"
+)
+
+// The number of tags in the database.
+func (db *Database) TagCount() (uint, error) {
+	return uint(len(db.data.tags)), nil
+}
+
+// The set of tags.
+func (db *Database) Tags() (entities.Tags, error) {
+	tags := db.tagsWhere(func(*entities.Tag) bool { return true })
+	sort.Sort(tags)
+
+	return tags, nil
+}
+
+// Retrieves a specific tag.
+func (db *Database) Tag(id entities.TagId) (*entities.Tag, error) {
+	tag, ok := db.data.tags[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return &tag, nil
+}
+
+// Retrieves the set of tags with the specified identifiers.
+func (db *Database) TagsByIds(ids entities.TagIds) (entities.Tags, error) {
+	wanted := make(map[entities.TagId]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	return db.tagsWhere(func(tag *entities.Tag) bool { return wanted[tag.Id] }), nil
+}
+
+// Retrieves a specific tag.
+func (db *Database) TagByName(name string) (*entities.Tag, error) {
+	tags := db.tagsWhere(func(tag *entities.Tag) bool { return tag.Name == name })
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	return tags[0], nil
+}
+
+// Retrieves the set of named tags.
+func (db *Database) TagsByNames(names []string) (entities.Tags, error) {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	return db.tagsWhere(func(tag *entities.Tag) bool { return wanted[tag.Name] }), nil
+}
+
+// Retrieves the set of tags that share their name with another tag.
+func (db *Database) DuplicateTags() (entities.Tags, error) {
+	counts := make(map[string]int, len(db.data.tags))
+	for _, tag := range db.data.tags {
+		counts[tag.Name]++
+	}
+
+	tags := db.tagsWhere(func(tag *entities.Tag) bool { return counts[tag.Name] > 1 })
+	sort.Stable(tags)
+
+	return tags, nil
+}
+
+// Adds a tag.
+func (db *Database) InsertTag(name string) (*entities.Tag, error) {
+	tag := entities.Tag{db.data.lastTagId + 1, name}
+	db.putTag(tag)
+
+	return &tag, nil
+}
+
+// Renames a tag.
+func (db *Database) RenameTag(tagId entities.TagId, name string) (*entities.Tag, error) {
+	if _, ok := db.data.tags[tagId]; !ok {
+		panic("expected exactly one row to be affected.")
+	}
+
+	tag := entities.Tag{tagId, name}
+	db.replaceTag(tag)
+
+	return &tag, nil
+}
+
+// Deletes a tag.
+func (db *Database) DeleteTag(tagId entities.TagId) error {
+	db.removeTag(tagId)
+
+	return nil
+}
+
+// Retrieves the usage of each tag
+func (db *Database) TagUsage() ([]entities.TagFileCount, error) {
+	counts := make(map[entities.TagId]uint, len(db.data.tags))
+	for key := range db.data.fileTags {
+		counts[key.tagId]++
+	}
+
+	tags, err := db.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make([]entities.TagFileCount, 0, len(tags))
+	for _, tag := range tags {
+		if count := counts[tag.Id]; count > 0 {
+			usage = append(usage, entities.TagFileCount{tag.Id, tag.Name, count})
+		}
+	}
+
+	return usage, nil
+}
+
+// unexported
+
+// Retrieves the tags satisfying the predicate in identifier order.
+func (db *Database) tagsWhere(predicate func(*entities.Tag) bool) entities.Tags {
+	ids := make(entities.TagIds, 0, len(db.data.tags))
+	for id := range db.data.tags {
+		ids = append(ids, id)
+	}
+	sort.Sort(ids)
+
+	tags := make(entities.Tags, 0, 10)
+	for _, id := range ids {
+		tag := db.data.tags[id]
+		if predicate(&tag) {
+			tags = append(tags, &tag)
+		}
+	}
+
+	return tags
+}
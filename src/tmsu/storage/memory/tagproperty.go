@@ -0,0 +1,92 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package memory
+
+import (
+	"errors"
+	"sort"
+	"tmsu/entities"
+	"tmsu/storage/database"
+)
+
+var errUniqueTagProperty = errors.New("UNIQUE constraint failed: tag_property.tag_id, tag_property.name")
+
+// The complete set of tag properties.
+func (db *Database) TagProperties() (entities.TagProperties, error) {
+	return db.tagPropertiesWhere(func(entities.TagId) bool { return true }), nil
+}
+
+// Retrieves the properties of the specified tag.
+func (db *Database) TagPropertiesByTagId(tagId entities.TagId) (entities.TagProperties, error) {
+	return db.tagPropertiesWhere(func(propertyTagId entities.TagId) bool { return propertyTagId == tagId }), nil
+}
+
+// Sets the value of a tag property, adding the property if necessary.
+func (db *Database) UpdateTagProperty(tagId entities.TagId, name, value string) (*entities.TagProperty, error) {
+	if _, ok := db.data.tags[tagId]; !ok {
+		return nil, errForeignKey
+	}
+
+	key := tagPropertyKey{tagId, name}
+	db.removeTagProperty(key)
+	db.putTagProperty(key, value)
+
+	return &entities.TagProperty{tagId, name, value}, nil
+}
+
+// Deletes a tag property.
+func (db *Database) DeleteTagProperty(tagId entities.TagId, name string) error {
+	if !db.removeTagProperty(tagPropertyKey{tagId, name}) {
+		return database.NoSuchTagPropertyError{tagId, name}
+	}
+
+	return nil
+}
+
+// Copies the properties of one tag to another.
+func (db *Database) CopyTagProperties(sourceTagId, destTagId entities.TagId) error {
+	if _, ok := db.data.tags[destTagId]; !ok {
+		return errForeignKey
+	}
+
+	for _, property := range db.tagPropertiesWhere(func(tagId entities.TagId) bool { return tagId == sourceTagId }) {
+		key := tagPropertyKey{destTagId, property.Name}
+		if _, ok := db.data.properties[key]; ok {
+			return errUniqueTagProperty
+		}
+
+		db.putTagProperty(key, property.Value)
+	}
+
+	return nil
+}
+
+// unexported
+
+// Retrieves the properties of the tags satisfying the predicate in tag and name order.
+func (db *Database) tagPropertiesWhere(predicate func(entities.TagId) bool) entities.TagProperties {
+	properties := make(entities.TagProperties, 0, 10)
+	for key, value := range db.data.properties {
+		if predicate(key.tagId) {
+			properties = append(properties, &entities.TagProperty{key.tagId, key.name, value})
+		}
+	}
+	sort.Sort(properties)
+
+	return properties
+}
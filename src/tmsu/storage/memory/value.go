@@ -0,0 +1,169 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"tmsu/entities"
+	"tmsu/storage/database"
+)
+
+// Retrieves the count of values.
+func (db *Database) ValueCount() (uint, error) {
+	return uint(len(db.data.values)), nil
+}
+
+// Retrieves the complete set of values.
+func (db *Database) Values() (entities.Values, error) {
+	values := db.valuesWhere(func(*entities.Value) bool { return true })
+	sort.Sort(values)
+
+	return values, nil
+}
+
+// Retrieves a specific value.
+func (db *Database) Value(id entities.ValueId) (*entities.Value, error) {
+	value, ok := db.data.values[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return &value, nil
+}
+
+// Retrieves a specific set of values.
+func (db *Database) ValuesByIds(ids entities.ValueIds) (entities.Values, error) {
+	wanted := make(map[entities.ValueId]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	return db.valuesWhere(func(value *entities.Value) bool { return wanted[value.Id] }), nil
+}
+
+// Retrieves the set of unused values.
+func (db *Database) UnusedValues() (entities.Values, error) {
+	used := db.usedValueIds()
+
+	return db.valuesWhere(func(value *entities.Value) bool { return !used[value.Id] }), nil
+}
+
+// Retrieves a specific value by name.
+func (db *Database) ValueByName(name string) (*entities.Value, error) {
+	values := db.valuesWhere(func(value *entities.Value) bool { return value.Name == name })
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	return values[0], nil
+}
+
+// Retrieves the set of values with the specified names.
+func (db *Database) ValuesByNames(names []string) (entities.Values, error) {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	return db.valuesWhere(func(value *entities.Value) bool { return wanted[value.Name] }), nil
+}
+
+// Retrieves the set of values for the specified tag.
+func (db *Database) ValuesByTagId(tagId entities.TagId) (entities.Values, error) {
+	wanted := make(map[entities.ValueId]bool)
+	for key := range db.data.fileTags {
+		if key.tagId == tagId {
+			wanted[key.valueId] = true
+		}
+	}
+
+	values := db.valuesWhere(func(value *entities.Value) bool { return wanted[value.Id] })
+	sort.Sort(values)
+
+	return values, nil
+}
+
+// Adds a value.
+func (db *Database) InsertValue(name string) (*entities.Value, error) {
+	if existing, _ := db.ValueByName(name); existing != nil {
+		return nil, fmt.Errorf("value '%v' already exists", name)
+	}
+
+	value := entities.Value{db.data.lastValueId + 1, name}
+	db.putValue(value)
+
+	return &value, nil
+}
+
+// Deletes a value.
+func (db *Database) DeleteValue(valueId entities.ValueId) error {
+	if !db.removeValue(valueId) {
+		return database.NoSuchValueError{valueId}
+	}
+
+	return nil
+}
+
+// Deletes all unused values.
+func (db *Database) DeleteUnusedValues(valueIds entities.ValueIds) error {
+	used := db.usedValueIds()
+
+	for _, valueId := range valueIds {
+		if !used[valueId] {
+			db.removeValue(valueId)
+		}
+	}
+
+	return nil
+}
+
+// unexported
+
+// Retrieves the values satisfying the predicate in identifier order.
+func (db *Database) valuesWhere(predicate func(*entities.Value) bool) entities.Values {
+	ids := make(entities.ValueIds, 0, len(db.data.values))
+	for id := range db.data.values {
+		ids = append(ids, id)
+	}
+	sort.Sort(ids)
+
+	values := make(entities.Values, 0, 10)
+	for _, id := range ids {
+		value := db.data.values[id]
+		if predicate(&value) {
+			values = append(values, &value)
+		}
+	}
+
+	return values
+}
+
+func (db *Database) usedValueIds() map[entities.ValueId]bool {
+	used := make(map[entities.ValueId]bool)
+	for key := range db.data.fileTags {
+		used[key.valueId] = true
+	}
+
+	for key := range db.data.implications {
+		used[key.valueId] = true
+		used[key.impliedValueId] = true
+	}
+
+	return used
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"tmsu/entities"
+	"tmsu/query"
+)
+
+// Translates between the file paths stored in the database and the paths on this host.
+//
+// Files beneath the root directory are stored relative to it so that the database
+// continues to work when the root is moved. Other paths are stored absolute and are
+// rewritten using the host's path mappings, if any.
+type pathMapper struct {
+	root     string
+	mappings []pathMapping
+}
+
+type pathMapping struct {
+	stored string
+	local  string
+}
+
+// unexported
+
+// The name of the setting holding this host's path mappings.
+func pathMappingsSettingName() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("could not determine hostname: %v", err)
+	}
+
+	return "pathMappings." + hostname, nil
+}
+
+// Parses path mappings of the form 'STORED=LOCAL', separated by the list separator.
+func parsePathMappings(text string) ([]pathMapping, error) {
+	mappings := make([]pathMapping, 0, 1)
+
+	for _, entry := range filepath.SplitList(text) {
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || !filepath.IsAbs(parts[0]) || !filepath.IsAbs(parts[1]) {
+			return nil, fmt.Errorf("invalid path mapping '%v': expected 'STORED=LOCAL' with absolute paths", entry)
+		}
+
+		mappings = append(mappings, pathMapping{filepath.Clean(parts[0]), filepath.Clean(parts[1])})
+	}
+
+	return mappings, nil
+}
+
+func loadPathMapper(db Backend) (*pathMapper, error) {
+	mapper := &pathMapper{}
+
+	settingName, err := pathMappingsSettingName()
+	if err != nil {
+		return nil, err
+	}
+
+	setting, err := db.Setting(settingName)
+	if err != nil {
+		return nil, err
+	}
+	if setting != nil {
+		mapper.mappings, err = parsePathMappings(setting.Value)
+		if err != nil {
+			return nil, fmt.Errorf("setting '%v': %v", settingName, err)
+		}
+	}
+
+	setting, err = db.Setting("root")
+	if err != nil {
+		return nil, err
+	}
+	if setting != nil && setting.Value != "" {
+		if filepath.IsAbs(setting.Value) {
+			mapper.root = mapper.toLocal(filepath.Clean(setting.Value))
+		} else {
+			// a relative root is relative to the directory containing the database
+			databaseDir, err := filepath.Abs(filepath.Dir(db.Location()))
+			if err != nil {
+				return nil, fmt.Errorf("could not resolve database directory: %v", err)
+			}
+
+			mapper.root = filepath.Join(databaseDir, setting.Value)
+		}
+	}
+
+	return mapper, nil
+}
+
+// Converts a stored path to the corresponding absolute path on this host.
+func (mapper *pathMapper) toLocal(path string) string {
+	if !filepath.IsAbs(path) {
+		return filepath.Join(mapper.root, path)
+	}
+
+	for _, mapping := range mapper.mappings {
+		if rest, ok := trimPathPrefix(path, mapping.stored); ok {
+			return filepath.Join(mapping.local, rest)
+		}
+	}
+
+	return path
+}
+
+// Converts an absolute path on this host to the form in which it is stored.
+func (mapper *pathMapper) toStored(path string) string {
+	if path == "" {
+		return path
+	}
+
+	if mapper.root != "" {
+		if rest, ok := trimPathPrefix(path, mapper.root); ok && rest != "" {
+			return rest
+		}
+	}
+
+	for _, mapping := range mapper.mappings {
+		if rest, ok := trimPathPrefix(path, mapping.local); ok {
+			return filepath.Join(mapping.stored, rest)
+		}
+	}
+
+	return path
+}
+
+// Converts the path by which a query is scoped to the form in which it is stored.
+//
+// When the path contains the root directory the files beneath the root, which are stored
+// relative to it, cannot be matched by path in the database. In this case the query is
+// left unscoped and the results must be filtered instead.
+func (mapper *pathMapper) toStoredScope(path string) (string, bool) {
+	if path == "" || mapper.root == "" {
+		return mapper.toStored(path), false
+	}
+
+	if _, ok := trimPathPrefix(mapper.root, filepath.Clean(path)); ok {
+		return "", true
+	}
+
+	return mapper.toStored(path), false
+}
+
+// Converts each of the paths by which a query is scoped to the form in which it is
+// stored. Should any path require the results to be filtered then the query is left
+// unscoped in its entirety.
+func (mapper *pathMapper) toStoredPathScope(scope query.PathScope) (query.PathScope, bool) {
+	stored := query.PathScope{make([]string, len(scope.Include)), make([]string, len(scope.Exclude))}
+
+	for index, path := range scope.Include {
+		storedPath, filter := mapper.toStoredScope(path)
+		if filter {
+			return query.PathScope{}, true
+		}
+
+		stored.Include[index] = storedPath
+	}
+
+	for index, path := range scope.Exclude {
+		storedPath, filter := mapper.toStoredScope(path)
+		if filter {
+			return query.PathScope{}, true
+		}
+
+		stored.Exclude[index] = storedPath
+	}
+
+	return stored, false
+}
+
+func (mapper *pathMapper) mapFile(file *entities.File) *entities.File {
+	if file != nil {
+		file.Directory = mapper.toLocal(file.Directory)
+	}
+
+	return file
+}
+
+func (mapper *pathMapper) mapFiles(files entities.Files) entities.Files {
+	for _, file := range files {
+		mapper.mapFile(file)
+	}
+
+	return files
+}
+
+// Retains only those files that lie within the specified scope.
+func filterFilesByScope(files entities.Files, scope query.PathScope) entities.Files {
+	filtered := make(entities.Files, 0, len(files))
+	for _, file := range files {
+		if scope.Contains(file.Path()) {
+			filtered = append(filtered, file)
+		}
+	}
+
+	return filtered
+}
+
+// Retains only those files whose directory is, or is beneath, the specified path.
+func filterFilesByDirectory(files entities.Files, path string) entities.Files {
+	path = filepath.Clean(path)
+
+	filtered := make(entities.Files, 0, len(files))
+	for _, file := range files {
+		if _, ok := trimPathPrefix(file.Directory, path); ok {
+			filtered = append(filtered, file)
+		}
+	}
+
+	return filtered
+}
+
+// Removes the directory prefix from the path, returning the remainder relative to it.
+func trimPathPrefix(path, prefix string) (string, bool) {
+	path = filepath.Clean(path)
+
+	if path == prefix {
+		return "", true
+	}
+
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+
+	if strings.HasPrefix(path, prefix) {
+		return path[len(prefix):], true
+	}
+
+	return "", false
+}
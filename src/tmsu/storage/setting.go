@@ -19,6 +19,8 @@ package storage
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"tmsu/entities"
 )
 
@@ -41,6 +43,8 @@ func (storage *Storage) Setting(name string) (*entities.Setting, error) {
 			return &entities.Setting{name, "dynamic:SHA256"}, nil
 		case "autoCreateTags", "autoCreateValues":
 			return &entities.Setting{name, "yes"}, nil
+		case "autoBackups":
+			return &entities.Setting{name, "0"}, nil
 		}
 	}
 
@@ -80,3 +84,62 @@ func (storage *Storage) SettingAsBool(name string) (bool, error) {
 
 	}
 }
+
+// Updates the specified setting.
+//
+// Changing the root re-stores the path of every file so that those beneath the new root
+// become relative to it.
+func (storage *Storage) UpdateSetting(name, value string) (*entities.Setting, error) {
+	if err := validateSetting(name, value); err != nil {
+		return nil, err
+	}
+
+	var files entities.Files
+	if name == "root" {
+		var err error
+		files, err = storage.Files()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	setting, err := storage.Db.UpdateSetting(name, value)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := loadPathMapper(storage.Db)
+	if err != nil {
+		return nil, err
+	}
+	storage.paths = paths
+
+	for _, file := range files {
+		if _, err := storage.UpdateFile(file.Id, file.Path(), file.Fingerprint, file.ModTime, file.Size, file.IsDir); err != nil {
+			return nil, fmt.Errorf("could not update path of file #%v: %v", file.Id, err)
+		}
+	}
+
+	return setting, nil
+}
+
+// unexported
+
+func validateSetting(name, value string) error {
+	switch {
+	case name == "autoCreateTags", name == "autoCreateValues":
+		if value != "yes" && value != "no" {
+			return fmt.Errorf("setting '%v' must be 'yes' or 'no'.", name)
+		}
+	case name == "autoBackups":
+		if _, err := strconv.ParseUint(value, 10, 0); err != nil {
+			return fmt.Errorf("setting '%v' must be a number.", name)
+		}
+	case strings.HasPrefix(name, "pathMappings."):
+		if _, err := parsePathMappings(value); err != nil {
+			return fmt.Errorf("setting '%v': %v", name, err)
+		}
+	}
+
+	return nil
+}
@@ -19,11 +19,17 @@ package storage
 
 import (
 	"fmt"
+	"path/filepath"
+	"tmsu/entities"
 	"tmsu/storage/database"
 )
 
 type Storage struct {
-	Db *database.Database
+	Db Backend
+
+	// unexported
+	paths     *pathMapper
+	operation *entities.Operation
 }
 
 func Open() (*Storage, error) {
@@ -32,7 +38,7 @@ func Open() (*Storage, error) {
 		return nil, fmt.Errorf("could not open database: %v", err)
 	}
 
-	return &Storage{db}, nil
+	return newStorage(db)
 }
 
 func OpenAt(path string) (*Storage, error) {
@@ -41,21 +47,75 @@ func OpenAt(path string) (*Storage, error) {
 		return nil, fmt.Errorf("could not open database at '%v': %v", path, err)
 	}
 
-	return &Storage{db}, nil
+	return newStorage(db)
+}
+
+// Creates storage upon the specified backend, such as an in-memory database.
+func New(backend Backend) (*Storage, error) {
+	return newStorage(backend)
 }
 
 func (storage *Storage) Begin() error {
 	return storage.Db.Begin()
 }
 
+// Begins a transaction that will write to the storage, locking out other writers until it
+// is committed or rolled back.
+func (storage *Storage) BeginWrite() error {
+	return storage.Db.BeginWrite()
+}
+
+// Commits the transaction, attributing the changes made within it to a new operation
+// in the journal.
 func (storage *Storage) Commit() error {
+	if err := storage.recordOperation(); err != nil {
+		storage.Db.Rollback()
+		storage.operation = nil
+		return fmt.Errorf("could not record operation: %v", err)
+	}
+
+	storage.operation = nil
+
 	return storage.Db.Commit()
 }
 
 func (storage *Storage) Rollback() error {
+	storage.operation = nil
+
 	return storage.Db.Rollback()
 }
 
+// The root directory that file paths are stored relative to, if any.
+func (storage *Storage) Root() string {
+	return storage.paths.root
+}
+
+// Converts a path to be relative to the root directory if it lies beneath it.
+func (storage *Storage) RootRelativePath(path string) string {
+	if storage.paths.root == "" {
+		return path
+	}
+
+	if rest, ok := trimPathPrefix(path, storage.paths.root); ok && rest != "" {
+		return rest
+	}
+
+	return path
+}
+
+// Resolves a path relative to the root directory to an absolute path.
+func (storage *Storage) ResolveRootRelativePath(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+
+	if storage.paths.root == "" {
+		return "", fmt.Errorf("relative path cannot be resolved as the database has no root directory")
+	}
+
+	return filepath.Join(storage.paths.root, path), nil
+}
+
 func (storage *Storage) Close() error {
 	err := storage.Db.Close()
 	if err != nil {
@@ -64,3 +124,15 @@ func (storage *Storage) Close() error {
 
 	return nil
 }
+
+// unexported
+
+func newStorage(db Backend) (*Storage, error) {
+	paths, err := loadPathMapper(db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not load path settings: %v", err)
+	}
+
+	return &Storage{db, paths, nil}, nil
+}
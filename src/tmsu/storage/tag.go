@@ -20,6 +20,7 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"tmsu/entities"
 	"unicode"
 )
@@ -44,19 +45,88 @@ func (storage Storage) TagsByIds(ids entities.TagIds) (entities.Tags, error) {
 	return storage.Db.TagsByIds(ids)
 }
 
-// Retrieves a specific tag.
+// Retrieves a specific tag by its name or by one of its aliases.
 func (storage Storage) TagByName(name string) (*entities.Tag, error) {
-	return storage.Db.TagByName(name)
+	tag, err := storage.Db.TagByName(name)
+	if err != nil || tag != nil {
+		return tag, err
+	}
+
+	alias, err := storage.Db.AliasByName(name)
+	if err != nil || alias == nil {
+		return nil, err
+	}
+
+	return &alias.Tag, nil
 }
 
-// Retrieves the set of named tags.
+// Retrieves the set of tags with the specified names or aliases.
 func (storage Storage) TagsByNames(names []string) (entities.Tags, error) {
-	return storage.Db.TagsByNames(names)
+	tagNames, err := storage.resolveTagNames(names)
+	if err != nil {
+		return nil, err
+	}
+
+	return storage.Db.TagsByNames(tagNames)
+}
+
+// Identifies the names that are neither the name nor an alias of a tag.
+func (storage Storage) UnknownTagNames(names []string) ([]string, error) {
+	tagNames, err := storage.resolveTagNames(names)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := storage.Db.TagsByNames(tagNames)
+	if err != nil {
+		return nil, err
+	}
+
+	unknown := make([]string, 0, len(names))
+	for index, name := range names {
+		if !tags.ContainsName(tagNames[index]) {
+			unknown = append(unknown, name)
+		}
+	}
+
+	if len(unknown) == 0 {
+		return unknown, nil
+	}
+
+	// a namespace is known if there are tags beneath it
+	allTags, err := storage.Db.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	stillUnknown := make([]string, 0, len(unknown))
+	for _, name := range unknown {
+		if len(descendantTags(allTags, name)) == 0 {
+			stillUnknown = append(stillUnknown, name)
+		}
+	}
+
+	return stillUnknown, nil
+}
+
+// Retrieves the tags that lie beneath the specified tag or namespace in the hierarchy.
+func (storage Storage) DescendantTags(name string) (entities.Tags, error) {
+	tags, err := storage.Db.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	return descendantTags(tags, name), nil
+}
+
+// Retrieves the tags that share their name with another tag.
+func (storage Storage) DuplicateTags() (entities.Tags, error) {
+	return storage.Db.DuplicateTags()
 }
 
 // Adds a tag.
 func (storage *Storage) AddTag(name string) (*entities.Tag, error) {
-	if err := validateTagName(name); err != nil {
+	if err := storage.validateNewTagName(name); err != nil {
 		return nil, err
 	}
 
@@ -65,7 +135,7 @@ func (storage *Storage) AddTag(name string) (*entities.Tag, error) {
 
 // Renames a tag.
 func (storage Storage) RenameTag(tagId entities.TagId, name string) (*entities.Tag, error) {
-	if err := validateTagName(name); err != nil {
+	if err := storage.validateNewTagName(name); err != nil {
 		return nil, err
 	}
 
@@ -74,7 +144,7 @@ func (storage Storage) RenameTag(tagId entities.TagId, name string) (*entities.T
 
 // Copies a tag.
 func (storage Storage) CopyTag(sourceTagId entities.TagId, name string) (*entities.Tag, error) {
-	if err := validateTagName(name); err != nil {
+	if err := storage.validateNewTagName(name); err != nil {
 		return nil, err
 	}
 
@@ -88,12 +158,19 @@ func (storage Storage) CopyTag(sourceTagId entities.TagId, name string) (*entiti
 		return nil, fmt.Errorf("could not copy file tags for tag #%v to tag '%v': %v", sourceTagId, name, err)
 	}
 
+	err = storage.Db.CopyTagProperties(sourceTagId, tag.Id)
+	if err != nil {
+		return nil, fmt.Errorf("could not copy properties of tag #%v to tag '%v': %v", sourceTagId, name, err)
+	}
+
 	return tag, nil
 }
 
 // Deletes a tag.
+//
+// The tag's file tags, implications and aliases are removed by the database's cascading deletes.
 func (storage Storage) DeleteTag(tagId entities.TagId) error {
-	err := storage.DeleteFileTagsByTagId(tagId)
+	fileTags, err := storage.Db.FileTagsByTagId(tagId)
 	if err != nil {
 		return err
 	}
@@ -103,6 +180,14 @@ func (storage Storage) DeleteTag(tagId entities.TagId) error {
 		return fmt.Errorf("could not delete tag '%v': %v", tagId, err)
 	}
 
+	if err := storage.DeleteUntaggedFiles(fileTags.FileIds()); err != nil {
+		return err
+	}
+
+	if err := storage.DeleteUnusedValues(fileTags.ValueIds()); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -111,8 +196,41 @@ func (storage Storage) TagUsage() ([]entities.TagFileCount, error) {
 	return storage.Db.TagUsage()
 }
 
+// Checks that the tag name is valid.
+func ValidateTagName(name string) error {
+	return validateTagName(name)
+}
+
 // unexported
 
+// Checks that the name is valid and not already in use as an alias.
+func (storage Storage) validateNewTagName(name string) error {
+	if err := validateTagName(name); err != nil {
+		return err
+	}
+
+	alias, err := storage.Db.AliasByName(name)
+	if err != nil {
+		return err
+	}
+	if alias != nil {
+		return fmt.Errorf("'%v' is an alias of tag '%v'.", name, alias.Tag.Name)
+	}
+
+	return nil
+}
+
+func descendantTags(tags entities.Tags, name string) entities.Tags {
+	descendants := make(entities.Tags, 0, 10)
+	for _, tag := range tags {
+		if entities.IsDescendantTagName(tag.Name, name) {
+			descendants = append(descendants, tag)
+		}
+	}
+
+	return descendants
+}
+
 var validTagChars = []*unicode.RangeTable{unicode.Letter, unicode.Number, unicode.Punct, unicode.Symbol}
 
 func validateTagName(tagName string) error {
@@ -131,6 +249,14 @@ func validateTagName(tagName string) error {
 		return errors.New("tag name cannot start with a minus: '-'.") // used in query language
 	}
 
+	if strings.HasPrefix(tagName, entities.TagNamespaceSeparator) || strings.HasSuffix(tagName, entities.TagNamespaceSeparator) {
+		return errors.New("tag name cannot start or end with a colon: ':'.") // separates the levels of the hierarchy
+	}
+
+	if strings.Contains(tagName, entities.TagNamespaceSeparator+entities.TagNamespaceSeparator) {
+		return errors.New("tag name cannot contain an empty level: '::'.") // separates the levels of the hierarchy
+	}
+
 	for _, ch := range tagName {
 		switch ch {
 		case '(', ')':
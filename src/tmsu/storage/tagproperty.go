@@ -0,0 +1,153 @@
+/*
+Copyright 2011-2014 Paul Ruane.
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>.
+*/
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"tmsu/common/terminal/ansi"
+	"tmsu/entities"
+)
+
+// The complete set of tag properties.
+func (storage *Storage) TagProperties() (entities.TagProperties, error) {
+	return storage.Db.TagProperties()
+}
+
+// Retrieves the properties of the specified tag.
+func (storage *Storage) TagPropertiesByTagId(tagId entities.TagId) (entities.TagProperties, error) {
+	return storage.Db.TagPropertiesByTagId(tagId)
+}
+
+// Sets the value of a tag property, such as its description or colour.
+func (storage *Storage) SetTagProperty(tagId entities.TagId, name, value string) (*entities.TagProperty, error) {
+	if err := validateTagPropertyName(name); err != nil {
+		return nil, err
+	}
+
+	if value == "" {
+		return nil, fmt.Errorf("the value of property '%v' cannot be empty.", name)
+	}
+
+	if name == entities.TagTypeProperty {
+		if err := storage.validateValueType(tagId, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if name == entities.TagColourProperty {
+		if _, ok := ansi.ColourCode(value); !ok {
+			return nil, fmt.Errorf("unknown colour '%v': valid colours are %v.", value, strings.Join(ansi.ColourNames(), ", "))
+		}
+	}
+
+	return storage.Db.UpdateTagProperty(tagId, name, value)
+}
+
+// Removes a tag property.
+func (storage *Storage) RemoveTagProperty(tagId entities.TagId, name string) error {
+	return storage.Db.DeleteTagProperty(tagId, name)
+}
+
+// Retrieves the declared type of the tag's values, if any.
+func (storage *Storage) ValueType(tagId entities.TagId) (entities.ValueType, error) {
+	properties, err := storage.Db.TagPropertiesByTagId(tagId)
+	if err != nil {
+		return "", err
+	}
+
+	return entities.ValueType(properties.Value(entities.TagTypeProperty)), nil
+}
+
+// Checks that the value is valid for the declared type of the tag's values.
+func (storage *Storage) ValidateTagValue(tagId entities.TagId, valueName string) error {
+	if valueName == "" {
+		return nil
+	}
+
+	valueType, err := storage.ValueType(tagId)
+	if err != nil {
+		return err
+	}
+	if valueType == "" {
+		return nil
+	}
+
+	return valueType.Validate(valueName)
+}
+
+// unexported
+
+// Checks that the type is valid and that the tag's existing values conform to it.
+func (storage *Storage) validateValueType(tagId entities.TagId, name string) error {
+	valueType, err := entities.ParseValueType(name)
+	if err != nil {
+		return err
+	}
+
+	values, err := storage.Db.ValuesByTagId(tagId)
+	if err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		if err := valueType.Validate(value.Name); err != nil {
+			return fmt.Errorf("the tag has values that are not of type '%v': %v.", valueType, err)
+		}
+	}
+
+	return nil
+}
+
+// Retrieves the declared types of the tags' values, keyed by tag name.
+func (storage *Storage) valueTypesByTagName() (map[string]entities.ValueType, error) {
+	properties, err := storage.Db.TagProperties()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve tag properties: %v", err)
+	}
+
+	valueTypes := make(map[string]entities.ValueType)
+	for _, property := range properties {
+		if property.Name != entities.TagTypeProperty {
+			continue
+		}
+
+		tag, err := storage.Db.Tag(property.TagId)
+		if err != nil {
+			return nil, fmt.Errorf("could not retrieve tag #%v: %v", property.TagId, err)
+		}
+		if tag != nil {
+			valueTypes[tag.Name] = entities.ValueType(property.Value)
+		}
+	}
+
+	return valueTypes, nil
+}
+
+func validateTagPropertyName(name string) error {
+	if name == "" {
+		return errors.New("property name cannot be empty.")
+	}
+
+	if strings.ContainsAny(name, "= \t") {
+		return errors.New("property names cannot contain '=', space or tab.")
+	}
+
+	return nil
+}
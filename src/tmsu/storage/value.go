@@ -20,6 +20,7 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"tmsu/entities"
 	"unicode"
 )
@@ -59,8 +60,23 @@ func (storage *Storage) ValueByName(name string) (*entities.Value, error) {
 }
 
 // Retrieves the set of values for the specified tag.
+//
+// The values are ordered according to the declared type of the tag's values, if any.
 func (storage *Storage) ValuesByTag(tagId entities.TagId) (entities.Values, error) {
-	return storage.Db.ValuesByTagId(tagId)
+	values, err := storage.Db.ValuesByTagId(tagId)
+	if err != nil {
+		return nil, err
+	}
+
+	valueType, err := storage.ValueType(tagId)
+	if err != nil {
+		return nil, err
+	}
+	if valueType != "" {
+		sort.Stable(valuesByType{values, valueType})
+	}
+
+	return values, nil
 }
 
 // Retrieves the set of values with the specified names.
@@ -78,38 +94,19 @@ func (storage *Storage) AddValue(name string) (*entities.Value, error) {
 }
 
 // Deletes a value.
+//
+// The value's file tags are removed by the database's cascading deletes.
 func (storage *Storage) DeleteValue(valueId entities.ValueId) error {
-	fileTags, err := storage.FileTagsByValueId(valueId)
-	if err != nil {
-		return err
-	}
-
-	for _, fileTag := range fileTags {
-		if err := storage.Db.DeleteFileTag(fileTag.FileId, fileTag.TagId, fileTag.ValueId); err != nil {
-			return err
-		}
-	}
-
 	return storage.Db.DeleteValue(valueId)
 }
 
-// Deletes the value if it is unused.
+// Deletes the value if it is used by neither a tagging nor an implication.
 func (storage *Storage) DeleteValueIfUnused(valueId entities.ValueId) error {
 	if valueId == 0 {
 		return nil
 	}
 
-	count, err := storage.FileTagCountByValueId(valueId)
-	if err != nil {
-		return err
-	}
-	if count == 0 {
-		if err := storage.Db.DeleteValue(valueId); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return storage.Db.DeleteUnusedValues(entities.ValueIds{valueId})
 }
 
 // Deletes unused values.
@@ -117,8 +114,30 @@ func (storage *Storage) DeleteUnusedValues(valueIds entities.ValueIds) error {
 	return storage.Db.DeleteUnusedValues(valueIds)
 }
 
+// Checks that the value name is valid.
+func ValidateValueName(name string) error {
+	return validateValueName(name)
+}
+
 // unexported
 
+type valuesByType struct {
+	values    entities.Values
+	valueType entities.ValueType
+}
+
+func (sorter valuesByType) Len() int {
+	return len(sorter.values)
+}
+
+func (sorter valuesByType) Swap(i, j int) {
+	sorter.values[i], sorter.values[j] = sorter.values[j], sorter.values[i]
+}
+
+func (sorter valuesByType) Less(i, j int) bool {
+	return sorter.valueType.Compare(sorter.values[i].Name, sorter.values[j].Name) < 0
+}
+
 var validValueChars = []*unicode.RangeTable{unicode.Letter, unicode.Number, unicode.Punct, unicode.Symbol}
 
 func validateValueName(valueName string) error {
@@ -28,6 +28,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 	"tmsu/common/log"
@@ -39,6 +40,7 @@ import (
 const tagsDir = "tags"
 const queriesDir = "queries"
 const queryHelpFilename = "README.md"
+const tagDescriptionFilename = "README"
 const queryDirHelp = `Query Directories
 -----------------
 
@@ -54,6 +56,12 @@ match the query. (It is not necessary to create the directory first.)
     $ ls
     cheese and (tomato or mushroom)  cheese and wine 
 
+Queries are written as for the 'files' subcommand so, for example, the files
+awaiting review can be listed with:
+
+    $ ls "photo and tagcount < 3"
+    $ ls "only(photo, raw)"
+
 You can even create new queries by typing the query into the file chooser of a
 graphical program.
 
@@ -64,6 +72,7 @@ type FuseVfs struct {
 	store     *storage.Storage
 	mountPath string
 	server    *fuse.Server
+	lock      *sync.Mutex // serialises the per-operation transactions
 }
 
 func MountVfs(store *storage.Storage, mountPath string, options []string) (*FuseVfs, error) {
@@ -80,6 +89,7 @@ func MountVfs(store *storage.Storage, mountPath string, options []string) (*Fuse
 	fuseVfs.store = store
 	fuseVfs.mountPath = mountPath
 	fuseVfs.server = server
+	fuseVfs.lock = &sync.Mutex{}
 
 	return &fuseVfs, nil
 }
@@ -128,6 +138,15 @@ func (vfs FuseVfs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse
 	log.Infof(2, "BEGIN GetAttr(%v)", name)
 	defer log.Infof(2, "END GetAttr(%v)", name)
 
+	// attributes of a query directory are looked up when it is created
+	path := vfs.splitPath(name)
+	isQuery := len(path) == 2 && path[0] == queriesDir
+
+	if status := vfs.begin(isQuery); status != fuse.OK {
+		return nil, status
+	}
+	defer vfs.end()
+
 	switch name {
 	case "":
 		fallthrough
@@ -137,8 +156,6 @@ func (vfs FuseVfs) GetAttr(name string, context *fuse.Context) (*fuse.Attr, fuse
 		return vfs.getQueryAttr()
 	}
 
-	path := vfs.splitPath(name)
-
 	switch path[0] {
 	case tagsDir:
 		return vfs.getTaggedEntryAttr(path[1:])
@@ -180,6 +197,11 @@ func (vfs FuseVfs) Mkdir(name string, mode uint32, context *fuse.Context) fuse.S
 		return fuse.EPERM
 	}
 
+	if status := vfs.begin(true); status != fuse.OK {
+		return status
+	}
+	defer vfs.end()
+
 	switch path[0] {
 	case tagsDir:
 		name := path[1]
@@ -221,6 +243,19 @@ func (vfs FuseVfs) Open(name string, flags uint32, context *fuse.Context) (nodef
 		return nodefs.NewDataFile([]byte(queryDirHelp)), fuse.OK
 	}
 
+	path := vfs.splitPath(name)
+	if len(path) > 2 && path[0] == tagsDir && path[len(path)-1] == tagDescriptionFilename {
+		if status := vfs.begin(false); status != fuse.OK {
+			return nil, status
+		}
+		defer vfs.end()
+
+		description := vfs.tagDescription(joinNamespaces(path[1 : len(path)-1]))
+		if description != "" {
+			return nodefs.NewDataFile([]byte(description + "\n")), fuse.OK
+		}
+	}
+
 	return nil, fuse.ENOSYS
 }
 
@@ -228,6 +263,11 @@ func (vfs FuseVfs) OpenDir(name string, context *fuse.Context) ([]fuse.DirEntry,
 	log.Infof(2, "BEGIN OpenDir(%v)", name)
 	defer log.Infof(2, "END OpenDir(%v)", name)
 
+	if status := vfs.begin(false); status != fuse.OK {
+		return nil, status
+	}
+	defer vfs.end()
+
 	switch name {
 	case "":
 		return vfs.topDirectories()
@@ -252,6 +292,11 @@ func (vfs FuseVfs) Readlink(name string, context *fuse.Context) (string, fuse.St
 	log.Infof(2, "BEGIN Readlink(%v)", name)
 	defer log.Infof(2, "END Readlink(%v)", name)
 
+	if status := vfs.begin(false); status != fuse.OK {
+		return "", status
+	}
+	defer vfs.end()
+
 	path := vfs.splitPath(name)
 	switch path[0] {
 	case tagsDir, queriesDir:
@@ -286,6 +331,11 @@ func (vfs FuseVfs) Rename(oldName string, newName string, context *fuse.Context)
 	oldTagName := oldPath[1]
 	newTagName := newPath[1]
 
+	if status := vfs.begin(true); status != fuse.OK {
+		return status
+	}
+	defer vfs.end()
+
 	tag, err := vfs.store.TagByName(oldTagName)
 	if err != nil {
 		log.Fatalf("could not retrieve tag '%v': %v", oldTagName, err)
@@ -305,6 +355,11 @@ func (vfs FuseVfs) Rmdir(name string, context *fuse.Context) fuse.Status {
 	log.Infof(2, "BEGIN Rmdir(%v)", name)
 	defer log.Infof(2, "END Rmdir(%v)", name)
 
+	if status := vfs.begin(true); status != fuse.OK {
+		return status
+	}
+	defer vfs.end()
+
 	path := vfs.splitPath(name)
 
 	switch path[0] {
@@ -396,6 +451,11 @@ func (vfs FuseVfs) Unlink(name string, context *fuse.Context) fuse.Status {
 		return fuse.EPERM
 	}
 
+	if status := vfs.begin(true); status != fuse.OK {
+		return status
+	}
+	defer vfs.end()
+
 	file, err := vfs.store.File(fileId)
 	if err != nil {
 		log.Fatal("could not retrieve file '%v': %v", fileId, err)
@@ -408,6 +468,7 @@ func (vfs FuseVfs) Unlink(name string, context *fuse.Context) fuse.Status {
 
 	switch path[0] {
 	case tagsDir:
+		path = append(joinNamespaces(path[:len(path)-1]), path[len(path)-1])
 		dirName := path[len(path)-2]
 
 		var tagName, valueName string
@@ -453,6 +514,34 @@ func (vfs FuseVfs) Utimens(name string, Atime *time.Time, Mtime *time.Time, cont
 
 // unexported
 
+// Begins the transaction for a single file-system operation, so that the database is only
+// locked whilst the operation is in progress.
+func (vfs FuseVfs) begin(write bool) fuse.Status {
+	vfs.lock.Lock()
+
+	begin := vfs.store.Begin
+	if write {
+		begin = vfs.store.BeginWrite
+	}
+
+	if err := begin(); err != nil {
+		vfs.lock.Unlock()
+		log.Warnf("could not begin transaction: %v", err)
+		return fuse.EAGAIN
+	}
+
+	return fuse.OK
+}
+
+// Ends the transaction begun by begin, committing any changes.
+func (vfs FuseVfs) end() {
+	if err := vfs.store.Commit(); err != nil {
+		log.Warnf("could not commit transaction: %v", err)
+	}
+
+	vfs.lock.Unlock()
+}
+
 func (vfs FuseVfs) splitPath(path string) []string {
 	return strings.Split(path, string(filepath.Separator))
 }
@@ -494,9 +583,15 @@ func (vfs FuseVfs) tagDirectories() ([]fuse.DirEntry, fuse.Status) {
 		log.Fatalf("Could not retrieve tags: %v", err)
 	}
 
-	entries := make([]fuse.DirEntry, len(tags))
-	for index, tag := range tags {
-		entries[index] = fuse.DirEntry{Name: tag.Name, Mode: fuse.S_IFDIR}
+	// hierarchical tags are shown beneath the top level of their namespace
+	entries := make([]fuse.DirEntry, 0, len(tags))
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		name := entities.TagNameLevels(tag.Name)[0]
+		if !containsString(names, name) {
+			names = append(names, name)
+			entries = append(entries, fuse.DirEntry{Name: name, Mode: fuse.S_IFDIR})
+		}
 	}
 
 	return entries, fuse.OK
@@ -555,19 +650,27 @@ func (vfs FuseVfs) getTaggedEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
 		return vfs.getFileEntryAttr(fileId)
 	}
 
+	if name == tagDescriptionFilename && len(path) > 1 {
+		description := vfs.tagDescription(joinNamespaces(path[:len(path)-1]))
+		if description != "" {
+			now := time.Now()
+			return &fuse.Attr{Mode: fuse.S_IFREG | 0444, Nlink: 1, Size: uint64(len(description) + 1), Mtime: uint64(now.Unix()), Mtimensec: uint32(now.Nanosecond())}, fuse.OK
+		}
+	}
+
 	tagNames := make([]string, 0, len(path))
-	for _, pathElement := range path {
+	for _, pathElement := range joinNamespaces(path) {
 		if pathElement[0] != '=' {
 			tagNames = append(tagNames, pathElement)
 		}
 	}
 
-	// tag directory
-	tagIds, err := vfs.tagNamesToIds(tagNames)
+	// tag or namespace directory
+	unknownTagNames, err := vfs.store.UnknownTagNames(tagNames)
 	if err != nil {
-		log.Fatalf("could not lookup tag IDs: %v.", err)
+		log.Fatalf("could not retrieve tags: %v.", err)
 	}
-	if tagIds == nil {
+	if len(unknownTagNames) > 0 {
 		return nil, fuse.ENOENT
 	}
 
@@ -607,12 +710,12 @@ func (vfs FuseVfs) getQueryEntryAttr(path []string) (*fuse.Attr, fuse.Status) {
 		return nil, fuse.ENOENT
 	}
 
-	tagNames := query.TagNames(expression)
-	tags, err := vfs.store.TagsByNames(tagNames)
-	for _, tagName := range tagNames {
-		if !containsTag(tags, tagName) {
-			return nil, fuse.ENOENT
-		}
+	unknownTagNames, err := vfs.store.UnknownTagNames(query.TagNames(expression))
+	if err != nil {
+		log.Fatalf("could not retrieve tags: %v", err)
+	}
+	if len(unknownTagNames) > 0 {
+		return nil, fuse.ENOENT
 	}
 
 	q, err := vfs.store.Query(queryText)
@@ -657,8 +760,10 @@ func (vfs FuseVfs) openTaggedEntryDir(path []string) ([]fuse.DirEntry, fuse.Stat
 	log.Infof(2, "BEGIN openTaggedEntryDir(%v)", path)
 	defer log.Infof(2, "END openTaggedEntryDir(%v)", path)
 
+	path = joinNamespaces(path)
+
 	expression := pathToExpression(path)
-	files, err := vfs.store.QueryFiles(expression, "", false)
+	files, err := vfs.store.QueryFiles(expression, query.PathScope{}, false)
 	if err != nil {
 		log.Fatalf("could not query files: %v", err)
 	}
@@ -682,10 +787,25 @@ func (vfs FuseVfs) openTaggedEntryDir(path []string) ([]fuse.DirEntry, fuse.Stat
 		log.Fatalf("could not retrieve further tags: %v", err)
 	}
 
+	// further tags are shown by the top level of their namespace and the levels
+	// beneath the current tag are shown as ':LEVEL' directories
 	entries := make([]fuse.DirEntry, 0, len(files)+len(furtherTagNames))
+	names := make([]string, 0, len(furtherTagNames))
 	for _, tagName := range furtherTagNames {
-		if !containsString(path, tagName) {
-			entries = append(entries, fuse.DirEntry{Name: tagName, Mode: fuse.S_IFDIR | 0755})
+		var name string
+		if lastPathElement[0] != '=' && entities.IsDescendantTagName(tagName, lastPathElement) {
+			childName := tagName[len(lastPathElement)+len(entities.TagNamespaceSeparator):]
+			name = entities.TagNamespaceSeparator + entities.TagNameLevels(childName)[0]
+		} else {
+			name = entities.TagNameLevels(tagName)[0]
+			if containsString(path, name) {
+				continue
+			}
+		}
+
+		if !containsString(names, name) {
+			names = append(names, name)
+			entries = append(entries, fuse.DirEntry{Name: name, Mode: fuse.S_IFDIR | 0755})
 		}
 	}
 
@@ -693,6 +813,10 @@ func (vfs FuseVfs) openTaggedEntryDir(path []string) ([]fuse.DirEntry, fuse.Stat
 		entries = append(entries, fuse.DirEntry{Name: "=" + valueName, Mode: fuse.S_IFDIR | 0755})
 	}
 
+	if vfs.tagDescription(path) != "" {
+		entries = append(entries, fuse.DirEntry{Name: tagDescriptionFilename, Mode: fuse.S_IFREG})
+	}
+
 	for _, file := range files {
 		linkName := vfs.getLinkName(file)
 		entries = append(entries, fuse.DirEntry{Name: linkName, Mode: fuse.S_IFLNK})
@@ -712,15 +836,17 @@ func (vfs FuseVfs) openQueryEntryDir(path []string) ([]fuse.DirEntry, fuse.Statu
 		return nil, fuse.ENOENT
 	}
 
-	tagNames := query.TagNames(expression)
-	tags, err := vfs.store.TagsByNames(tagNames)
-	for _, tagName := range tagNames {
-		if !containsTag(tags, tagName) {
-			return nil, fuse.ENOENT
-		}
+	unknownTagNames, err := vfs.store.UnknownTagNames(query.TagNames(expression))
+	if err != nil {
+		log.Fatalf("could not retrieve tags: %v", err)
+	}
+	if len(unknownTagNames) > 0 {
+		return nil, fuse.ENOENT
 	}
 
-	files, err := vfs.store.QueryFiles(expression, "", false)
+	// entries link to files by their identifier so paths that are not in the database,
+	// which 'untagged' would otherwise match, cannot be listed
+	files, err := vfs.store.QueryFiles(expression, query.PathScope{}, false)
 	if err != nil {
 		log.Fatalf("could not query files: %v", err)
 	}
@@ -766,22 +892,36 @@ func (vfs FuseVfs) getLinkName(file *entities.File) string {
 	return linkName + suffix
 }
 
-func (vfs FuseVfs) tagNamesToIds(tagNames []string) (entities.TagIds, error) {
-	tagIds := make(entities.TagIds, len(tagNames))
+// Retrieves the description of the tag whose directory is at the end of the path, if any.
+func (vfs FuseVfs) tagDescription(path []string) string {
+	tagName := path[len(path)-1]
+	if tagName[0] == '=' {
+		return ""
+	}
 
-	for index, tagName := range tagNames {
-		tag, err := vfs.store.TagByName(tagName)
-		if err != nil {
-			return nil, fmt.Errorf("could not retrieve tag '%v': %v", tagName, err)
-		}
-		if tag == nil {
-			return nil, nil
-		}
+	// a tag or namespace of the same name as the description file has the directory entry
+	unknownTagNames, err := vfs.store.UnknownTagNames([]string{tagDescriptionFilename})
+	if err != nil {
+		log.Fatalf("could not retrieve tags: %v.", err)
+	}
+	if len(unknownTagNames) == 0 {
+		return ""
+	}
+
+	tag, err := vfs.store.TagByName(tagName)
+	if err != nil {
+		log.Fatalf("could not look up tag '%v': %v", tagName, err)
+	}
+	if tag == nil {
+		return ""
+	}
 
-		tagIds[index] = tag.Id
+	properties, err := vfs.store.TagPropertiesByTagId(tag.Id)
+	if err != nil {
+		log.Fatalf("could not retrieve properties of tag '%v': %v", tagName, err)
 	}
 
-	return tagIds, nil
+	return properties.Value(entities.TagDescriptionProperty)
 }
 
 func (vfs FuseVfs) tagValueNamesForFiles(tagName string, files entities.Files) ([]string, error) {
@@ -850,6 +990,23 @@ func (vfs FuseVfs) tagNamesForFiles(files entities.Files) ([]string, error) {
 	return tagNames, nil
 }
 
+// Joins the ':LEVEL' directories of a hierarchical tag onto the directory of
+// its parent so that, for example, 'music/:genre/:jazz' becomes 'music:genre:jazz'.
+func joinNamespaces(path []string) []string {
+	joined := make([]string, 0, len(path))
+
+	for _, pathElement := range path {
+		count := len(joined)
+		if count > 0 && len(pathElement) > 1 && strings.HasPrefix(pathElement, entities.TagNamespaceSeparator) && joined[count-1][0] != '=' {
+			joined[count-1] += pathElement
+		} else {
+			joined = append(joined, pathElement)
+		}
+	}
+
+	return joined
+}
+
 func pathToExpression(path []string) query.Expression {
 	var expression query.Expression = query.EmptyExpression{}
 
@@ -881,16 +1038,6 @@ func asciiToFileId(str string) (entities.FileId, error) {
 	return entities.FileId(ui64), err
 }
 
-func containsTag(tags entities.Tags, tagName string) bool {
-	for _, tag := range tags {
-		if tag.Name == tagName {
-			return true
-		}
-	}
-
-	return false
-}
-
 func containsString(values []string, value string) bool {
 	for _, v := range values {
 		if v == value {